@@ -0,0 +1,173 @@
+package main
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/interface/importer"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/auditrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	_ "github.com/lib/pq"
+
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: chat-admin <command> [flags]
+
+Commands:
+  import    import history from Slack or Matrix export
+  role      grant moderator or admin role to an account, or revoke it
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "role":
+		err = runRole(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "slack", "export format: slack (workspace zip) or matrix (room JSON)")
+	file := fs.String("file", "", "export file path")
+	reportPath := fs.String("report", "import-report.json", "mapping report, read on rerun to skip imported entities")
+	usersPath := fs.String("users", "", "JSON object mapping foreign user ids to logins of existing accounts")
+	connStr := fs.String("db", "user=postgres password=12345678 host=db dbname=postgres sslmode=disable", "postgres connection string")
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	var (
+		e   importer.Export
+		err error
+	)
+	switch *format {
+	case "slack":
+		e, err = importer.ReadSlack(*file)
+	case "matrix":
+		e, err = importer.ReadMatrix(*file)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := importer.LoadReport(*reportPath)
+	if err != nil {
+		return err
+	}
+	if report.Source != "" && report.Source != e.Source {
+		return fmt.Errorf("report %s belongs to %s import", *reportPath, report.Source)
+	}
+
+	conn, err := sql.Open("postgres", *connStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	accounts := accountrepo.New(conn)
+	im := importer.Importer{
+		AccountStorage: accounts,
+		RoomStorage:    roomrepo.New(conn),
+		MessageStorage: messagerepo.New(conn),
+		Checkpoint: func(r *importer.Report) error {
+			return importer.SaveReport(*reportPath, r)
+		},
+	}
+	if *usersPath != "" {
+		if im.Users, err = importer.LoadUsers(*usersPath); err != nil {
+			return err
+		}
+	}
+	runErr := im.Run(e, report)
+	if err := importer.SaveReport(*reportPath, report); err != nil {
+		return err
+	}
+	// a failed run may have imported a part already, so it's recorded either way
+	auditUseCases := &audit.UseCases{AuditStorage: auditrepo.New(conn), AccountStorage: accounts}
+	details := fmt.Sprintf("chat-admin: %d accounts, %d rooms, %d messages created",
+		report.Accounts.Created, report.Rooms.Created, report.Messages.Imported)
+	if runErr != nil {
+		details += "; failed: " + runErr.Error()
+	}
+	if err := auditUseCases.Record(audit.Source{}, audit.ActionImport, e.Source+" "+*file, details); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	fmt.Printf("accounts: %d created, %d matched\n", report.Accounts.Created, report.Accounts.Matched)
+	fmt.Printf("rooms: %d created, %d existing\n", report.Rooms.Created, report.Rooms.Existing)
+	fmt.Printf("messages: %d imported, %d already imported, %d skipped\n",
+		report.Messages.Imported, report.Messages.AlreadyImported, report.Messages.Skipped)
+	fmt.Printf("mapping report written to %s\n", *reportPath)
+	return nil
+}
+
+func runRole(args []string) error {
+	fs := flag.NewFlagSet("role", flag.ExitOnError)
+	login := fs.String("login", "", "login of the account")
+	role := fs.String("role", "", "moderator, admin or empty to revoke")
+	connStr := fs.String("db", "user=postgres password=12345678 host=db dbname=postgres sslmode=disable", "postgres connection string")
+	fs.Parse(args)
+
+	if *login == "" {
+		return fmt.Errorf("-login is required")
+	}
+	switch *role {
+	case "", account.RoleModerator, account.RoleAdmin:
+	default:
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	conn, err := sql.Open("postgres", *connStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	accounts := accountrepo.New(conn)
+	acc, err := accounts.GetAccountByLogin(*login)
+	if err != nil {
+		return err
+	}
+	var was string
+	_, err = accounts.UpdateAccount(acc.Id, func(a account.Account) (account.Account, error) {
+		was = a.Role
+		a.Role = *role
+		return a, nil
+	})
+	if err != nil {
+		return err
+	}
+	// the change is made from the server's shell, there is no actor account
+	auditUseCases := &audit.UseCases{AuditStorage: auditrepo.New(conn), AccountStorage: accounts}
+	details := fmt.Sprintf("chat-admin: %q -> %q", was, *role)
+	if err := auditUseCases.Record(audit.Source{}, audit.ActionRoleChange, acc.Id, details); err != nil {
+		return err
+	}
+	fmt.Printf("account %s (%s) role set to %q\n", *login, acc.Id, *role)
+	return nil
+}
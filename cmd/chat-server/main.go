@@ -1,30 +1,98 @@
 package main
 
 import (
+	domainattachment "github.com/mp-hl-2021/chat/internal/domain/attachment"
+	domainfilter "github.com/mp-hl-2021/chat/internal/domain/filter"
+	fsblobrepo "github.com/mp-hl-2021/chat/internal/interface/filesystem/blobrepo"
 	"github.com/mp-hl-2021/chat/internal/interface/httpapi"
-	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
-	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/lockoutrepo"
 	"github.com/mp-hl-2021/chat/internal/interface/postgres/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/apitokenrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/auditrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/commandrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/filterrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/incomingrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/jobrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/mentionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/reportrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/schedulerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/postgres/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/prom"
+	s3blobrepo "github.com/mp-hl-2021/chat/internal/interface/s3/blobrepo"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+	"github.com/mp-hl-2021/chat/internal/service/janitor"
 	"github.com/mp-hl-2021/chat/internal/service/token"
 	"github.com/mp-hl-2021/chat/internal/usecases/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/admin"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/block"
+	"github.com/mp-hl-2021/chat/internal/usecases/command"
+	"github.com/mp-hl-2021/chat/internal/usecases/export"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	"github.com/mp-hl-2021/chat/internal/usecases/incoming"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+	"github.com/mp-hl-2021/chat/internal/usecases/mention"
 	"github.com/mp-hl-2021/chat/internal/usecases/message"
+	"github.com/mp-hl-2021/chat/internal/usecases/moderation"
+	"github.com/mp-hl-2021/chat/internal/usecases/retention"
 	"github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
 
 	_ "github.com/lib/pq"
 
 	"database/sql"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
 	privateKeyPath := flag.String("privateKey", "app.rsa", "file path")
 	publicKeyPath := flag.String("publicKey", "app.rsa.pub", "file path")
+	erasePolicy := flag.String("erasePolicy", string(account.AnonymizeMessages),
+		"what to do with messages of erased accounts: anonymize or delete with attachments")
+	exportDir := flag.String("exportDir", filepath.Join(os.TempDir(), "chat-exports"), "directory for data exports")
+	exportTtl := flag.Duration("exportTtl", export.DefaultArchiveTtl, "how long export archives are kept for download")
+	blobStore := flag.String("blobStore", "fs", "where to keep attachments: fs or s3")
+	blobDir := flag.String("blobDir", filepath.Join(os.TempDir(), "chat-blobs"), "directory for attachments with fs blob store")
+	s3Endpoint := flag.String("s3Endpoint", "", "S3 compatible storage url, credentials are read from S3_ACCESS_KEY and S3_SECRET_KEY")
+	s3Region := flag.String("s3Region", "us-east-1", "S3 region")
+	s3Bucket := flag.String("s3Bucket", "chat-attachments", "S3 bucket for attachments")
+	maxFileSize := flag.Int64("maxFileSize", attachment.DefaultMaxFileSize, "attachment size limit in bytes")
+	roomQuota := flag.Int64("roomQuota", attachment.DefaultRoomQuota, "total size of attachments per room in bytes")
+	uploadTtl := flag.Duration("uploadTtl", attachment.DefaultOrphanTtl, "how long uploads not attached to a message are kept")
+	thumbnailWorkers := flag.Int("thumbnailWorkers", 2, "number of images processed at once")
+	webhookWorkers := flag.Int("webhookWorkers", 4, "number of webhook deliveries made at once")
+	filters := flag.String("filters", "", "json file with global banned words, blocked link hosts, length and flood limits of messages")
+	janitorInterval := flag.Duration("janitorInterval", time.Minute, "how often expired data like room mutes is cleaned up")
+	schedulerInterval := flag.Duration("schedulerInterval", 5*time.Second, "how often due scheduled messages are posted")
+	retentionDays := flag.Int("retentionDays", 0, "days messages are kept for in every room, 0 keeps them forever")
+	retentionKeepLast := flag.Int("retentionKeepLast", 0, "number of the newest messages kept in every room, 0 keeps all")
+	retentionInterval := flag.Duration("retentionInterval", time.Hour, "how often messages outside of retention are deleted")
+	rateLimits := flag.String("rateLimits", "", "json file with rate limits of routes, built-in defaults if empty")
 	flag.Parse()
 
+	switch account.ErasePolicy(*erasePolicy) {
+	case account.AnonymizeMessages, account.DeleteMessages:
+	default:
+		panic(fmt.Sprintf("unknown erase policy: %s", *erasePolicy))
+	}
+	if *retentionDays < 0 || *retentionKeepLast < 0 {
+		panic("retention limits must not be negative")
+	}
+
 	privateKeyBytes, err := ioutil.ReadFile(*privateKeyPath)
 	if err != nil {
 		panic(err)
@@ -34,6 +102,22 @@ func main() {
 		panic(err)
 	}
 
+	limits := httpapi.DefaultRateLimits
+	if *rateLimits != "" {
+		b, err := ioutil.ReadFile(*rateLimits)
+		if err != nil {
+			panic(err)
+		}
+		limits = nil
+		if err := json.Unmarshal(b, &limits); err != nil {
+			panic(fmt.Sprintf("invalid rate limits: %v", err))
+		}
+	}
+	rateLimiter, err := httpapi.NewRateLimiter(limits)
+	if err != nil {
+		panic(fmt.Sprintf("invalid rate limits: %v", err))
+	}
+
 	a, err := token.NewJwt(privateKeyBytes, publicKeyBytes, 100*time.Minute)
 	if err != nil {
 		panic(err)
@@ -46,23 +130,232 @@ func main() {
 		panic(fmt.Sprintf("Couldn't connect to DB: %v", err))
 	}
 
-	accountUseCases := &account.UseCases{
-		AccountStorage: accountrepo.New(conn),
-		Auth:           a,
+	if err := os.MkdirAll(*exportDir, 0700); err != nil {
+		panic(err)
+	}
+
+	var blobStorage domainattachment.BlobStorage
+	switch *blobStore {
+	case "fs":
+		if err := os.MkdirAll(*blobDir, 0700); err != nil {
+			panic(err)
+		}
+		blobStorage = fsblobrepo.New(*blobDir)
+	case "s3":
+		blobStorage = s3blobrepo.New(s3blobrepo.Config{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			Bucket:    *s3Bucket,
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		panic(fmt.Sprintf("unknown blob store: %s", *blobStore))
+	}
+
+	accountStorage := accountrepo.New(conn)
+	roomStorage := roomrepo.New(conn)
+	messageStorage := messagerepo.New(conn)
+	attachmentStorage := attachmentrepo.New(conn)
+	sanctionStorage := sanctionrepo.New(conn)
+	blockStorage := blockrepo.New(conn)
+	scheduleStorage := schedulerepo.New(conn)
+	webhookStorage := webhookrepo.New(conn)
+	hookStorage := incomingrepo.New(conn)
+	commandStorage := commandrepo.New(conn)
+
+	auditUseCases := &audit.UseCases{
+		AuditStorage:   auditrepo.New(conn),
+		AccountStorage: accountStorage,
+	}
+	jobUseCases := &job.UseCases{
+		JobStorage: jobrepo.New(conn),
+	}
+	webhookUseCases := &webhook.UseCases{
+		WebhookStorage: webhookStorage,
+		RoomStorage:    roomStorage,
+		Jobs:           jobUseCases,
 	}
 	roomUseCases := &room.UseCases{
-		RoomStorage: roomrepo.NewMemory(),
+		RoomStorage:     roomStorage,
+		SanctionStorage: sanctionStorage,
+		BlockStorage:    blockStorage,
+		Webhooks:        webhookUseCases,
+		Audit:           auditUseCases,
+	}
+	attachmentUseCases := &attachment.UseCases{
+		AttachmentStorage: attachmentStorage,
+		BlobStorage:       blobStorage,
+		RoomStorage:       roomStorage,
+		Jobs:              jobUseCases,
+		MaxFileSize:       *maxFileSize,
+		RoomQuota:         *roomQuota,
+		OrphanTtl:         *uploadTtl,
+	}
+	accountUseCases := &account.UseCases{
+		AccountStorage:  accountStorage,
+		TokenStorage:    apitokenrepo.New(conn),
+		MessageStorage:  messageStorage,
+		RoomStorage:     roomStorage,
+		ScheduleStorage: scheduleStorage,
+		Attachments:     attachmentUseCases,
+		Lockout:         lockoutrepo.NewMemory(),
+		Auth:            a,
+		RoomUseCases:    roomUseCases,
+		Jobs:            jobUseCases,
+		Audit:           auditUseCases,
+		ErasePolicy:     account.ErasePolicy(*erasePolicy),
+	}
+	eventBus := events.NewBus(100)
+	mentionUseCases := &mention.UseCases{
+		MentionStorage: mentionrepo.New(conn),
+		MessageStorage: messageStorage,
+		BlockStorage:   blockStorage,
+		Events:         eventBus,
+	}
+	filterStorage := filterrepo.New(conn)
+	filterChain, err := newFilterChain(*filters, filterStorage)
+	if err != nil {
+		panic(fmt.Sprintf("invalid filters: %v", err))
+	}
+	filterUseCases := &filter.UseCases{
+		FilterStorage: filterStorage,
+		RoomStorage:   roomStorage,
+		Chain:         filterChain,
+		Observe: func(d filter.Decision) {
+			prom.ObserveFilterDecision(d.Filter, string(d.Action))
+		},
+	}
+	commandUseCases := &command.UseCases{
+		CommandStorage:  commandStorage,
+		AccountStorage:  accountStorage,
+		RoomStorage:     roomStorage,
+		SanctionStorage: sanctionStorage,
+		RoomUseCases:    roomUseCases,
+		Filters:         filterUseCases,
 	}
 	messageUseCases := &message.UseCases{
-		MessageStorage: messagerepo.NewMemory(),
+		AccountStorage:    accountStorage,
+		MessageStorage:    messageStorage,
+		RoomStorage:       roomStorage,
+		AttachmentStorage: attachmentStorage,
+		Mentions:          mentionUseCases,
+		Webhooks:          webhookUseCases,
+		Commands:          commandUseCases,
+		Filters:           filterUseCases,
+		SanctionStorage:   sanctionStorage,
+		BlockStorage:      blockStorage,
+		Attachments:       attachmentUseCases,
+		Events:            eventBus,
+		ScheduleStorage:   scheduleStorage,
+	}
+	incomingUseCases := &incoming.UseCases{
+		HookStorage:     hookStorage,
+		AccountStorage:  accountStorage,
+		RoomStorage:     roomStorage,
+		RoomUseCases:    roomUseCases,
+		MessageUseCases: messageUseCases,
+	}
+	blockUseCases := &block.UseCases{
+		BlockStorage:   blockStorage,
+		AccountStorage: accountStorage,
+	}
+	reportStorage := reportrepo.New(conn)
+	moderationUseCases := &moderation.UseCases{
+		ReportStorage:   reportStorage,
+		AccountStorage:  accountStorage,
+		MessageStorage:  messageStorage,
+		RoomStorage:     roomStorage,
+		SanctionStorage: sanctionStorage,
+		Messages:        messageUseCases,
+		Rooms:           roomUseCases,
+		Audit:           auditUseCases,
+	}
+	adminUseCases := &admin.UseCases{
+		AccountStorage: accountStorage,
+		RoomStorage:    roomStorage,
+		MessageStorage: messageStorage,
+		ReportStorage:  reportStorage,
+		Passwords:      accountUseCases,
+		Audit:          auditUseCases,
+
+		Attachments:     attachmentUseCases,
+		WebhookStorage:  webhookStorage,
+		HookStorage:     hookStorage,
+		CommandStorage:  commandStorage,
+		FilterStorage:   filterStorage,
+		SanctionStorage: sanctionStorage,
+	}
+	retentionUseCases := &retention.UseCases{
+		RoomStorage:    roomStorage,
+		MessageStorage: messageStorage,
+		Attachments:    attachmentUseCases,
+		AccountStorage: accountStorage,
+		Audit:          auditUseCases,
+		Default:        retention.Policy{Days: *retentionDays, KeepLast: *retentionKeepLast},
 	}
 
+	exportUseCases := &export.UseCases{
+		AccountStorage: accountStorage,
+		RoomStorage:    roomStorage,
+		MessageStorage: messageStorage,
+		Jobs:           jobUseCases,
+		Dir:            *exportDir,
+		ArchiveTtl:     *exportTtl,
+	}
+
+	jobUseCases.Register(account.EraseJobKind, accountUseCases.EraseJob, 2)
+	jobUseCases.Register(export.ExportJobKind, exportUseCases.ExportJob, 2)
+	jobUseCases.Register(attachment.ThumbnailJobKind, attachmentUseCases.ThumbnailJob, *thumbnailWorkers)
+	jobUseCases.Register(webhook.DeliveryJobKind, webhookUseCases.DeliveryJob, *webhookWorkers)
+	if _, err := jobUseCases.Resume(); err != nil {
+		panic(err)
+	}
+
+	cleanup := janitor.New(*janitorInterval)
+	cleanup.Add("expired mutes", roomUseCases.LiftExpiredMutes)
+	cleanup.Add("expired messages", messageUseCases.PurgeExpired)
+	cleanup.Add("expired exports", exportUseCases.PurgeArchives)
+	cleanup.Add("orphaned uploads", attachmentUseCases.PurgeOrphaned)
+	// takes over jobs of instances which stopped without finishing them
+	cleanup.Add("abandoned jobs", func(time.Time) (int, error) { return jobUseCases.Resume() })
+	cleanup.Start()
+	defer cleanup.Stop()
+
+	// retention walks every room, so it runs less often than the cleanup
+	pruner := janitor.New(*retentionInterval)
+	pruner.Add("retention", retentionUseCases.Enforce)
+	pruner.Start()
+	defer pruner.Stop()
+
+	scheduler := janitor.New(*schedulerInterval)
+	scheduler.Add("scheduled messages", messageUseCases.PublishScheduled)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	const writeTimeout = 10 * time.Second
 	service := httpapi.NewApi(accountUseCases, roomUseCases, messageUseCases)
+	service.JobUseCases = jobUseCases
+	service.ExportUseCases = exportUseCases
+	service.AttachmentUseCases = attachmentUseCases
+	service.MentionUseCases = mentionUseCases
+	service.WebhookUseCases = webhookUseCases
+	service.IncomingUseCases = incomingUseCases
+	service.CommandUseCases = commandUseCases
+	service.FilterUseCases = filterUseCases
+	service.ModerationUseCases = moderationUseCases
+	service.BlockUseCases = blockUseCases
+	service.AdminUseCases = adminUseCases
+	service.AuditUseCases = auditUseCases
+	service.RetentionUseCases = retentionUseCases
+	service.Events = eventBus
+	service.RateLimiter = rateLimiter
+	service.StreamTimeout = writeTimeout - time.Second
 
 	server := http.Server{
 		Addr:         ":8080",
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout,
 
 		Handler: service.Router(),
 	}
@@ -71,3 +364,62 @@ func main() {
 		panic(err)
 	}
 }
+
+type filterConfig struct {
+	MaxLength   int `json:"max-length"`
+	BannedWords []struct {
+		Pattern string `json:"pattern"`
+		Regexp  bool   `json:"regexp"`
+		Action  string `json:"action"` // reject or flag
+	} `json:"banned-words"`
+	BlockedHosts []string `json:"blocked-hosts"`
+	FloodWindow  string   `json:"flood-window"`
+	FloodMax     int      `json:"flood-max"`
+}
+
+// newFilterChain reads the filter config, defaults are used for missing values.
+// Zero length or flood limits turn the filters off, the length limit can only
+// be lower than the one of stored messages.
+func newFilterChain(path string, storage domainfilter.Interface) ([]filter.Filter, error) {
+	c := filterConfig{MaxLength: message.MaxTextLength, FloodWindow: "1m", FloodMax: 3}
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, err
+		}
+	}
+	if c.MaxLength > message.MaxTextLength {
+		return nil, fmt.Errorf("max-length must not exceed %d", message.MaxTextLength)
+	}
+	floodWindow, err := time.ParseDuration(c.FloodWindow)
+	if err != nil {
+		return nil, err
+	}
+	global := make([]domainfilter.Rule, 0, len(c.BannedWords))
+	for _, w := range c.BannedWords {
+		action := filter.Action(w.Action)
+		if action == "" {
+			action = filter.ActionReject
+		}
+		if action != filter.ActionReject && action != filter.ActionFlag {
+			return nil, filter.ErrInvalidAction
+		}
+		global = append(global, domainfilter.Rule{Pattern: w.Pattern, Regexp: w.Regexp, Action: string(action)})
+	}
+	words, err := filter.NewWords(global, storage)
+	if err != nil {
+		return nil, err
+	}
+	chain := []filter.Filter{words, filter.NewLinks(c.BlockedHosts)}
+	if c.MaxLength > 0 {
+		chain = append([]filter.Filter{filter.MaxLength(c.MaxLength)}, chain...)
+	}
+	if c.FloodMax > 0 {
+		// the last one, so messages rejected by others don't count as posted
+		chain = append(chain, filter.NewFlood(floodWindow, c.FloodMax))
+	}
+	return chain, nil
+}
@@ -4,8 +4,309 @@ CREATE TABLE accounts (
     id serial primary key,
     login varchar(255) not null,
     password varchar(255) not null,
+    totpSecret varchar(255) not null default '',
+    totpEnabled boolean not null default false,
+    totpLastStep bigint not null default 0,
+    recoveryCodes text[] not null default '{}',
+    displayName varchar(255) not null default '',
+    bio text not null default '',
+    avatar varchar(512) not null default '',
+    status varchar(255) not null default '',
+    timezone varchar(64) not null default '',
+    deactivated boolean not null default false,
+    bot boolean not null default false,
+    botOwner varchar(64) not null default '',
+    role varchar(16) not null default '',
+    suspended boolean not null default false,
+    resetTokenHash varchar(64) not null default '',
+    resetExpiresAt timestamp with time zone not null default 'epoch',
     createdAt timestamp without time zone default now(),
     updatedAt timestamp without time zone default now(),
 
     unique(login)
-)
\ No newline at end of file
+);
+
+CREATE INDEX accounts_login_prefix ON accounts (lower(login) text_pattern_ops);
+CREATE INDEX accounts_display_name_prefix ON accounts (lower(displayName) text_pattern_ops);
+
+CREATE INDEX accounts_bot_owner ON accounts (botOwner) WHERE bot;
+
+CREATE TABLE api_tokens (
+    id serial primary key,
+    accountId varchar(64) not null,
+    name varchar(64) not null,
+    hash varchar(64) not null,
+    createdAt timestamp with time zone not null,
+
+    unique(hash)
+);
+
+CREATE INDEX api_tokens_account ON api_tokens (accountId);
+
+CREATE TABLE jobs (
+    id varchar(64) primary key,
+    kind varchar(64) not null,
+    owner varchar(64) not null,
+    state varchar(16) not null,
+    payload text not null default '',
+    cursor text not null default '',
+    done integer not null default 0,
+    total integer not null default 0,
+    result text not null default '',
+    error text not null default '',
+    runAt timestamp with time zone,
+    createdAt timestamp with time zone not null,
+    updatedAt timestamp with time zone not null,
+    leaseOwner varchar(64) not null default '',
+    leaseUntil timestamp with time zone
+);
+
+CREATE INDEX jobs_unfinished ON jobs (createdAt) WHERE state IN ('pending', 'running');
+
+CREATE TABLE rooms (
+    id serial primary key,
+    creator varchar(64) not null,
+    topic varchar(1024) not null default '',
+    retentionDays integer not null default 0,
+    retentionKeepLast integer not null default 0,
+    legalHold boolean not null default false,
+    createdAt timestamp with time zone default now()
+);
+
+CREATE TABLE room_members (
+    roomId integer not null references rooms(id) on delete cascade,
+    accountId varchar(64) not null,
+    position serial,
+
+    primary key(roomId, accountId)
+);
+
+CREATE INDEX room_members_account ON room_members (accountId);
+
+CREATE TABLE messages (
+    id serial primary key,
+    author varchar(64) not null,
+    room varchar(64) not null,
+    createdAt timestamp with time zone not null,
+    text text not null,
+    format varchar(16) not null default 'plain',
+    html text not null default '',
+    entities jsonb not null default '[]',
+    attachments text[] not null default '{}',
+    pinned boolean not null default false,
+    expiresAt timestamp with time zone,
+    system boolean not null default false,
+    scheduledId varchar(64),
+    importKey varchar(256)
+);
+
+CREATE INDEX messages_room ON messages (room, createdAt, id);
+CREATE INDEX messages_author ON messages (author, createdAt, id);
+CREATE INDEX messages_expires ON messages (expiresAt) WHERE expiresAt IS NOT NULL;
+CREATE UNIQUE INDEX messages_scheduled ON messages (scheduledId) WHERE scheduledId IS NOT NULL;
+CREATE UNIQUE INDEX messages_imported ON messages (importKey) WHERE importKey IS NOT NULL;
+
+CREATE TABLE scheduled_messages (
+    id serial primary key,
+    author varchar(64) not null,
+    room varchar(64) not null,
+    text text not null,
+    format varchar(16) not null default 'plain',
+    attachments text[] not null default '{}',
+    ttl bigint not null default 0, -- of the posted message in milliseconds
+    sendAt timestamp with time zone not null,
+    createdAt timestamp with time zone not null,
+    leaseOwner varchar(64) not null default '',
+    leaseUntil timestamp with time zone
+);
+
+CREATE INDEX scheduled_messages_author ON scheduled_messages (author, sendAt);
+CREATE INDEX scheduled_messages_due ON scheduled_messages (sendAt);
+
+CREATE TABLE attachments (
+    id serial primary key,
+    room varchar(64) not null,
+    owner varchar(64) not null,
+    filename varchar(255) not null,
+    mimeType varchar(255) not null,
+    size bigint not null,
+    checksum varchar(64) not null,
+    blobKey varchar(255) not null,
+    createdAt timestamp with time zone not null,
+    width integer not null default 0,
+    height integer not null default 0,
+    placeholder varchar(64) not null default '',
+    thumbnails jsonb not null default '[]',
+    attached boolean not null default false
+);
+
+CREATE INDEX attachments_room ON attachments (room);
+CREATE INDEX attachments_unattached ON attachments (createdAt) WHERE NOT attached;
+
+CREATE TABLE mentions (
+    accountId varchar(64) not null,
+    messageId varchar(64) not null,
+    room varchar(64) not null,
+    author varchar(64) not null,
+    createdAt timestamp with time zone not null,
+    read boolean not null default false,
+
+    primary key(accountId, messageId)
+);
+
+CREATE INDEX mentions_feed ON mentions (accountId, createdAt DESC);
+CREATE INDEX mentions_unread ON mentions (accountId) WHERE NOT read;
+
+CREATE TABLE webhooks (
+    id serial primary key,
+    room varchar(64) not null,
+    creator varchar(64) not null,
+    url varchar(2048) not null,
+    secret varchar(128) not null,
+    events text[] not null default '{}',
+    active boolean not null default true,
+    failures integer not null default 0,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX webhooks_room ON webhooks (room);
+
+CREATE TABLE webhook_deliveries (
+    id serial primary key,
+    webhookId integer not null references webhooks(id) on delete cascade,
+    eventId varchar(64) not null,
+    event varchar(64) not null,
+    attempt integer not null,
+    statusCode integer not null default 0,
+    error text not null default '',
+    success boolean not null,
+    durationMs bigint not null default 0,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhookId, id DESC);
+
+CREATE TABLE incoming_hooks (
+    id serial primary key,
+    room varchar(64) not null,
+    bot varchar(64) not null,
+    creator varchar(64) not null,
+    name varchar(64) not null,
+    tokenHash varchar(64) not null,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX incoming_hooks_room ON incoming_hooks (room);
+
+CREATE TABLE commands (
+    id serial primary key,
+    room varchar(64) not null,
+    name varchar(32) not null,
+    bot varchar(64) not null,
+    creator varchar(64) not null,
+    url varchar(2048) not null,
+    secret varchar(64) not null,
+    createdAt timestamp with time zone not null,
+    unique (room, name)
+);
+
+CREATE TABLE filter_rules (
+    id serial primary key,
+    room varchar(64) not null,
+    pattern varchar(256) not null,
+    regexp boolean not null,
+    action varchar(16) not null,
+    creator varchar(64) not null,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX filter_rules_room ON filter_rules (room);
+
+CREATE TABLE filter_flags (
+    id serial primary key,
+    message varchar(64) not null,
+    room varchar(64) not null,
+    author varchar(64) not null,
+    filter varchar(64) not null,
+    reason varchar(1024) not null,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX filter_flags_room ON filter_flags (room, id);
+
+CREATE TABLE reports (
+    id serial primary key,
+    reporter varchar(64) not null,
+    message varchar(64) not null,
+    room varchar(64) not null,
+    account varchar(64) not null,
+    reason varchar(1024) not null,
+    status varchar(16) not null,
+    moderator varchar(64) not null,
+    resolution varchar(32) not null,
+    createdAt timestamp with time zone not null,
+    updatedAt timestamp with time zone not null
+);
+
+CREATE INDEX reports_queue ON reports (status, id);
+
+CREATE TABLE moderation_actions (
+    id serial primary key,
+    report integer not null references reports (id),
+    moderator varchar(64) not null,
+    action varchar(32) not null,
+    note varchar(1024) not null,
+    createdAt timestamp with time zone not null
+);
+
+CREATE INDEX moderation_actions_report ON moderation_actions (report, id);
+
+CREATE TABLE room_bans (
+    room varchar(64) not null,
+    account varchar(64) not null,
+    actor varchar(64) not null,
+    reason varchar(1024) not null,
+    createdAt timestamp with time zone not null,
+    primary key (room, account)
+);
+
+CREATE TABLE room_mutes (
+    room varchar(64) not null,
+    account varchar(64) not null,
+    actor varchar(64) not null,
+    reason varchar(1024) not null,
+    until timestamp with time zone not null,
+    createdAt timestamp with time zone not null,
+    primary key (room, account)
+);
+
+CREATE INDEX room_mutes_until ON room_mutes (until);
+
+CREATE TABLE blocks (
+    blocker varchar(64) not null,
+    blocked varchar(64) not null,
+    createdAt timestamp with time zone not null,
+    primary key (blocker, blocked)
+);
+
+CREATE INDEX blocks_blocked ON blocks (blocked);
+
+CREATE TABLE audit_log (
+    id serial primary key,
+    actor varchar(64) not null,
+    action varchar(64) not null,
+    target varchar(64) not null,
+    details text not null,
+    ip varchar(64) not null,
+    requestId varchar(64) not null,
+    createdAt timestamp with time zone not null,
+    prevHash varchar(64) not null,
+    hash varchar(64) not null
+);
+
+CREATE INDEX audit_log_actor ON audit_log(actor);
+CREATE INDEX audit_log_target ON audit_log(target);
+
+-- the audit trail is append only, entries are also chained by hash
+CREATE RULE audit_log_no_update AS ON UPDATE TO audit_log DO INSTEAD NOTHING;
+CREATE RULE audit_log_no_delete AS ON DELETE TO audit_log DO INSTEAD NOTHING;
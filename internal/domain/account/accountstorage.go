@@ -1,8 +1,34 @@
 package account
 
+import "time"
+
 type Account struct {
 	Id string
 	Credentials
+	Totp        Totp
+	Profile     Profile
+	Deactivated bool
+	Bot         bool   // bots authenticate with api tokens only
+	BotOwner    string // account id which created the bot
+	Role        string // server-wide role, empty for regular accounts
+	Suspended   bool   // by moderators, suspended accounts can't sign in
+	Reset       PasswordReset
+}
+
+// Server-wide roles. Admins are moderators too.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// IsAdmin reports whether the account may use the server admin api.
+func (a Account) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
+
+// IsModerator reports whether the account may handle the moderation queue.
+func (a Account) IsModerator() bool {
+	return a.Role == RoleModerator || a.Role == RoleAdmin
 }
 
 type Credentials struct {
@@ -10,8 +36,47 @@ type Credentials struct {
 	Password string
 }
 
+// PasswordReset is a pending password reset forced by an admin.
+type PasswordReset struct {
+	TokenHash string // empty if there is no pending reset
+	ExpiresAt time.Time
+}
+
+// Totp holds time-based one-time password settings of an account.
+type Totp struct {
+	Secret        string
+	Enabled       bool
+	LastStep      int64    // the last accepted time step, codes are single-use
+	RecoveryCodes []string // hashes of unused recovery codes
+}
+
+// Profile is a public part of an account.
+type Profile struct {
+	DisplayName string
+	Bio         string
+	Avatar      string // reference to an image
+	Status      string
+	Timezone    string // IANA time zone name
+}
+
 type Interface interface {
 	CreateAccount(cred Credentials) (Account, error)
+	// CreateBot creates a bot account without password.
+	CreateBot(login, ownerId string) (Account, error)
 	GetAccountById(id string) (Account, error)
 	GetAccountByLogin(login string) (Account, error)
+	// GetAccountsByIds skips unknown ids.
+	GetAccountsByIds(ids []string) ([]Account, error)
+	// SearchAccounts returns active accounts whose login or display name
+	// starts with the prefix, case insensitive, ordered by login.
+	SearchAccounts(prefix string, offset, limit int) ([]Account, error)
+	// ListBots returns bots created by the account, ordered by login.
+	ListBots(ownerId string) ([]Account, error)
+	// ListAccounts is like SearchAccounts but includes deactivated accounts.
+	ListAccounts(prefix string, offset, limit int) ([]Account, error)
+	CountAccounts() (int, error)
+	UpdateAccount(id string, upd UpdateFunc) (Account, error)
+	DeleteAccount(id string) error
 }
+
+type UpdateFunc func(a Account) (Account, error)
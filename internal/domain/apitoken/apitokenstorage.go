@@ -0,0 +1,21 @@
+package apitoken
+
+import "time"
+
+// Token is a long-lived credential of a bot account. Only a hash of
+// the token is stored, the token itself is shown once on creation.
+type Token struct {
+	Id        string
+	AccountId string
+	Name      string
+	Hash      string // hex encoded sha256 of the token
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	CreateToken(t Token) (Token, error)
+	GetTokenByHash(hash string) (Token, error)
+	// ListTokens returns tokens of the account in order of creation.
+	ListTokens(accountId string) ([]Token, error)
+	DeleteToken(id string) error
+}
@@ -0,0 +1,67 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("room quota exceeded")
+
+type Attachment struct {
+	Id        string
+	Room      string
+	Owner     string // account id of the uploader
+	Filename  string
+	MimeType  string
+	Size      int64
+	Checksum  string // hex encoded sha256 of the content
+	BlobKey   string
+	CreatedAt time.Time
+	Attached  bool // referred to by a message or a scheduled message
+
+	// fields below are filled in for images once they are processed
+	Width       int
+	Height      int
+	Placeholder string // blurhash of the image
+	Thumbnails  []Thumbnail
+}
+
+type Thumbnail struct {
+	Size     int // longest side the image was fit into
+	Width    int
+	Height   int
+	MimeType string
+	BlobKey  string
+}
+
+type Interface interface {
+	// CreateAttachment stores the attachment unless room usage would exceed quota,
+	// in that case ErrQuotaExceeded is returned.
+	CreateAttachment(a Attachment, roomQuota int64) (Attachment, error)
+	GetAttachmentById(id string) (Attachment, error)
+	GetAttachmentsByIds(ids []string) ([]Attachment, error)
+	UpdateAttachment(id string, upd UpdateFunc) (Attachment, error)
+	// GetRoomUsage returns total size of attachments uploaded to the room.
+	GetRoomUsage(roomId string) (int64, error)
+	// ListRoomAttachments returns ids of all attachments uploaded to the room.
+	ListRoomAttachments(roomId string) ([]string, error)
+	// DeleteAttachments removes the attachments, their blobs are left to the caller.
+	// Unknown ids are skipped.
+	DeleteAttachments(ids []string) (int, error)
+	// SetAttached marks the attachments as referred to or not and returns
+	// how many of them were found.
+	SetAttached(ids []string, attached bool) (int, error)
+	// DeleteUnattached removes at most limit attachments uploaded before the time
+	// and never attached since. It returns them, their blobs are left to the caller.
+	DeleteUnattached(before time.Time, limit int) ([]Attachment, error)
+}
+
+type UpdateFunc func(a Attachment) (Attachment, error)
+
+// BlobStorage keeps attachment content.
+type BlobStorage interface {
+	PutBlob(key string, r io.Reader, size int64) error
+	GetBlob(key string) (io.ReadCloser, error)
+	DeleteBlob(key string) error
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Entry records a security-relevant event. Entries form a chain: Hash covers
+// the entry fields and PrevHash, the Hash of the entry appended before it,
+// so changing or removing an entry breaks the chain after it.
+type Entry struct {
+	Id        string
+	Actor     string // empty when not known, e.g. a failed sign-in
+	Action    string
+	Target    string // id of the account, room or message acted on
+	Details   string
+	Ip        string
+	RequestId string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// ComputeHash returns the hash of the entry chained to its PrevHash. Id isn't
+// covered, it's assigned by the storage.
+func (e Entry) ComputeHash() string {
+	b, _ := json.Marshal([]string{
+		e.PrevHash,
+		e.Actor,
+		e.Action,
+		e.Target,
+		e.Details,
+		e.Ip,
+		e.RequestId,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter narrows ListEntries, zero fields match any entry.
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (f Filter) Match(e Entry) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Target == "" || e.Target == f.Target) &&
+		(f.Since.IsZero() || !e.CreatedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || e.CreatedAt.Before(f.Until))
+}
+
+// Interface is append only, entries are never changed or removed.
+type Interface interface {
+	// AppendEntry links the entry to the last one and sets its Id, PrevHash
+	// and Hash. Appends are serialized so the chain never forks.
+	AppendEntry(e Entry) (Entry, error)
+	// ListEntries returns entries matching the filter newest first.
+	ListEntries(f Filter, offset, limit int) ([]Entry, error)
+	// ReadEntries returns entries in order of appending.
+	ReadEntries(offset, limit int) ([]Entry, error)
+}
@@ -0,0 +1,20 @@
+package block
+
+import "time"
+
+// Block hides the blocked account from the blocker.
+type Block struct {
+	Blocker   string
+	Blocked   string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// CreateBlock fails with domain.ErrAlreadyExist if the account is blocked already.
+	CreateBlock(b Block) error
+	DeleteBlock(blockerId, blockedId string) error
+	// ListBlocks returns accounts blocked by the blocker, newest blocks first.
+	ListBlocks(blockerId string) ([]Block, error)
+	// ListBlockers returns blocks of the account by anyone.
+	ListBlockers(blockedId string) ([]Block, error)
+}
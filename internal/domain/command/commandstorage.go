@@ -0,0 +1,26 @@
+package command
+
+import "time"
+
+// Command is a slash command of the room forwarded to a bot. The bot answers
+// at Url, requests are signed with Secret.
+type Command struct {
+	Id        string
+	Room      string
+	Name      string // without the leading slash
+	Bot       string // account id public replies are posted as
+	Creator   string
+	Url       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// CreateCommand fails with domain.ErrAlreadyExist if the room has a command with the same name.
+	CreateCommand(c Command) (Command, error)
+	GetCommandById(id string) (Command, error)
+	GetCommandByName(roomId, name string) (Command, error)
+	// ListCommands returns commands of the room in order of creation.
+	ListCommands(roomId string) ([]Command, error)
+	DeleteCommand(id string) error
+}
@@ -0,0 +1,37 @@
+package filter
+
+import "time"
+
+// Rule is a banned word or regular expression of a room.
+type Rule struct {
+	Id        string
+	Room      string
+	Pattern   string
+	Regexp    bool   // pattern is a regular expression rather than a word
+	Action    string // reject or flag
+	Creator   string
+	CreatedAt time.Time
+}
+
+// Flag records a posted message a filter asked to review.
+type Flag struct {
+	Id        string
+	Message   string
+	Room      string
+	Author    string
+	Filter    string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	CreateRule(r Rule) (Rule, error)
+	GetRuleById(id string) (Rule, error)
+	// ListRules returns rules of the room in order of creation.
+	ListRules(roomId string) ([]Rule, error)
+	DeleteRule(id string) error
+
+	CreateFlag(f Flag) (Flag, error)
+	// ListFlags returns up to limit flags of the room, newest first.
+	ListFlags(roomId string, limit int) ([]Flag, error)
+}
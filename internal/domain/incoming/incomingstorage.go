@@ -0,0 +1,23 @@
+package incoming
+
+import "time"
+
+// Hook lets external services post messages to the room as a bot.
+// Only a hash of the hook token is stored.
+type Hook struct {
+	Id        string
+	Room      string
+	Bot       string // account id messages are posted as
+	Creator   string
+	Name      string
+	TokenHash string // hex encoded sha256 of the token
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	CreateHook(h Hook) (Hook, error)
+	GetHookById(id string) (Hook, error)
+	// ListHooks returns hooks of the room in order of creation.
+	ListHooks(roomId string) ([]Hook, error)
+	DeleteHook(id string) error
+}
@@ -0,0 +1,44 @@
+package job
+
+import "time"
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+// Job is a long running task performed in background.
+type Job struct {
+	Id        string
+	Kind      string
+	Owner     string // account id
+	State     State
+	Payload   string // kind specific arguments
+	Cursor    string // kind specific position, lets interrupted jobs resume
+	Done      int
+	Total     int
+	Result    string
+	Error     string
+	RunAt     time.Time // pending jobs wait until then, zero if they can run at once
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// A server instance running the job holds it until the lease runs out,
+	// so other instances don't run it at the same time.
+	LeaseOwner string
+	LeaseUntil time.Time
+}
+
+type Interface interface {
+	CreateJob(j Job) (Job, error)
+	GetJobById(id string) (Job, error)
+	UpdateJob(id string, upd UpdateFunc) (Job, error)
+	// ListUnfinishedJobs returns pending and running jobs.
+	ListUnfinishedJobs() ([]Job, error)
+}
+
+type UpdateFunc func(j Job) (Job, error)
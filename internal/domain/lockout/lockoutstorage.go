@@ -0,0 +1,23 @@
+package lockout
+
+import "time"
+
+// Attempts describes failed authentication attempts made with some key,
+// e.g. a login or a client address.
+type Attempts struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Interface keeps track of failed attempts. Implementations may be shared
+// between several server instances.
+type Interface interface {
+	// GetAttempts returns zero Attempts for keys without failures.
+	GetAttempts(key string) (Attempts, error)
+	UpdateAttempts(key string, upd UpdateFunc) (Attempts, error)
+	ResetAttempts(key string) error
+}
+
+type UpdateFunc func(a Attempts) (Attempts, error)
@@ -0,0 +1,23 @@
+package mention
+
+import "time"
+
+// Mention is a reference from a message to an account mentioned in it.
+type Mention struct {
+	AccountId string // mentioned account
+	MessageId string
+	Room      string
+	Author    string
+	CreatedAt time.Time
+	Read      bool
+}
+
+type Interface interface {
+	// CreateMentions stores mentions, already existing ones are left as is.
+	CreateMentions(mm []Mention) error
+	// ListMentions returns mentions of the account, newest first.
+	ListMentions(accountId string, unreadOnly bool, offset, limit int) ([]Mention, error)
+	// MarkRead marks mentions in the messages read, all of them if no ids given.
+	MarkRead(accountId string, messageIds []string) (int, error)
+	CountUnread(accountId string) (int, error)
+}
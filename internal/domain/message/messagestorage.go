@@ -1,6 +1,11 @@
 package message
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var ErrPinLimit = errors.New("room has too many pinned messages")
 
 type Message struct {
 	Id        string
@@ -8,10 +13,67 @@ type Message struct {
 	Room      string
 	CreatedAt time.Time
 
-	Text string
+	Text        string
+	Format      string // plain or markdown
+	Html        string // sanitized rendering of the text
+	Entities    []Entity
+	Attachments []string  // attachment ids
+	Pinned      bool      // pinned messages outlive room retention
+	ExpiresAt   time.Time // zero if the message doesn't expire
+	System      bool      // notice of the server like a pin, Author is the account which caused it
+	ScheduledId string    // scheduled message it was posted from, empty if posted right away
+	ImportKey   string    // source and foreign id of imported messages
+}
+
+// Expired tells whether the message is gone for everyone at the time.
+func (m Message) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+// Entity is a link, code block or mention found in the text.
+type Entity struct {
+	Type      string
+	Text      string
+	Url       string
+	Language  string
+	AccountId string // mentioned room member, empty if login is unknown or not a member
 }
 
 type Interface interface {
-	CreateMessage(creatorId, roomId string, text string, createdAt time.Time) (Message, error)
+	// CreateMessage stores the message and returns it with assigned id.
+	// Scheduled and imported messages are stored once: a message with the
+	// ScheduledId or ImportKey of a stored one is refused with domain.ErrAlreadyExist,
+	// and the id of the stored one is returned along with the error.
+	CreateMessage(m Message) (Message, error)
+	// ListMessages skips expired messages.
 	ListMessages(actorId, roomId string) ([]Message, error)
+	// GetMessagesByIds skips unknown ids and expired messages.
+	GetMessagesByIds(ids []string) ([]Message, error)
+
+	// AnonymizeMessages removes author of all the messages written by the account.
+	AnonymizeMessages(authorId string) (int, error)
+	// ListMessagesByAuthor returns up to limit oldest messages written by the
+	// account, expired ones included. Messages of the except rooms are left out.
+	ListMessagesByAuthor(authorId string, except []string, limit int) ([]Message, error)
+	DeleteMessage(id string) error
+	// DeleteMessagesByRoom removes all the messages of the room.
+	DeleteMessagesByRoom(roomId string) (int, error)
+	CountMessages() (int, error)
+
+	// ListPrunable returns up to limit oldest unpinned messages of the room created
+	// before the time or not among keepLast newest ones. Zero before or keepLast
+	// don't select anything.
+	ListPrunable(roomId string, before time.Time, keepLast, limit int) ([]Message, error)
+	// DeleteMessagesByIds removes the messages, unknown ids are skipped.
+	DeleteMessagesByIds(ids []string) (int, error)
+	// ListExpired returns up to limit messages expired at the time, the ones
+	// expired first go first. Messages of the except rooms are left out.
+	ListExpired(now time.Time, except []string, limit int) ([]Message, error)
+
+	// PinMessage pins the message unless its room already has limit pinned
+	// messages, then it fails with ErrPinLimit. Pinned messages are returned as is.
+	PinMessage(id string, limit int) (Message, error)
+	UnpinMessage(id string) (Message, error)
+	// ListPinned returns pinned messages of the room, oldest first, skipping expired ones.
+	ListPinned(roomId string) ([]Message, error)
 }
@@ -0,0 +1,53 @@
+package report
+
+import "time"
+
+// Statuses of reports in the moderation queue.
+const (
+	StatusOpen      = "open"
+	StatusClaimed   = "claimed"
+	StatusResolving = "resolving" // the action is being applied
+	StatusResolved  = "resolved"
+)
+
+// Report is a complaint about a message or an account.
+type Report struct {
+	Id         string
+	Reporter   string
+	Message    string // empty for reports of accounts
+	Room       string // room of the message
+	Account    string // reported account, the author for reports of messages
+	Reason     string
+	Status     string
+	Moderator  string // who claimed the report
+	Resolution string // action the report was resolved with
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Action is a step a moderator took on a report, they are never changed.
+type Action struct {
+	Id        string
+	Report    string
+	Moderator string
+	Action    string
+	Note      string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	CreateReport(r Report) (Report, error)
+	GetReportById(id string) (Report, error)
+	// ListReports returns up to limit reports with the status, oldest first,
+	// all of them if the status is empty.
+	ListReports(status string, limit int) ([]Report, error)
+	// CountReports counts reports with the status, all of them if the status is empty.
+	CountReports(status string) (int, error)
+	UpdateReport(id string, upd UpdateFunc) (Report, error)
+
+	CreateAction(a Action) (Action, error)
+	// ListActions returns actions taken on the report in order.
+	ListActions(reportId string) ([]Action, error)
+}
+
+type UpdateFunc func(r Report) (Report, error)
@@ -1,9 +1,18 @@
 package room
 
 type Room struct {
-	Id      string
-	Creator string
-	Members []string
+	Id        string
+	Creator   string
+	Members   []string
+	Topic     string
+	Retention Retention
+	LegalHold bool // messages aren't deleted by retention while set
+}
+
+// Retention limits how long messages of the room are kept. Zero fields don't limit.
+type Retention struct {
+	Days     int
+	KeepLast int // number of the newest messages kept
 }
 
 type Interface interface {
@@ -11,6 +20,26 @@ type Interface interface {
 	GetRoomById(actorId, roomId string) (Room, error)
 	UpdateRoom(actorId, roomId string, upd UpdateFunc) (Room, error)
 	ListRooms(accountId string) ([]Room, error)
+
+	// InspectRoom returns the room to server admins, who aren't members.
+	InspectRoom(roomId string) (Room, error)
+	// DeleteRoom removes the room with its members.
+	DeleteRoom(roomId string) error
+	CountRooms() (int, error)
+	// SetLegalHold changes the legal hold of the room, server admins set it without being members.
+	SetLegalHold(roomId string, hold bool) (Room, error)
+	// RemoveMember takes the account out of the room on behalf of server moderators,
+	// who aren't members. Removing an account which isn't a member does nothing.
+	RemoveMember(roomId, accountId string) error
+	// ListAllRooms returns rooms in order of creation, for background tasks.
+	ListAllRooms(offset, limit int) ([]Room, error)
+	// ListHeldRooms returns ids of rooms under legal hold.
+	ListHeldRooms() ([]string, error)
 }
 
 type UpdateFunc func(r Room) (Room, error)
+
+// IsAdmin reports whether the account administers the room. The creator is the room admin.
+func (r Room) IsAdmin(accountId string) bool {
+	return r.Creator == accountId
+}
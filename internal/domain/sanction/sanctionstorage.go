@@ -0,0 +1,41 @@
+package sanction
+
+import "time"
+
+// Ban keeps the account out of the room.
+type Ban struct {
+	Room      string
+	Account   string
+	Actor     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// Mute stops the account from posting to the room until it expires.
+type Mute struct {
+	Room      string
+	Account   string
+	Actor     string
+	Reason    string
+	Until     time.Time
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// PutBan creates the ban of the account in the room or replaces the existing one.
+	PutBan(b Ban) error
+	GetBan(roomId, accountId string) (Ban, error)
+	// ListBans returns bans of the room, oldest first.
+	ListBans(roomId string) ([]Ban, error)
+	DeleteBan(roomId, accountId string) error
+
+	// PutMute creates the mute of the account in the room or replaces the existing one.
+	PutMute(m Mute) error
+	// GetMute returns the mute even if it has expired.
+	GetMute(roomId, accountId string) (Mute, error)
+	// ListMutes returns mutes of the room, expired ones included, oldest first.
+	ListMutes(roomId string) ([]Mute, error)
+	DeleteMute(roomId, accountId string) error
+	// DeleteExpiredMutes removes mutes which expired before now and returns their number.
+	DeleteExpiredMutes(now time.Time) (int, error)
+}
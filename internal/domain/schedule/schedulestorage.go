@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLeased = errors.New("scheduled message is being sent")
+
+// Message waits in the queue of its author until it's time to post it.
+type Message struct {
+	Id          string
+	Author      string
+	Room        string
+	Text        string
+	Format      string
+	Attachments []string      // attachment ids
+	Ttl         time.Duration // of the posted message, zero if it doesn't expire
+	SendAt      time.Time
+	CreatedAt   time.Time
+
+	// A server instance posting the message holds it until the lease
+	// runs out, so other instances don't post it again.
+	LeaseOwner string
+	LeaseUntil time.Time
+}
+
+type Interface interface {
+	// CreateScheduled stores the message and returns it with assigned id.
+	CreateScheduled(m Message) (Message, error)
+	GetScheduledById(id string) (Message, error)
+	// ListScheduledByAuthor returns the queue of the author, the ones to be sent first go first.
+	ListScheduledByAuthor(authorId string) ([]Message, error)
+	// CancelScheduled removes the message unless it's leased at the time,
+	// then it fails with ErrLeased.
+	CancelScheduled(id string, now time.Time) error
+	// DeleteScheduled removes the message once it's posted or can't be posted anymore.
+	DeleteScheduled(id string) error
+	// DeleteScheduledByAuthor removes the queue of the author.
+	DeleteScheduledByAuthor(authorId string) (int, error)
+
+	// ClaimDue leases up to limit messages due at the time to the owner until
+	// leaseUntil, the ones to be sent first go first. Messages leased by anyone
+	// else until after now are skipped.
+	ClaimDue(owner string, now, leaseUntil time.Time, limit int) ([]Message, error)
+}
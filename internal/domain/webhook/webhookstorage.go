@@ -0,0 +1,43 @@
+package webhook
+
+import "time"
+
+type Webhook struct {
+	Id        string
+	Room      string
+	Creator   string // account id of the room admin who registered the hook
+	Url       string
+	Secret    string // key for HMAC signatures of deliveries
+	Events    []string
+	Active    bool
+	Failures  int // deliveries failed in a row, reset by a successful one
+	CreatedAt time.Time
+}
+
+// Delivery is a single attempt to deliver an event to the webhook.
+type Delivery struct {
+	Id         string
+	Webhook    string
+	EventId    string // same for all attempts to deliver the event
+	Event      string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Success    bool
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+type Interface interface {
+	CreateWebhook(w Webhook) (Webhook, error)
+	GetWebhookById(id string) (Webhook, error)
+	ListWebhooks(roomId string) ([]Webhook, error)
+	UpdateWebhook(id string, upd UpdateFunc) (Webhook, error)
+	DeleteWebhook(id string) error
+
+	CreateDelivery(d Delivery) (Delivery, error)
+	// ListDeliveries returns latest attempts to deliver events to the webhook, newest first.
+	ListDeliveries(webhookId string, limit int) ([]Delivery, error)
+}
+
+type UpdateFunc func(w Webhook) (Webhook, error)
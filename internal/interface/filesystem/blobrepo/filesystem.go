@@ -0,0 +1,85 @@
+package blobrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// FileSystem keeps blobs as files under the root directory.
+type FileSystem struct {
+	root string
+}
+
+func New(root string) *FileSystem {
+	return &FileSystem{root: root}
+}
+
+// PutBlob writes the blob into a temporary file first and renames it once complete,
+// so readers never observe partial content.
+func (f *FileSystem) PutBlob(key string, r io.Reader, size int64) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if n != size {
+		tmp.Close()
+		return io.ErrUnexpectedEOF
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (f *FileSystem) GetBlob(key string) (io.ReadCloser, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, domain.ErrNotFound
+	}
+	return file, err
+}
+
+func (f *FileSystem) DeleteBlob(key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path spreads blobs over subdirectories named after the key prefix.
+func (f *FileSystem) path(key string) (string, error) {
+	if len(key) < 3 || strings.ContainsAny(key, `/\.`) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(f.root, key[:2], key), nil
+}
@@ -0,0 +1,303 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/usecases/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/admin"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"github.com/gorilla/mux"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// staffOnly guards the /admin route group. On top of authentication the account
+// must be a moderator or an admin, handlers check narrower permissions.
+func (a *Api) staffOnly(next http.Handler) http.Handler {
+	return a.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		aid, ok := r.Context().Value(accountIdContextKey).(string)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := a.AdminUseCases.Authorize(aid); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type adminAccountModel struct {
+	Id           string `json:"id"`
+	Login        string `json:"login"`
+	DisplayName  string `json:"display-name"`
+	Role         string `json:"role,omitempty"`
+	Bot          bool   `json:"bot"`
+	BotOwnerId   string `json:"bot-owner-id,omitempty"`
+	MfaEnabled   bool   `json:"mfa-enabled"`
+	Deactivated  bool   `json:"deactivated"`
+	Suspended    bool   `json:"suspended"`
+	ResetPending bool   `json:"reset-pending"`
+}
+
+type getAdminAccountsResponseModel struct {
+	Accounts []adminAccountModel `json:"accounts"`
+	Offset   int                 `json:"offset"`
+}
+
+// getAdminAccounts lists accounts whose login or display name starts with q,
+// deactivated and suspended ones included.
+func (a *Api) getAdminAccounts(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	offset, err := intQueryParam(q.Get("offset"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(q.Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	aa, err := a.AdminUseCases.ListAccounts(aid, q.Get("q"), offset, limit)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	resp := getAdminAccountsResponseModel{Accounts: make([]adminAccountModel, 0, len(aa)), Offset: offset}
+	for _, acc := range aa {
+		resp.Accounts = append(resp.Accounts, toAdminAccountModel(acc))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *Api) getAdminAccount(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	acc, err := a.AdminUseCases.GetAccount(aid, id)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAdminAccountModel(acc))
+}
+
+type adminReasonRequestModel struct {
+	Reason string `json:"reason"`
+}
+
+func (a *Api) postAdminAccountSuspend(w http.ResponseWriter, r *http.Request) {
+	a.setAccountSuspended(w, r, a.AdminUseCases.SuspendAccount)
+}
+
+func (a *Api) postAdminAccountUnsuspend(w http.ResponseWriter, r *http.Request) {
+	a.setAccountSuspended(w, r, a.AdminUseCases.UnsuspendAccount)
+}
+
+func (a *Api) setAccountSuspended(w http.ResponseWriter, r *http.Request, set func(src audit.Source, accountId, reason string) (admin.Account, error)) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m adminReasonRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	acc, err := set(source(r), id, m.Reason)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAdminAccountModel(acc))
+}
+
+type postAdminPasswordResetResponseModel struct {
+	ResetToken string `json:"reset-token"`
+}
+
+// postAdminPasswordReset signs the account out and returns a token to pass
+// to the owner, who sets a new password at /password-reset with it.
+func (a *Api) postAdminPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m adminReasonRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token, err := a.AdminUseCases.ResetPassword(source(r), id, m.Reason)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(postAdminPasswordResetResponseModel{ResetToken: token})
+}
+
+type postPasswordResetRequestModel struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// postPasswordReset sets a new password with the token issued by an admin.
+func (a *Api) postPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var m postPasswordResetRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_, err := a.AccountUseCases.ResetPassword(m.Token, m.Password, source(r))
+	switch {
+	case errors.Is(err, account.ErrInvalidResetToken):
+		w.WriteHeader(http.StatusUnauthorized)
+	case errors.Is(err, account.ErrInvalidPasswordString),
+		errors.Is(err, account.ErrTooShortString),
+		errors.Is(err, account.ErrTooLongString):
+		w.WriteHeader(http.StatusBadRequest)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type adminRoomModel struct {
+	Id        string   `json:"id"`
+	CreatorId string   `json:"creator-id"`
+	Topic     string   `json:"topic,omitempty"`
+	Members   []string `json:"members"`
+}
+
+func (a *Api) getAdminRoom(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rm, err := a.AdminUseCases.GetRoom(aid, rid)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminRoomModel{
+		Id:        rm.Id,
+		CreatorId: rm.Creator,
+		Topic:     rm.Topic,
+		Members:   rm.Members,
+	})
+}
+
+// deleteAdminRoom removes the room with its messages, the reason is passed in the query.
+func (a *Api) deleteAdminRoom(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if err := a.AdminUseCases.DeleteRoom(source(r), rid, reason); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type adminStatsModel struct {
+	Accounts    int `json:"accounts"`
+	Rooms       int `json:"rooms"`
+	Messages    int `json:"messages"`
+	OpenReports int `json:"open-reports"`
+}
+
+func (a *Api) getAdminStats(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s, err := a.AdminUseCases.Stats(aid)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminStatsModel{
+		Accounts:    s.Accounts,
+		Rooms:       s.Rooms,
+		Messages:    s.Messages,
+		OpenReports: s.OpenReports,
+	})
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, admin.ErrNotStaff),
+		errors.Is(err, admin.ErrNotAdmin),
+		errors.Is(err, admin.ErrProtectedAccount):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, admin.ErrInvalidReason),
+		errors.Is(err, admin.ErrInvalidPaging),
+		errors.Is(err, account.ErrNoPassword):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, admin.ErrLegalHold):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toAdminAccountModel(a admin.Account) adminAccountModel {
+	return adminAccountModel{
+		Id:           a.Id,
+		Login:        a.Login,
+		DisplayName:  a.DisplayName,
+		Role:         a.Role,
+		Bot:          a.Bot,
+		BotOwnerId:   a.BotOwner,
+		MfaEnabled:   a.MfaEnabled,
+		Deactivated:  a.Deactivated,
+		Suspended:    a.Suspended,
+		ResetPending: a.ResetPending,
+	}
+}
@@ -1,29 +1,87 @@
 package httpapi
 
 import (
+	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/interface/prom"
+	"github.com/mp-hl-2021/chat/internal/service/events"
 	"github.com/mp-hl-2021/chat/internal/usecases/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/admin"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/block"
+	"github.com/mp-hl-2021/chat/internal/usecases/command"
+	"github.com/mp-hl-2021/chat/internal/usecases/export"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	"github.com/mp-hl-2021/chat/internal/usecases/incoming"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+	"github.com/mp-hl-2021/chat/internal/usecases/mention"
 	"github.com/mp-hl-2021/chat/internal/usecases/message"
+	"github.com/mp-hl-2021/chat/internal/usecases/moderation"
+	"github.com/mp-hl-2021/chat/internal/usecases/retention"
 	"github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
 	accountIdContextKey = "account_id"
+	requestIdContextKey = "request_id"
 	accountIdUrlPathKey = "account_id"
 	roomsIdUrlPathKey   = "room_id"
+	jobIdUrlPathKey     = "job_id"
+	exportIdUrlPathKey  = "export_id"
+
+	attachmentIdUrlPathKey  = "attachment_id"
+	thumbnailSizeUrlPathKey = "size"
+	webhookIdUrlPathKey     = "webhook_id"
+	botIdUrlPathKey         = "bot_id"
+	tokenIdUrlPathKey       = "token_id"
+	hookIdUrlPathKey        = "hook_id"
+	hookTokenUrlPathKey     = "token"
+	commandIdUrlPathKey     = "command_id"
+	filterRuleIdUrlPathKey  = "rule_id"
+	reportIdUrlPathKey      = "report_id"
+	blockedIdUrlPathKey     = "blocked_id"
+	scheduledIdUrlPathKey   = "scheduled_id"
+	messageIdUrlPathKey     = "message_id"
 )
 
 type Api struct {
 	AccountUseCases account.Interface
 	RoomUseCases    room.Interface
 	MessageUseCases message.Interface
+
+	// use cases below are set after construction
+	JobUseCases        job.Interface
+	ExportUseCases     export.Interface
+	AttachmentUseCases attachment.Interface
+	MentionUseCases    mention.Interface
+	WebhookUseCases    webhook.Interface
+	IncomingUseCases   incoming.Interface
+	CommandUseCases    command.Interface
+	FilterUseCases     filter.Interface
+	ModerationUseCases moderation.Interface
+	BlockUseCases      block.Interface
+	AdminUseCases      admin.Interface
+	AuditUseCases      audit.Interface // security events aren't recorded if nil
+	RetentionUseCases  retention.Interface
+	Events             events.Interface
+	RateLimiter        *RateLimiter // requests aren't limited if nil
+	// StreamTimeout ends event streams before the server write timeout does,
+	// clients reconnect and catch up with Last-Event-ID.
+	StreamTimeout time.Duration
 }
 
 func NewApi(a account.Interface, r room.Interface, m message.Interface) *Api {
@@ -40,20 +98,105 @@ func (a *Api) Router() http.Handler {
 
 	router.HandleFunc("/signup", a.postSignup).Methods(http.MethodPost)
 	router.HandleFunc("/signin", a.postSignin).Methods(http.MethodPost)
+	router.HandleFunc("/signin/mfa", a.postSigninMfa).Methods(http.MethodPost)
+	router.HandleFunc("/password-reset", a.postPasswordReset).Methods(http.MethodPost)
 
-	router.HandleFunc("/accounts/"+accountIdUrlPathKey, a.authenticate(a.getAccount)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts", a.authenticate(a.getAccounts)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/search", a.authenticate(a.getAccountsSearch)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}", a.authenticate(a.getAccount)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}", a.authenticate(a.patchAccount)).Methods(http.MethodPatch)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}", a.authenticate(a.deleteAccount)).Methods(http.MethodDelete)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/export", a.authenticate(a.postAccountExport)).Methods(http.MethodPost)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/mfa", a.authenticate(a.postAccountMfa)).Methods(http.MethodPost)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/mfa/confirm", a.authenticate(a.postAccountMfaConfirm)).Methods(http.MethodPost)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/blocks", a.authenticate(a.getAccountBlocks)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/blocks", a.authenticate(a.postAccountBlocks)).Methods(http.MethodPost)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/blocks/{"+blockedIdUrlPathKey+"}", a.authenticate(a.deleteAccountBlock)).Methods(http.MethodDelete)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/scheduled-messages", a.authenticate(a.getScheduledMessages)).Methods(http.MethodGet)
+	router.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/scheduled-messages/{"+scheduledIdUrlPathKey+"}", a.authenticate(a.deleteScheduledMessage)).Methods(http.MethodDelete)
 
 	router.HandleFunc("/rooms", a.authenticate(a.getAccountRooms)).Methods(http.MethodGet)
 	router.HandleFunc("/rooms", a.authenticate(a.postAccountRooms)).Methods(http.MethodPost)
-	router.HandleFunc("/rooms/"+roomsIdUrlPathKey, a.authenticate(a.getAccountRoom)).Methods(http.MethodGet)
-	router.HandleFunc("/rooms/"+roomsIdUrlPathKey, a.authenticate(a.putAccountRoom)).Methods(http.MethodPut)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}", a.authenticate(a.getAccountRoom)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}", a.authenticate(a.putAccountRoom)).Methods(http.MethodPut)
+
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/messages", a.authenticate(a.getMessages)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/messages", a.authenticate(a.postMessages)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/attachments", a.authenticate(a.postAttachments)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/attachments/{"+attachmentIdUrlPathKey+"}", a.authenticate(a.getAttachment)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/attachments/{"+attachmentIdUrlPathKey+"}/thumbnails/{"+thumbnailSizeUrlPathKey+"}", a.authenticate(a.getAttachmentThumbnail)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/webhooks", a.authenticate(a.getWebhooks)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/webhooks", a.authenticate(a.postWebhooks)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/webhooks/{"+webhookIdUrlPathKey+"}", a.authenticate(a.patchWebhook)).Methods(http.MethodPatch)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/webhooks/{"+webhookIdUrlPathKey+"}", a.authenticate(a.deleteWebhook)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/webhooks/{"+webhookIdUrlPathKey+"}/deliveries", a.authenticate(a.getWebhookDeliveries)).Methods(http.MethodGet)
+
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/incoming-webhooks", a.authenticate(a.getIncomingHooks)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/incoming-webhooks", a.authenticate(a.postIncomingHooks)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/incoming-webhooks/{"+hookIdUrlPathKey+"}", a.authenticate(a.deleteIncomingHook)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/commands", a.authenticate(a.getCommands)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/commands", a.authenticate(a.postCommands)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/commands/{"+commandIdUrlPathKey+"}", a.authenticate(a.deleteCommand)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/filter-rules", a.authenticate(a.getFilterRules)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/filter-rules", a.authenticate(a.postFilterRules)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/filter-rules/{"+filterRuleIdUrlPathKey+"}", a.authenticate(a.deleteFilterRule)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/filter-flags", a.authenticate(a.getFilterFlags)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/bans", a.authenticate(a.getRoomBans)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/bans", a.authenticate(a.postRoomBans)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/bans/{"+accountIdUrlPathKey+"}", a.authenticate(a.deleteRoomBan)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/mutes", a.authenticate(a.getRoomMutes)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/mutes", a.authenticate(a.postRoomMutes)).Methods(http.MethodPost)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/mutes/{"+accountIdUrlPathKey+"}", a.authenticate(a.deleteRoomMute)).Methods(http.MethodDelete)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/retention", a.authenticate(a.getRoomRetention)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/retention", a.authenticate(a.putRoomRetention)).Methods(http.MethodPut)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/pins", a.authenticate(a.getRoomPins)).Methods(http.MethodGet)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/pins/{"+messageIdUrlPathKey+"}", a.authenticate(a.putRoomPin)).Methods(http.MethodPut)
+	router.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}"+"/pins/{"+messageIdUrlPathKey+"}", a.authenticate(a.deleteRoomPin)).Methods(http.MethodDelete)
+	router.HandleFunc("/hooks/{"+hookIdUrlPathKey+"}/{"+hookTokenUrlPathKey+"}", a.postHook).Methods(http.MethodPost)
+
+	router.HandleFunc("/bots", a.authenticate(a.getBots)).Methods(http.MethodGet)
+	router.HandleFunc("/bots", a.authenticate(a.postBots)).Methods(http.MethodPost)
+	router.HandleFunc("/bots/{"+botIdUrlPathKey+"}/tokens", a.authenticate(a.getBotTokens)).Methods(http.MethodGet)
+	router.HandleFunc("/bots/{"+botIdUrlPathKey+"}/tokens", a.authenticate(a.postBotTokens)).Methods(http.MethodPost)
+	router.HandleFunc("/bots/{"+botIdUrlPathKey+"}/tokens/{"+tokenIdUrlPathKey+"}", a.authenticate(a.deleteBotToken)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/mentions", a.authenticate(a.getMentions)).Methods(http.MethodGet)
+	router.HandleFunc("/mentions/read", a.authenticate(a.postMentionsRead)).Methods(http.MethodPost)
+	router.HandleFunc("/events", a.authenticate(a.getEvents)).Methods(http.MethodGet)
+
+	router.HandleFunc("/reports", a.authenticate(a.postReports)).Methods(http.MethodPost)
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(a.staffOnly)
+	admin.HandleFunc("/reports", a.authenticate(a.getAdminReports)).Methods(http.MethodGet)
+	admin.HandleFunc("/reports/{"+reportIdUrlPathKey+"}", a.authenticate(a.getAdminReport)).Methods(http.MethodGet)
+	admin.HandleFunc("/reports/{"+reportIdUrlPathKey+"}/claim", a.authenticate(a.postAdminReportClaim)).Methods(http.MethodPost)
+	admin.HandleFunc("/reports/{"+reportIdUrlPathKey+"}/resolve", a.authenticate(a.postAdminReportResolve)).Methods(http.MethodPost)
+	admin.HandleFunc("/accounts", a.authenticate(a.getAdminAccounts)).Methods(http.MethodGet)
+	admin.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}", a.authenticate(a.getAdminAccount)).Methods(http.MethodGet)
+	admin.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/suspend", a.authenticate(a.postAdminAccountSuspend)).Methods(http.MethodPost)
+	admin.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/unsuspend", a.authenticate(a.postAdminAccountUnsuspend)).Methods(http.MethodPost)
+	admin.HandleFunc("/accounts/{"+accountIdUrlPathKey+"}/password-reset", a.authenticate(a.postAdminPasswordReset)).Methods(http.MethodPost)
+	admin.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}", a.authenticate(a.getAdminRoom)).Methods(http.MethodGet)
+	admin.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}", a.authenticate(a.deleteAdminRoom)).Methods(http.MethodDelete)
+	admin.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}/legal-hold", a.authenticate(a.postAdminRoomLegalHold)).Methods(http.MethodPost)
+	admin.HandleFunc("/rooms/{"+roomsIdUrlPathKey+"}/legal-hold", a.authenticate(a.deleteAdminRoomLegalHold)).Methods(http.MethodDelete)
+	admin.HandleFunc("/stats", a.authenticate(a.getAdminStats)).Methods(http.MethodGet)
+	admin.HandleFunc("/audit", a.authenticate(a.getAdminAudit)).Methods(http.MethodGet)
+	admin.HandleFunc("/audit/export", a.authenticate(a.getAdminAuditExport)).Methods(http.MethodGet)
+	admin.HandleFunc("/audit/verify", a.authenticate(a.getAdminAuditVerify)).Methods(http.MethodGet)
 
-	router.HandleFunc("/rooms/"+roomsIdUrlPathKey+"/messages", a.authenticate(a.getMessages)).Methods(http.MethodGet)
-	router.HandleFunc("/rooms/"+roomsIdUrlPathKey+"/messages", a.authenticate(a.postMessages)).Methods(http.MethodPost)
+	router.HandleFunc("/jobs/{"+jobIdUrlPathKey+"}", a.getJob).Methods(http.MethodGet)
+	router.HandleFunc("/exports/{"+exportIdUrlPathKey+"}", a.authenticate(a.getExport)).Methods(http.MethodGet)
+	router.HandleFunc("/exports/{"+exportIdUrlPathKey+"}/archive", a.authenticate(a.getExportArchive)).Methods(http.MethodGet)
 
 	router.Handle("/metrics", promhttp.Handler())
 
+	router.Use(a.requestId) // outermost, so the logger sees the id
 	router.Use(prom.Measurer())
+	if a.RateLimiter != nil {
+		router.Use(a.rateLimit)
+	}
 	router.Use(a.logger)
 	fmt.Println("test")
 
@@ -73,7 +216,7 @@ func (a *Api) postSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acc, err := a.AccountUseCases.CreateAccount(m.Login, m.Password)
+	acc, err := a.AccountUseCases.CreateAccount(m.Login, m.Password, source(r))
 	if err != nil { // todo: map domain errors to http error codes
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -84,7 +227,13 @@ func (a *Api) postSignup(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+type postSigninMfaPendingResponseModel struct {
+	MfaToken string `json:"mfa-token"`
+}
+
 // postSignin handles login request for existing user.
+// Accounts with two-factor authentication get MFA pending token
+// that must be exchanged at /signin/mfa.
 func (a *Api) postSignin(w http.ResponseWriter, r *http.Request) {
 	var m postSignupRequestModel
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
@@ -92,21 +241,73 @@ func (a *Api) postSignin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := a.AccountUseCases.LoginToAccount(m.Login, m.Password)
+	session, err := a.AccountUseCases.LoginToAccount(m.Login, m.Password, source(r))
 	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
+	if session.MfaPending {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(postSigninMfaPendingResponseModel{MfaToken: session.Token})
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwt")
+	w.Write([]byte(session.Token))
+}
+
+type postSigninMfaRequestModel struct {
+	MfaToken string `json:"mfa-token"`
+	Code     string `json:"code"`
+}
+
+// postSigninMfa completes login with one-time password or recovery code.
+func (a *Api) postSigninMfa(w http.ResponseWriter, r *http.Request) {
+	var m postSigninMfaRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	session, err := a.AccountUseCases.CompleteMfaLogin(m.MfaToken, m.Code, source(r))
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/jwt")
-	w.Write([]byte(token))
+	w.Write([]byte(session.Token))
+}
+
+func writeLoginError(w http.ResponseWriter, err error) {
+	var lockout *account.LockoutError
+	if errors.As(err, &lockout) {
+		retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, account.ErrAccountSuspended) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
 }
 
 type getAccountResponseModel struct {
-	Id string `json:"id"`
+	Id          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display-name"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+	Status      string `json:"status"`
+	Timezone    string `json:"timezone"`
+	Bot         bool   `json:"bot"`
 }
 
-// getAccount handles request for user's account information.
+// getAccount handles request for account's profile.
+// Profiles are visible to the owner and accounts sharing a room with the owner.
 func (a *Api) getAccount(w http.ResponseWriter, r *http.Request) {
 	accountId, ok := r.Context().Value(accountIdContextKey).(string)
 	if !ok {
@@ -119,22 +320,285 @@ func (a *Api) getAccount(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if id != accountId { // todo: move to the upper layer
+	acc, err := a.AccountUseCases.GetProfile(accountId, id)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(toAccountResponseModel(acc)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+type patchAccountRequestModel struct {
+	DisplayName *string `json:"display-name"`
+	Bio         *string `json:"bio"`
+	Avatar      *string `json:"avatar"`
+	Status      *string `json:"status"`
+	Timezone    *string `json:"timezone"`
+}
+
+// patchAccount updates fields of account's profile present in request.
+func (a *Api) patchAccount(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m patchAccountRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	acc, err := a.AccountUseCases.UpdateProfile(accountId, id, account.ProfileUpdate{
+		DisplayName: m.DisplayName,
+		Bio:         m.Bio,
+		Avatar:      m.Avatar,
+		Status:      m.Status,
+		Timezone:    m.Timezone,
+	})
+	switch {
+	case errors.Is(err, account.ErrInvalidProfileString),
+		errors.Is(err, account.ErrInvalidTimezone),
+		errors.Is(err, account.ErrTooLongString):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(toAccountResponseModel(acc)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// deleteAccount deactivates account or starts its erasure depending on mode parameter.
+func (a *Api) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mode := account.DeletionMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = account.Deactivate
+	}
+	j, err := a.AccountUseCases.DeleteAccount(accountId, id, mode)
+	switch {
+	case errors.Is(err, account.ErrUnknownDeletionMode):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	if mode == account.Deactivate {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s", j.Id))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(toJobModel(j)); err != nil {
+		return
+	}
+}
+
+func toAccountResponseModel(acc account.Account) getAccountResponseModel {
+	return getAccountResponseModel{
+		Id:          acc.Id,
+		Login:       acc.Login,
+		DisplayName: acc.Profile.DisplayName,
+		Bio:         acc.Profile.Bio,
+		Avatar:      acc.Profile.Avatar,
+		Status:      acc.Profile.Status,
+		Timezone:    acc.Profile.Timezone,
+		Bot:         acc.Bot,
+	}
+}
+
+type postAccountMfaResponseModel struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+// postAccountMfa starts enrollment of time-based one-time passwords.
+func (a *Api) postAccountMfa(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != accountId {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	enrollment, err := a.AccountUseCases.EnrollTotp(accountId)
+	if errors.Is(err, account.ErrMfaAlreadyEnabled) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	m := postAccountMfaResponseModel{
+		Secret: enrollment.Secret,
+		Uri:    enrollment.Uri,
+	}
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+type postAccountMfaConfirmRequestModel struct {
+	Code string `json:"code"`
+}
+
+type postAccountMfaConfirmResponseModel struct {
+	RecoveryCodes []string `json:"recovery-codes"`
+}
+
+// postAccountMfaConfirm enables two-factor authentication once user proves
+// that the secret is saved in authenticator.
+func (a *Api) postAccountMfaConfirm(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != accountId {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	acc, err := a.AccountUseCases.GetAccountById(accountId)
+	var m postAccountMfaConfirmRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	codes, err := a.AccountUseCases.ConfirmTotp(accountId, m.Code)
+	switch {
+	case errors.Is(err, account.ErrMfaAlreadyEnabled):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case errors.Is(err, account.ErrMfaNotEnrolled), errors.Is(err, account.ErrInvalidMfaCode):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := postAccountMfaConfirmResponseModel{RecoveryCodes: codes}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// getAccounts looks up an account by exact login.
+func (a *Api) getAccounts(w http.ResponseWriter, r *http.Request) {
+	login := r.URL.Query().Get("login")
+	if login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	acc, err := a.AccountUseCases.FindAccountByLogin(login)
+	switch {
+	case errors.Is(err, account.ErrInvalidLoginString),
+		errors.Is(err, account.ErrTooShortString),
+		errors.Is(err, account.ErrTooLongString):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	m := toAccountSummaryModel(acc)
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+type getAccountsSearchResponseModel struct {
+	Accounts []accountSummaryModel `json:"accounts"`
+	Offset   int                   `json:"offset"`
+	Count    int                   `json:"count"`
+}
+
+// getAccountsSearch searches accounts by login or display name prefix.
+func (a *Api) getAccountsSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, err := intQueryParam(q.Get("offset"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(q.Get("limit"))
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	aa, err := a.AccountUseCases.SearchAccounts(q.Get("q"), offset, limit)
+	switch {
+	case errors.Is(err, account.ErrTooShortString),
+		errors.Is(err, account.ErrTooLongString),
+		errors.Is(err, account.ErrInvalidPaging):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	m := getAccountResponseModel{Id: acc.Id}
+	m := getAccountsSearchResponseModel{
+		Accounts: make([]accountSummaryModel, 0, len(aa)),
+		Offset:   offset,
+		Count:    len(aa),
+	}
+	for _, acc := range aa {
+		m.Accounts = append(m.Accounts, toAccountSummaryModel(acc))
+	}
 	if err := json.NewEncoder(w).Encode(m); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+func toAccountSummaryModel(acc account.Account) accountSummaryModel {
+	return accountSummaryModel{
+		Id:          acc.Id,
+		Login:       acc.Login,
+		DisplayName: acc.Profile.DisplayName,
+		Bot:         acc.Bot,
+	}
+}
+
 type getAccountRoomsResponseModel struct {
 	RoomIds     []string `json:"room-ids"`
 	RoomsNumber int      `json:"rooms-number"`
@@ -157,7 +621,7 @@ func (a *Api) getAccountRooms(w http.ResponseWriter, r *http.Request) {
 		RoomsNumber: len(rr),
 	}
 	for i := range rr {
-		m.RoomIds[i] = rr[i].Id
+		m.RoomIds = append(m.RoomIds, rr[i].Id)
 	}
 	if err := json.NewEncoder(w).Encode(m); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -183,9 +647,18 @@ func (a *Api) postAccountRooms(w http.ResponseWriter, r *http.Request) {
 }
 
 type getAccountRoomResponseModel struct {
-	CreatorId    string   `json:"creator-id"`
-	MemberIds    []string `json:"member-ids"`
-	MembersCount int      `json:"members-count"`
+	CreatorId    string                `json:"creator-id"`
+	Topic        string                `json:"topic"`
+	MemberIds    []string              `json:"member-ids"`
+	Members      []accountSummaryModel `json:"members"`
+	MembersCount int                   `json:"members-count"`
+}
+
+type accountSummaryModel struct {
+	Id          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display-name"`
+	Bot         bool   `json:"bot"`
 }
 
 // getAccountRoom returns room info.
@@ -206,11 +679,23 @@ func (a *Api) getAccountRoom(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	accounts, err := a.accountsByIds(rm.Members)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	m := getAccountRoomResponseModel{
 		CreatorId:    "todo", // todo
+		Topic:        rm.Topic,
 		MemberIds:    rm.Members,
+		Members:      make([]accountSummaryModel, 0, len(rm.Members)),
 		MembersCount: len(rm.Members),
 	}
+	for _, id := range rm.Members {
+		acc := accounts[id]
+		acc.Id = id
+		m.Members = append(m.Members, toAccountSummaryModel(acc))
+	}
 	if err := json.NewEncoder(w).Encode(m); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -226,8 +711,7 @@ type putAccountRoomRequestModel struct {
 
 // putAccountRoom allows to add and remove room members.
 func (a *Api) putAccountRoom(w http.ResponseWriter, r *http.Request) {
-	aid, ok := r.Context().Value(accountIdContextKey).(string)
-	if !ok {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -255,12 +739,17 @@ func (a *Api) putAccountRoom(w http.ResponseWriter, r *http.Request) {
 		}
 		toAdd = append(toAdd, member.Id)
 	}
-	err := a.RoomUseCases.AddMembers(aid, rid, toAdd)
+	src := source(r)
+	err := a.RoomUseCases.AddMembers(src, rid, toAdd)
+	if errors.Is(err, room.ErrBanned) || errors.Is(err, room.ErrNotAddable) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	err = a.RoomUseCases.RemoveMembers(aid, rid, toDelete)
+	err = a.RoomUseCases.RemoveMembers(src, rid, toDelete)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -272,11 +761,58 @@ type getMessagesResponseModel struct {
 }
 
 type messageModel struct {
-	AuthorId string `json:"author-id"`
-	Text     string `json:"text"`
+	Id          string            `json:"id"`
+	AuthorId    string            `json:"author-id"`
+	AuthorName  string            `json:"author-name"`
+	AuthorBot   bool              `json:"author-bot"`
+	Format      string            `json:"format"`
+	Text        string            `json:"text,omitempty"`
+	Html        string            `json:"html,omitempty"`
+	Entities    []entityModel     `json:"entities"`
+	CreatedAt   time.Time         `json:"created-at"`
+	Attachments []attachmentModel `json:"attachments"`
+	Ephemeral   bool              `json:"ephemeral,omitempty"` // command reply only the author sees
+	Pinned      bool              `json:"pinned,omitempty"`
+	System      bool              `json:"system,omitempty"` // notice of the author's action like a pin
+	ExpiresAt   *time.Time        `json:"expires-at,omitempty"`
+	SendAt      *time.Time        `json:"send-at,omitempty"` // of a scheduled message
+}
+
+type entityModel struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Url       string `json:"url,omitempty"`
+	Language  string `json:"language,omitempty"`
+	AccountId string `json:"account-id,omitempty"`
+}
+
+const (
+	renderSource = "source"
+	renderHtml   = "html"
+)
+
+type attachmentModel struct {
+	Id          string           `json:"id"`
+	Filename    string           `json:"filename"`
+	MimeType    string           `json:"mime-type"`
+	Size        int64            `json:"size"`
+	Checksum    string           `json:"sha256"`
+	Url         string           `json:"url"`
+	Width       int              `json:"width,omitempty"`
+	Height      int              `json:"height,omitempty"`
+	Placeholder string           `json:"placeholder,omitempty"`
+	Thumbnails  []thumbnailModel `json:"thumbnails"`
+}
+
+type thumbnailModel struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Url    string `json:"url"`
 }
 
 // getMessages returns messages for the selected room.
+// Text is returned as written unless render=html asks for sanitized HTML.
 func (a *Api) getMessages(w http.ResponseWriter, r *http.Request) {
 	aid, ok := r.Context().Value(accountIdContextKey).(string)
 	if !ok {
@@ -289,17 +825,42 @@ func (a *Api) getMessages(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	render, ok := renderOf(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 	msgs, err := a.MessageUseCases.ListMessages(aid, rid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	a.writeMessages(w, msgs, render)
+}
+
+// renderOf returns how the request wants messages rendered, source by default.
+func renderOf(r *http.Request) (string, bool) {
+	render := r.URL.Query().Get("render")
+	if render == "" {
+		render = renderSource
+	}
+	return render, render == renderSource || render == renderHtml
+}
+
+// writeMessages responds with the messages and names of their authors.
+func (a *Api) writeMessages(w http.ResponseWriter, msgs []message.Message, render string) {
+	authorIds := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		authorIds = append(authorIds, msg.Author)
+	}
+	authors, err := a.accountsByIds(authorIds)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	m := getMessagesResponseModel{Messages: make([]messageModel, 0, len(msgs))}
 	for _, msg := range msgs {
-		m.Messages = append(m.Messages, messageModel{
-			AuthorId: msg.Author,
-			Text:     msg.Text,
-		})
+		m.Messages = append(m.Messages, toMessageModel(msg, authors[msg.Author], render))
 	}
 	if err := json.NewEncoder(w).Encode(m); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -308,10 +869,16 @@ func (a *Api) getMessages(w http.ResponseWriter, r *http.Request) {
 }
 
 type postMessagesRequestModel struct {
-	Text string `json:"text"`
+	Text        string    `json:"text"`
+	Format      string    `json:"format"` // plain or markdown
+	Attachments []string  `json:"attachments"`
+	Ttl         string    `json:"ttl"` // the message deletes itself after it, like "10m"
+	SendAt      time.Time `json:"send-at"`
 }
 
-// postMessages allows user to create a new message.
+// postMessages allows user to create a new message. Messages starting with
+// a slash run commands, replies only the caller sees come with 200 instead of 201.
+// Messages to be sent later come with 202, their id is the one in the queue.
 func (a *Api) postMessages(w http.ResponseWriter, r *http.Request) {
 	aid, ok := r.Context().Value(accountIdContextKey).(string)
 	if !ok {
@@ -329,9 +896,2052 @@ func (a *Api) postMessages(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err := a.MessageUseCases.CreateMessage(aid, rid, m.Text)
+	var ttl time.Duration
+	if m.Ttl != "" {
+		var err error
+		if ttl, err = time.ParseDuration(m.Ttl); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	msg, err := a.MessageUseCases.CreateMessage(aid, rid, message.Draft{
+		Text:        m.Text,
+		Format:      m.Format,
+		Attachments: m.Attachments,
+		Ttl:         ttl,
+		SendAt:      m.SendAt,
+	})
 	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case msg.Ephemeral:
+		w.WriteHeader(http.StatusOK)
+	case !msg.SendAt.IsZero():
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(toMessageModel(msg, account.Account{}, renderSource))
+}
+
+type rejectedMessageModel struct {
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+}
+
+// writeMessageError maps errors of posting a message to http status codes.
+// Messages rejected by filters get 422 with the reason.
+func writeMessageError(w http.ResponseWriter, err error) {
+	var rejected *filter.RejectedError
+	switch {
+	case errors.As(err, &rejected):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(rejectedMessageModel{Filter: rejected.Filter, Reason: rejected.Reason})
+	case errors.Is(err, message.ErrInvalidFormat),
+		errors.Is(err, message.ErrMessageTooLong),
+		errors.Is(err, message.ErrEmptyMessage),
+		errors.Is(err, message.ErrTooManyAttachments),
+		errors.Is(err, message.ErrInvalidAttachment),
+		errors.Is(err, message.ErrCommandAttachments),
+		errors.Is(err, message.ErrInvalidTtl),
+		errors.Is(err, message.ErrInvalidSendAt),
+		errors.Is(err, message.ErrScheduledCommand),
+		errors.Is(err, command.ErrUnknownCommand),
+		errors.Is(err, room.ErrInvalidTopic):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, message.ErrMuted),
+		errors.Is(err, command.ErrMuted):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, message.ErrTooManyScheduled):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, command.ErrBotUnavailable):
+		w.WriteHeader(http.StatusBadGateway)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toMessageModel(msg message.Message, author account.Account, render string) messageModel {
+	m := messageModel{
+		Id:          msg.Id,
+		AuthorId:    msg.Author,
+		AuthorName:  author.Profile.DisplayName,
+		AuthorBot:   author.Bot,
+		Format:      msg.Format,
+		Entities:    make([]entityModel, 0, len(msg.Entities)),
+		CreatedAt:   msg.CreatedAt,
+		Attachments: make([]attachmentModel, 0, len(msg.Attachments)),
+		Ephemeral:   msg.Ephemeral,
+		Pinned:      msg.Pinned,
+		System:      msg.System,
+	}
+	if !msg.ExpiresAt.IsZero() {
+		m.ExpiresAt = &msg.ExpiresAt
+	}
+	if !msg.SendAt.IsZero() {
+		m.SendAt = &msg.SendAt
+	}
+	if render == renderHtml {
+		m.Html = msg.Html
+	} else {
+		m.Text = msg.Text
+	}
+	for _, e := range msg.Entities {
+		m.Entities = append(m.Entities, entityModel{
+			Type:      e.Type,
+			Text:      e.Text,
+			Url:       e.Url,
+			Language:  e.Language,
+			AccountId: e.AccountId,
+		})
+	}
+	for _, att := range msg.Attachments {
+		am := attachmentModel{
+			Id:          att.Id,
+			Filename:    att.Filename,
+			MimeType:    att.MimeType,
+			Size:        att.Size,
+			Checksum:    att.Checksum,
+			Url:         attachmentUrl(msg.Room, att.Id),
+			Width:       att.Width,
+			Height:      att.Height,
+			Placeholder: att.Placeholder,
+			Thumbnails:  make([]thumbnailModel, 0, len(att.Thumbnails)),
+		}
+		for _, t := range att.Thumbnails {
+			am.Thumbnails = append(am.Thumbnails, thumbnailModel{
+				Size:   t.Size,
+				Width:  t.Width,
+				Height: t.Height,
+				Url:    fmt.Sprintf("%s/thumbnails/%d", am.Url, t.Size),
+			})
+		}
+		m.Attachments = append(m.Attachments, am)
+	}
+	return m
+}
+
+func attachmentUrl(roomId, attachmentId string) string {
+	return fmt.Sprintf("/rooms/%s/attachments/%s", roomId, attachmentId)
+}
+
+// postAttachments uploads a file to the room. The request body is the file content,
+// the name is passed in the filename query parameter.
+// The returned id may then be referenced by messages posted to the room.
+func (a *Api) postAttachments(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	att, err := a.AttachmentUseCases.Upload(aid, rid, r.URL.Query().Get("filename"), r.Header.Get("Content-Type"), r.Body)
+	switch {
+	case errors.Is(err, attachment.ErrFileTooLarge), errors.Is(err, attachment.ErrQuotaExceeded):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	url := attachmentUrl(rid, att.Id)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", url)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachmentModel{
+		Id:         att.Id,
+		Filename:   att.Filename,
+		MimeType:   att.MimeType,
+		Size:       att.Size,
+		Checksum:   att.Checksum,
+		Url:        url,
+		Thumbnails: []thumbnailModel{},
+	})
+}
+
+// inlineMimeTypes are shown in browser, everything else is downloaded
+// so uploaded html or svg can't run scripts on our origin.
+var inlineMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// getAttachment downloads attachment content for room members.
+func (a *Api) getAttachment(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[attachmentIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	att, content, err := a.AttachmentUseCases.Download(aid, rid, id)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	defer content.Close()
+	disposition := "attachment"
+	if inlineMimeTypes[att.MimeType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", att.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+att.Checksum+`"`)
+	io.Copy(w, content)
+}
+
+// getAttachmentThumbnail downloads image preview, it is missing until thumbnail job is done.
+func (a *Api) getAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[attachmentIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(vars[thumbnailSizeUrlPathKey])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thumb, content, err := a.AttachmentUseCases.DownloadThumbnail(aid, rid, id, size)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", thumb.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	io.Copy(w, content)
+}
+
+// accountsByIds fetches accounts with one request to embed their names into listings.
+func (a *Api) accountsByIds(ids []string) (map[string]account.Account, error) {
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	aa, err := a.AccountUseCases.GetAccountsByIds(unique)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]account.Account, len(aa))
+	for _, acc := range aa {
+		res[acc.Id] = acc
+	}
+	return res, nil
+}
+
+// writeDomainError maps common domain errors to http status codes.
+func writeDomainError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, domain.ErrUnauthorized):
+		w.WriteHeader(http.StatusUnauthorized)
+	case errors.Is(err, domain.ErrAlreadyExist):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// intQueryParam parses optional integer query parameter.
+func intQueryParam(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+type jobModel struct {
+	Id        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	State     string    `json:"state"`
+	Done      int       `json:"done"`
+	Total     int       `json:"total"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created-at"`
+	UpdatedAt time.Time `json:"updated-at"`
+}
+
+// getJob reports progress of a background job. It doesn't require authentication:
+// job ids are random, and owners of erased accounts can't authenticate anymore.
+func (a *Api) getJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars[jobIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	j, err := a.JobUseCases.GetJobStatus(id)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	// the erased account can't sign in, so only erasure progress is public
+	if j.Kind != account.EraseJobKind {
+		writeDomainError(w, domain.ErrNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(toJobModel(j)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func toJobModel(j job.Job) jobModel {
+	return jobModel{
+		Id:        j.Id,
+		Kind:      j.Kind,
+		State:     j.State,
+		Done:      j.Done,
+		Total:     j.Total,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+}
+
+// postAccountExport starts export of account's data.
+func (a *Api) postAccountExport(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	j, err := a.ExportUseCases.StartExport(accountId, id)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/exports/%s", j.Id))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(toExportModel(j)); err != nil {
+		return
+	}
+}
+
+type exportModel struct {
+	jobModel
+	Archive string `json:"archive,omitempty"`
+}
+
+// getExport reports export status.
+func (a *Api) getExport(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[exportIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	j, err := a.ExportUseCases.GetExport(accountId, id)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(toExportModel(j)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// getExportArchive downloads finished export.
+func (a *Api) getExportArchive(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[exportIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	archive, err := a.ExportUseCases.OpenArchive(accountId, id)
+	if errors.Is(err, export.ErrNotReady) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if errors.Is(err, export.ErrExpired) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	defer archive.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-export-%s.zip"`, id))
+	io.Copy(w, archive)
+}
+
+func toExportModel(j job.Job) exportModel {
+	m := exportModel{jobModel: toJobModel(j)}
+	if j.State == job.StateDone {
+		m.Archive = fmt.Sprintf("/exports/%s/archive", j.Id)
+	}
+	return m
+}
+
+type getMentionsResponseModel struct {
+	Mentions []mentionModel `json:"mentions"`
+	Unread   int            `json:"unread"`
+}
+
+type mentionModel struct {
+	MessageId  string    `json:"message-id"`
+	RoomId     string    `json:"room-id"`
+	AuthorId   string    `json:"author-id"`
+	AuthorName string    `json:"author-name"`
+	Format     string    `json:"format"`
+	Text       string    `json:"text"`
+	Html       string    `json:"html"`
+	CreatedAt  time.Time `json:"created-at"`
+	Read       bool      `json:"read"`
+}
+
+// getMentions returns messages mentioning the caller across all rooms.
+func (a *Api) getMentions(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	offset, err := intQueryParam(q.Get("offset"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(q.Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mm, err := a.MentionUseCases.ListMentions(aid, q.Get("unread") == "true", offset, limit)
+	if errors.Is(err, mention.ErrInvalidPaging) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	unread, err := a.MentionUseCases.CountUnread(aid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	authorIds := make([]string, 0, len(mm))
+	for _, m := range mm {
+		authorIds = append(authorIds, m.Author)
+	}
+	authors, err := a.accountsByIds(authorIds)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := getMentionsResponseModel{Mentions: make([]mentionModel, 0, len(mm)), Unread: unread}
+	for _, m := range mm {
+		resp.Mentions = append(resp.Mentions, mentionModel{
+			MessageId:  m.MessageId,
+			RoomId:     m.Room,
+			AuthorId:   m.Author,
+			AuthorName: authors[m.Author].Profile.DisplayName,
+			Format:     m.Format,
+			Text:       m.Text,
+			Html:       m.Html,
+			CreatedAt:  m.CreatedAt,
+			Read:       m.Read,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postMentionsReadRequestModel struct {
+	MessageIds []string `json:"message-ids"` // all mentions if empty
+}
+
+type postMentionsReadResponseModel struct {
+	Marked int `json:"marked"`
+}
+
+// postMentionsRead marks caller's mentions read.
+func (a *Api) postMentionsRead(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var m postMentionsReadRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	n, err := a.MentionUseCases.MarkRead(aid, m.MessageIds)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(postMentionsReadResponseModel{Marked: n})
+}
+
+type mentionEventModel struct {
+	MessageId string    `json:"message-id"`
+	RoomId    string    `json:"room-id"`
+	AuthorId  string    `json:"author-id"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type messageDeletedEventModel struct {
+	MessageId string `json:"message-id"`
+	RoomId    string `json:"room-id"`
+}
+
+// toEventModel converts event payloads to their json models.
+func toEventModel(e events.Event) (interface{}, bool) {
+	switch data := e.Data.(type) {
+	case mention.Event:
+		return mentionEventModel{
+			MessageId: data.MessageId,
+			RoomId:    data.Room,
+			AuthorId:  data.Author,
+			CreatedAt: data.CreatedAt,
+		}, true
+	case message.DeletedEvent:
+		return messageDeletedEventModel{
+			MessageId: data.MessageId,
+			RoomId:    data.Room,
+		}, true
+	}
+	return nil, false
+}
+
+// getEvents streams caller's notifications as server-sent events.
+// The stream ends before the server write timeout, clients reconnect
+// with Last-Event-ID header and get the events they missed.
+func (a *Api) getEvents(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	replay, sub := a.Events.Subscribe(aid, r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	for _, e := range replay {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	timeout := time.NewTimer(a.StreamTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		case <-timeout.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, e events.Event) {
+	m, ok := toEventModel(e)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+}
+
+type webhookModel struct {
+	Id        string    `json:"id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only in the response to creation
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Failures  int       `json:"failures"`
+	CreatorId string    `json:"creator-id"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getWebhooksResponseModel struct {
+	Webhooks []webhookModel `json:"webhooks"`
+}
+
+// getWebhooks lists webhooks of the room to its admin.
+func (a *Api) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ww, err := a.WebhookUseCases.ListWebhooks(aid, rid)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	resp := getWebhooksResponseModel{Webhooks: make([]webhookModel, 0, len(ww))}
+	for _, wh := range ww {
+		resp.Webhooks = append(resp.Webhooks, toWebhookModel(wh))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postWebhooksRequestModel struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// postWebhooks registers a webhook for the room. The response has the secret
+// deliveries are signed with, it isn't shown again.
+func (a *Api) postWebhooks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postWebhooksRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wh, err := a.WebhookUseCases.CreateWebhook(aid, rid, m.Url, m.Events)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/rooms/%s/webhooks/%s", rid, wh.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toWebhookModel(wh))
+}
+
+type patchWebhookRequestModel struct {
+	Url    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// patchWebhook changes the webhook, setting active re-enables webhook disabled after failures.
+func (a *Api) patchWebhook(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[webhookIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m patchWebhookRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wh, err := a.WebhookUseCases.UpdateWebhook(aid, rid, id, webhook.Update{Url: m.Url, Events: m.Events, Active: m.Active})
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toWebhookModel(wh))
+}
+
+// deleteWebhook removes the webhook with its delivery log.
+func (a *Api) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[webhookIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.WebhookUseCases.DeleteWebhook(aid, rid, id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type webhookDeliveryModel struct {
+	Id         string    `json:"id"`
+	EventId    string    `json:"event-id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status-code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration-ms"`
+	CreatedAt  time.Time `json:"created-at"`
+}
+
+type getWebhookDeliveriesResponseModel struct {
+	Deliveries []webhookDeliveryModel `json:"deliveries"`
+}
+
+// getWebhookDeliveries returns the delivery log of the webhook, newest attempts first.
+func (a *Api) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[webhookIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(r.URL.Query().Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dd, err := a.WebhookUseCases.ListDeliveries(aid, rid, id, limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	resp := getWebhookDeliveriesResponseModel{Deliveries: make([]webhookDeliveryModel, 0, len(dd))}
+	for _, d := range dd {
+		resp.Deliveries = append(resp.Deliveries, webhookDeliveryModel{
+			Id:         d.Id,
+			EventId:    d.EventId,
+			Event:      d.Event,
+			Attempt:    d.Attempt,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			Success:    d.Success,
+			DurationMs: d.Duration.Milliseconds(),
+			CreatedAt:  d.CreatedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNotRoomAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, webhook.ErrInvalidUrl), errors.Is(err, webhook.ErrInvalidEvents), errors.Is(err, webhook.ErrInvalidLimit):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toWebhookModel(wh webhook.Webhook) webhookModel {
+	events := wh.Events
+	if events == nil {
+		events = []string{}
+	}
+	return webhookModel{
+		Id:        wh.Id,
+		Url:       wh.Url,
+		Secret:    wh.Secret,
+		Events:    events,
+		Active:    wh.Active,
+		Failures:  wh.Failures,
+		CreatorId: wh.Creator,
+		CreatedAt: wh.CreatedAt,
+	}
+}
+
+type botModel struct {
+	Id          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display-name"`
+}
+
+type getBotsResponseModel struct {
+	Bots []botModel `json:"bots"`
+}
+
+// getBots lists bots created by the caller.
+func (a *Api) getBots(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	bots, err := a.AccountUseCases.ListBots(aid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	resp := getBotsResponseModel{Bots: make([]botModel, 0, len(bots))}
+	for _, bot := range bots {
+		resp.Bots = append(resp.Bots, botModel{Id: bot.Id, Login: bot.Login, DisplayName: bot.Profile.DisplayName})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postBotsRequestModel struct {
+	Login string `json:"login"`
+}
+
+// postBots creates a bot account owned by the caller.
+func (a *Api) postBots(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var m postBotsRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	bot, err := a.AccountUseCases.CreateBot(aid, m.Login)
+	switch {
+	case errors.Is(err, account.ErrInvalidLoginString),
+		errors.Is(err, account.ErrTooShortString),
+		errors.Is(err, account.ErrTooLongString):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case errors.Is(err, account.ErrBotsCantManageBots):
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/accounts/%s", bot.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(botModel{Id: bot.Id, Login: bot.Login})
+}
+
+type apiTokenModel struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"` // only in the response to creation
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getBotTokensResponseModel struct {
+	Tokens []apiTokenModel `json:"tokens"`
+}
+
+// getBotTokens lists api tokens of the caller's bot, without the tokens themselves.
+func (a *Api) getBotTokens(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	botId, ok := vars[botIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tt, err := a.AccountUseCases.ListApiTokens(aid, botId)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	resp := getBotTokensResponseModel{Tokens: make([]apiTokenModel, 0, len(tt))}
+	for _, t := range tt {
+		resp.Tokens = append(resp.Tokens, apiTokenModel{Id: t.Id, Name: t.Name, CreatedAt: t.CreatedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postBotTokensRequestModel struct {
+	Name string `json:"name"`
+}
+
+// postBotTokens issues an api token for the caller's bot. The token is shown only once.
+func (a *Api) postBotTokens(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	botId, ok := vars[botIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postBotTokensRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	t, err := a.AccountUseCases.CreateApiToken(aid, botId, m.Name)
+	switch {
+	case errors.Is(err, account.ErrInvalidProfileString),
+		errors.Is(err, account.ErrTooLongString):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case errors.Is(err, account.ErrTooManyApiTokens):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil:
+		writeDomainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apiTokenModel{Id: t.Id, Name: t.Name, Token: t.Token, CreatedAt: t.CreatedAt})
+}
+
+// deleteBotToken revokes an api token of the caller's bot.
+func (a *Api) deleteBotToken(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	botId, ok := vars[botIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tokenId, ok := vars[tokenIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.AccountUseCases.RevokeApiToken(source(r), botId, tokenId); err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type incomingHookModel struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	BotId     string    `json:"bot-id"`
+	CreatorId string    `json:"creator-id"`
+	Url       string    `json:"url,omitempty"` // only in the response to creation, it contains the token
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getIncomingHooksResponseModel struct {
+	Hooks []incomingHookModel `json:"incoming-webhooks"`
+}
+
+// getIncomingHooks lists incoming webhooks of the room to its admin.
+func (a *Api) getIncomingHooks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	hh, err := a.IncomingUseCases.ListHooks(aid, rid)
+	if err != nil {
+		writeIncomingHookError(w, err)
+		return
+	}
+	resp := getIncomingHooksResponseModel{Hooks: make([]incomingHookModel, 0, len(hh))}
+	for _, h := range hh {
+		resp.Hooks = append(resp.Hooks, toIncomingHookModel(h))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postIncomingHooksRequestModel struct {
+	Name  string `json:"name"`
+	BotId string `json:"bot-id"`
+}
+
+// postIncomingHooks creates an incoming webhook posting to the room as the caller's bot.
+// The response has the hook url with the secret token, it isn't shown again.
+func (a *Api) postIncomingHooks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postIncomingHooksRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h, err := a.IncomingUseCases.CreateHook(aid, rid, m.BotId, m.Name)
+	if err != nil {
+		writeIncomingHookError(w, err)
+		return
+	}
+	hm := toIncomingHookModel(h)
+	hm.Url = fmt.Sprintf("/hooks/%s/%s", h.Id, h.Token)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hm)
+}
+
+// deleteIncomingHook removes the incoming webhook, its url stops working.
+func (a *Api) deleteIncomingHook(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[hookIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.IncomingUseCases.DeleteHook(aid, rid, id); err != nil {
+		writeIncomingHookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type postHookRequestModel struct {
+	Text   string `json:"text"`
+	Format string `json:"format"` // plain or markdown
+}
+
+type postHookResponseModel struct {
+	Id string `json:"id"`
+}
+
+// postHook posts a message to the room of the incoming webhook. It doesn't require
+// authentication, the token in the url is the credential.
+func (a *Api) postHook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars[hookIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token, ok := vars[hookTokenUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postHookRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msg, err := a.IncomingUseCases.Post(id, token, message.Draft{Text: m.Text, Format: m.Format})
+	if errors.Is(err, incoming.ErrBotDeactivated) || errors.Is(err, incoming.ErrCreatorRevoked) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(postHookResponseModel{Id: msg.Id})
+}
+
+func writeIncomingHookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, incoming.ErrNotRoomAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, incoming.ErrNotBot), errors.Is(err, incoming.ErrInvalidName):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toIncomingHookModel(h incoming.Hook) incomingHookModel {
+	return incomingHookModel{
+		Id:        h.Id,
+		Name:      h.Name,
+		BotId:     h.Bot,
+		CreatorId: h.Creator,
+		CreatedAt: h.CreatedAt,
+	}
+}
+
+type commandModel struct {
+	Id        string     `json:"id,omitempty"` // built-in commands have no id
+	Name      string     `json:"name"`
+	Usage     string     `json:"usage"`
+	BotId     string     `json:"bot-id,omitempty"`
+	CreatorId string     `json:"creator-id,omitempty"`
+	Url       string     `json:"url,omitempty"`
+	Secret    string     `json:"secret,omitempty"` // only in the response to creation
+	CreatedAt *time.Time `json:"created-at,omitempty"`
+}
+
+type getCommandsResponseModel struct {
+	Commands []commandModel `json:"commands"`
+}
+
+// getCommands lists commands available in the room to its members.
+func (a *Api) getCommands(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cc, err := a.CommandUseCases.ListCommands(aid, rid)
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+	resp := getCommandsResponseModel{Commands: make([]commandModel, 0, len(cc))}
+	for _, c := range cc {
+		resp.Commands = append(resp.Commands, toCommandModel(c))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postCommandsRequestModel struct {
+	Name  string `json:"name"`
+	BotId string `json:"bot-id"`
+	Url   string `json:"url"`
+}
+
+// postCommands registers a command of the room forwarded to the caller's bot.
+// The response has the secret requests to the bot are signed with.
+func (a *Api) postCommands(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postCommandsRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c, err := a.CommandUseCases.CreateCommand(aid, rid, m.Name, m.BotId, m.Url)
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+	cm := toCommandModel(c)
+	cm.Secret = c.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cm)
+}
+
+// deleteCommand removes the forwarded command from the room.
+func (a *Api) deleteCommand(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[commandIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.CommandUseCases.DeleteCommand(aid, rid, id); err != nil {
+		writeCommandError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeCommandError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, command.ErrNotRoomAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, command.ErrNotBot),
+		errors.Is(err, command.ErrInvalidName),
+		errors.Is(err, command.ErrReservedName),
+		errors.Is(err, command.ErrInvalidUrl):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toCommandModel(c command.Command) commandModel {
+	m := commandModel{
+		Id:        c.Id,
+		Name:      c.Name,
+		Usage:     c.Usage,
+		BotId:     c.Bot,
+		CreatorId: c.Creator,
+		Url:       c.Url,
+	}
+	if c.Id != "" {
+		m.CreatedAt = &c.CreatedAt
+	}
+	return m
+}
+
+type filterRuleModel struct {
+	Id        string    `json:"id"`
+	Pattern   string    `json:"pattern"`
+	Regexp    bool      `json:"regexp"`
+	Action    string    `json:"action"`
+	CreatorId string    `json:"creator-id"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getFilterRulesResponseModel struct {
+	Rules []filterRuleModel `json:"rules"`
+}
+
+// getFilterRules lists banned words and patterns of the room to its admin.
+func (a *Api) getFilterRules(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rr, err := a.FilterUseCases.ListRules(aid, rid)
+	if err != nil {
+		writeFilterError(w, err)
+		return
+	}
+	resp := getFilterRulesResponseModel{Rules: make([]filterRuleModel, 0, len(rr))}
+	for _, rule := range rr {
+		resp.Rules = append(resp.Rules, toFilterRuleModel(rule))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postFilterRulesRequestModel struct {
+	Pattern string `json:"pattern"`
+	Regexp  bool   `json:"regexp"`
+	Action  string `json:"action"` // reject or flag, reject if empty
+}
+
+// postFilterRules bans a word or a regular expression in the room.
+func (a *Api) postFilterRules(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postFilterRulesRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rule, err := a.FilterUseCases.CreateRule(aid, rid, filter.RuleDraft{
+		Pattern: m.Pattern,
+		Regexp:  m.Regexp,
+		Action:  filter.Action(m.Action),
+	})
+	if err != nil {
+		writeFilterError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toFilterRuleModel(rule))
+}
+
+func (a *Api) deleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[filterRuleIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.FilterUseCases.DeleteRule(aid, rid, id); err != nil {
+		writeFilterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type filterFlagModel struct {
+	Id        string    `json:"id"`
+	MessageId string    `json:"message-id"`
+	AuthorId  string    `json:"author-id"`
+	Filter    string    `json:"filter"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getFilterFlagsResponseModel struct {
+	Flags []filterFlagModel `json:"flags"`
+}
+
+// getFilterFlags lists messages of the room filters flagged for review, newest first.
+func (a *Api) getFilterFlags(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(r.URL.Query().Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ff, err := a.FilterUseCases.ListFlags(aid, rid, limit)
+	if err != nil {
+		writeFilterError(w, err)
+		return
+	}
+	resp := getFilterFlagsResponseModel{Flags: make([]filterFlagModel, 0, len(ff))}
+	for _, f := range ff {
+		resp.Flags = append(resp.Flags, filterFlagModel{
+			Id:        f.Id,
+			MessageId: f.Message,
+			AuthorId:  f.Author,
+			Filter:    f.Filter,
+			Reason:    f.Reason,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeFilterError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, filter.ErrNotRoomAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, filter.ErrInvalidPattern),
+		errors.Is(err, filter.ErrInvalidAction),
+		errors.Is(err, filter.ErrTooManyRules),
+		errors.Is(err, filter.ErrInvalidLimit):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toFilterRuleModel(r filter.Rule) filterRuleModel {
+	return filterRuleModel{
+		Id:        r.Id,
+		Pattern:   r.Pattern,
+		Regexp:    r.Regexp,
+		Action:    string(r.Action),
+		CreatorId: r.Creator,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+type blockModel struct {
+	AccountId string    `json:"account-id"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getAccountBlocksResponseModel struct {
+	Blocks []blockModel `json:"blocks"`
+}
+
+// getAccountBlocks lists accounts blocked by the account, only to the account itself.
+func (a *Api) getAccountBlocks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != aid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	bb, err := a.BlockUseCases.ListBlocks(aid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	resp := getAccountBlocksResponseModel{Blocks: make([]blockModel, 0, len(bb))}
+	for _, b := range bb {
+		resp.Blocks = append(resp.Blocks, blockModel{AccountId: b.Account, CreatedAt: b.CreatedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postAccountBlocksRequestModel struct {
+	AccountId string `json:"account-id"`
+}
+
+// postAccountBlocks blocks the account, the blocked one isn't notified.
+func (a *Api) postAccountBlocks(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != aid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var m postAccountBlocksRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.AccountId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b, err := a.BlockUseCases.Block(aid, m.AccountId)
+	if errors.Is(err, block.ErrSelfBlock) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(blockModel{AccountId: b.Account, CreatedAt: b.CreatedAt})
+}
+
+func (a *Api) deleteAccountBlock(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != aid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	blockedId, ok := vars[blockedIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.BlockUseCases.Unblock(aid, blockedId); err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type banModel struct {
+	AccountId string    `json:"account-id"`
+	ActorId   string    `json:"actor-id"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getRoomBansResponseModel struct {
+	Bans []banModel `json:"bans"`
+}
+
+func (a *Api) getRoomBans(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	bb, err := a.RoomUseCases.ListBans(aid, rid)
+	if err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	resp := getRoomBansResponseModel{Bans: make([]banModel, 0, len(bb))}
+	for _, b := range bb {
+		resp.Bans = append(resp.Bans, toBanModel(b))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postRoomBansRequestModel struct {
+	AccountId string `json:"account-id"`
+	Reason    string `json:"reason"`
+}
+
+// postRoomBans removes the account from the room and keeps it from being added back.
+func (a *Api) postRoomBans(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postRoomBansRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.AccountId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b, err := a.RoomUseCases.BanMember(source(r), rid, m.AccountId, m.Reason)
+	if err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toBanModel(b))
+}
+
+func (a *Api) deleteRoomBan(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.RoomUseCases.UnbanMember(source(r), rid, id); err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type muteModel struct {
+	AccountId string    `json:"account-id"`
+	ActorId   string    `json:"actor-id"`
+	Reason    string    `json:"reason,omitempty"`
+	Until     time.Time `json:"until"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type getRoomMutesResponseModel struct {
+	Mutes []muteModel `json:"mutes"`
+}
+
+// getRoomMutes lists mutes of the room which haven't expired yet.
+func (a *Api) getRoomMutes(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mm, err := a.RoomUseCases.ListMutes(aid, rid)
+	if err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	resp := getRoomMutesResponseModel{Mutes: make([]muteModel, 0, len(mm))}
+	for _, m := range mm {
+		resp.Mutes = append(resp.Mutes, toMuteModel(m))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type postRoomMutesRequestModel struct {
+	AccountId string `json:"account-id"`
+	Duration  string `json:"duration"` // like "1h30m"
+	Reason    string `json:"reason"`
+}
+
+// postRoomMutes stops the account from posting to the room for the duration.
+func (a *Api) postRoomMutes(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postRoomMutesRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.AccountId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	d, err := time.ParseDuration(m.Duration)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mute, err := a.RoomUseCases.MuteMember(aid, rid, m.AccountId, d, m.Reason)
+	if err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toMuteModel(mute))
+}
+
+func (a *Api) deleteRoomMute(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.RoomUseCases.UnmuteMember(aid, rid, id); err != nil {
+		writeSanctionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSanctionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, room.ErrNotRoomAdmin),
+		errors.Is(err, room.ErrProtectedMember):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, room.ErrInvalidReason),
+		errors.Is(err, room.ErrInvalidDuration):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toBanModel(b room.Ban) banModel {
+	return banModel{
+		AccountId: b.Account,
+		ActorId:   b.Actor,
+		Reason:    b.Reason,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+func toMuteModel(m room.Mute) muteModel {
+	return muteModel{
+		AccountId: m.Account,
+		ActorId:   m.Actor,
+		Reason:    m.Reason,
+		Until:     m.Until,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+type postReportsRequestModel struct {
+	MessageId string `json:"message-id"`
+	AccountId string `json:"account-id"`
+	Reason    string `json:"reason"`
+}
+
+type reportModel struct {
+	Id          string    `json:"id"`
+	ReporterId  string    `json:"reporter-id"`
+	MessageId   string    `json:"message-id,omitempty"`
+	RoomId      string    `json:"room-id,omitempty"`
+	AccountId   string    `json:"account-id"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"`
+	ModeratorId string    `json:"moderator-id,omitempty"`
+	Resolution  string    `json:"resolution,omitempty"`
+	CreatedAt   time.Time `json:"created-at"`
+	UpdatedAt   time.Time `json:"updated-at"`
+}
+
+// postReports reports a message or an account to moderators.
+func (a *Api) postReports(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var m postReportsRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rep, err := a.ModerationUseCases.Report(aid, moderation.Draft{
+		MessageId: m.MessageId,
+		AccountId: m.AccountId,
+		Reason:    m.Reason,
+	})
+	if err != nil {
+		writeModerationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toReportModel(rep))
+}
+
+type getAdminReportsResponseModel struct {
+	Reports []reportModel `json:"reports"`
+}
+
+// getAdminReports lists the moderation queue, oldest reports first.
+func (a *Api) getAdminReports(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	limit, err := intQueryParam(q.Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rr, err := a.ModerationUseCases.ListReports(aid, q.Get("status"), limit)
+	if err != nil {
+		writeModerationError(w, err)
+		return
+	}
+	resp := getAdminReportsResponseModel{Reports: make([]reportModel, 0, len(rr))}
+	for _, rep := range rr {
+		resp.Reports = append(resp.Reports, toReportModel(rep))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type moderationActionModel struct {
+	Id          string    `json:"id"`
+	ModeratorId string    `json:"moderator-id"`
+	Action      string    `json:"action"`
+	Note        string    `json:"note,omitempty"`
+	CreatedAt   time.Time `json:"created-at"`
+}
+
+type getAdminReportResponseModel struct {
+	reportModel
+	Actions []moderationActionModel `json:"actions"`
+}
+
+func (a *Api) getAdminReport(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[reportIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rep, actions, err := a.ModerationUseCases.GetReport(aid, id)
+	if err != nil {
+		writeModerationError(w, err)
+		return
+	}
+	resp := getAdminReportResponseModel{
+		reportModel: toReportModel(rep),
+		Actions:     make([]moderationActionModel, 0, len(actions)),
+	}
+	for _, act := range actions {
+		resp.Actions = append(resp.Actions, moderationActionModel{
+			Id:          act.Id,
+			ModeratorId: act.Moderator,
+			Action:      act.Action,
+			Note:        act.Note,
+			CreatedAt:   act.CreatedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// postAdminReportClaim assigns the report to the moderator.
+func (a *Api) postAdminReportClaim(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[reportIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rep, err := a.ModerationUseCases.ClaimReport(aid, id)
+	if err != nil {
+		writeModerationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toReportModel(rep))
+}
+
+type postAdminReportResolveRequestModel struct {
+	Action   string `json:"action"`
+	RoomId   string `json:"room-id"`  // room to mute or ban in, room of the message if empty
+	Duration string `json:"duration"` // of a mute, like "1h30m"
+	Note     string `json:"note"`
+}
+
+// postAdminReportResolve takes the action and closes the report.
+func (a *Api) postAdminReportResolve(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[reportIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m postAdminReportResolveRequestModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var muteFor time.Duration
+	if m.Duration != "" {
+		var err error
+		if muteFor, err = time.ParseDuration(m.Duration); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	rep, err := a.ModerationUseCases.ResolveReport(source(r), id, moderation.Resolution{
+		Action:  m.Action,
+		RoomId:  m.RoomId,
+		MuteFor: muteFor,
+		Note:    m.Note,
+	})
+	if err != nil {
+		writeModerationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toReportModel(rep))
+}
+
+func writeModerationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, moderation.ErrNotModerator),
+		errors.Is(err, moderation.ErrProtectedAccount):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, moderation.ErrAlreadyClaimed),
+		errors.Is(err, moderation.ErrNotClaimed),
+		errors.Is(err, moderation.ErrResolving),
+		errors.Is(err, moderation.ErrAlreadyResolved):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, moderation.ErrInvalidReason),
+		errors.Is(err, moderation.ErrInvalidTarget),
+		errors.Is(err, moderation.ErrInvalidStatus),
+		errors.Is(err, moderation.ErrInvalidLimit),
+		errors.Is(err, moderation.ErrInvalidAction),
+		errors.Is(err, moderation.ErrInvalidDuration):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toReportModel(r moderation.Report) reportModel {
+	return reportModel{
+		Id:          r.Id,
+		ReporterId:  r.Reporter,
+		MessageId:   r.Message,
+		RoomId:      r.Room,
+		AccountId:   r.Account,
+		Reason:      r.Reason,
+		Status:      r.Status,
+		ModeratorId: r.Moderator,
+		Resolution:  r.Resolution,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
 }
@@ -1,7 +1,15 @@
 package httpapi
 
 import (
+	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/usecases/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/export"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+	"github.com/mp-hl-2021/chat/internal/usecases/message"
+	"github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"github.com/gorilla/mux"
 
 	"bytes"
 	"encoding/json"
@@ -9,11 +17,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type AccountUseCasesFake struct{}
 
-func (AccountUseCasesFake) CreateAccount(login, password string) (account.Account, error) {
+func (AccountUseCasesFake) CreateAccount(login, password string, src audit.Source) (account.Account, error) {
 	switch login {
 	case "alice":
 		return account.Account{
@@ -28,14 +37,115 @@ func (AccountUseCasesFake) GetAccountById(id string) (account.Account, error) {
 	panic("implement me")
 }
 
-func (AccountUseCasesFake) LoginToAccount(login, password string) (string, error) {
+func (AccountUseCasesFake) LoginToAccount(login, password string, src audit.Source) (account.Session, error) {
 	if login == "alice" && password == "123" {
-		return "token", nil
+		return account.Session{Token: "token"}, nil
+	}
+	if login == "carol" && password == "123" {
+		return account.Session{Token: "mfa-token", MfaPending: true}, nil
+	}
+	if login == "mallory" {
+		return account.Session{}, &account.LockoutError{RetryAfter: 1500 * time.Millisecond}
+	}
+	return account.Session{}, errors.New("invalid login or password")
+}
+
+func (AccountUseCasesFake) CompleteMfaLogin(mfaToken, code string, src audit.Source) (account.Session, error) {
+	if mfaToken == "mfa-token" && code == "123456" {
+		return account.Session{Token: "token"}, nil
 	}
-	return "", errors.New("invalid login or password")
+	return account.Session{}, errors.New("invalid one-time password")
 }
 
 func (a *AccountUseCasesFake) Authenticate(token string) (string, error) {
+	if token == "token" {
+		return "1", nil
+	}
+	return "", errors.New("invalid token")
+}
+
+func (AccountUseCasesFake) EnrollTotp(accountId string) (account.TotpEnrollment, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) ConfirmTotp(accountId, code string) ([]string, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) GetProfile(actorId, accountId string) (account.Account, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) UpdateProfile(actorId, accountId string, upd account.ProfileUpdate) (account.Account, error) {
+	if actorId != accountId {
+		return account.Account{}, domain.ErrUnauthorized
+	}
+	if upd.Timezone != nil && *upd.Timezone == "Mars/Olympus" {
+		return account.Account{}, account.ErrInvalidTimezone
+	}
+	acc := account.Account{Id: accountId, Login: "alice"}
+	if upd.DisplayName != nil {
+		acc.Profile.DisplayName = *upd.DisplayName
+	}
+	return acc, nil
+}
+
+func (AccountUseCasesFake) GetAccountsByIds(ids []string) ([]account.Account, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) DeleteAccount(actorId, accountId string, mode account.DeletionMode) (job.Job, error) {
+	if actorId != accountId {
+		return job.Job{}, domain.ErrUnauthorized
+	}
+	switch mode {
+	case account.Deactivate:
+		return job.Job{}, nil
+	case account.Erase:
+		return job.Job{Id: "abc", Kind: account.EraseJobKind, State: "pending"}, nil
+	}
+	return job.Job{}, account.ErrUnknownDeletionMode
+}
+
+func (AccountUseCasesFake) FindAccountByLogin(login string) (account.Account, error) {
+	if login == "alice" {
+		return account.Account{Id: "1", Login: "alice"}, nil
+	}
+	return account.Account{}, domain.ErrNotFound
+}
+
+func (AccountUseCasesFake) SearchAccounts(query string, offset, limit int) ([]account.Account, error) {
+	if len(query) < 2 {
+		return nil, account.ErrTooShortString
+	}
+	return []account.Account{{Id: "1", Login: "alice"}}, nil
+}
+
+func (AccountUseCasesFake) CreateBot(actorId, login string) (account.Account, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) ListBots(actorId string) ([]account.Account, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) CreateApiToken(actorId, botId, name string) (account.ApiToken, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) ListApiTokens(actorId, botId string) ([]account.ApiToken, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) RevokeApiToken(src audit.Source, botId, tokenId string) error {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) ForcePasswordReset(accountId string) (string, error) {
+	panic("implement me")
+}
+
+func (AccountUseCasesFake) ResetPassword(resetToken, password string, src audit.Source) (string, error) {
 	panic("implement me")
 }
 
@@ -127,6 +237,255 @@ func Test_postSignin(t *testing.T) {
 
 		assertStatusCode(t, resp.Code, http.StatusOK)
 	})
+	t.Run("pending login for account with two-factor authentication", func(t *testing.T) {
+		m := postSignupRequestModel{
+			Login:    "carol",
+			Password: "123",
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal("failed to marshal struct")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/signin", bytes.NewReader(b))
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assertStatusCode(t, resp.Code, http.StatusAccepted)
+
+		var pending postSigninMfaPendingResponseModel
+		if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+			t.Fatal("failed to unmarshal response")
+		}
+		if pending.MfaToken != "mfa-token" {
+			t.Errorf("Server MUST return %s MFA token, but %s given", "mfa-token", pending.MfaToken)
+		}
+	})
+	t.Run("failed login after too many attempts", func(t *testing.T) {
+		m := postSignupRequestModel{
+			Login:    "mallory",
+			Password: "123",
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal("failed to marshal struct")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/signin", bytes.NewReader(b))
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assertStatusCode(t, resp.Code, http.StatusTooManyRequests)
+
+		retryAfter := resp.Header().Get("Retry-After")
+		if retryAfter != "2" {
+			t.Errorf("Server MUST return %s Retry-After header, but %s given", "2", retryAfter)
+		}
+	})
+}
+
+func Test_postSigninMfa(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	router := service.Router()
+
+	t.Run("failure on invalid json", func(t *testing.T) {
+		resp := invalidJsonTest(router, "/signin/mfa")
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("failed login with incorrect code", func(t *testing.T) {
+		m := postSigninMfaRequestModel{
+			MfaToken: "mfa-token",
+			Code:     "000000",
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal("failed to marshal struct")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/signin/mfa", bytes.NewReader(b))
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("successful login with correct code", func(t *testing.T) {
+		m := postSigninMfaRequestModel{
+			MfaToken: "mfa-token",
+			Code:     "123456",
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal("failed to marshal struct")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/signin/mfa", bytes.NewReader(b))
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assertStatusCode(t, resp.Code, http.StatusOK)
+		if resp.Body.String() != "token" {
+			t.Errorf("Server MUST return %s token, but %s given", "token", resp.Body.String())
+		}
+	})
+}
+
+func Test_patchAccount(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	router := service.Router()
+
+	patch := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer token")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("failure on someone else's account", func(t *testing.T) {
+		resp := patch("/accounts/2", `{"display-name": "Bob"}`)
+		assertStatusCode(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("failure on invalid time zone", func(t *testing.T) {
+		resp := patch("/accounts/1", `{"timezone": "Mars/Olympus"}`)
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("successful profile update", func(t *testing.T) {
+		resp := patch("/accounts/1", `{"display-name": "Alice"}`)
+		assertStatusCode(t, resp.Code, http.StatusOK)
+
+		var m getAccountResponseModel
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatal("failed to unmarshal response")
+		}
+		if m.DisplayName != "Alice" {
+			t.Errorf("Server MUST return %s display name, but %s given", "Alice", m.DisplayName)
+		}
+	})
+}
+
+func Test_getAccounts(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	router := service.Router()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("lookup of unknown login", func(t *testing.T) {
+		resp := get("/accounts?login=bob")
+		assertStatusCode(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("lookup by login", func(t *testing.T) {
+		resp := get("/accounts?login=alice")
+		assertStatusCode(t, resp.Code, http.StatusOK)
+
+		var m accountSummaryModel
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatal("failed to unmarshal response")
+		}
+		if m.Id != "1" {
+			t.Errorf("Server MUST return %s account id, but %s given", "1", m.Id)
+		}
+	})
+	t.Run("search with too short query", func(t *testing.T) {
+		resp := get("/accounts/search?q=a")
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("search with invalid limit", func(t *testing.T) {
+		resp := get("/accounts/search?q=al&limit=many")
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("search by prefix", func(t *testing.T) {
+		resp := get("/accounts/search?q=al&limit=10")
+		assertStatusCode(t, resp.Code, http.StatusOK)
+
+		var m getAccountsSearchResponseModel
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatal("failed to unmarshal response")
+		}
+		if m.Count != 1 || len(m.Accounts) != 1 {
+			t.Errorf("Server MUST return %d accounts, but %d given", 1, len(m.Accounts))
+		}
+	})
+}
+
+func Test_deleteAccount(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	router := service.Router()
+
+	del := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("failure on someone else's account", func(t *testing.T) {
+		resp := del("/accounts/2")
+		assertStatusCode(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("failure on unknown mode", func(t *testing.T) {
+		resp := del("/accounts/1?mode=forget")
+		assertStatusCode(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("successful deactivation", func(t *testing.T) {
+		resp := del("/accounts/1?mode=deactivate")
+		assertStatusCode(t, resp.Code, http.StatusNoContent)
+	})
+	t.Run("successful erasure start", func(t *testing.T) {
+		resp := del("/accounts/1?mode=erase")
+		assertStatusCode(t, resp.Code, http.StatusAccepted)
+
+		location := resp.Header().Get("Location")
+		if location != "/jobs/abc" {
+			t.Errorf("Server MUST return %s Location header, but %s given", "/jobs/abc", location)
+		}
+	})
+}
+
+type JobUseCasesFake struct {
+	job.Interface
+}
+
+func (JobUseCasesFake) GetJobStatus(jobId string) (job.Job, error) {
+	switch jobId {
+	case "abc":
+		return job.Job{Id: "abc", Kind: account.EraseJobKind, State: "running"}, nil
+	case "def":
+		return job.Job{Id: "def", Kind: export.ExportJobKind, State: "running"}, nil
+	}
+	return job.Job{}, domain.ErrNotFound
+}
+
+func Test_getJob(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	service.JobUseCases = JobUseCasesFake{}
+	router := service.Router()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("successful erasure progress", func(t *testing.T) {
+		resp := get("/jobs/abc")
+		assertStatusCode(t, resp.Code, http.StatusOK)
+	})
+	t.Run("failure on other kinds of jobs", func(t *testing.T) {
+		resp := get("/jobs/def")
+		assertStatusCode(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("failure on unknown job", func(t *testing.T) {
+		resp := get("/jobs/ghi")
+		assertStatusCode(t, resp.Code, http.StatusNotFound)
+	})
 }
 
 func assertStatusCode(t *testing.T, expectedCode, actualCode int) {
@@ -142,3 +501,98 @@ func invalidJsonTest(router http.Handler, path string) *httptest.ResponseRecorde
 	router.ServeHTTP(resp, req)
 	return resp
 }
+
+func Test_rateLimit(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, nil, nil)
+	limiter, err := NewRateLimiter([]RateLimit{{Method: http.MethodPost, Path: "/signup", Ip: "1/m"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.RateLimiter = limiter
+	router := service.Router()
+
+	signup := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/signup", bytes.NewReader([]byte(`{"login": "alice"}`)))
+		req.RemoteAddr = remoteAddr
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := signup("10.0.0.1:1000")
+	assertStatusCode(t, resp.Code, http.StatusCreated)
+	if v := resp.Header().Get("RateLimit-Remaining"); v != "0" {
+		t.Errorf("Server MUST return RateLimit-Remaining 0, but %s given", v)
+	}
+	resp = signup("10.0.0.1:1001")
+	assertStatusCode(t, resp.Code, http.StatusTooManyRequests)
+	if v := resp.Header().Get("Retry-After"); v != "60" {
+		t.Errorf("Server MUST return Retry-After 60, but %s given", v)
+	}
+	resp = signup("10.0.0.2:1000")
+	assertStatusCode(t, resp.Code, http.StatusCreated)
+}
+
+// RoomUseCasesFake has room r1 of account 1.
+type RoomUseCasesFake struct {
+	room.Interface
+}
+
+func (RoomUseCasesFake) GetRoomById(actorId, roomId string) (room.Room, error) {
+	if actorId == "1" && roomId == "r1" {
+		return room.Room{Id: "r1", Members: []string{"1"}}, nil
+	}
+	return room.Room{}, domain.ErrNotFound
+}
+
+type MessageUseCasesFake struct {
+	message.Interface
+}
+
+func (MessageUseCasesFake) CreateMessage(creatorId, roomId string, d message.Draft) (message.Message, error) {
+	return message.Message{Id: "m", Author: creatorId, Room: roomId, Text: d.Text}, nil
+}
+
+func Test_rateLimitRoom(t *testing.T) {
+	service := NewApi(&AccountUseCasesFake{}, RoomUseCasesFake{}, MessageUseCasesFake{})
+	limiter, err := NewRateLimiter([]RateLimit{{Method: http.MethodPost, Path: "/rooms/{" + roomsIdUrlPathKey + "}/messages", Room: "1/m"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.RateLimiter = limiter
+	router := service.Router()
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/rooms/r1/messages", bytes.NewReader([]byte(`{"text": "hi"}`)))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// requests of strangers don't spend tokens of the room
+	assertStatusCode(t, post("").Code, http.StatusBadRequest)
+	for i := 0; i < 3; i++ {
+		assertStatusCode(t, post("forged").Code, http.StatusUnauthorized)
+	}
+	resp := post("token")
+	assertStatusCode(t, resp.Code, http.StatusCreated)
+	if v := resp.Header().Get("RateLimit-Remaining"); v != "0" {
+		t.Errorf("Server MUST return RateLimit-Remaining 0, but %s given", v)
+	}
+	assertStatusCode(t, post("token").Code, http.StatusTooManyRequests)
+}
+
+func Test_loggedUrl(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/hooks/7/s3cret?debug=1", nil)
+	req = mux.SetURLVars(req, map[string]string{hookIdUrlPathKey: "7", hookTokenUrlPathKey: "s3cret"})
+	if got := loggedUrl(req); got != "/hooks/7/redacted?debug=1" {
+		t.Errorf("got %s logged, want the token redacted", got)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/rooms/7", nil)
+	if got := loggedUrl(req); got != "/rooms/7" {
+		t.Errorf("got %s logged, want the url as is", got)
+	}
+}
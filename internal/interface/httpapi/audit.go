@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// source describes the request for the audit log.
+func source(r *http.Request) audit.Source {
+	aid, _ := r.Context().Value(accountIdContextKey).(string)
+	return audit.Source{Actor: aid, Ip: clientIp(r), RequestId: requestIdOf(r)}
+}
+
+type auditEntryModel struct {
+	Id        string    `json:"id"`
+	ActorId   string    `json:"actor-id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details,omitempty"`
+	Ip        string    `json:"ip,omitempty"`
+	RequestId string    `json:"request-id,omitempty"`
+	CreatedAt time.Time `json:"created-at"`
+	PrevHash  string    `json:"prev-hash"`
+	Hash      string    `json:"hash"`
+}
+
+type getAdminAuditResponseModel struct {
+	Entries []auditEntryModel `json:"entries"`
+	Offset  int               `json:"offset"`
+}
+
+// getAdminAudit returns entries of the audit log newest first. They're filtered
+// by actor, action, target and time range in RFC 3339.
+func (a *Api) getAdminAudit(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	offset, err := intQueryParam(q.Get("offset"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intQueryParam(q.Get("limit"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f := audit.Filter{Actor: q.Get("actor"), Action: q.Get("action"), Target: q.Get("target")}
+	if f.Since, err = timeQueryParam(q.Get("since")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if f.Until, err = timeQueryParam(q.Get("until")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ee, err := a.AuditUseCases.ListEntries(aid, f, offset, limit)
+	if err != nil {
+		writeAuditError(w, err)
+		return
+	}
+	resp := getAdminAuditResponseModel{Entries: make([]auditEntryModel, 0, len(ee)), Offset: offset}
+	for _, e := range ee {
+		resp.Entries = append(resp.Entries, auditEntryModel{
+			Id:        e.Id,
+			ActorId:   e.Actor,
+			Action:    e.Action,
+			Target:    e.Target,
+			Details:   e.Details,
+			Ip:        e.Ip,
+			RequestId: e.RequestId,
+			CreatedAt: e.CreatedAt,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// getAdminAuditExport streams the whole log as JSON lines, oldest first.
+func (a *Api) getAdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	src := source(r)
+	sw := &exportWriter{w: w}
+	if err := a.AuditUseCases.Export(src, sw); err != nil {
+		if !sw.started {
+			writeAuditError(w, err)
+			return
+		}
+		// the status is sent already, a cut stream tells the client
+		fmt.Printf("audit export: %v; request-id: %s;\n", err, src.RequestId)
+	}
+}
+
+// exportWriter sends the headers with the first line, so failures before it
+// get a status of their own.
+type exportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	return e.w.Write(p)
+}
+
+type getAdminAuditVerifyResponseModel struct {
+	Entries  int    `json:"entries"`
+	Head     string `json:"head"`
+	Valid    bool   `json:"valid"`
+	BrokenAt string `json:"broken-at,omitempty"`
+}
+
+// getAdminAuditVerify recomputes the hash chain of the log.
+func (a *Api) getAdminAuditVerify(w http.ResponseWriter, r *http.Request) {
+	src := source(r)
+	v, err := a.AuditUseCases.Verify(src)
+	if err != nil {
+		writeAuditError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getAdminAuditVerifyResponseModel{
+		Entries:  v.Entries,
+		Head:     v.Head,
+		Valid:    v.BrokenAt == "",
+		BrokenAt: v.BrokenAt,
+	})
+}
+
+func timeQueryParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func writeAuditError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, audit.ErrNotAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, audit.ErrInvalidPaging):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
@@ -1,8 +1,13 @@
 package httpapi
 
 import (
+	"github.com/gorilla/mux"
+
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -10,13 +15,16 @@ import (
 
 func (a *Api) authenticate(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		bearHeader := r.Header.Get("Authorization")
-		strArr := strings.Split(bearHeader, " ")
-		if len(strArr) != 2 {
+		if _, ok := r.Context().Value(accountIdContextKey).(string); ok {
+			// authenticated by rate limiter already
+			next(w, r)
+			return
+		}
+		token, ok := bearerToken(r)
+		if !ok {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		token := strArr[1]
 		id, err := a.AccountUseCases.Authenticate(token)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -27,9 +35,49 @@ func (a *Api) authenticate(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+func bearerToken(r *http.Request) (string, bool) {
+	strArr := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(strArr) != 2 {
+		return "", false
+	}
+	return strArr[1], true
+}
+
+// clientIp returns the address of the peer. Forwarding headers are ignored
+// since any client can set them.
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestId tags the request with a random id, it's returned in X-Request-Id
+// and written to the log and the audit log. Ids sent by clients are ignored,
+// the audit log must not carry them.
+func (a *Api) requestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		id := hex.EncodeToString(b)
+		w.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(r.Context(), requestIdContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIdOf(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdContextKey).(string)
+	return id
+}
+
 type responseWriterObserver struct {
 	http.ResponseWriter
-	status int
+	status      int
 	wroteHeader bool
 }
 
@@ -49,16 +97,36 @@ func (o *responseWriterObserver) StatusCode() int {
 	return o.status
 }
 
+// Flush lets event streams pass through the observer.
+func (o *responseWriterObserver) Flush() {
+	if f, ok := o.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (a *Api) logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		o := &responseWriterObserver{ResponseWriter: w}
 		next.ServeHTTP(o, r)
-		fmt.Printf("method: %s; url: %s; status-code: %d; remote-addr: %s; duration: %v;\n",
-			r.Method, r.URL.String(), o.StatusCode(), r.RemoteAddr, time.Since(start))
+		fmt.Printf("method: %s; url: %s; status-code: %d; remote-addr: %s; request-id: %s; duration: %v;\n",
+			r.Method, loggedUrl(r), o.StatusCode(), r.RemoteAddr, requestIdOf(r), time.Since(start))
 	})
 }
 
+// loggedUrl returns the request url with the incoming webhook token replaced,
+// it's a secret stored only hashed.
+func loggedUrl(r *http.Request) string {
+	token := mux.Vars(r)[hookTokenUrlPathKey]
+	if token == "" || !strings.HasSuffix(r.URL.Path, "/"+token) {
+		return r.URL.String()
+	}
+	u := *r.URL
+	u.Path = strings.TrimSuffix(u.Path, token) + "redacted"
+	u.RawPath = ""
+	return u.String()
+}
+
 //"github.com/rs/zerolog/log"
 // httpLogger := log.With().Str("module", "http-server").Logger()
 //
@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/usecases/message"
+
+	"github.com/gorilla/mux"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// getRoomPins lists pinned messages of the room to its members.
+func (a *Api) getRoomPins(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	render, ok := renderOf(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msgs, err := a.MessageUseCases.ListPins(aid, rid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	a.writeMessages(w, msgs, render)
+}
+
+func (a *Api) putRoomPin(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mid, ok := vars[messageIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msg, err := a.MessageUseCases.Pin(aid, rid, mid)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+	authors, err := a.accountsByIds([]string{msg.Author})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toMessageModel(msg, authors[msg.Author], renderSource))
+}
+
+func (a *Api) deleteRoomPin(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	rid, ok := vars[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mid, ok := vars[messageIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.MessageUseCases.Unpin(aid, rid, mid); err != nil {
+		writePinError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writePinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, message.ErrNotRoomAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, message.ErrPinLimit):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		writeDomainError(w, err)
+	}
+}
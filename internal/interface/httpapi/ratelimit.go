@@ -0,0 +1,176 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/interface/prom"
+	"github.com/mp-hl-2021/chat/internal/service/ratelimit"
+
+	"github.com/gorilla/mux"
+
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Scopes requests are counted in.
+const (
+	scopeAccount = "account"
+	scopeRoom    = "room"
+	scopeIp      = "ip"
+)
+
+// RateLimit configures limits of a route, each one in ratelimit.ParseLimit
+// format. Empty limits aren't applied.
+type RateLimit struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"` // route template like /rooms/{room_id}/messages
+	Account string `json:"account"`
+	Room    string `json:"room"`
+	Ip      string `json:"ip"`
+}
+
+var DefaultRateLimits = []RateLimit{
+	{Method: http.MethodPost, Path: "/signup", Ip: "10/m:20"},
+	{Method: http.MethodPost, Path: "/signin", Ip: "30/m"},
+	{Method: http.MethodPost, Path: "/rooms/{" + roomsIdUrlPathKey + "}/messages", Account: "5/s:10", Room: "20/s:40", Ip: "50/s:100"},
+	{Method: http.MethodPost, Path: "/rooms/{" + roomsIdUrlPathKey + "}/attachments", Account: "30/m:10"},
+	{Method: http.MethodPost, Path: "/hooks/{" + hookIdUrlPathKey + "}/{" + hookTokenUrlPathKey + "}", Ip: "5/s:10"},
+}
+
+type scopedLimiter struct {
+	scope   string
+	limiter *ratelimit.Limiter
+}
+
+// RateLimiter holds token buckets of all limited routes.
+type RateLimiter struct {
+	routes map[string][]scopedLimiter // by method and path template
+}
+
+func NewRateLimiter(limits []RateLimit) (*RateLimiter, error) {
+	rl := &RateLimiter{routes: make(map[string][]scopedLimiter)}
+	for _, l := range limits {
+		key := routeKey(l.Method, l.Path)
+		for _, s := range []struct{ scope, limit string }{
+			{scopeIp, l.Ip},
+			{scopeAccount, l.Account},
+			{scopeRoom, l.Room},
+		} {
+			if s.limit == "" {
+				continue
+			}
+			limit, err := ratelimit.ParseLimit(s.limit)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s limit of %s: %w", s.scope, s.limit, key, err)
+			}
+			rl.routes[key] = append(rl.routes[key], scopedLimiter{scope: s.scope, limiter: ratelimit.New(limit)})
+		}
+	}
+	return rl, nil
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// rateLimit answers 429 when a request exceeds any limit of its route.
+// Limits are checked from the address to the room, a request limited by one
+// of them has spent tokens of the ones checked before. Only requests of room
+// members are counted in the room, so others can't spend its tokens. Every
+// response of a limited route carries RateLimit-* headers of the scope closest
+// to its limit.
+func (a *Api) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limiters := a.RateLimiter.routes[routeKey(r.Method, path)]
+		var tightest *ratelimit.Result
+		for _, l := range limiters {
+			var key string
+			switch l.scope {
+			case scopeIp:
+				key = clientIp(r)
+			case scopeRoom:
+				var id string
+				id, r = a.identified(r)
+				key = a.memberRoom(id, mux.Vars(r)[roomsIdUrlPathKey])
+			case scopeAccount:
+				key, r = a.identified(r)
+			}
+			if key == "" {
+				continue
+			}
+			res := l.limiter.Allow(key)
+			prom.ObserveRateLimit(path, l.scope, res.Allowed, l.limiter.Len())
+			if !res.Allowed {
+				writeRateLimitHeaders(w, res)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			if tightest == nil || res.Remaining < tightest.Remaining {
+				tightest = &res
+			}
+		}
+		if tightest != nil {
+			writeRateLimitHeaders(w, *tightest)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identify authenticates the request for account limits. The account id is
+// put in the context for authenticate, so the token isn't checked twice.
+// Requests which fail authentication aren't counted, they get 401 anyway.
+func (a *Api) identify(r *http.Request) (string, context.Context) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", r.Context()
+	}
+	id, err := a.AccountUseCases.Authenticate(token)
+	if err != nil {
+		return "", r.Context()
+	}
+	return id, context.WithValue(r.Context(), accountIdContextKey, id)
+}
+
+// identified returns the account found by identify, authenticating the request
+// unless an earlier limit did.
+func (a *Api) identified(r *http.Request) (string, *http.Request) {
+	if id, ok := r.Context().Value(accountIdContextKey).(string); ok {
+		return id, r
+	}
+	id, ctx := a.identify(r)
+	return id, r.WithContext(ctx)
+}
+
+// memberRoom returns the room id if the account is its member and empty string otherwise.
+func (a *Api) memberRoom(accountId, roomId string) string {
+	if accountId == "" || roomId == "" {
+		return ""
+	}
+	if _, err := a.RoomUseCases.GetRoomById(accountId, roomId); err != nil {
+		return ""
+	}
+	return roomId
+}
+
+func writeRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/usecases/retention"
+
+	"github.com/gorilla/mux"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type retentionPolicyModel struct {
+	Days     int `json:"days"`
+	KeepLast int `json:"keep-last"`
+}
+
+type retentionModel struct {
+	Room      retentionPolicyModel `json:"room"`
+	Server    retentionPolicyModel `json:"server"`
+	Effective retentionPolicyModel `json:"effective"`
+	LegalHold bool                 `json:"legal-hold"`
+}
+
+func (a *Api) getRoomRetention(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s, err := a.RetentionUseCases.GetSettings(aid, rid)
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toRetentionModel(s))
+}
+
+// putRoomRetention sets the room policy, zero fields mean no room limit.
+func (a *Api) putRoomRetention(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m retentionPolicyModel
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s, err := a.RetentionUseCases.SetPolicy(aid, rid, retention.Policy{Days: m.Days, KeepLast: m.KeepLast})
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toRetentionModel(s))
+}
+
+func (a *Api) postAdminRoomLegalHold(w http.ResponseWriter, r *http.Request) {
+	a.setLegalHold(w, r, true)
+}
+
+func (a *Api) deleteAdminRoomLegalHold(w http.ResponseWriter, r *http.Request) {
+	a.setLegalHold(w, r, false)
+}
+
+func (a *Api) setLegalHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	if _, ok := r.Context().Value(accountIdContextKey).(string); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rid, ok := mux.Vars(r)[roomsIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s, err := a.RetentionUseCases.SetLegalHold(source(r), rid, hold)
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toRetentionModel(s))
+}
+
+func writeRetentionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, retention.ErrNotRoomAdmin),
+		errors.Is(err, retention.ErrNotAdmin):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, retention.ErrInvalidPolicy):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		writeDomainError(w, err)
+	}
+}
+
+func toRetentionModel(s retention.Settings) retentionModel {
+	return retentionModel{
+		Room:      retentionPolicyModel{Days: s.Room.Days, KeepLast: s.Room.KeepLast},
+		Server:    retentionPolicyModel{Days: s.Server.Days, KeepLast: s.Server.KeepLast},
+		Effective: retentionPolicyModel{Days: s.Effective.Days, KeepLast: s.Effective.KeepLast},
+		LegalHold: s.LegalHold,
+	}
+}
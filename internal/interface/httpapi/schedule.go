@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"github.com/mp-hl-2021/chat/internal/usecases/message"
+
+	"github.com/gorilla/mux"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type scheduledMessageModel struct {
+	Id          string    `json:"id"`
+	RoomId      string    `json:"room-id"`
+	Text        string    `json:"text"`
+	Format      string    `json:"format"`
+	Attachments []string  `json:"attachments"`
+	Ttl         string    `json:"ttl,omitempty"`
+	SendAt      time.Time `json:"send-at"`
+	CreatedAt   time.Time `json:"created-at"`
+}
+
+type getScheduledMessagesResponseModel struct {
+	Messages []scheduledMessageModel `json:"messages"`
+}
+
+// getScheduledMessages lists the queue of the account, only to the account itself.
+func (a *Api) getScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, ok := mux.Vars(r)[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != aid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	mm, err := a.MessageUseCases.ListScheduled(aid)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	resp := getScheduledMessagesResponseModel{Messages: make([]scheduledMessageModel, 0, len(mm))}
+	for _, m := range mm {
+		sm := scheduledMessageModel{
+			Id:          m.Id,
+			RoomId:      m.Room,
+			Text:        m.Text,
+			Format:      m.Format,
+			Attachments: m.Attachments,
+			SendAt:      m.SendAt,
+			CreatedAt:   m.CreatedAt,
+		}
+		if m.Ttl > 0 {
+			sm.Ttl = m.Ttl.String()
+		}
+		resp.Messages = append(resp.Messages, sm)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// deleteScheduledMessage cancels the message unless it's being sent right now.
+func (a *Api) deleteScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	aid, ok := r.Context().Value(accountIdContextKey).(string)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars[accountIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id != aid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	scheduledId, ok := vars[scheduledIdUrlPathKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err := a.MessageUseCases.CancelScheduled(aid, scheduledId)
+	if errors.Is(err, message.ErrSending) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+// Package importer brings chat history from other messengers.
+package importer
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Export is a messenger independent representation of an export.
+type Export struct {
+	Source   string // name of the format, it prefixes keys in the mapping
+	Users    []User
+	Channels []Channel
+	Messages []Message
+}
+
+type User struct {
+	Id          string
+	Name        string
+	DisplayName string
+}
+
+type Channel struct {
+	Id      string
+	Name    string
+	Members []string // user ids
+}
+
+type Message struct {
+	Id        string // unique within the channel
+	Channel   string
+	User      string
+	Text      string
+	CreatedAt time.Time
+}
+
+const (
+	minLoginLength = 6
+	maxLoginLength = 32
+
+	// checkpointBatch is how many messages are imported between checkpoints.
+	checkpointBatch = 500
+)
+
+type Importer struct {
+	AccountStorage account.Interface
+	RoomStorage    room.Interface
+	MessageStorage message.Interface
+
+	// Users maps foreign user ids to logins of existing accounts. It's the only
+	// way users are matched with existing accounts, everyone else gets a new one.
+	Users map[string]string
+
+	// Checkpoint is called after every created account and room and every
+	// checkpointBatch messages, so the mapping may be saved and an interrupted
+	// import resumed. Messages are stored with their foreign ids, so the ones
+	// imported after the last checkpoint aren't imported twice either.
+	Checkpoint func(r *Report) error
+}
+
+// Run imports everything not yet present in the report mapping.
+// New accounts are created without password and can't sign in until it is reset.
+func (im *Importer) Run(e Export, r *Report) error {
+	r.init(e.Source)
+	if err := im.importUsers(e, r); err != nil {
+		return err
+	}
+	messagesByChannel := make(map[string][]Message)
+	for _, m := range e.Messages {
+		messagesByChannel[m.Channel] = append(messagesByChannel[m.Channel], m)
+	}
+	for _, c := range e.Channels {
+		roomId, err := im.importChannel(e, c, r)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", c.Name, err)
+		}
+		if err := im.importMessages(e, c, roomId, messagesByChannel[c.Id], r); err != nil {
+			return fmt.Errorf("channel %s: %w", c.Name, err)
+		}
+		if err := im.checkpoint(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *Importer) checkpoint(r *Report) error {
+	if im.Checkpoint == nil {
+		return nil
+	}
+	return im.Checkpoint(r)
+}
+
+func (im *Importer) importUsers(e Export, r *Report) error {
+	for _, u := range e.Users {
+		key := e.Source + ":" + u.Id
+		if _, ok := r.Mapping.Accounts[key]; ok {
+			continue
+		}
+		if login, ok := im.Users[u.Id]; ok {
+			acc, err := im.AccountStorage.GetAccountByLogin(login)
+			if err != nil {
+				return fmt.Errorf("user %s mapped to %s: %w", u.Name, login, err)
+			}
+			r.Mapping.Accounts[key] = acc.Id
+			r.Accounts.Matched++
+			continue
+		}
+		accountId, err := im.importUser(u)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		r.Mapping.Accounts[key] = accountId
+		r.Accounts.Created++
+		if err := im.checkpoint(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importUser creates an account for the user. Logins of existing accounts are
+// never reused, the user gets a login with id suffix instead.
+func (im *Importer) importUser(u User) (string, error) {
+	for _, login := range []string{toLogin(u.Name, u.Id), toLogin(u.Name+u.Id, u.Id)} {
+		_, err := im.AccountStorage.GetAccountByLogin(login)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			return "", err
+		}
+		acc, err := im.AccountStorage.CreateAccount(account.Credentials{Login: login})
+		if err != nil {
+			return "", err
+		}
+		if u.DisplayName != "" {
+			_, err = im.AccountStorage.UpdateAccount(acc.Id, func(a account.Account) (account.Account, error) {
+				a.Profile.DisplayName = u.DisplayName
+				return a, nil
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+		return acc.Id, nil
+	}
+	return "", errors.New("no free login")
+}
+
+func (im *Importer) importChannel(e Export, c Channel, r *Report) (string, error) {
+	members := make([]string, 0, len(c.Members))
+	for _, u := range c.Members {
+		if id, ok := r.Mapping.Accounts[e.Source+":"+u]; ok {
+			members = append(members, id)
+		}
+	}
+	if len(members) == 0 {
+		return "", errors.New("no known members")
+	}
+	key := e.Source + ":" + c.Id
+	roomId, ok := r.Mapping.Rooms[key]
+	if ok {
+		r.Rooms.Existing++
+	} else {
+		rm, err := im.RoomStorage.CreateRoom(members[0])
+		if err != nil {
+			return "", err
+		}
+		roomId = rm.Id
+		r.Mapping.Rooms[key] = roomId
+		r.Rooms.Created++
+		if err := im.checkpoint(r); err != nil {
+			return "", err
+		}
+	}
+	// note: members are added on every run, so people who joined
+	// the channel after the previous import show up as well.
+	_, err := im.RoomStorage.UpdateRoom(members[0], roomId, func(rm room.Room) (room.Room, error) {
+		present := make(map[string]bool, len(rm.Members))
+		for _, m := range rm.Members {
+			present[m] = true
+		}
+		for _, m := range members {
+			if !present[m] {
+				rm.Members = append(rm.Members, m)
+				present[m] = true
+			}
+		}
+		return rm, nil
+	})
+	return roomId, err
+}
+
+func (im *Importer) importMessages(e Export, c Channel, roomId string, mm []Message, r *Report) error {
+	sort.SliceStable(mm, func(i, j int) bool {
+		return mm[i].CreatedAt.Before(mm[j].CreatedAt)
+	})
+	for _, m := range mm {
+		key := e.Source + ":" + c.Id + ":" + m.Id
+		if _, ok := r.Mapping.Messages[key]; ok {
+			r.Messages.AlreadyImported++
+			continue
+		}
+		author, ok := r.Mapping.Accounts[e.Source+":"+m.User]
+		if !ok {
+			r.Messages.Skipped++
+			continue
+		}
+		msg, err := im.MessageStorage.CreateMessage(message.Message{
+			Author:    author,
+			Room:      roomId,
+			CreatedAt: m.CreatedAt,
+			Text:      m.Text,
+			ImportKey: key,
+		})
+		if errors.Is(err, domain.ErrAlreadyExist) {
+			// imported by a run interrupted before its checkpoint
+			r.Mapping.Messages[key] = msg.Id
+			r.Messages.AlreadyImported++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.Mapping.Messages[key] = msg.Id
+		r.Messages.Imported++
+		if r.Messages.Imported%checkpointBatch == 0 {
+			if err := im.checkpoint(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toLogin turns a foreign user name into a valid login.
+func toLogin(name, id string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	login := []rune(b.String())
+	if len(login) < minLoginLength {
+		for _, r := range strings.ToLower(id) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				login = append(login, r)
+			}
+		}
+	}
+	for len(login) < minLoginLength {
+		login = append(login, '0')
+	}
+	if len(login) > maxLoginLength {
+		// keep the end, it holds id suffix if there is one
+		login = login[len(login)-maxLoginLength:]
+	}
+	return string(login)
+}
@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSlackExport(t *testing.T, files map[string]string) string {
+	name := filepath.Join(t.TempDir(), "slack.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for n, content := range files {
+		w, err := zw.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestImporter_Slack(t *testing.T) {
+	file := writeSlackExport(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice.smith", "profile": {"display_name": "Alice"}},
+			{"id": "U2", "name": "bob", "profile": {"real_name": "Bob Brown"}}
+		]`,
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+		"general/2021-04-13.json": `[
+			{"type": "message", "user": "U2", "text": "hi <@U1>", "ts": "1618312400.000200"},
+			{"type": "message", "user": "U1", "text": "see <https://example.com|docs>", "ts": "1618312345.000100"},
+			{"type": "message", "subtype": "channel_join", "user": "U2", "text": "joined", "ts": "1618312300.000000"}
+		]`,
+	})
+	e, err := ReadSlack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := accountrepo.NewMemory()
+	rooms := roomrepo.NewMemory()
+	messages := messagerepo.NewMemory()
+	im := Importer{
+		AccountStorage: accounts,
+		RoomStorage:    rooms,
+		MessageStorage: messages,
+	}
+	report := &Report{}
+	if err := im.Run(e, report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Accounts.Created != 2 || report.Rooms.Created != 1 || report.Messages.Imported != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	alice, err := accounts.GetAccountByLogin("alicesmith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Profile.DisplayName != "Alice" {
+		t.Errorf("display name MUST be %s, but %s given", "Alice", alice.Profile.DisplayName)
+	}
+	roomId := report.Mapping.Rooms["slack:C1"]
+	mm, err := messages.ListMessages(alice.Id, roomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 2 {
+		t.Fatalf("%d messages MUST be imported, but %d given", 2, len(mm))
+	}
+	if mm[0].Text != "see docs (https://example.com)" || !mm[0].CreatedAt.Equal(time.Unix(1618312345, 100000)) {
+		t.Errorf("unexpected first message: %+v", mm[0])
+	}
+	if mm[1].Text != "hi @alicesmith" {
+		t.Errorf("unexpected second message: %+v", mm[1])
+	}
+
+	t.Run("rerun doesn't duplicate anything", func(t *testing.T) {
+		if err := im.Run(e, report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Accounts.Created != 0 || report.Rooms.Created != 0 || report.Messages.Imported != 0 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+		if report.Messages.AlreadyImported != 2 {
+			t.Errorf("%d messages MUST be already imported, but %d given", 2, report.Messages.AlreadyImported)
+		}
+		mm, err := messages.ListMessages(alice.Id, roomId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mm) != 2 {
+			t.Errorf("%d messages MUST be stored, but %d given", 2, len(mm))
+		}
+	})
+}
+
+func TestImporter_UsersAndResume(t *testing.T) {
+	e := Export{
+		Source:   "slack",
+		Users:    []User{{Id: "U1", Name: "alice"}, {Id: "U2", Name: "bobbyb"}},
+		Channels: []Channel{{Id: "C1", Name: "general", Members: []string{"U1", "U2"}}},
+		Messages: []Message{
+			{Id: "1", Channel: "C1", User: "U1", Text: "one", CreatedAt: time.Unix(1, 0)},
+			{Id: "2", Channel: "C1", User: "U2", Text: "two", CreatedAt: time.Unix(2, 0)},
+		},
+	}
+	accounts := accountrepo.NewMemory()
+	alice, err := accounts.CreateAccount(account.Credentials{Login: "alice0", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := accounts.CreateAccount(account.Credentials{Login: "bobbyb", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := messagerepo.NewMemory()
+	interrupted := errors.New("interrupted")
+	saved := &Report{}
+	im := Importer{
+		AccountStorage: accounts,
+		RoomStorage:    roomrepo.NewMemory(),
+		MessageStorage: messages,
+		Users:          map[string]string{"U1": "alice0"},
+		Checkpoint: func(r *Report) error {
+			if r.Messages.Imported > 0 {
+				return interrupted
+			}
+			// the checkpoint keeps the mapping as it was, like a saved file
+			*saved = Report{Mapping: Mapping{
+				Accounts: copyMap(r.Mapping.Accounts),
+				Rooms:    copyMap(r.Mapping.Rooms),
+				Messages: copyMap(r.Mapping.Messages),
+			}}
+			return nil
+		},
+	}
+	if err := im.Run(e, &Report{}); !errors.Is(err, interrupted) {
+		t.Fatalf("got %v, want the import interrupted", err)
+	}
+	if saved.Mapping.Accounts["slack:U1"] != alice.Id {
+		t.Errorf("mapped user MUST be matched with %s, but %s given", alice.Id, saved.Mapping.Accounts["slack:U1"])
+	}
+	if id := saved.Mapping.Accounts["slack:U2"]; id == "" || id == bob.Id {
+		t.Errorf("user with a taken login MUST get a new account, but %q given", id)
+	}
+
+	im.Checkpoint = nil
+	if err := im.Run(e, saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Messages.Imported != 0 || saved.Messages.AlreadyImported != 2 {
+		t.Errorf("resumed import MUST find both messages imported: %+v", saved.Messages)
+	}
+	mm, err := messages.ListMessages(alice.Id, saved.Mapping.Rooms["slack:C1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 2 {
+		t.Errorf("%d messages MUST be stored, but %d given", 2, len(mm))
+	}
+}
+
+func copyMap(m map[string]string) map[string]string {
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func TestReadMatrix(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "matrix.json")
+	err := os.WriteFile(name, []byte(`{
+		"room_name": "Team",
+		"messages": [
+			{"type": "m.room.member", "room_id": "!r:example.org", "sender": "@alice:example.org",
+				"state_key": "@alice:example.org", "content": {"membership": "join", "displayname": "Alice"}},
+			{"type": "m.room.message", "room_id": "!r:example.org", "sender": "@alice:example.org",
+				"event_id": "$1", "origin_server_ts": 1620000000123, "content": {"msgtype": "m.text", "body": "hello"}}
+		]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ReadMatrix(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Users) != 1 || e.Users[0].Name != "alice" || e.Users[0].DisplayName != "Alice" {
+		t.Errorf("unexpected users: %+v", e.Users)
+	}
+	if len(e.Messages) != 1 || e.Messages[0].Text != "hello" {
+		t.Fatalf("unexpected messages: %+v", e.Messages)
+	}
+	if !e.Messages[0].CreatedAt.Equal(time.Unix(1620000000, 123000000)) {
+		t.Errorf("unexpected message time: %v", e.Messages[0].CreatedAt)
+	}
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+type matrixExport struct {
+	RoomName string        `json:"room_name"`
+	Messages []matrixEvent `json:"messages"`
+}
+
+type matrixEvent struct {
+	Type           string `json:"type"`
+	EventId        string `json:"event_id"`
+	RoomId         string `json:"room_id"`
+	Sender         string `json:"sender"`
+	StateKey       string `json:"state_key"`
+	OriginServerTs int64  `json:"origin_server_ts"`
+	Content        struct {
+		MsgType     string `json:"msgtype"`
+		Body        string `json:"body"`
+		Membership  string `json:"membership"`
+		DisplayName string `json:"displayname"`
+	} `json:"content"`
+}
+
+// ReadMatrix reads a room export in JSON format as produced by Element.
+// Users are the senders and room members found in the events.
+func ReadMatrix(file string) (Export, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Export{}, err
+	}
+	defer f.Close()
+	var me matrixExport
+	if err := json.NewDecoder(f).Decode(&me); err != nil {
+		return Export{}, err
+	}
+
+	e := Export{Source: "matrix"}
+	c := Channel{Name: me.RoomName}
+	users := make(map[string]*User)
+	addUser := func(id string) *User {
+		u, ok := users[id]
+		if !ok {
+			u = &User{Id: id, Name: matrixLocalpart(id)}
+			users[id] = u
+			c.Members = append(c.Members, id)
+		}
+		return u
+	}
+	for _, ev := range me.Messages {
+		if c.Id == "" {
+			c.Id = ev.RoomId
+		}
+		switch ev.Type {
+		case "m.room.member":
+			if ev.StateKey == "" || ev.Content.Membership != "join" {
+				continue
+			}
+			u := addUser(ev.StateKey)
+			if ev.Content.DisplayName != "" {
+				u.DisplayName = ev.Content.DisplayName
+			}
+		case "m.room.message":
+			if ev.Content.MsgType != "m.text" && ev.Content.MsgType != "m.emote" && ev.Content.MsgType != "m.notice" {
+				continue
+			}
+			addUser(ev.Sender)
+			text := ev.Content.Body
+			if ev.Content.MsgType == "m.emote" {
+				text = "* " + text
+			}
+			e.Messages = append(e.Messages, Message{
+				Id:        ev.EventId,
+				Channel:   ev.RoomId,
+				User:      ev.Sender,
+				Text:      text,
+				CreatedAt: time.Unix(0, ev.OriginServerTs*int64(time.Millisecond)).UTC(),
+			})
+		}
+	}
+	if c.Id == "" {
+		return Export{}, errors.New("export has no events")
+	}
+	for _, id := range c.Members {
+		e.Users = append(e.Users, *users[id])
+	}
+	e.Channels = []Channel{c}
+	return e, nil
+}
+
+// matrixLocalpart turns "@alice:example.org" into "alice".
+func matrixLocalpart(id string) string {
+	id = strings.TrimPrefix(id, "@")
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		id = id[:i]
+	}
+	return id
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// Report describes what has been imported. Its mapping from foreign ids
+// to ours makes reruns skip already imported entities.
+type Report struct {
+	Source   string `json:"source"`
+	Accounts struct {
+		Created int `json:"created"`
+		Matched int `json:"matched"`
+	} `json:"accounts"`
+	Rooms struct {
+		Created  int `json:"created"`
+		Existing int `json:"existing"`
+	} `json:"rooms"`
+	Messages struct {
+		Imported        int `json:"imported"`
+		AlreadyImported int `json:"already-imported"`
+		Skipped         int `json:"skipped"`
+	} `json:"messages"`
+	Mapping Mapping `json:"mapping"`
+}
+
+type Mapping struct {
+	Accounts map[string]string `json:"accounts"`
+	Rooms    map[string]string `json:"rooms"`
+	Messages map[string]string `json:"messages"`
+}
+
+// LoadReport reads the report of a previous run, missing file gives an empty report.
+func LoadReport(path string) (*Report, error) {
+	r := &Report{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SaveReport replaces the file atomically.
+func SaveReport(path string, r *Report) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadUsers reads the mapping of foreign user ids to logins of existing accounts,
+// a JSON object like {"U024BE7LH": "alice"}.
+func LoadUsers(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string)
+	if err := json.Unmarshal(b, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// init resets counters of the previous run and keeps its mapping.
+func (r *Report) init(source string) {
+	mapping := r.Mapping
+	*r = Report{Source: source, Mapping: mapping}
+	if r.Mapping.Accounts == nil {
+		r.Mapping.Accounts = make(map[string]string)
+	}
+	if r.Mapping.Rooms == nil {
+		r.Mapping.Rooms = make(map[string]string)
+	}
+	if r.Mapping.Messages == nil {
+		r.Mapping.Messages = make(map[string]string)
+	}
+}
@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type slackUser struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Profile struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type slackMessage struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	User    string `json:"user"`
+	Text    string `json:"text"`
+	Ts      string `json:"ts"`
+}
+
+// slackSubtypes lists message subtypes holding user written text.
+var slackSubtypes = map[string]bool{
+	"":                 true,
+	"me_message":       true,
+	"thread_broadcast": true,
+}
+
+var (
+	slackUserMention = regexp.MustCompile(`<@([A-Z0-9]+)(\|[^>]*)?>`)
+	slackLink        = regexp.MustCompile(`<((?:https?|mailto):[^|>]+)(?:\|([^>]*))?>`)
+)
+
+// ReadSlack reads a workspace export zip: users.json, channels.json
+// and a directory with daily message files for every channel.
+func ReadSlack(file string) (Export, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return Export{}, err
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var users []slackUser
+	if err := readZipJson(files, "users.json", &users); err != nil {
+		return Export{}, err
+	}
+	var channels []slackChannel
+	if err := readZipJson(files, "channels.json", &channels); err != nil {
+		return Export{}, err
+	}
+
+	e := Export{Source: "slack"}
+	logins := make(map[string]string, len(users))
+	for _, u := range users {
+		name := u.Profile.DisplayName
+		if name == "" {
+			name = u.Profile.RealName
+		}
+		e.Users = append(e.Users, User{Id: u.Id, Name: u.Name, DisplayName: name})
+		logins[u.Id] = toLogin(u.Name, u.Id)
+	}
+	for _, c := range channels {
+		e.Channels = append(e.Channels, Channel{Id: c.Id, Name: c.Name, Members: c.Members})
+		for _, f := range zr.File {
+			if path.Dir(f.Name) != c.Name || path.Ext(f.Name) != ".json" {
+				continue
+			}
+			var mm []slackMessage
+			if err := readZipJson(files, f.Name, &mm); err != nil {
+				return Export{}, err
+			}
+			for _, m := range mm {
+				if m.Type != "message" || !slackSubtypes[m.Subtype] || m.User == "" {
+					continue
+				}
+				createdAt, err := parseSlackTs(m.Ts)
+				if err != nil {
+					return Export{}, fmt.Errorf("%s: %w", f.Name, err)
+				}
+				e.Messages = append(e.Messages, Message{
+					Id:        m.Ts,
+					Channel:   c.Id,
+					User:      m.User,
+					Text:      slackText(m.Text, logins),
+					CreatedAt: createdAt,
+				})
+			}
+		}
+	}
+	return e, nil
+}
+
+// slackText replaces slack markup with plain text.
+func slackText(text string, logins map[string]string) string {
+	text = slackUserMention.ReplaceAllStringFunc(text, func(s string) string {
+		id := slackUserMention.FindStringSubmatch(s)[1]
+		if login, ok := logins[id]; ok {
+			return "@" + login
+		}
+		return s
+	})
+	text = slackLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := slackLink.FindStringSubmatch(s)
+		if m[2] == "" || m[2] == m[1] {
+			return m[1]
+		}
+		return m[2] + " (" + m[1] + ")"
+	})
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// parseSlackTs parses message timestamps like "1618312345.000200".
+func parseSlackTs(ts string) (time.Time, error) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	var usec int64
+	if len(parts) == 2 {
+		usec, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond)).UTC(), nil
+}
+
+func readZipJson(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s not found in export", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/domain/account"
 
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -39,6 +41,24 @@ func (m *Memory) CreateAccount(cred account.Credentials) (account.Account, error
 	return a, nil
 }
 
+func (m *Memory) CreateBot(login, ownerId string) (account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.accountsByLogin[login]; ok {
+		return account.Account{}, domain.ErrAlreadyExist
+	}
+	a := account.Account{
+		Id:          strconv.FormatUint(m.nextId, 16),
+		Credentials: account.Credentials{Login: login},
+		Bot:         true,
+		BotOwner:    ownerId,
+	}
+	m.accountsById[a.Id] = a
+	m.accountsByLogin[a.Login] = a
+	m.nextId++
+	return a, nil
+}
+
 func (m *Memory) GetAccountById(id string) (account.Account, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -58,3 +78,104 @@ func (m *Memory) GetAccountByLogin(login string) (account.Account, error) {
 	}
 	return a, nil
 }
+
+func (m *Memory) GetAccountsByIds(ids []string) ([]account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	aa := make([]account.Account, 0, len(ids))
+	for _, id := range ids {
+		if a, ok := m.accountsById[id]; ok {
+			aa = append(aa, a)
+		}
+	}
+	return aa, nil
+}
+
+func (m *Memory) SearchAccounts(prefix string, offset, limit int) ([]account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.find(prefix, false, offset, limit), nil
+}
+
+func (m *Memory) ListAccounts(prefix string, offset, limit int) ([]account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.find(prefix, true, offset, limit), nil
+}
+
+func (m *Memory) CountAccounts() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.accountsById), nil
+}
+
+func (m *Memory) ListBots(ownerId string) ([]account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := make([]account.Account, 0)
+	for _, a := range m.accountsById {
+		if a.Bot && a.BotOwner == ownerId {
+			found = append(found, a)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Login < found[j].Login
+	})
+	return found, nil
+}
+
+func (m *Memory) UpdateAccount(id string, upd account.UpdateFunc) (account.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accountsById[id]
+	if !ok {
+		return a, domain.ErrNotFound
+	}
+	login, bot, botOwner := a.Login, a.Bot, a.BotOwner
+	a, err := upd(a)
+	if err != nil {
+		return a, err
+	}
+	a.Id, a.Bot, a.BotOwner = id, bot, botOwner
+	delete(m.accountsByLogin, login)
+	m.accountsById[id] = a
+	m.accountsByLogin[a.Login] = a
+	return a, nil
+}
+
+func (m *Memory) DeleteAccount(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accountsById[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.accountsById, id)
+	delete(m.accountsByLogin, a.Login)
+	return nil
+}
+
+func (m *Memory) find(prefix string, deactivated bool, offset, limit int) []account.Account {
+	prefix = strings.ToLower(prefix)
+	found := make([]account.Account, 0)
+	for _, a := range m.accountsById {
+		if a.Deactivated && !deactivated {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(a.Login), prefix) ||
+			strings.HasPrefix(strings.ToLower(a.Profile.DisplayName), prefix) {
+			found = append(found, a)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Login < found[j].Login
+	})
+	if offset >= len(found) {
+		return []account.Account{}
+	}
+	found = found[offset:]
+	if limit < len(found) {
+		found = found[:limit]
+	}
+	return found
+}
@@ -0,0 +1,70 @@
+package apitokenrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/apitoken"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	tokens []apitoken.Token // in order of creation
+	nextId uint64
+	mu     *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateToken(t apitoken.Token) (apitoken.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.tokens {
+		if existing.Hash == t.Hash {
+			return apitoken.Token{}, domain.ErrAlreadyExist
+		}
+	}
+	t.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	m.tokens = append(m.tokens, t)
+	return t, nil
+}
+
+func (m *Memory) GetTokenByHash(hash string) (apitoken.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return apitoken.Token{}, domain.ErrNotFound
+}
+
+func (m *Memory) ListTokens(accountId string) ([]apitoken.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]apitoken.Token, 0)
+	for _, t := range m.tokens {
+		if t.AccountId == accountId {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteToken(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.tokens {
+		if t.Id == id {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
@@ -0,0 +1,153 @@
+package attachmentrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Memory struct {
+	attachmentById map[string]attachment.Attachment
+	usageByRoom    map[string]int64
+	nextId         uint64
+	mu             *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		attachmentById: make(map[string]attachment.Attachment),
+		usageByRoom:    make(map[string]int64),
+		mu:             &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateAttachment(a attachment.Attachment, roomQuota int64) (attachment.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usageByRoom[a.Room]+a.Size > roomQuota {
+		return attachment.Attachment{}, attachment.ErrQuotaExceeded
+	}
+	a.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	a.Thumbnails = append([]attachment.Thumbnail(nil), a.Thumbnails...)
+	m.attachmentById[a.Id] = a
+	m.usageByRoom[a.Room] += a.Size
+	return a, nil
+}
+
+func (m *Memory) GetAttachmentById(id string) (attachment.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attachmentById[id]
+	if !ok {
+		return a, domain.ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *Memory) GetAttachmentsByIds(ids []string) ([]attachment.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	aa := make([]attachment.Attachment, 0, len(ids))
+	for _, id := range ids {
+		if a, ok := m.attachmentById[id]; ok {
+			aa = append(aa, a)
+		}
+	}
+	return aa, nil
+}
+
+// UpdateAttachment keeps room and size, so the room usage stays consistent.
+func (m *Memory) UpdateAttachment(id string, upd attachment.UpdateFunc) (attachment.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attachmentById[id]
+	if !ok {
+		return a, domain.ErrNotFound
+	}
+	a.Thumbnails = append([]attachment.Thumbnail(nil), a.Thumbnails...)
+	updated, err := upd(a)
+	if err != nil {
+		return updated, err
+	}
+	updated.Id, updated.Room, updated.Size, updated.Attached = a.Id, a.Room, a.Size, a.Attached
+	updated.Thumbnails = append([]attachment.Thumbnail(nil), updated.Thumbnails...)
+	m.attachmentById[id] = updated
+	return updated, nil
+}
+
+func (m *Memory) GetRoomUsage(roomId string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usageByRoom[roomId], nil
+}
+
+func (m *Memory) ListRoomAttachments(roomId string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0)
+	for id, a := range m.attachmentById {
+		if a.Room == roomId {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) DeleteAttachments(ids []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, id := range ids {
+		a, ok := m.attachmentById[id]
+		if !ok {
+			continue
+		}
+		m.usageByRoom[a.Room] -= a.Size
+		delete(m.attachmentById, id)
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) SetAttached(ids []string, attached bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, id := range ids {
+		a, ok := m.attachmentById[id]
+		if !ok {
+			continue
+		}
+		a.Attached = attached
+		m.attachmentById[id] = a
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) DeleteUnattached(before time.Time, limit int) ([]attachment.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	aa := make([]attachment.Attachment, 0)
+	for _, a := range m.attachmentById {
+		if !a.Attached && a.CreatedAt.Before(before) {
+			aa = append(aa, a)
+		}
+	}
+	sort.Slice(aa, func(i, j int) bool {
+		return aa[i].CreatedAt.Before(aa[j].CreatedAt)
+	})
+	if len(aa) > limit {
+		aa = aa[:limit]
+	}
+	for _, a := range aa {
+		m.usageByRoom[a.Room] -= a.Size
+		delete(m.attachmentById, a.Id)
+	}
+	return aa, nil
+}
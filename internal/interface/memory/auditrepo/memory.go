@@ -0,0 +1,61 @@
+package auditrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/audit"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	entries []audit.Entry // in order of appending
+	nextId  uint64
+	mu      *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) AppendEntry(e audit.Entry) (audit.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	e.PrevHash = ""
+	if len(m.entries) > 0 {
+		e.PrevHash = m.entries[len(m.entries)-1].Hash
+	}
+	e.Hash = e.ComputeHash()
+	m.entries = append(m.entries, e)
+	return e, nil
+}
+
+func (m *Memory) ListEntries(f audit.Filter, offset, limit int) ([]audit.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]audit.Entry, 0)
+	for i := len(m.entries) - 1; i >= 0 && len(res) < limit; i-- {
+		if !f.Match(m.entries[i]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		res = append(res, m.entries[i])
+	}
+	return res, nil
+}
+
+func (m *Memory) ReadEntries(offset, limit int) ([]audit.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]audit.Entry, 0)
+	for i := offset; i < len(m.entries) && len(res) < limit; i++ {
+		res = append(res, m.entries[i])
+	}
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package blockrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+
+	"sync"
+)
+
+type Memory struct {
+	blocks []block.Block // in order of creation
+	mu     *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateBlock(b block.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.blocks {
+		if other.Blocker == b.Blocker && other.Blocked == b.Blocked {
+			return domain.ErrAlreadyExist
+		}
+	}
+	m.blocks = append(m.blocks, b)
+	return nil
+}
+
+func (m *Memory) DeleteBlock(blockerId, blockedId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, b := range m.blocks {
+		if b.Blocker == blockerId && b.Blocked == blockedId {
+			m.blocks = append(m.blocks[:i], m.blocks[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *Memory) ListBlocks(blockerId string) ([]block.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]block.Block, 0)
+	for i := len(m.blocks) - 1; i >= 0; i-- {
+		if m.blocks[i].Blocker == blockerId {
+			res = append(res, m.blocks[i])
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) ListBlockers(blockedId string) ([]block.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]block.Block, 0)
+	for _, b := range m.blocks {
+		if b.Blocked == blockedId {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
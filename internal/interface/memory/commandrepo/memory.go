@@ -0,0 +1,81 @@
+package commandrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	commands []command.Command // in order of creation
+	nextId   uint64
+	mu       *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateCommand(c command.Command) (command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.commands {
+		if other.Room == c.Room && other.Name == c.Name {
+			return command.Command{}, domain.ErrAlreadyExist
+		}
+	}
+	c.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	m.commands = append(m.commands, c)
+	return c, nil
+}
+
+func (m *Memory) GetCommandById(id string) (command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.commands {
+		if c.Id == id {
+			return c, nil
+		}
+	}
+	return command.Command{}, domain.ErrNotFound
+}
+
+func (m *Memory) GetCommandByName(roomId, name string) (command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.commands {
+		if c.Room == roomId && c.Name == name {
+			return c, nil
+		}
+	}
+	return command.Command{}, domain.ErrNotFound
+}
+
+func (m *Memory) ListCommands(roomId string) ([]command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]command.Command, 0)
+	for _, c := range m.commands {
+		if c.Room == roomId {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteCommand(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.commands {
+		if c.Id == id {
+			m.commands = append(m.commands[:i], m.commands[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
@@ -0,0 +1,88 @@
+package filterrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	rules      []filter.Rule // in order of creation
+	flags      []filter.Flag // in order of creation
+	nextRuleId uint64
+	nextFlagId uint64
+	mu         *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateRule(r filter.Rule) (filter.Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.Id = strconv.FormatUint(m.nextRuleId, 16)
+	m.nextRuleId++
+	m.rules = append(m.rules, r)
+	return r, nil
+}
+
+func (m *Memory) GetRuleById(id string) (filter.Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rules {
+		if r.Id == id {
+			return r, nil
+		}
+	}
+	return filter.Rule{}, domain.ErrNotFound
+}
+
+func (m *Memory) ListRules(roomId string) ([]filter.Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]filter.Rule, 0)
+	for _, r := range m.rules {
+		if r.Room == roomId {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.Id == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *Memory) CreateFlag(f filter.Flag) (filter.Flag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f.Id = strconv.FormatUint(m.nextFlagId, 16)
+	m.nextFlagId++
+	m.flags = append(m.flags, f)
+	return f, nil
+}
+
+func (m *Memory) ListFlags(roomId string, limit int) ([]filter.Flag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]filter.Flag, 0)
+	for i := len(m.flags) - 1; i >= 0 && len(res) < limit; i-- {
+		if m.flags[i].Room == roomId {
+			res = append(res, m.flags[i])
+		}
+	}
+	return res, nil
+}
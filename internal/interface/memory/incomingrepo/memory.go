@@ -0,0 +1,65 @@
+package incomingrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	hooks  []incoming.Hook // in order of creation
+	nextId uint64
+	mu     *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateHook(h incoming.Hook) (incoming.Hook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	m.hooks = append(m.hooks, h)
+	return h, nil
+}
+
+func (m *Memory) GetHookById(id string) (incoming.Hook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range m.hooks {
+		if h.Id == id {
+			return h, nil
+		}
+	}
+	return incoming.Hook{}, domain.ErrNotFound
+}
+
+func (m *Memory) ListHooks(roomId string) ([]incoming.Hook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]incoming.Hook, 0)
+	for _, h := range m.hooks {
+		if h.Room == roomId {
+			res = append(res, h)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteHook(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, h := range m.hooks {
+		if h.Id == id {
+			m.hooks = append(m.hooks[:i], m.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
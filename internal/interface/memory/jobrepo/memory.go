@@ -0,0 +1,72 @@
+package jobrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/job"
+
+	"sort"
+	"sync"
+)
+
+type Memory struct {
+	jobById map[string]job.Job
+	mu      *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		jobById: make(map[string]job.Job),
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateJob(j job.Job) (job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobById[j.Id]; ok {
+		return job.Job{}, domain.ErrAlreadyExist
+	}
+	m.jobById[j.Id] = j
+	return j, nil
+}
+
+func (m *Memory) GetJobById(id string) (job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobById[id]
+	if !ok {
+		return j, domain.ErrNotFound
+	}
+	return j, nil
+}
+
+func (m *Memory) UpdateJob(id string, upd job.UpdateFunc) (job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobById[id]
+	if !ok {
+		return j, domain.ErrNotFound
+	}
+	j, err := upd(j)
+	if err != nil {
+		return j, err
+	}
+	j.Id = id
+	m.jobById[id] = j
+	return j, nil
+}
+
+func (m *Memory) ListUnfinishedJobs() ([]job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jj := make([]job.Job, 0)
+	for _, j := range m.jobById {
+		if j.State == job.StatePending || j.State == job.StateRunning {
+			jj = append(jj, j)
+		}
+	}
+	sort.Slice(jj, func(i, k int) bool {
+		return jj[i].CreatedAt.Before(jj[k].CreatedAt)
+	})
+	return jj, nil
+}
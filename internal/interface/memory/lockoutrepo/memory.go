@@ -0,0 +1,51 @@
+package lockoutrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/lockout"
+
+	"sync"
+)
+
+type Memory struct {
+	attemptsByKey map[string]lockout.Attempts
+	mu            *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		attemptsByKey: make(map[string]lockout.Attempts),
+		mu:            &sync.Mutex{},
+	}
+}
+
+func (m *Memory) GetAttempts(key string) (lockout.Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attemptsByKey[key]
+	if !ok {
+		return lockout.Attempts{Key: key}, nil
+	}
+	return a, nil
+}
+
+func (m *Memory) UpdateAttempts(key string, upd lockout.UpdateFunc) (lockout.Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attemptsByKey[key]
+	if !ok {
+		a = lockout.Attempts{Key: key}
+	}
+	a, err := upd(a)
+	if err != nil {
+		return a, err
+	}
+	m.attemptsByKey[key] = a
+	return a, nil
+}
+
+func (m *Memory) ResetAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attemptsByKey, key)
+	return nil
+}
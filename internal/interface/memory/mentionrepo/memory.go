@@ -0,0 +1,88 @@
+package mentionrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/mention"
+
+	"sync"
+)
+
+type Memory struct {
+	mentionsByAccount map[string][]mention.Mention // in order of creation
+	mu                *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mentionsByAccount: make(map[string][]mention.Mention),
+		mu:                &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateMentions(mm []mention.Mention) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mn := range mm {
+		if m.find(mn.AccountId, mn.MessageId) >= 0 {
+			continue
+		}
+		m.mentionsByAccount[mn.AccountId] = append(m.mentionsByAccount[mn.AccountId], mn)
+	}
+	return nil
+}
+
+func (m *Memory) ListMentions(accountId string, unreadOnly bool, offset, limit int) ([]mention.Mention, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := m.mentionsByAccount[accountId]
+	res := make([]mention.Mention, 0, limit)
+	for i := len(all) - 1; i >= 0 && len(res) < limit; i-- {
+		if unreadOnly && all[i].Read {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		res = append(res, all[i])
+	}
+	return res, nil
+}
+
+func (m *Memory) MarkRead(accountId string, messageIds []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make(map[string]bool, len(messageIds))
+	for _, id := range messageIds {
+		ids[id] = true
+	}
+	n := 0
+	all := m.mentionsByAccount[accountId]
+	for i := range all {
+		if !all[i].Read && (len(ids) == 0 || ids[all[i].MessageId]) {
+			all[i].Read = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) CountUnread(accountId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, mn := range m.mentionsByAccount[accountId] {
+		if !mn.Read {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) find(accountId, messageId string) int {
+	for i, mn := range m.mentionsByAccount[accountId] {
+		if mn.MessageId == messageId {
+			return i
+		}
+	}
+	return -1
+}
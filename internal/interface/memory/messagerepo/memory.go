@@ -1,8 +1,10 @@
 package messagerepo
 
 import (
+	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/domain/message"
 
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -10,6 +12,8 @@ import (
 
 type Memory struct {
 	messagesByRoom map[string][]message.Message
+	scheduled      map[string]string // ids of messages by scheduled message ids
+	imported       map[string]string // ids of messages by import keys
 	nextId         uint64
 	mu             *sync.Mutex
 }
@@ -17,25 +21,31 @@ type Memory struct {
 func NewMemory() *Memory {
 	return &Memory{
 		messagesByRoom: make(map[string][]message.Message),
+		scheduled:      make(map[string]string),
+		imported:       make(map[string]string),
 		mu:             &sync.Mutex{},
 	}
 }
 
-func (m *Memory) CreateMessage(creatorId, roomId string, text string, createdAt time.Time) (message.Message, error) {
+func (m *Memory) CreateMessage(msg message.Message) (message.Message, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	msg := message.Message{
-		Id:        strconv.FormatUint(m.nextId, 16),
-		Author:    creatorId,
-		Room:      roomId,
-		CreatedAt: createdAt,
-		Text:      text,
+	if id, ok := m.scheduled[msg.ScheduledId]; ok && msg.ScheduledId != "" {
+		return message.Message{Id: id}, domain.ErrAlreadyExist
 	}
-	msgs, ok := m.messagesByRoom[roomId]
-	if !ok {
-		m.messagesByRoom[roomId] = make([]message.Message, 0, 1)
+	if id, ok := m.imported[msg.ImportKey]; ok && msg.ImportKey != "" {
+		return message.Message{Id: id}, domain.ErrAlreadyExist
 	}
-	m.messagesByRoom[roomId] = append(msgs, msg)
+	msg.Id = strconv.FormatUint(m.nextId, 16)
+	if msg.ScheduledId != "" {
+		m.scheduled[msg.ScheduledId] = msg.Id
+	}
+	if msg.ImportKey != "" {
+		m.imported[msg.ImportKey] = msg.Id
+	}
+	msg.Attachments = append([]string(nil), msg.Attachments...)
+	msg.Entities = append([]message.Entity(nil), msg.Entities...)
+	m.messagesByRoom[msg.Room] = append(m.messagesByRoom[msg.Room], msg)
 	m.nextId++
 	return msg, nil
 }
@@ -43,9 +53,237 @@ func (m *Memory) CreateMessage(creatorId, roomId string, text string, createdAt
 func (m *Memory) ListMessages(actorId, roomId string) ([]message.Message, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	msgs, ok := m.messagesByRoom[roomId]
-	if !ok {
-		return []message.Message{}, nil
+	now := time.Now()
+	res := make([]message.Message, 0)
+	for _, msg := range m.messagesByRoom[roomId] {
+		if !msg.Expired(now) {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) GetMessagesByIds(ids []string) ([]message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	now := time.Now()
+	res := make([]message.Message, 0, len(ids))
+	for _, msgs := range m.messagesByRoom {
+		for _, msg := range msgs {
+			if wanted[msg.Id] && !msg.Expired(now) {
+				res = append(res, msg)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) AnonymizeMessages(authorId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, msgs := range m.messagesByRoom {
+		for i := range msgs {
+			if msgs[i].Author == authorId {
+				msgs[i].Author = ""
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) ListMessagesByAuthor(authorId string, except []string, limit int) ([]message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	skip := make(map[string]bool, len(except))
+	for _, id := range except {
+		skip[id] = true
+	}
+	res := make([]message.Message, 0)
+	for roomId, msgs := range m.messagesByRoom {
+		if skip[roomId] {
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Author == authorId {
+				res = append(res, msg)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteMessage(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for roomId, msgs := range m.messagesByRoom {
+		for i, msg := range msgs {
+			if msg.Id == id {
+				m.messagesByRoom[roomId] = append(msgs[:i:i], msgs[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *Memory) DeleteMessagesByRoom(roomId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.messagesByRoom[roomId])
+	delete(m.messagesByRoom, roomId)
+	return n, nil
+}
+
+func (m *Memory) ListPrunable(roomId string, before time.Time, keepLast, limit int) ([]message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := m.messagesByRoom[roomId]
+	res := make([]message.Message, 0)
+	for i, msg := range msgs {
+		if len(res) == limit {
+			break
+		}
+		if msg.Pinned {
+			continue
+		}
+		old := !before.IsZero() && msg.CreatedAt.Before(before)
+		pushedOut := keepLast > 0 && i < len(msgs)-keepLast
+		if old || pushedOut {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteMessagesByIds(ids []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	n := 0
+	for roomId, msgs := range m.messagesByRoom {
+		kept := make([]message.Message, 0, len(msgs))
+		for _, msg := range msgs {
+			if deleted[msg.Id] {
+				n++
+				continue
+			}
+			kept = append(kept, msg)
+		}
+		m.messagesByRoom[roomId] = kept
+	}
+	return n, nil
+}
+
+func (m *Memory) ListExpired(now time.Time, except []string, limit int) ([]message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	skip := make(map[string]bool, len(except))
+	for _, id := range except {
+		skip[id] = true
+	}
+	res := make([]message.Message, 0)
+	for roomId, msgs := range m.messagesByRoom {
+		if skip[roomId] {
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Expired(now) {
+				res = append(res, msg)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ExpiresAt.Before(res[j].ExpiresAt)
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (m *Memory) PinMessage(id string, limit int) (message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, err := m.find(id)
+	if err != nil || msg.Pinned {
+		return msg, err
+	}
+	now := time.Now()
+	pinned := 0
+	for _, other := range m.messagesByRoom[msg.Room] {
+		if other.Pinned && !other.Expired(now) {
+			pinned++
+		}
+	}
+	if pinned >= limit {
+		return message.Message{}, message.ErrPinLimit
+	}
+	return m.setPinned(id, true)
+}
+
+func (m *Memory) UnpinMessage(id string) (message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setPinned(id, false)
+}
+
+func (m *Memory) ListPinned(roomId string) ([]message.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	res := make([]message.Message, 0)
+	for _, msg := range m.messagesByRoom[roomId] {
+		if msg.Pinned && !msg.Expired(now) {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) find(id string) (message.Message, error) {
+	for _, msgs := range m.messagesByRoom {
+		for _, msg := range msgs {
+			if msg.Id == id {
+				return msg, nil
+			}
+		}
+	}
+	return message.Message{}, domain.ErrNotFound
+}
+
+func (m *Memory) setPinned(id string, pinned bool) (message.Message, error) {
+	for _, msgs := range m.messagesByRoom {
+		for i := range msgs {
+			if msgs[i].Id == id {
+				msgs[i].Pinned = pinned
+				return msgs[i], nil
+			}
+		}
+	}
+	return message.Message{}, domain.ErrNotFound
+}
+
+func (m *Memory) CountMessages() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, msgs := range m.messagesByRoom {
+		n += len(msgs)
 	}
-	return msgs, nil
+	return n, nil
 }
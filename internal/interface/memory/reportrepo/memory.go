@@ -0,0 +1,109 @@
+package reportrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/report"
+
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	reports      []report.Report // in order of creation
+	actions      []report.Action // in order of creation
+	nextId       uint64
+	nextActionId uint64
+	mu           *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateReport(r report.Report) (report.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	m.reports = append(m.reports, r)
+	return r, nil
+}
+
+func (m *Memory) GetReportById(id string) (report.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.reports {
+		if r.Id == id {
+			return r, nil
+		}
+	}
+	return report.Report{}, domain.ErrNotFound
+}
+
+func (m *Memory) ListReports(status string, limit int) ([]report.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]report.Report, 0)
+	for _, r := range m.reports {
+		if len(res) == limit {
+			break
+		}
+		if status == "" || r.Status == status {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) CountReports(status string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.reports {
+		if status == "" || r.Status == status {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) UpdateReport(id string, upd report.UpdateFunc) (report.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.reports {
+		if r.Id != id {
+			continue
+		}
+		r, err := upd(r)
+		if err != nil {
+			return r, err
+		}
+		r.Id = id
+		m.reports[i] = r
+		return r, nil
+	}
+	return report.Report{}, domain.ErrNotFound
+}
+
+func (m *Memory) CreateAction(a report.Action) (report.Action, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a.Id = strconv.FormatUint(m.nextActionId, 16)
+	m.nextActionId++
+	m.actions = append(m.actions, a)
+	return a, nil
+}
+
+func (m *Memory) ListActions(reportId string) ([]report.Action, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]report.Action, 0)
+	for _, a := range m.actions {
+		if a.Report == reportId {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
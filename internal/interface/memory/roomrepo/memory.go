@@ -4,22 +4,23 @@ import (
 	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/domain/room"
 
+	"sort"
 	"strconv"
 	"sync"
 )
 
 type Memory struct {
-	roomById         map[string]room.Room
-	roomsByAccountId map[string]map[string]room.Room
-	nextId           uint64
-	mu               *sync.Mutex
+	roomById           map[string]room.Room
+	roomIdsByAccountId map[string]map[string]struct{}
+	nextId             uint64
+	mu                 *sync.Mutex
 }
 
 func NewMemory() *Memory {
 	return &Memory{
-		roomById:         make(map[string]room.Room),
-		roomsByAccountId: make(map[string]map[string]room.Room),
-		mu:               &sync.Mutex{},
+		roomById:           make(map[string]room.Room),
+		roomIdsByAccountId: make(map[string]map[string]struct{}),
+		mu:                 &sync.Mutex{},
 	}
 }
 
@@ -32,13 +33,7 @@ func (m *Memory) CreateRoom(creatorId string) (room.Room, error) {
 		Members: []string{creatorId},
 	}
 	m.roomById[r.Id] = r
-	accountRooms, ok := m.roomsByAccountId[creatorId]
-	if !ok {
-		accountRooms = make(map[string]room.Room)
-	}
-	accountRooms[r.Id] = r
-	m.roomsByAccountId[creatorId] = accountRooms
-	m.roomById[r.Id] = r
+	m.index(r.Id, nil, r.Members)
 	m.nextId++
 	return r, nil
 }
@@ -46,13 +41,17 @@ func (m *Memory) CreateRoom(creatorId string) (room.Room, error) {
 func (m *Memory) GetRoomById(actorId, roomId string) (room.Room, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.getRoomById(actorId, roomId)
+}
+
+func (m *Memory) getRoomById(actorId, roomId string) (room.Room, error) {
 	r, ok := m.roomById[roomId]
 	if !ok {
 		return r, domain.ErrNotFound
 	}
 	for _, member := range r.Members {
 		if member == actorId {
-			return r, nil
+			return copyRoom(r), nil
 		}
 	}
 	return r, domain.ErrUnauthorized
@@ -61,29 +60,137 @@ func (m *Memory) GetRoomById(actorId, roomId string) (room.Room, error) {
 func (m *Memory) UpdateRoom(actorId, roomId string, upd room.UpdateFunc) (room.Room, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	r, err := m.GetRoomById(actorId, roomId)
+	r, err := m.getRoomById(actorId, roomId)
 	if err != nil {
 		return r, err
 	}
-	r, err = upd(r)
+	oldMembers, hold := r.Members, r.LegalHold
+	r, err = upd(copyRoom(r))
 	if err != nil {
 		return r, err
 	}
+	r.LegalHold = hold // only SetLegalHold changes it
 	m.roomById[roomId] = r
-	m.roomsByAccountId[actorId][roomId] = r
+	m.index(roomId, oldMembers, r.Members)
 	return r, nil
 }
 
 func (m *Memory) ListRooms(accountId string) ([]room.Room, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	rm, ok := m.roomsByAccountId[accountId]
+	ids := m.roomIdsByAccountId[accountId]
+	rr := make([]room.Room, 0, len(ids))
+	for id := range ids {
+		rr = append(rr, copyRoom(m.roomById[id]))
+	}
+	return rr, nil
+}
+
+// index keeps rooms by account index in sync with room members.
+func (m *Memory) index(roomId string, oldMembers, newMembers []string) {
+	for _, id := range oldMembers {
+		delete(m.roomIdsByAccountId[id], roomId)
+	}
+	for _, id := range newMembers {
+		ids, ok := m.roomIdsByAccountId[id]
+		if !ok {
+			ids = make(map[string]struct{})
+			m.roomIdsByAccountId[id] = ids
+		}
+		ids[roomId] = struct{}{}
+	}
+}
+
+// copyRoom prevents callers from modifying stored members in place.
+func copyRoom(r room.Room) room.Room {
+	r.Members = append([]string(nil), r.Members...)
+	return r
+}
+
+func (m *Memory) InspectRoom(roomId string) (room.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.roomById[roomId]
 	if !ok {
-		return nil, domain.ErrNotFound
+		return r, domain.ErrNotFound
+	}
+	return copyRoom(r), nil
+}
+
+func (m *Memory) DeleteRoom(roomId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.roomById[roomId]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	m.index(roomId, r.Members, nil)
+	delete(m.roomById, roomId)
+	return nil
+}
+
+func (m *Memory) CountRooms() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.roomById), nil
+}
+
+func (m *Memory) SetLegalHold(roomId string, hold bool) (room.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.roomById[roomId]
+	if !ok {
+		return r, domain.ErrNotFound
+	}
+	r.LegalHold = hold
+	m.roomById[roomId] = r
+	return copyRoom(r), nil
+}
+
+func (m *Memory) RemoveMember(roomId, accountId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.roomById[roomId]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	members := make([]string, 0, len(r.Members))
+	for _, id := range r.Members {
+		if id != accountId {
+			members = append(members, id)
+		}
+	}
+	oldMembers := r.Members
+	r.Members = members
+	m.roomById[roomId] = r
+	m.index(roomId, oldMembers, r.Members)
+	return nil
+}
+
+func (m *Memory) ListHeldRooms() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0)
+	for id, r := range m.roomById {
+		if r.LegalHold {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) ListAllRooms(offset, limit int) ([]room.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]uint64, 0, len(m.roomById))
+	for id := range m.roomById {
+		n, _ := strconv.ParseUint(id, 16, 64)
+		ids = append(ids, n)
 	}
-	rr := make([]room.Room, 0, len(rm))
-	for _, val := range rm {
-		rr = append(rr, val)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	rr := make([]room.Room, 0)
+	for i := offset; i < len(ids) && len(rr) < limit; i++ {
+		rr = append(rr, copyRoom(m.roomById[strconv.FormatUint(ids[i], 16)]))
 	}
 	return rr, nil
 }
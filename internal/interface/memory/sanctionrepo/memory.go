@@ -0,0 +1,128 @@
+package sanctionrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+
+	"sort"
+	"sync"
+	"time"
+)
+
+type key struct {
+	room    string
+	account string
+}
+
+type Memory struct {
+	bans  map[key]sanction.Ban
+	mutes map[key]sanction.Mute
+	mu    *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		bans:  make(map[key]sanction.Ban),
+		mutes: make(map[key]sanction.Mute),
+		mu:    &sync.Mutex{},
+	}
+}
+
+func (m *Memory) PutBan(b sanction.Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bans[key{b.Room, b.Account}] = b
+	return nil
+}
+
+func (m *Memory) GetBan(roomId, accountId string) (sanction.Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.bans[key{roomId, accountId}]
+	if !ok {
+		return b, domain.ErrNotFound
+	}
+	return b, nil
+}
+
+func (m *Memory) ListBans(roomId string) ([]sanction.Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]sanction.Ban, 0)
+	for k, b := range m.bans {
+		if k.room == roomId {
+			res = append(res, b)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (m *Memory) DeleteBan(roomId, accountId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{roomId, accountId}
+	if _, ok := m.bans[k]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.bans, k)
+	return nil
+}
+
+func (m *Memory) PutMute(mute sanction.Mute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mutes[key{mute.Room, mute.Account}] = mute
+	return nil
+}
+
+func (m *Memory) GetMute(roomId, accountId string) (sanction.Mute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mute, ok := m.mutes[key{roomId, accountId}]
+	if !ok {
+		return mute, domain.ErrNotFound
+	}
+	return mute, nil
+}
+
+func (m *Memory) ListMutes(roomId string) ([]sanction.Mute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]sanction.Mute, 0)
+	for k, mute := range m.mutes {
+		if k.room == roomId {
+			res = append(res, mute)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (m *Memory) DeleteMute(roomId, accountId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{roomId, accountId}
+	if _, ok := m.mutes[k]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.mutes, k)
+	return nil
+}
+
+func (m *Memory) DeleteExpiredMutes(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, mute := range m.mutes {
+		if mute.Until.Before(now) {
+			delete(m.mutes, k)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package schedulerepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/schedule"
+
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Memory struct {
+	messagesById map[string]schedule.Message
+	nextId       uint64
+	mu           *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		messagesById: make(map[string]schedule.Message),
+		mu:           &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateScheduled(msg schedule.Message) (schedule.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg.Id = strconv.FormatUint(m.nextId, 16)
+	msg.Attachments = append([]string(nil), msg.Attachments...)
+	m.messagesById[msg.Id] = msg
+	m.nextId++
+	return msg, nil
+}
+
+func (m *Memory) GetScheduledById(id string) (schedule.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, ok := m.messagesById[id]
+	if !ok {
+		return schedule.Message{}, domain.ErrNotFound
+	}
+	return msg, nil
+}
+
+func (m *Memory) ListScheduledByAuthor(authorId string) ([]schedule.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]schedule.Message, 0)
+	for _, msg := range m.messagesById {
+		if msg.Author == authorId {
+			res = append(res, msg)
+		}
+	}
+	sortBySendAt(res)
+	return res, nil
+}
+
+func (m *Memory) CancelScheduled(id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, ok := m.messagesById[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	if now.Before(msg.LeaseUntil) {
+		return schedule.ErrLeased
+	}
+	delete(m.messagesById, id)
+	return nil
+}
+
+func (m *Memory) DeleteScheduled(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.messagesById[id]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.messagesById, id)
+	return nil
+}
+
+func (m *Memory) DeleteScheduledByAuthor(authorId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, msg := range m.messagesById {
+		if msg.Author == authorId {
+			delete(m.messagesById, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) ClaimDue(owner string, now, leaseUntil time.Time, limit int) ([]schedule.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := make([]schedule.Message, 0)
+	for _, msg := range m.messagesById {
+		if !msg.SendAt.After(now) && !now.Before(msg.LeaseUntil) {
+			due = append(due, msg)
+		}
+	}
+	sortBySendAt(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].LeaseOwner = owner
+		due[i].LeaseUntil = leaseUntil
+		m.messagesById[due[i].Id] = due[i]
+	}
+	return due, nil
+}
+
+func sortBySendAt(mm []schedule.Message) {
+	sort.Slice(mm, func(i, j int) bool {
+		if mm[i].SendAt.Equal(mm[j].SendAt) {
+			return mm[i].CreatedAt.Before(mm[j].CreatedAt)
+		}
+		return mm[i].SendAt.Before(mm[j].SendAt)
+	})
+}
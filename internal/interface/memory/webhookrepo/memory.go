@@ -0,0 +1,123 @@
+package webhookrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type Memory struct {
+	webhookById         map[string]webhook.Webhook
+	deliveriesByWebhook map[string][]webhook.Delivery // in order of creation
+	nextId              uint64
+	nextDeliveryId      uint64
+	mu                  *sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		webhookById:         make(map[string]webhook.Webhook),
+		deliveriesByWebhook: make(map[string][]webhook.Delivery),
+		mu:                  &sync.Mutex{},
+	}
+}
+
+func (m *Memory) CreateWebhook(w webhook.Webhook) (webhook.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Id = strconv.FormatUint(m.nextId, 16)
+	m.nextId++
+	w.Events = append([]string(nil), w.Events...)
+	m.webhookById[w.Id] = w
+	return w, nil
+}
+
+func (m *Memory) GetWebhookById(id string) (webhook.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.webhookById[id]
+	if !ok {
+		return w, domain.ErrNotFound
+	}
+	w.Events = append([]string(nil), w.Events...)
+	return w, nil
+}
+
+func (m *Memory) ListWebhooks(roomId string) ([]webhook.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ww := make([]webhook.Webhook, 0)
+	for _, w := range m.webhookById {
+		if w.Room == roomId {
+			w.Events = append([]string(nil), w.Events...)
+			ww = append(ww, w)
+		}
+	}
+	sortById(ww)
+	return ww, nil
+}
+
+// UpdateWebhook keeps id, room and creator of the webhook.
+func (m *Memory) UpdateWebhook(id string, upd webhook.UpdateFunc) (webhook.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.webhookById[id]
+	if !ok {
+		return w, domain.ErrNotFound
+	}
+	w.Events = append([]string(nil), w.Events...)
+	updated, err := upd(w)
+	if err != nil {
+		return updated, err
+	}
+	updated.Id, updated.Room, updated.Creator = w.Id, w.Room, w.Creator
+	updated.Events = append([]string(nil), updated.Events...)
+	m.webhookById[id] = updated
+	return updated, nil
+}
+
+func (m *Memory) DeleteWebhook(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhookById[id]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.webhookById, id)
+	delete(m.deliveriesByWebhook, id)
+	return nil
+}
+
+func (m *Memory) CreateDelivery(d webhook.Delivery) (webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhookById[d.Webhook]; !ok {
+		return d, domain.ErrNotFound
+	}
+	d.Id = strconv.FormatUint(m.nextDeliveryId, 16)
+	m.nextDeliveryId++
+	m.deliveriesByWebhook[d.Webhook] = append(m.deliveriesByWebhook[d.Webhook], d)
+	return d, nil
+}
+
+func (m *Memory) ListDeliveries(webhookId string, limit int) ([]webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := m.deliveriesByWebhook[webhookId]
+	res := make([]webhook.Delivery, 0, limit)
+	for i := len(all) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, all[i])
+	}
+	return res, nil
+}
+
+// sortById orders webhooks by creation, ids are hex counters.
+func sortById(ww []webhook.Webhook) {
+	sort.Slice(ww, func(i, j int) bool {
+		a, _ := strconv.ParseUint(ww[i].Id, 16, 64)
+		b, _ := strconv.ParseUint(ww[j].Id, 16, 64)
+		return a < b
+	})
+}
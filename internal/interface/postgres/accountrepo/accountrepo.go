@@ -1,8 +1,13 @@
 package accountrepo
 
 import (
-	"database/sql"
+	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/domain/account"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"strings"
 )
 
 type Postgres struct {
@@ -31,40 +36,333 @@ func (p *Postgres) CreateAccount(cred account.Credentials) (account.Account, err
 	return a, err
 }
 
+const queryCreateBot = `
+	INSERT INTO accounts(
+		login,
+		password,
+		bot,
+		botOwner
+	) VALUES ($1, '', true, $2)
+	RETURNING id
+`
+
+func (p *Postgres) CreateBot(login, ownerId string) (account.Account, error) {
+	a := account.Account{Credentials: account.Credentials{Login: login}, Bot: true, BotOwner: ownerId}
+	err := p.conn.QueryRow(queryCreateBot, login, ownerId).Scan(&a.Id)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		return account.Account{}, domain.ErrAlreadyExist
+	}
+	return a, err
+}
+
 const queryGetAccountById = `
 	SELECT
 		id,
 		login,
-		password
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
 	FROM accounts
 	WHERE id = $1
 `
 
 func (p *Postgres) GetAccountById(id string) (account.Account, error) {
-	a := account.Account{}
-	row := p.conn.QueryRow(queryGetAccountById, id)
-	err := row.Scan(&a.Id, &a.Login, &a.Password)
-	if err != nil && err == sql.ErrNoRows {
-		return a, err // todo: make error wrappers (notFound)
-	}
-	return a, err
+	return scanAccount(p.conn.QueryRow(queryGetAccountById, id))
 }
 
 const queryGetAccountByLogin = `
 	SELECT
 		id,
 		login,
-		password
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
 	FROM accounts
 	WHERE login = $1
 `
 
 func (p *Postgres) GetAccountByLogin(login string) (account.Account, error) {
+	return scanAccount(p.conn.QueryRow(queryGetAccountByLogin, login))
+}
+
+const queryGetAccountsByIds = `
+	SELECT
+		id,
+		login,
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
+	FROM accounts
+	WHERE id = ANY($1::int[])
+`
+
+func (p *Postgres) GetAccountsByIds(ids []string) ([]account.Account, error) {
+	rows, err := p.conn.Query(queryGetAccountsByIds, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+const querySearchAccounts = `
+	SELECT
+		id,
+		login,
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
+	FROM accounts
+	WHERE (lower(login) LIKE $1 OR lower(displayName) LIKE $1) AND NOT deactivated
+	ORDER BY login
+	OFFSET $2
+	LIMIT $3
+`
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (p *Postgres) SearchAccounts(prefix string, offset, limit int) ([]account.Account, error) {
+	pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+	rows, err := p.conn.Query(querySearchAccounts, pattern, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+const queryListAccounts = `
+	SELECT
+		id,
+		login,
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
+	FROM accounts
+	WHERE lower(login) LIKE $1 OR lower(displayName) LIKE $1
+	ORDER BY login
+	OFFSET $2
+	LIMIT $3
+`
+
+func (p *Postgres) ListAccounts(prefix string, offset, limit int) ([]account.Account, error) {
+	pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+	rows, err := p.conn.Query(queryListAccounts, pattern, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+const queryCountAccounts = `SELECT count(*) FROM accounts`
+
+func (p *Postgres) CountAccounts() (int, error) {
+	var n int
+	err := p.conn.QueryRow(queryCountAccounts).Scan(&n)
+	return n, err
+}
+
+const queryListBots = `
+	SELECT
+		id,
+		login,
+		password,
+		totpSecret,
+		totpEnabled,
+		totpLastStep,
+		recoveryCodes,
+		displayName,
+		bio,
+		avatar,
+		status,
+		timezone,
+		deactivated,
+		bot,
+		botOwner,
+		role,
+		suspended,
+		resetTokenHash,
+		resetExpiresAt
+	FROM accounts
+	WHERE bot AND botOwner = $1
+	ORDER BY login
+`
+
+func (p *Postgres) ListBots(ownerId string) ([]account.Account, error) {
+	rows, err := p.conn.Query(queryListBots, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+const queryGetAccountByIdForUpdate = queryGetAccountById + `
+	FOR UPDATE
+`
+
+const queryUpdateAccount = `
+	UPDATE accounts SET
+		login = $2,
+		password = $3,
+		totpSecret = $4,
+		totpEnabled = $5,
+		totpLastStep = $6,
+		recoveryCodes = $7,
+		displayName = $8,
+		bio = $9,
+		avatar = $10,
+		status = $11,
+		timezone = $12,
+		deactivated = $13,
+		role = $14,
+		suspended = $15,
+		resetTokenHash = $16,
+		resetExpiresAt = $17,
+		updatedAt = now()
+	WHERE id = $1
+`
+
+// UpdateAccount keeps id and bot fields of the account.
+func (p *Postgres) UpdateAccount(id string, upd account.UpdateFunc) (account.Account, error) {
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return account.Account{}, err
+	}
+	defer tx.Rollback()
+	a, err := scanAccount(tx.QueryRow(queryGetAccountByIdForUpdate, id))
+	if err != nil {
+		return a, err
+	}
+	bot, botOwner := a.Bot, a.BotOwner
+	a, err = upd(a)
+	if err != nil {
+		return a, err
+	}
+	a.Id, a.Bot, a.BotOwner = id, bot, botOwner
+	_, err = tx.Exec(queryUpdateAccount, a.Id, a.Login, a.Password,
+		a.Totp.Secret, a.Totp.Enabled, a.Totp.LastStep, pq.Array(a.Totp.RecoveryCodes),
+		a.Profile.DisplayName, a.Profile.Bio, a.Profile.Avatar, a.Profile.Status, a.Profile.Timezone,
+		a.Deactivated, a.Role, a.Suspended, a.Reset.TokenHash, a.Reset.ExpiresAt)
+	if err != nil {
+		return a, err
+	}
+	return a, tx.Commit()
+}
+
+const queryDeleteAccount = `
+	DELETE FROM accounts
+	WHERE id = $1
+`
+
+func (p *Postgres) DeleteAccount(id string) error {
+	res, err := p.conn.Exec(queryDeleteAccount, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccount(row scanner) (account.Account, error) {
 	a := account.Account{}
-	row := p.conn.QueryRow(queryGetAccountByLogin, login)
-	err := row.Scan(&a.Id, &a.Login, &a.Password)
-	if err != nil && err == sql.ErrNoRows {
-		return a, err // todo: make error wrappers (notFound)
+	err := row.Scan(&a.Id, &a.Login, &a.Password,
+		&a.Totp.Secret, &a.Totp.Enabled, &a.Totp.LastStep, pq.Array(&a.Totp.RecoveryCodes),
+		&a.Profile.DisplayName, &a.Profile.Bio, &a.Profile.Avatar, &a.Profile.Status, &a.Profile.Timezone,
+		&a.Deactivated, &a.Bot, &a.BotOwner, &a.Role, &a.Suspended,
+		&a.Reset.TokenHash, &a.Reset.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return a, domain.ErrNotFound
 	}
 	return a, err
 }
+
+func scanAccounts(rows *sql.Rows) ([]account.Account, error) {
+	defer rows.Close()
+	aa := make([]account.Account, 0)
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+	return aa, rows.Err()
+}
@@ -0,0 +1,122 @@
+package apitokenrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/apitoken"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateToken = `
+	INSERT INTO api_tokens(
+		accountId,
+		name,
+		hash,
+		createdAt
+	) VALUES ($1, $2, $3, $4)
+	RETURNING id
+`
+
+func (p *Postgres) CreateToken(t apitoken.Token) (apitoken.Token, error) {
+	err := p.conn.QueryRow(queryCreateToken, t.AccountId, t.Name, t.Hash, t.CreatedAt).Scan(&t.Id)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		return apitoken.Token{}, domain.ErrAlreadyExist
+	}
+	return t, err
+}
+
+const queryGetTokenByHash = `
+	SELECT
+		id,
+		accountId,
+		name,
+		hash,
+		createdAt
+	FROM api_tokens
+	WHERE hash = $1
+`
+
+func (p *Postgres) GetTokenByHash(hash string) (apitoken.Token, error) {
+	return scanToken(p.conn.QueryRow(queryGetTokenByHash, hash))
+}
+
+const queryListTokens = `
+	SELECT
+		id,
+		accountId,
+		name,
+		hash,
+		createdAt
+	FROM api_tokens
+	WHERE accountId = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListTokens(accountId string) ([]apitoken.Token, error) {
+	rows, err := p.conn.Query(queryListTokens, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tt := make([]apitoken.Token, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tt = append(tt, t)
+	}
+	return tt, rows.Err()
+}
+
+const queryDeleteToken = `
+	DELETE FROM api_tokens WHERE id = $1
+`
+
+func (p *Postgres) DeleteToken(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteToken, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (apitoken.Token, error) {
+	t := apitoken.Token{}
+	err := row.Scan(&t.Id, &t.AccountId, &t.Name, &t.Hash, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return t, domain.ErrNotFound
+	}
+	return t, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,324 @@
+package attachmentrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+// queryLockRoomUsage serializes uploads to the same room
+// so concurrent uploads can't exceed the quota together.
+const queryLockRoomUsage = `
+	SELECT pg_advisory_xact_lock(hashtext('attachments:' || $1))
+`
+
+const queryGetRoomUsage = `
+	SELECT COALESCE(SUM(size), 0)
+	FROM attachments
+	WHERE room = $1
+`
+
+const queryCreateAttachment = `
+	INSERT INTO attachments(
+		room,
+		owner,
+		filename,
+		mimeType,
+		size,
+		checksum,
+		blobKey,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+`
+
+func (p *Postgres) CreateAttachment(a attachment.Attachment, roomQuota int64) (attachment.Attachment, error) {
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(queryLockRoomUsage, a.Room); err != nil {
+		return attachment.Attachment{}, err
+	}
+	var usage int64
+	if err := tx.QueryRow(queryGetRoomUsage, a.Room).Scan(&usage); err != nil {
+		return attachment.Attachment{}, err
+	}
+	if usage+a.Size > roomQuota {
+		return attachment.Attachment{}, attachment.ErrQuotaExceeded
+	}
+	err = tx.QueryRow(queryCreateAttachment, a.Room, a.Owner, a.Filename, a.MimeType,
+		a.Size, a.Checksum, a.BlobKey, a.CreatedAt).Scan(&a.Id)
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	return a, tx.Commit()
+}
+
+const queryGetAttachmentById = `
+	SELECT
+		id,
+		room,
+		owner,
+		filename,
+		mimeType,
+		size,
+		checksum,
+		blobKey,
+		createdAt,
+		width,
+		height,
+		placeholder,
+		thumbnails,
+		attached
+	FROM attachments
+	WHERE id = $1
+`
+
+func (p *Postgres) GetAttachmentById(id string) (attachment.Attachment, error) {
+	if !validId(id) {
+		return attachment.Attachment{}, domain.ErrNotFound
+	}
+	return scanAttachment(p.conn.QueryRow(queryGetAttachmentById, id))
+}
+
+const queryGetAttachmentsByIds = `
+	SELECT
+		id,
+		room,
+		owner,
+		filename,
+		mimeType,
+		size,
+		checksum,
+		blobKey,
+		createdAt,
+		width,
+		height,
+		placeholder,
+		thumbnails,
+		attached
+	FROM attachments
+	WHERE id = ANY($1::int[])
+`
+
+func (p *Postgres) GetAttachmentsByIds(ids []string) ([]attachment.Attachment, error) {
+	rows, err := p.conn.Query(queryGetAttachmentsByIds, pq.Array(validIds(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aa := make([]attachment.Attachment, 0, len(ids))
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+	return aa, rows.Err()
+}
+
+const queryGetAttachmentByIdForUpdate = queryGetAttachmentById + `
+	FOR UPDATE
+`
+
+const queryUpdateAttachment = `
+	UPDATE attachments SET
+		filename = $2,
+		mimeType = $3,
+		width = $4,
+		height = $5,
+		placeholder = $6,
+		thumbnails = $7
+	WHERE id = $1
+`
+
+// UpdateAttachment keeps room and size, so the room usage stays consistent.
+// Whether the attachment is attached is changed by SetAttached only.
+func (p *Postgres) UpdateAttachment(id string, upd attachment.UpdateFunc) (attachment.Attachment, error) {
+	if !validId(id) {
+		return attachment.Attachment{}, domain.ErrNotFound
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	defer tx.Rollback()
+	a, err := scanAttachment(tx.QueryRow(queryGetAttachmentByIdForUpdate, id))
+	if err != nil {
+		return a, err
+	}
+	updated, err := upd(a)
+	if err != nil {
+		return updated, err
+	}
+	updated.Id, updated.Room, updated.Size, updated.Attached = a.Id, a.Room, a.Size, a.Attached
+	if updated.Thumbnails == nil {
+		updated.Thumbnails = []attachment.Thumbnail{}
+	}
+	thumbnails, err := json.Marshal(updated.Thumbnails)
+	if err != nil {
+		return updated, err
+	}
+	_, err = tx.Exec(queryUpdateAttachment, updated.Id, updated.Filename, updated.MimeType,
+		updated.Width, updated.Height, updated.Placeholder, string(thumbnails))
+	if err != nil {
+		return updated, err
+	}
+	return updated, tx.Commit()
+}
+
+func (p *Postgres) GetRoomUsage(roomId string) (int64, error) {
+	var usage int64
+	err := p.conn.QueryRow(queryGetRoomUsage, roomId).Scan(&usage)
+	return usage, err
+}
+
+const queryListRoomAttachments = `
+	SELECT id
+	FROM attachments
+	WHERE room = $1
+`
+
+func (p *Postgres) ListRoomAttachments(roomId string) ([]string, error) {
+	rows, err := p.conn.Query(queryListRoomAttachments, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const queryDeleteAttachments = `
+	DELETE FROM attachments
+	WHERE id = ANY($1::int[])
+`
+
+func (p *Postgres) DeleteAttachments(ids []string) (int, error) {
+	res, err := p.conn.Exec(queryDeleteAttachments, pq.Array(validIds(ids)))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const querySetAttached = `
+	UPDATE attachments SET
+		attached = $2
+	WHERE id = ANY($1::int[])
+`
+
+func (p *Postgres) SetAttached(ids []string, attached bool) (int, error) {
+	res, err := p.conn.Exec(querySetAttached, pq.Array(validIds(ids)), attached)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// queryDeleteUnattached checks attached again on delete, so an attachment
+// attached to a message meanwhile stays.
+const queryDeleteUnattached = `
+	DELETE FROM attachments
+	WHERE id IN (
+		SELECT id FROM attachments
+		WHERE NOT attached AND createdAt < $1
+		ORDER BY createdAt
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	) AND NOT attached
+	RETURNING
+		id,
+		room,
+		owner,
+		filename,
+		mimeType,
+		size,
+		checksum,
+		blobKey,
+		createdAt,
+		width,
+		height,
+		placeholder,
+		thumbnails,
+		attached
+`
+
+func (p *Postgres) DeleteUnattached(before time.Time, limit int) ([]attachment.Attachment, error) {
+	rows, err := p.conn.Query(queryDeleteUnattached, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aa := make([]attachment.Attachment, 0)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+	return aa, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(row scanner) (attachment.Attachment, error) {
+	a := attachment.Attachment{}
+	var thumbnails string
+	err := row.Scan(&a.Id, &a.Room, &a.Owner, &a.Filename, &a.MimeType,
+		&a.Size, &a.Checksum, &a.BlobKey, &a.CreatedAt,
+		&a.Width, &a.Height, &a.Placeholder, &thumbnails, &a.Attached)
+	if err == sql.ErrNoRows {
+		return a, domain.ErrNotFound
+	}
+	if err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(thumbnails), &a.Thumbnails)
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
+
+// validIds leaves out ids that can't be serial keys, they can't match anything.
+func validIds(ids []string) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if validId(id) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
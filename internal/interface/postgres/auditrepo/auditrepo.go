@@ -0,0 +1,138 @@
+package auditrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/audit"
+
+	"database/sql"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+// queryLockLog serializes appends, concurrent ones would link to the same entry.
+// Reads aren't blocked.
+const queryLockLog = `LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE`
+
+const queryLastHash = `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`
+
+const queryAppendEntry = `
+	INSERT INTO audit_log(
+		actor,
+		action,
+		target,
+		details,
+		ip,
+		requestId,
+		createdAt,
+		prevHash,
+		hash
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+`
+
+func (p *Postgres) AppendEntry(e audit.Entry) (audit.Entry, error) {
+	// postgres keeps microseconds, the hash must survive the round trip
+	e.CreatedAt = e.CreatedAt.Truncate(time.Microsecond)
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return audit.Entry{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(queryLockLog); err != nil {
+		return audit.Entry{}, err
+	}
+	e.PrevHash = ""
+	if err := tx.QueryRow(queryLastHash).Scan(&e.PrevHash); err != nil && err != sql.ErrNoRows {
+		return audit.Entry{}, err
+	}
+	e.Hash = e.ComputeHash()
+	err = tx.QueryRow(queryAppendEntry, e.Actor, e.Action, e.Target, e.Details, e.Ip, e.RequestId,
+		e.CreatedAt, e.PrevHash, e.Hash).Scan(&e.Id)
+	if err != nil {
+		return audit.Entry{}, err
+	}
+	return e, tx.Commit()
+}
+
+const queryListEntries = `
+	SELECT
+		id,
+		actor,
+		action,
+		target,
+		details,
+		ip,
+		requestId,
+		createdAt,
+		prevHash,
+		hash
+	FROM audit_log
+	WHERE ($1 = '' OR actor = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3 = '' OR target = $3)
+		AND ($4::timestamptz IS NULL OR createdAt >= $4)
+		AND ($5::timestamptz IS NULL OR createdAt < $5)
+	ORDER BY id DESC
+	OFFSET $6
+	LIMIT $7
+`
+
+func (p *Postgres) ListEntries(f audit.Filter, offset, limit int) ([]audit.Entry, error) {
+	rows, err := p.conn.Query(queryListEntries, f.Actor, f.Action, f.Target,
+		nullTime(f.Since), nullTime(f.Until), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+const queryReadEntries = `
+	SELECT
+		id,
+		actor,
+		action,
+		target,
+		details,
+		ip,
+		requestId,
+		createdAt,
+		prevHash,
+		hash
+	FROM audit_log
+	ORDER BY id
+	OFFSET $1
+	LIMIT $2
+`
+
+func (p *Postgres) ReadEntries(offset, limit int) ([]audit.Entry, error) {
+	rows, err := p.conn.Query(queryReadEntries, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func scanEntries(rows *sql.Rows) ([]audit.Entry, error) {
+	defer rows.Close()
+	res := make([]audit.Entry, 0)
+	for rows.Next() {
+		var e audit.Entry
+		err := rows.Scan(&e.Id, &e.Actor, &e.Action, &e.Target, &e.Details, &e.Ip, &e.RequestId,
+			&e.CreatedAt, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,95 @@
+package blockrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateBlock = `
+	INSERT INTO blocks(
+		blocker,
+		blocked,
+		createdAt
+	) VALUES ($1, $2, $3)
+`
+
+func (p *Postgres) CreateBlock(b block.Block) error {
+	_, err := p.conn.Exec(queryCreateBlock, b.Blocker, b.Blocked, b.CreatedAt)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		return domain.ErrAlreadyExist
+	}
+	return err
+}
+
+const queryDeleteBlock = `DELETE FROM blocks WHERE blocker = $1 AND blocked = $2`
+
+func (p *Postgres) DeleteBlock(blockerId, blockedId string) error {
+	res, err := p.conn.Exec(queryDeleteBlock, blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryListBlocks = `
+	SELECT
+		blocker,
+		blocked,
+		createdAt
+	FROM blocks
+	WHERE blocker = $1
+	ORDER BY createdAt DESC
+`
+
+func (p *Postgres) ListBlocks(blockerId string) ([]block.Block, error) {
+	return p.list(queryListBlocks, blockerId)
+}
+
+const queryListBlockers = `
+	SELECT
+		blocker,
+		blocked,
+		createdAt
+	FROM blocks
+	WHERE blocked = $1
+`
+
+func (p *Postgres) ListBlockers(blockedId string) ([]block.Block, error) {
+	return p.list(queryListBlockers, blockedId)
+}
+
+func (p *Postgres) list(query, accountId string) ([]block.Block, error) {
+	rows, err := p.conn.Query(query, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]block.Block, 0)
+	for rows.Next() {
+		var b block.Block
+		if err := rows.Scan(&b.Blocker, &b.Blocked, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,152 @@
+package commandrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateCommand = `
+	INSERT INTO commands(
+		room,
+		name,
+		bot,
+		creator,
+		url,
+		secret,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+`
+
+func (p *Postgres) CreateCommand(c command.Command) (command.Command, error) {
+	err := p.conn.QueryRow(queryCreateCommand, c.Room, c.Name, c.Bot, c.Creator, c.Url, c.Secret, c.CreatedAt).Scan(&c.Id)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		return command.Command{}, domain.ErrAlreadyExist
+	}
+	return c, err
+}
+
+const queryGetCommandById = `
+	SELECT
+		id,
+		room,
+		name,
+		bot,
+		creator,
+		url,
+		secret,
+		createdAt
+	FROM commands
+	WHERE id = $1
+`
+
+func (p *Postgres) GetCommandById(id string) (command.Command, error) {
+	if !validId(id) {
+		return command.Command{}, domain.ErrNotFound
+	}
+	return scanCommand(p.conn.QueryRow(queryGetCommandById, id))
+}
+
+const queryGetCommandByName = `
+	SELECT
+		id,
+		room,
+		name,
+		bot,
+		creator,
+		url,
+		secret,
+		createdAt
+	FROM commands
+	WHERE room = $1 AND name = $2
+`
+
+func (p *Postgres) GetCommandByName(roomId, name string) (command.Command, error) {
+	return scanCommand(p.conn.QueryRow(queryGetCommandByName, roomId, name))
+}
+
+const queryListCommands = `
+	SELECT
+		id,
+		room,
+		name,
+		bot,
+		creator,
+		url,
+		secret,
+		createdAt
+	FROM commands
+	WHERE room = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListCommands(roomId string) ([]command.Command, error) {
+	rows, err := p.conn.Query(queryListCommands, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cc := make([]command.Command, 0)
+	for rows.Next() {
+		c, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, c)
+	}
+	return cc, rows.Err()
+}
+
+const queryDeleteCommand = `
+	DELETE FROM commands WHERE id = $1
+`
+
+func (p *Postgres) DeleteCommand(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteCommand, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCommand(row scanner) (command.Command, error) {
+	c := command.Command{}
+	err := row.Scan(&c.Id, &c.Room, &c.Name, &c.Bot, &c.Creator, &c.Url, &c.Secret, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c, domain.ErrNotFound
+	}
+	return c, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,175 @@
+package filterrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateRule = `
+	INSERT INTO filter_rules(
+		room,
+		pattern,
+		regexp,
+		action,
+		creator,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (p *Postgres) CreateRule(r filter.Rule) (filter.Rule, error) {
+	err := p.conn.QueryRow(queryCreateRule, r.Room, r.Pattern, r.Regexp, r.Action, r.Creator, r.CreatedAt).Scan(&r.Id)
+	return r, err
+}
+
+const queryGetRuleById = `
+	SELECT
+		id,
+		room,
+		pattern,
+		regexp,
+		action,
+		creator,
+		createdAt
+	FROM filter_rules
+	WHERE id = $1
+`
+
+func (p *Postgres) GetRuleById(id string) (filter.Rule, error) {
+	if !validId(id) {
+		return filter.Rule{}, domain.ErrNotFound
+	}
+	return scanRule(p.conn.QueryRow(queryGetRuleById, id))
+}
+
+const queryListRules = `
+	SELECT
+		id,
+		room,
+		pattern,
+		regexp,
+		action,
+		creator,
+		createdAt
+	FROM filter_rules
+	WHERE room = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListRules(roomId string) ([]filter.Rule, error) {
+	rows, err := p.conn.Query(queryListRules, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rr := make([]filter.Rule, 0)
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+const queryDeleteRule = `
+	DELETE FROM filter_rules WHERE id = $1
+`
+
+func (p *Postgres) DeleteRule(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteRule, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryCreateFlag = `
+	INSERT INTO filter_flags(
+		message,
+		room,
+		author,
+		filter,
+		reason,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (p *Postgres) CreateFlag(f filter.Flag) (filter.Flag, error) {
+	err := p.conn.QueryRow(queryCreateFlag, f.Message, f.Room, f.Author, f.Filter, f.Reason, f.CreatedAt).Scan(&f.Id)
+	return f, err
+}
+
+const queryListFlags = `
+	SELECT
+		id,
+		message,
+		room,
+		author,
+		filter,
+		reason,
+		createdAt
+	FROM filter_flags
+	WHERE room = $1
+	ORDER BY id DESC
+	LIMIT $2
+`
+
+func (p *Postgres) ListFlags(roomId string, limit int) ([]filter.Flag, error) {
+	rows, err := p.conn.Query(queryListFlags, roomId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ff := make([]filter.Flag, 0, limit)
+	for rows.Next() {
+		var f filter.Flag
+		if err := rows.Scan(&f.Id, &f.Message, &f.Room, &f.Author, &f.Filter, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		ff = append(ff, f)
+	}
+	return ff, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row scanner) (filter.Rule, error) {
+	r := filter.Rule{}
+	err := row.Scan(&r.Id, &r.Room, &r.Pattern, &r.Regexp, &r.Action, &r.Creator, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return r, domain.ErrNotFound
+	}
+	return r, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
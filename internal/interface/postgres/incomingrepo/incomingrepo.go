@@ -0,0 +1,126 @@
+package incomingrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateHook = `
+	INSERT INTO incoming_hooks(
+		room,
+		bot,
+		creator,
+		name,
+		tokenHash,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (p *Postgres) CreateHook(h incoming.Hook) (incoming.Hook, error) {
+	err := p.conn.QueryRow(queryCreateHook, h.Room, h.Bot, h.Creator, h.Name, h.TokenHash, h.CreatedAt).Scan(&h.Id)
+	return h, err
+}
+
+const queryGetHookById = `
+	SELECT
+		id,
+		room,
+		bot,
+		creator,
+		name,
+		tokenHash,
+		createdAt
+	FROM incoming_hooks
+	WHERE id = $1
+`
+
+func (p *Postgres) GetHookById(id string) (incoming.Hook, error) {
+	if !validId(id) {
+		return incoming.Hook{}, domain.ErrNotFound
+	}
+	return scanHook(p.conn.QueryRow(queryGetHookById, id))
+}
+
+const queryListHooks = `
+	SELECT
+		id,
+		room,
+		bot,
+		creator,
+		name,
+		tokenHash,
+		createdAt
+	FROM incoming_hooks
+	WHERE room = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListHooks(roomId string) ([]incoming.Hook, error) {
+	rows, err := p.conn.Query(queryListHooks, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hh := make([]incoming.Hook, 0)
+	for rows.Next() {
+		h, err := scanHook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hh = append(hh, h)
+	}
+	return hh, rows.Err()
+}
+
+const queryDeleteHook = `
+	DELETE FROM incoming_hooks WHERE id = $1
+`
+
+func (p *Postgres) DeleteHook(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteHook, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHook(row scanner) (incoming.Hook, error) {
+	h := incoming.Hook{}
+	err := row.Scan(&h.Id, &h.Room, &h.Bot, &h.Creator, &h.Name, &h.TokenHash, &h.CreatedAt)
+	if err == sql.ErrNoRows {
+		return h, domain.ErrNotFound
+	}
+	return h, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,171 @@
+package jobrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/job"
+
+	"database/sql"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateJob = `
+	INSERT INTO jobs(
+		id,
+		kind,
+		owner,
+		state,
+		payload,
+		cursor,
+		done,
+		total,
+		result,
+		error,
+		runAt,
+		createdAt,
+		updatedAt,
+		leaseOwner,
+		leaseUntil
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+`
+
+func (p *Postgres) CreateJob(j job.Job) (job.Job, error) {
+	_, err := p.conn.Exec(queryCreateJob, j.Id, j.Kind, j.Owner, j.State, j.Payload, j.Cursor,
+		j.Done, j.Total, j.Result, j.Error, nullTime(j.RunAt), j.CreatedAt, j.UpdatedAt, j.LeaseOwner, nullTime(j.LeaseUntil))
+	return j, err
+}
+
+const queryGetJobById = `
+	SELECT
+		id,
+		kind,
+		owner,
+		state,
+		payload,
+		cursor,
+		done,
+		total,
+		result,
+		error,
+		runAt,
+		createdAt,
+		updatedAt,
+		leaseOwner,
+		leaseUntil
+	FROM jobs
+	WHERE id = $1
+`
+
+func (p *Postgres) GetJobById(id string) (job.Job, error) {
+	return scanJob(p.conn.QueryRow(queryGetJobById, id))
+}
+
+const queryGetJobByIdForUpdate = queryGetJobById + `
+	FOR UPDATE
+`
+
+const queryUpdateJob = `
+	UPDATE jobs SET
+		state = $2,
+		cursor = $3,
+		done = $4,
+		total = $5,
+		result = $6,
+		error = $7,
+		runAt = $8,
+		updatedAt = $9,
+		leaseOwner = $10,
+		leaseUntil = $11
+	WHERE id = $1
+`
+
+func (p *Postgres) UpdateJob(id string, upd job.UpdateFunc) (job.Job, error) {
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return job.Job{}, err
+	}
+	defer tx.Rollback()
+	j, err := scanJob(tx.QueryRow(queryGetJobByIdForUpdate, id))
+	if err != nil {
+		return j, err
+	}
+	j, err = upd(j)
+	if err != nil {
+		return j, err
+	}
+	j.Id = id
+	_, err = tx.Exec(queryUpdateJob, j.Id, j.State, j.Cursor, j.Done, j.Total, j.Result, j.Error, nullTime(j.RunAt), j.UpdatedAt,
+		j.LeaseOwner, nullTime(j.LeaseUntil))
+	if err != nil {
+		return j, err
+	}
+	return j, tx.Commit()
+}
+
+const queryListUnfinishedJobs = `
+	SELECT
+		id,
+		kind,
+		owner,
+		state,
+		payload,
+		cursor,
+		done,
+		total,
+		result,
+		error,
+		runAt,
+		createdAt,
+		updatedAt,
+		leaseOwner,
+		leaseUntil
+	FROM jobs
+	WHERE state IN ('pending', 'running')
+	ORDER BY createdAt
+`
+
+func (p *Postgres) ListUnfinishedJobs() ([]job.Job, error) {
+	rows, err := p.conn.Query(queryListUnfinishedJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jj := make([]job.Job, 0)
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jj = append(jj, j)
+	}
+	return jj, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (job.Job, error) {
+	j := job.Job{}
+	var runAt, leaseUntil sql.NullTime
+	err := row.Scan(&j.Id, &j.Kind, &j.Owner, &j.State, &j.Payload, &j.Cursor,
+		&j.Done, &j.Total, &j.Result, &j.Error, &runAt, &j.CreatedAt, &j.UpdatedAt,
+		&j.LeaseOwner, &leaseUntil)
+	if err == sql.ErrNoRows {
+		return j, domain.ErrNotFound
+	}
+	j.RunAt = runAt.Time
+	j.LeaseUntil = leaseUntil.Time
+	return j, err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,106 @@
+package mentionrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/mention"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateMention = `
+	INSERT INTO mentions(
+		accountId,
+		messageId,
+		room,
+		author,
+		createdAt,
+		read
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT DO NOTHING
+`
+
+func (p *Postgres) CreateMentions(mm []mention.Mention) error {
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range mm {
+		_, err := tx.Exec(queryCreateMention, m.AccountId, m.MessageId, m.Room, m.Author, m.CreatedAt, m.Read)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const queryListMentions = `
+	SELECT
+		accountId,
+		messageId,
+		room,
+		author,
+		createdAt,
+		read
+	FROM mentions
+	WHERE accountId = $1 AND (NOT $2 OR NOT read)
+	ORDER BY createdAt DESC, messageId DESC
+	OFFSET $3
+	LIMIT $4
+`
+
+func (p *Postgres) ListMentions(accountId string, unreadOnly bool, offset, limit int) ([]mention.Mention, error) {
+	rows, err := p.conn.Query(queryListMentions, accountId, unreadOnly, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]mention.Mention, 0, limit)
+	for rows.Next() {
+		m := mention.Mention{}
+		if err := rows.Scan(&m.AccountId, &m.MessageId, &m.Room, &m.Author, &m.CreatedAt, &m.Read); err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+const queryMarkRead = `
+	UPDATE mentions SET
+		read = true
+	WHERE accountId = $1 AND NOT read AND (cardinality($2::text[]) = 0 OR messageId = ANY($2))
+`
+
+func (p *Postgres) MarkRead(accountId string, messageIds []string) (int, error) {
+	if messageIds == nil {
+		messageIds = []string{}
+	}
+	res, err := p.conn.Exec(queryMarkRead, accountId, pq.Array(messageIds))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const queryCountUnread = `
+	SELECT count(*)
+	FROM mentions
+	WHERE accountId = $1 AND NOT read
+`
+
+func (p *Postgres) CountUnread(accountId string) (int, error) {
+	var n int
+	err := p.conn.QueryRow(queryCountUnread, accountId).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,504 @@
+package messagerepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateMessage = `
+	INSERT INTO messages(
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system,
+		scheduledId,
+		importKey
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT DO NOTHING
+	RETURNING id
+`
+
+const queryGetStoredOnce = `
+	SELECT id FROM messages
+	WHERE scheduledId = $1 OR importKey = $2
+`
+
+func (p *Postgres) CreateMessage(m message.Message) (message.Message, error) {
+	if m.Entities == nil {
+		m.Entities = []message.Entity{}
+	}
+	entities, err := json.Marshal(m.Entities)
+	if err != nil {
+		return m, err
+	}
+	scheduledId := nullString(m.ScheduledId)
+	importKey := nullString(m.ImportKey)
+	err = p.conn.QueryRow(queryCreateMessage, m.Author, m.Room, m.CreatedAt, m.Text, m.Format, m.Html,
+		string(entities), pq.Array(m.Attachments), m.Pinned, nullTime(m.ExpiresAt), m.System,
+		scheduledId, importKey).Scan(&m.Id)
+	if err != sql.ErrNoRows {
+		return m, err
+	}
+	// nothing is returned when the message is stored already
+	if err := p.conn.QueryRow(queryGetStoredOnce, scheduledId, importKey).Scan(&m.Id); err != nil {
+		return m, err
+	}
+	return m, domain.ErrAlreadyExist
+}
+
+const queryListMessages = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE room = $1
+		AND (expiresAt IS NULL OR expiresAt > now())
+	ORDER BY createdAt, id
+`
+
+func (p *Postgres) ListMessages(actorId, roomId string) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryListMessages, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+const queryGetMessagesByIds = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE id = ANY($1::int[])
+		AND (expiresAt IS NULL OR expiresAt > now())
+`
+
+func (p *Postgres) GetMessagesByIds(ids []string) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryGetMessagesByIds, pq.Array(validIds(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0, len(ids))
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+const queryAnonymizeMessages = `
+	UPDATE messages SET
+		author = ''
+	WHERE author = $1
+`
+
+func (p *Postgres) AnonymizeMessages(authorId string) (int, error) {
+	return p.exec(queryAnonymizeMessages, authorId)
+}
+
+const queryListMessagesByAuthor = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE author = $1
+		AND NOT room = ANY($2)
+	ORDER BY createdAt, id
+	LIMIT $3
+`
+
+func (p *Postgres) ListMessagesByAuthor(authorId string, except []string, limit int) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryListMessagesByAuthor, authorId, pq.Array(except), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+const queryDeleteMessage = `
+	DELETE FROM messages
+	WHERE id = $1
+`
+
+func (p *Postgres) DeleteMessage(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	n, err := p.exec(queryDeleteMessage, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryDeleteMessagesByRoom = `
+	DELETE FROM messages
+	WHERE room = $1
+`
+
+func (p *Postgres) DeleteMessagesByRoom(roomId string) (int, error) {
+	return p.exec(queryDeleteMessagesByRoom, roomId)
+}
+
+const queryCountMessages = `SELECT count(*) FROM messages`
+
+func (p *Postgres) CountMessages() (int, error) {
+	var n int
+	err := p.conn.QueryRow(queryCountMessages).Scan(&n)
+	return n, err
+}
+
+// queryListPrunable picks messages by age or by position from the newest one.
+// Pinned messages count towards keepLast, they're just never picked.
+const queryListPrunable = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE room = $1
+		AND NOT pinned
+		AND (
+			($2::timestamptz IS NOT NULL AND createdAt < $2)
+			OR ($3 > 0 AND id NOT IN (
+				SELECT id FROM messages
+				WHERE room = $1
+				ORDER BY createdAt DESC, id DESC
+				LIMIT $3
+			))
+		)
+	ORDER BY createdAt, id
+	LIMIT $4
+`
+
+func (p *Postgres) ListPrunable(roomId string, before time.Time, keepLast, limit int) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryListPrunable, roomId, nullTime(before), keepLast, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+const queryDeleteMessagesByIds = `
+	DELETE FROM messages
+	WHERE id = ANY($1::int[])
+`
+
+func (p *Postgres) DeleteMessagesByIds(ids []string) (int, error) {
+	return p.exec(queryDeleteMessagesByIds, pq.Array(validIds(ids)))
+}
+
+const queryListExpired = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE expiresAt <= $1
+		AND NOT room = ANY($2)
+	ORDER BY expiresAt, id
+	LIMIT $3
+`
+
+func (p *Postgres) ListExpired(now time.Time, except []string, limit int) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryListExpired, now, pq.Array(except), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+// queryLockRoomPins serializes pins in the same room
+// so concurrent pins can't exceed the limit together.
+const queryLockRoomPins = `
+	SELECT pg_advisory_xact_lock(hashtext('pins:' || $1))
+`
+
+const queryGetMessageById = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE id = $1
+`
+
+const queryCountPinned = `
+	SELECT count(*)
+	FROM messages
+	WHERE room = $1
+		AND pinned
+		AND (expiresAt IS NULL OR expiresAt > now())
+`
+
+const querySetPinned = `
+	UPDATE messages SET
+		pinned = $2
+	WHERE id = $1
+`
+
+func (p *Postgres) PinMessage(id string, limit int) (message.Message, error) {
+	m, err := p.getMessageById(id)
+	if err != nil || m.Pinned {
+		return m, err
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return message.Message{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(queryLockRoomPins, m.Room); err != nil {
+		return message.Message{}, err
+	}
+	var pinned int
+	if err := tx.QueryRow(queryCountPinned, m.Room).Scan(&pinned); err != nil {
+		return message.Message{}, err
+	}
+	if pinned >= limit {
+		return message.Message{}, message.ErrPinLimit
+	}
+	if _, err := tx.Exec(querySetPinned, id, true); err != nil {
+		return message.Message{}, err
+	}
+	m.Pinned = true
+	return m, tx.Commit()
+}
+
+func (p *Postgres) UnpinMessage(id string) (message.Message, error) {
+	if !validId(id) {
+		return message.Message{}, domain.ErrNotFound
+	}
+	n, err := p.exec(querySetPinned, id, false)
+	if err != nil {
+		return message.Message{}, err
+	}
+	if n == 0 {
+		return message.Message{}, domain.ErrNotFound
+	}
+	m, err := p.getMessageById(id)
+	m.Pinned = false
+	return m, err
+}
+
+const queryListPinned = `
+	SELECT
+		id,
+		author,
+		room,
+		createdAt,
+		text,
+		format,
+		html,
+		entities,
+		attachments,
+		pinned,
+		expiresAt,
+		system
+	FROM messages
+	WHERE room = $1
+		AND pinned
+		AND (expiresAt IS NULL OR expiresAt > now())
+	ORDER BY createdAt, id
+`
+
+func (p *Postgres) ListPinned(roomId string) ([]message.Message, error) {
+	rows, err := p.conn.Query(queryListPinned, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm := make([]message.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+func (p *Postgres) getMessageById(id string) (message.Message, error) {
+	if !validId(id) {
+		return message.Message{}, domain.ErrNotFound
+	}
+	m, err := scanMessage(p.conn.QueryRow(queryGetMessageById, id))
+	if err == sql.ErrNoRows {
+		return m, domain.ErrNotFound
+	}
+	return m, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
+
+// validIds leaves out ids that can't be serial keys, they can't match anything.
+func validIds(ids []string) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if validId(id) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+func (p *Postgres) exec(query string, args ...interface{}) (int, error) {
+	res, err := p.conn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row scanner) (message.Message, error) {
+	m := message.Message{}
+	var entities string
+	var expiresAt sql.NullTime
+	err := row.Scan(&m.Id, &m.Author, &m.Room, &m.CreatedAt, &m.Text,
+		&m.Format, &m.Html, &entities, pq.Array(&m.Attachments), &m.Pinned, &expiresAt, &m.System)
+	if err != nil {
+		return m, err
+	}
+	m.ExpiresAt = expiresAt.Time
+	return m, json.Unmarshal([]byte(entities), &m.Entities)
+}
+
+// nullTime stores zero time as null.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
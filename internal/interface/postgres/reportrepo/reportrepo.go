@@ -0,0 +1,220 @@
+package reportrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/report"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateReport = `
+	INSERT INTO reports(
+		reporter,
+		message,
+		room,
+		account,
+		reason,
+		status,
+		moderator,
+		resolution,
+		createdAt,
+		updatedAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id
+`
+
+func (p *Postgres) CreateReport(r report.Report) (report.Report, error) {
+	err := p.conn.QueryRow(queryCreateReport, r.Reporter, r.Message, r.Room, r.Account, r.Reason,
+		r.Status, r.Moderator, r.Resolution, r.CreatedAt, r.UpdatedAt).Scan(&r.Id)
+	return r, err
+}
+
+const queryGetReportById = `
+	SELECT
+		id,
+		reporter,
+		message,
+		room,
+		account,
+		reason,
+		status,
+		moderator,
+		resolution,
+		createdAt,
+		updatedAt
+	FROM reports
+	WHERE id = $1
+`
+
+func (p *Postgres) GetReportById(id string) (report.Report, error) {
+	if !validId(id) {
+		return report.Report{}, domain.ErrNotFound
+	}
+	return scanReport(p.conn.QueryRow(queryGetReportById, id))
+}
+
+const queryListReports = `
+	SELECT
+		id,
+		reporter,
+		message,
+		room,
+		account,
+		reason,
+		status,
+		moderator,
+		resolution,
+		createdAt,
+		updatedAt
+	FROM reports
+	WHERE $1 = '' OR status = $1
+	ORDER BY id
+	LIMIT $2
+`
+
+func (p *Postgres) ListReports(status string, limit int) ([]report.Report, error) {
+	rows, err := p.conn.Query(queryListReports, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rr := make([]report.Report, 0, limit)
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+const queryCountReports = `
+	SELECT count(*)
+	FROM reports
+	WHERE $1 = '' OR status = $1
+`
+
+func (p *Postgres) CountReports(status string) (int, error) {
+	var n int
+	err := p.conn.QueryRow(queryCountReports, status).Scan(&n)
+	return n, err
+}
+
+const queryGetReportByIdForUpdate = queryGetReportById + `
+	FOR UPDATE
+`
+
+const queryUpdateReport = `
+	UPDATE reports SET
+		status = $2,
+		moderator = $3,
+		resolution = $4,
+		updatedAt = $5
+	WHERE id = $1
+`
+
+// UpdateReport changes status, moderator and resolution of the report,
+// what was reported and why is kept.
+func (p *Postgres) UpdateReport(id string, upd report.UpdateFunc) (report.Report, error) {
+	if !validId(id) {
+		return report.Report{}, domain.ErrNotFound
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return report.Report{}, err
+	}
+	defer tx.Rollback()
+	r, err := scanReport(tx.QueryRow(queryGetReportByIdForUpdate, id))
+	if err != nil {
+		return r, err
+	}
+	updated, err := upd(r)
+	if err != nil {
+		return updated, err
+	}
+	_, err = tx.Exec(queryUpdateReport, id, updated.Status, updated.Moderator, updated.Resolution, updated.UpdatedAt)
+	if err != nil {
+		return updated, err
+	}
+	r.Status, r.Moderator, r.Resolution, r.UpdatedAt = updated.Status, updated.Moderator, updated.Resolution, updated.UpdatedAt
+	return r, tx.Commit()
+}
+
+const queryCreateAction = `
+	INSERT INTO moderation_actions(
+		report,
+		moderator,
+		action,
+		note,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5)
+	RETURNING id
+`
+
+func (p *Postgres) CreateAction(a report.Action) (report.Action, error) {
+	err := p.conn.QueryRow(queryCreateAction, a.Report, a.Moderator, a.Action, a.Note, a.CreatedAt).Scan(&a.Id)
+	return a, err
+}
+
+const queryListActions = `
+	SELECT
+		id,
+		report,
+		moderator,
+		action,
+		note,
+		createdAt
+	FROM moderation_actions
+	WHERE report = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListActions(reportId string) ([]report.Action, error) {
+	if !validId(reportId) {
+		return []report.Action{}, nil
+	}
+	rows, err := p.conn.Query(queryListActions, reportId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aa := make([]report.Action, 0)
+	for rows.Next() {
+		var a report.Action
+		if err := rows.Scan(&a.Id, &a.Report, &a.Moderator, &a.Action, &a.Note, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+	return aa, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReport(row scanner) (report.Report, error) {
+	r := report.Report{}
+	err := row.Scan(&r.Id, &r.Reporter, &r.Message, &r.Room, &r.Account, &r.Reason,
+		&r.Status, &r.Moderator, &r.Resolution, &r.CreatedAt, &r.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return r, domain.ErrNotFound
+	}
+	return r, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
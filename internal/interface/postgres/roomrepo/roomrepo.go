@@ -0,0 +1,331 @@
+package roomrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"strconv"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateRoom = `
+	INSERT INTO rooms(
+		creator
+	) VALUES ($1)
+	RETURNING id
+`
+
+const queryAddMember = `
+	INSERT INTO room_members(
+		roomId,
+		accountId
+	) VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+`
+
+func (p *Postgres) CreateRoom(creatorId string) (room.Room, error) {
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return room.Room{}, err
+	}
+	defer tx.Rollback()
+	r := room.Room{Creator: creatorId, Members: []string{creatorId}}
+	if err := tx.QueryRow(queryCreateRoom, creatorId).Scan(&r.Id); err != nil {
+		return room.Room{}, err
+	}
+	if _, err := tx.Exec(queryAddMember, r.Id, creatorId); err != nil {
+		return room.Room{}, err
+	}
+	return r, tx.Commit()
+}
+
+const queryGetRoomById = `
+	SELECT
+		r.id,
+		r.creator,
+		r.topic,
+		r.retentionDays,
+		r.retentionKeepLast,
+		r.legalHold,
+		array_remove(array_agg(m.accountId ORDER BY m.position), NULL)
+	FROM rooms r
+	LEFT JOIN room_members m ON m.roomId = r.id
+	WHERE r.id = $1
+	GROUP BY r.id
+`
+
+func (p *Postgres) GetRoomById(actorId, roomId string) (room.Room, error) {
+	if !validId(roomId) {
+		return room.Room{}, domain.ErrNotFound
+	}
+	r, err := scanRoom(p.conn.QueryRow(queryGetRoomById, roomId))
+	if err != nil {
+		return r, err
+	}
+	return r, authorize(actorId, r)
+}
+
+const queryLockRoom = `
+	SELECT id FROM rooms WHERE id = $1 FOR UPDATE
+`
+
+const queryUpdateRoom = `
+	UPDATE rooms SET
+		topic = $2,
+		retentionDays = $3,
+		retentionKeepLast = $4
+	WHERE id = $1
+`
+
+const queryRemoveMember = `
+	DELETE FROM room_members
+	WHERE roomId = $1 AND accountId = $2
+`
+
+func (p *Postgres) UpdateRoom(actorId, roomId string, upd room.UpdateFunc) (room.Room, error) {
+	if !validId(roomId) {
+		return room.Room{}, domain.ErrNotFound
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return room.Room{}, err
+	}
+	defer tx.Rollback()
+	var id string
+	if err := tx.QueryRow(queryLockRoom, roomId).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return room.Room{}, domain.ErrNotFound
+		}
+		return room.Room{}, err
+	}
+	r, err := scanRoom(tx.QueryRow(queryGetRoomById, roomId))
+	if err != nil {
+		return r, err
+	}
+	if err := authorize(actorId, r); err != nil {
+		return r, err
+	}
+	oldMembers, hold := r.Members, r.LegalHold
+	r, err = upd(r)
+	if err != nil {
+		return r, err
+	}
+	r.Id, r.LegalHold = roomId, hold // only SetLegalHold changes the hold
+	_, err = tx.Exec(queryUpdateRoom, roomId, r.Topic, r.Retention.Days, r.Retention.KeepLast)
+	if err != nil {
+		return r, err
+	}
+	kept := make(map[string]bool, len(r.Members))
+	for _, m := range r.Members {
+		kept[m] = true
+	}
+	for _, m := range oldMembers {
+		if kept[m] {
+			continue
+		}
+		if _, err := tx.Exec(queryRemoveMember, roomId, m); err != nil {
+			return r, err
+		}
+	}
+	for _, m := range r.Members {
+		if _, err := tx.Exec(queryAddMember, roomId, m); err != nil {
+			return r, err
+		}
+	}
+	return r, tx.Commit()
+}
+
+const queryListRooms = `
+	SELECT
+		r.id,
+		r.creator,
+		r.topic,
+		r.retentionDays,
+		r.retentionKeepLast,
+		r.legalHold,
+		array_agg(m.accountId ORDER BY m.position)
+	FROM rooms r
+	JOIN room_members m ON m.roomId = r.id
+	WHERE r.id IN (SELECT roomId FROM room_members WHERE accountId = $1)
+	GROUP BY r.id
+	ORDER BY r.id
+`
+
+func (p *Postgres) ListRooms(accountId string) ([]room.Room, error) {
+	rows, err := p.conn.Query(queryListRooms, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rr := make([]room.Room, 0)
+	for rows.Next() {
+		r, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+func (p *Postgres) InspectRoom(roomId string) (room.Room, error) {
+	if !validId(roomId) {
+		return room.Room{}, domain.ErrNotFound
+	}
+	return scanRoom(p.conn.QueryRow(queryGetRoomById, roomId))
+}
+
+const queryDeleteRoom = `
+	DELETE FROM rooms
+	WHERE id = $1
+`
+
+func (p *Postgres) DeleteRoom(roomId string) error {
+	if !validId(roomId) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteRoom, roomId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryCountRooms = `SELECT count(*) FROM rooms`
+
+func (p *Postgres) CountRooms() (int, error) {
+	var n int
+	err := p.conn.QueryRow(queryCountRooms).Scan(&n)
+	return n, err
+}
+
+const querySetLegalHold = `
+	UPDATE rooms SET legalHold = $2 WHERE id = $1
+`
+
+func (p *Postgres) SetLegalHold(roomId string, hold bool) (room.Room, error) {
+	if !validId(roomId) {
+		return room.Room{}, domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(querySetLegalHold, roomId, hold)
+	if err != nil {
+		return room.Room{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return room.Room{}, err
+	}
+	if n == 0 {
+		return room.Room{}, domain.ErrNotFound
+	}
+	return p.InspectRoom(roomId)
+}
+
+func (p *Postgres) RemoveMember(roomId, accountId string) error {
+	if !validId(roomId) {
+		return domain.ErrNotFound
+	}
+	_, err := p.conn.Exec(queryRemoveMember, roomId, accountId)
+	return err
+}
+
+const queryListHeldRooms = `
+	SELECT id FROM rooms WHERE legalHold
+`
+
+func (p *Postgres) ListHeldRooms() ([]string, error) {
+	rows, err := p.conn.Query(queryListHeldRooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const queryListAllRooms = `
+	SELECT
+		r.id,
+		r.creator,
+		r.topic,
+		r.retentionDays,
+		r.retentionKeepLast,
+		r.legalHold,
+		array_remove(array_agg(m.accountId ORDER BY m.position), NULL)
+	FROM rooms r
+	LEFT JOIN room_members m ON m.roomId = r.id
+	GROUP BY r.id
+	ORDER BY r.id
+	OFFSET $1
+	LIMIT $2
+`
+
+func (p *Postgres) ListAllRooms(offset, limit int) ([]room.Room, error) {
+	rows, err := p.conn.Query(queryListAllRooms, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rr := make([]room.Room, 0)
+	for rows.Next() {
+		r, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoom(row scanner) (room.Room, error) {
+	r := room.Room{}
+	err := row.Scan(&r.Id, &r.Creator, &r.Topic, &r.Retention.Days, &r.Retention.KeepLast,
+		&r.LegalHold, pq.Array(&r.Members))
+	if err == sql.ErrNoRows {
+		return r, domain.ErrNotFound
+	}
+	return r, err
+}
+
+func authorize(actorId string, r room.Room) error {
+	for _, m := range r.Members {
+		if m == actorId {
+			return nil
+		}
+	}
+	return domain.ErrUnauthorized
+}
+
+// validId filters out ids postgres can't compare with serial column.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
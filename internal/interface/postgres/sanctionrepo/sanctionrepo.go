@@ -0,0 +1,195 @@
+package sanctionrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+
+	"database/sql"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryPutBan = `
+	INSERT INTO room_bans(
+		room,
+		account,
+		actor,
+		reason,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (room, account) DO UPDATE SET
+		actor = EXCLUDED.actor,
+		reason = EXCLUDED.reason,
+		createdAt = EXCLUDED.createdAt
+`
+
+func (p *Postgres) PutBan(b sanction.Ban) error {
+	_, err := p.conn.Exec(queryPutBan, b.Room, b.Account, b.Actor, b.Reason, b.CreatedAt)
+	return err
+}
+
+const queryGetBan = `
+	SELECT
+		room,
+		account,
+		actor,
+		reason,
+		createdAt
+	FROM room_bans
+	WHERE room = $1 AND account = $2
+`
+
+func (p *Postgres) GetBan(roomId, accountId string) (sanction.Ban, error) {
+	var b sanction.Ban
+	err := p.conn.QueryRow(queryGetBan, roomId, accountId).Scan(&b.Room, &b.Account, &b.Actor, &b.Reason, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return b, domain.ErrNotFound
+	}
+	return b, err
+}
+
+const queryListBans = `
+	SELECT
+		room,
+		account,
+		actor,
+		reason,
+		createdAt
+	FROM room_bans
+	WHERE room = $1
+	ORDER BY createdAt
+`
+
+func (p *Postgres) ListBans(roomId string) ([]sanction.Ban, error) {
+	rows, err := p.conn.Query(queryListBans, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]sanction.Ban, 0)
+	for rows.Next() {
+		var b sanction.Ban
+		if err := rows.Scan(&b.Room, &b.Account, &b.Actor, &b.Reason, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, rows.Err()
+}
+
+const queryDeleteBan = `DELETE FROM room_bans WHERE room = $1 AND account = $2`
+
+func (p *Postgres) DeleteBan(roomId, accountId string) error {
+	return p.delete(queryDeleteBan, roomId, accountId)
+}
+
+const queryPutMute = `
+	INSERT INTO room_mutes(
+		room,
+		account,
+		actor,
+		reason,
+		until,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (room, account) DO UPDATE SET
+		actor = EXCLUDED.actor,
+		reason = EXCLUDED.reason,
+		until = EXCLUDED.until,
+		createdAt = EXCLUDED.createdAt
+`
+
+func (p *Postgres) PutMute(m sanction.Mute) error {
+	_, err := p.conn.Exec(queryPutMute, m.Room, m.Account, m.Actor, m.Reason, m.Until, m.CreatedAt)
+	return err
+}
+
+const queryGetMute = `
+	SELECT
+		room,
+		account,
+		actor,
+		reason,
+		until,
+		createdAt
+	FROM room_mutes
+	WHERE room = $1 AND account = $2
+`
+
+func (p *Postgres) GetMute(roomId, accountId string) (sanction.Mute, error) {
+	var m sanction.Mute
+	err := p.conn.QueryRow(queryGetMute, roomId, accountId).Scan(&m.Room, &m.Account, &m.Actor, &m.Reason, &m.Until, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return m, domain.ErrNotFound
+	}
+	return m, err
+}
+
+const queryListMutes = `
+	SELECT
+		room,
+		account,
+		actor,
+		reason,
+		until,
+		createdAt
+	FROM room_mutes
+	WHERE room = $1
+	ORDER BY createdAt
+`
+
+func (p *Postgres) ListMutes(roomId string) ([]sanction.Mute, error) {
+	rows, err := p.conn.Query(queryListMutes, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]sanction.Mute, 0)
+	for rows.Next() {
+		var m sanction.Mute
+		if err := rows.Scan(&m.Room, &m.Account, &m.Actor, &m.Reason, &m.Until, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+const queryDeleteMute = `DELETE FROM room_mutes WHERE room = $1 AND account = $2`
+
+func (p *Postgres) DeleteMute(roomId, accountId string) error {
+	return p.delete(queryDeleteMute, roomId, accountId)
+}
+
+const queryDeleteExpiredMutes = `DELETE FROM room_mutes WHERE until < $1`
+
+func (p *Postgres) DeleteExpiredMutes(now time.Time) (int, error) {
+	res, err := p.conn.Exec(queryDeleteExpiredMutes, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (p *Postgres) delete(query, roomId, accountId string) error {
+	res, err := p.conn.Exec(query, roomId, accountId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
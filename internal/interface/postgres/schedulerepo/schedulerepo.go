@@ -0,0 +1,239 @@
+package schedulerepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/schedule"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateScheduled = `
+	INSERT INTO scheduled_messages(
+		author,
+		room,
+		text,
+		format,
+		attachments,
+		ttl,
+		sendAt,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+`
+
+func (p *Postgres) CreateScheduled(m schedule.Message) (schedule.Message, error) {
+	err := p.conn.QueryRow(queryCreateScheduled, m.Author, m.Room, m.Text, m.Format,
+		pq.Array(m.Attachments), m.Ttl.Milliseconds(), m.SendAt, m.CreatedAt).Scan(&m.Id)
+	return m, err
+}
+
+const queryGetScheduledById = `
+	SELECT
+		id,
+		author,
+		room,
+		text,
+		format,
+		attachments,
+		ttl,
+		sendAt,
+		createdAt,
+		leaseOwner,
+		leaseUntil
+	FROM scheduled_messages
+	WHERE id = $1
+`
+
+func (p *Postgres) GetScheduledById(id string) (schedule.Message, error) {
+	if !validId(id) {
+		return schedule.Message{}, domain.ErrNotFound
+	}
+	return scanScheduled(p.conn.QueryRow(queryGetScheduledById, id))
+}
+
+const queryListScheduledByAuthor = `
+	SELECT
+		id,
+		author,
+		room,
+		text,
+		format,
+		attachments,
+		ttl,
+		sendAt,
+		createdAt,
+		leaseOwner,
+		leaseUntil
+	FROM scheduled_messages
+	WHERE author = $1
+	ORDER BY sendAt, createdAt
+`
+
+func (p *Postgres) ListScheduledByAuthor(authorId string) ([]schedule.Message, error) {
+	rows, err := p.conn.Query(queryListScheduledByAuthor, authorId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAll(rows)
+}
+
+const queryGetScheduledByIdForUpdate = queryGetScheduledById + `
+	FOR UPDATE
+`
+
+const queryDeleteScheduled = `
+	DELETE FROM scheduled_messages
+	WHERE id = $1
+`
+
+func (p *Postgres) CancelScheduled(id string, now time.Time) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	m, err := scanScheduled(tx.QueryRow(queryGetScheduledByIdForUpdate, id))
+	if err != nil {
+		return err
+	}
+	if now.Before(m.LeaseUntil) {
+		return schedule.ErrLeased
+	}
+	if _, err := tx.Exec(queryDeleteScheduled, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) DeleteScheduled(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteScheduled, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryDeleteScheduledByAuthor = `
+	DELETE FROM scheduled_messages
+	WHERE author = $1
+`
+
+func (p *Postgres) DeleteScheduledByAuthor(authorId string) (int, error) {
+	res, err := p.conn.Exec(queryDeleteScheduledByAuthor, authorId)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// queryClaimDue skips rows other instances are claiming at the same moment,
+// so each due message is leased to one instance only.
+const queryClaimDue = `
+	UPDATE scheduled_messages SET
+		leaseOwner = $1,
+		leaseUntil = $3
+	WHERE id IN (
+		SELECT id FROM scheduled_messages
+		WHERE sendAt <= $2
+			AND (leaseUntil IS NULL OR leaseUntil <= $2)
+		ORDER BY sendAt, createdAt
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING
+		id,
+		author,
+		room,
+		text,
+		format,
+		attachments,
+		ttl,
+		sendAt,
+		createdAt,
+		leaseOwner,
+		leaseUntil
+`
+
+func (p *Postgres) ClaimDue(owner string, now, leaseUntil time.Time, limit int) ([]schedule.Message, error) {
+	rows, err := p.conn.Query(queryClaimDue, owner, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mm, err := scanAll(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING keeps no order
+	sort.Slice(mm, func(i, j int) bool {
+		if mm[i].SendAt.Equal(mm[j].SendAt) {
+			return mm[i].CreatedAt.Before(mm[j].CreatedAt)
+		}
+		return mm[i].SendAt.Before(mm[j].SendAt)
+	})
+	return mm, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanScheduled(row scanner) (schedule.Message, error) {
+	m := schedule.Message{}
+	var ttl int64
+	var leaseUntil sql.NullTime
+	err := row.Scan(&m.Id, &m.Author, &m.Room, &m.Text, &m.Format, pq.Array(&m.Attachments),
+		&ttl, &m.SendAt, &m.CreatedAt, &m.LeaseOwner, &leaseUntil)
+	if err == sql.ErrNoRows {
+		return m, domain.ErrNotFound
+	}
+	m.Ttl = time.Duration(ttl) * time.Millisecond
+	m.LeaseUntil = leaseUntil.Time
+	return m, err
+}
+
+func scanAll(rows *sql.Rows) ([]schedule.Message, error) {
+	mm := make([]schedule.Message, 0)
+	for rows.Next() {
+		m, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		mm = append(mm, m)
+	}
+	return mm, rows.Err()
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,248 @@
+package webhookrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+
+	"github.com/lib/pq"
+
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+type Postgres struct {
+	conn *sql.DB
+}
+
+func New(conn *sql.DB) *Postgres {
+	return &Postgres{conn: conn}
+}
+
+const queryCreateWebhook = `
+	INSERT INTO webhooks(
+		room,
+		creator,
+		url,
+		secret,
+		events,
+		active,
+		failures,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+`
+
+func (p *Postgres) CreateWebhook(w webhook.Webhook) (webhook.Webhook, error) {
+	err := p.conn.QueryRow(queryCreateWebhook, w.Room, w.Creator, w.Url, w.Secret,
+		pq.Array(w.Events), w.Active, w.Failures, w.CreatedAt).Scan(&w.Id)
+	return w, err
+}
+
+const queryGetWebhookById = `
+	SELECT
+		id,
+		room,
+		creator,
+		url,
+		secret,
+		events,
+		active,
+		failures,
+		createdAt
+	FROM webhooks
+	WHERE id = $1
+`
+
+func (p *Postgres) GetWebhookById(id string) (webhook.Webhook, error) {
+	if !validId(id) {
+		return webhook.Webhook{}, domain.ErrNotFound
+	}
+	return scanWebhook(p.conn.QueryRow(queryGetWebhookById, id))
+}
+
+const queryListWebhooks = `
+	SELECT
+		id,
+		room,
+		creator,
+		url,
+		secret,
+		events,
+		active,
+		failures,
+		createdAt
+	FROM webhooks
+	WHERE room = $1
+	ORDER BY id
+`
+
+func (p *Postgres) ListWebhooks(roomId string) ([]webhook.Webhook, error) {
+	rows, err := p.conn.Query(queryListWebhooks, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ww := make([]webhook.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		ww = append(ww, w)
+	}
+	return ww, rows.Err()
+}
+
+const queryGetWebhookByIdForUpdate = queryGetWebhookById + `
+	FOR UPDATE
+`
+
+const queryUpdateWebhook = `
+	UPDATE webhooks SET
+		url = $2,
+		secret = $3,
+		events = $4,
+		active = $5,
+		failures = $6
+	WHERE id = $1
+`
+
+// UpdateWebhook keeps id, room and creator of the webhook.
+func (p *Postgres) UpdateWebhook(id string, upd webhook.UpdateFunc) (webhook.Webhook, error) {
+	if !validId(id) {
+		return webhook.Webhook{}, domain.ErrNotFound
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+	defer tx.Rollback()
+	w, err := scanWebhook(tx.QueryRow(queryGetWebhookByIdForUpdate, id))
+	if err != nil {
+		return w, err
+	}
+	updated, err := upd(w)
+	if err != nil {
+		return updated, err
+	}
+	updated.Id, updated.Room, updated.Creator = w.Id, w.Room, w.Creator
+	_, err = tx.Exec(queryUpdateWebhook, updated.Id, updated.Url, updated.Secret,
+		pq.Array(updated.Events), updated.Active, updated.Failures)
+	if err != nil {
+		return updated, err
+	}
+	return updated, tx.Commit()
+}
+
+const queryDeleteWebhook = `
+	DELETE FROM webhooks WHERE id = $1
+`
+
+// DeleteWebhook removes the webhook, its delivery log is removed by cascade.
+func (p *Postgres) DeleteWebhook(id string) error {
+	if !validId(id) {
+		return domain.ErrNotFound
+	}
+	res, err := p.conn.Exec(queryDeleteWebhook, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const queryCreateDelivery = `
+	INSERT INTO webhook_deliveries(
+		webhookId,
+		eventId,
+		event,
+		attempt,
+		statusCode,
+		error,
+		success,
+		durationMs,
+		createdAt
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+`
+
+func (p *Postgres) CreateDelivery(d webhook.Delivery) (webhook.Delivery, error) {
+	if !validId(d.Webhook) {
+		return d, domain.ErrNotFound
+	}
+	err := p.conn.QueryRow(queryCreateDelivery, d.Webhook, d.EventId, d.Event, d.Attempt,
+		d.StatusCode, d.Error, d.Success, d.Duration.Milliseconds(), d.CreatedAt).Scan(&d.Id)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+		return d, domain.ErrNotFound
+	}
+	return d, err
+}
+
+const queryListDeliveries = `
+	SELECT
+		id,
+		webhookId,
+		eventId,
+		event,
+		attempt,
+		statusCode,
+		error,
+		success,
+		durationMs,
+		createdAt
+	FROM webhook_deliveries
+	WHERE webhookId = $1
+	ORDER BY id DESC
+	LIMIT $2
+`
+
+func (p *Postgres) ListDeliveries(webhookId string, limit int) ([]webhook.Delivery, error) {
+	if !validId(webhookId) {
+		return []webhook.Delivery{}, nil
+	}
+	rows, err := p.conn.Query(queryListDeliveries, webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dd := make([]webhook.Delivery, 0, limit)
+	for rows.Next() {
+		var d webhook.Delivery
+		var durationMs int64
+		err := rows.Scan(&d.Id, &d.Webhook, &d.EventId, &d.Event, &d.Attempt,
+			&d.StatusCode, &d.Error, &d.Success, &durationMs, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Duration = time.Duration(durationMs) * time.Millisecond
+		dd = append(dd, d)
+	}
+	return dd, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (webhook.Webhook, error) {
+	w := webhook.Webhook{}
+	err := row.Scan(&w.Id, &w.Room, &w.Creator, &w.Url, &w.Secret,
+		pq.Array(&w.Events), &w.Active, &w.Failures, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return w, domain.ErrNotFound
+	}
+	return w, err
+}
+
+// validId filters out ids that can't be serial keys, postgres would fail on them otherwise.
+func validId(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,16 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var filterDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "message_filter_decisions_total",
+	Help: "Decisions of message filters by filter and action",
+}, []string{"filter", "action"})
+
+// ObserveFilterDecision counts the decision a message filter made.
+func ObserveFilterDecision(filter, action string) {
+	filterDecisions.WithLabelValues(filter, action).Inc()
+}
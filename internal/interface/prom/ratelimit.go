@@ -0,0 +1,28 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rateLimitedHttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limit_requests_total",
+		Help: "HTTP requests checked against rate limits by result",
+	}, []string{"path", "scope", "result"})
+	rateLimitKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_rate_limit_keys",
+		Help: "Accounts, rooms or addresses with partly spent rate limits",
+	}, []string{"path", "scope"})
+)
+
+// ObserveRateLimit counts the rate limit decision for the route
+// and updates the number of keys the limiter tracks.
+func ObserveRateLimit(path, scope string, allowed bool, keys int) {
+	result := "allowed"
+	if !allowed {
+		result = "limited"
+	}
+	rateLimitedHttpRequests.WithLabelValues(path, scope, result).Inc()
+	rateLimitKeys.WithLabelValues(path, scope).Set(float64(keys))
+}
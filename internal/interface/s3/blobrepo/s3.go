@@ -0,0 +1,102 @@
+// Package blobrepo keeps blobs in S3 compatible object storage.
+package blobrepo
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 uses path style addressing, so it works with MinIO and similar servers
+// that don't have per-bucket host names.
+type S3 struct {
+	config Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func New(c Config) *S3 {
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	return &S3{
+		config: c,
+		client: &http.Client{Timeout: 5 * time.Minute},
+		now:    time.Now,
+	}
+}
+
+func (s *S3) PutBlob(key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectUrl(key), ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) GetBlob(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectUrl(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) DeleteBlob(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.objectUrl(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err == domain.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) objectUrl(key string) string {
+	return s.config.Endpoint + "/" + s.config.Bucket + "/" + key
+}
+
+// do signs and sends the request. Responses other than 2xx are turned into errors.
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, domain.ErrNotFound
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3: %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, body)
+}
@@ -0,0 +1,132 @@
+// Package events delivers notifications to connected clients of an account.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// subscriptionBuffer is how many events may wait for a slow client.
+// Once it is full the subscription is closed, the client reconnects
+// and gets missed events from the history.
+const subscriptionBuffer = 64
+
+type Event struct {
+	Id   string // "<run>-<sequence number>", ids of previous server runs aren't comparable
+	Type string
+	Data interface{}
+
+	seq uint64
+}
+
+type Interface interface {
+	Publish(accountId, eventType string, data interface{})
+	// Subscribe returns events of the account after lastEventId kept in
+	// history and a subscription to the new ones. Empty lastEventId means
+	// the client starts from now.
+	Subscribe(accountId, lastEventId string) ([]Event, *Subscription)
+}
+
+type Subscription struct {
+	C <-chan Event // closed when the subscription is closed
+
+	ch        chan Event
+	accountId string
+	bus       *Bus
+	closed    bool
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.unsubscribe(s)
+}
+
+// Bus keeps the last events of each account in memory so clients
+// can catch up after reconnecting.
+type Bus struct {
+	run         string
+	nextSeq     uint64
+	historySize int
+	history     map[string][]Event
+	subscribers map[string]map[*Subscription]bool
+	mu          sync.Mutex
+}
+
+func NewBus(historySize int) *Bus {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &Bus{
+		run:         hex.EncodeToString(b),
+		nextSeq:     1,
+		historySize: historySize,
+		history:     make(map[string][]Event),
+		subscribers: make(map[string]map[*Subscription]bool),
+	}
+}
+
+func (b *Bus) Publish(accountId, eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := Event{
+		Id:   b.run + "-" + strconv.FormatUint(b.nextSeq, 10),
+		Type: eventType,
+		Data: data,
+		seq:  b.nextSeq,
+	}
+	b.nextSeq++
+	h := append(b.history[accountId], e)
+	if len(h) > b.historySize {
+		h = append([]Event(nil), h[len(h)-b.historySize:]...)
+	}
+	b.history[accountId] = h
+	for s := range b.subscribers[accountId] {
+		select {
+		case s.ch <- e:
+		default:
+			b.unsubscribe(s)
+		}
+	}
+}
+
+func (b *Bus) Subscribe(accountId, lastEventId string) ([]Event, *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: ch, ch: ch, accountId: accountId, bus: b}
+	if b.subscribers[accountId] == nil {
+		b.subscribers[accountId] = make(map[*Subscription]bool)
+	}
+	b.subscribers[accountId][s] = true
+	if lastEventId == "" {
+		return []Event{}, s
+	}
+	// ids from another run or malformed ones replay all the history
+	var after uint64
+	if parts := strings.SplitN(lastEventId, "-", 2); len(parts) == 2 && parts[0] == b.run {
+		after, _ = strconv.ParseUint(parts[1], 10, 64)
+	}
+	replay := make([]Event, 0)
+	for _, e := range b.history[accountId] {
+		if e.seq > after {
+			replay = append(replay, e)
+		}
+	}
+	return replay, s
+}
+
+// unsubscribe must be called with the lock held.
+func (b *Bus) unsubscribe(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+	delete(b.subscribers[s.accountId], s)
+	if len(b.subscribers[s.accountId]) == 0 {
+		delete(b.subscribers, s.accountId)
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBus_Replay(t *testing.T) {
+	b := NewBus(2)
+	b.Publish("1", "mention", "a")
+	replay, sub := b.Subscribe("1", "")
+	sub.Close()
+	if len(replay) != 0 {
+		t.Fatalf("subscription without last event id MUST NOT replay, but %d events given", len(replay))
+	}
+	b.Publish("1", "mention", "b")
+	b.Publish("1", "mention", "c")
+	b.Publish("2", "mention", "other account")
+
+	replay, sub = b.Subscribe("1", "stale-run-1")
+	sub.Close()
+	if len(replay) != 2 || replay[0].Data != "b" || replay[1].Data != "c" {
+		t.Fatalf("unknown id MUST replay the whole history, but %+v given", replay)
+	}
+	replay, sub = b.Subscribe("1", replay[0].Id)
+	sub.Close()
+	if len(replay) != 1 || replay[0].Data != "c" {
+		t.Fatalf("MUST replay events after the given one, but %+v given", replay)
+	}
+}
+
+func TestBus_SlowSubscriberIsClosed(t *testing.T) {
+	b := NewBus(10)
+	_, sub := b.Subscribe("1", "")
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.Publish("1", "mention", i)
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriptionBuffer {
+		t.Errorf("MUST deliver buffered events before closing, but %d given", n)
+	}
+	sub.Close()
+	if !strings.HasPrefix(b.history["1"][0].Id, b.run+"-") {
+		t.Errorf("event id MUST start with the run, but %s given", b.history["1"][0].Id)
+	}
+}
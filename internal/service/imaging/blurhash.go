@@ -0,0 +1,99 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurhashSampleSide is the size the image is reduced to before encoding,
+// placeholder is too blurry to need more pixels.
+const blurhashSampleSide = 32
+
+// Blurhash encodes the image into a compact placeholder string clients can
+// render before the thumbnail is loaded, see https://blurha.sh.
+// Components are numbers of cosine basis functions along each axis, 1 to 9.
+func Blurhash(img image.Image, xComponents, yComponents int) string {
+	src := Fit(img, blurhashSampleSide)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cy
+					off := y*src.Stride + x*4
+					f[0] += basis * srgbToLinear(src.Pix[off])
+					f[1] += basis * srgbToLinear(src.Pix[off+1])
+					f[2] += basis * srgbToLinear(src.Pix[off+2])
+				}
+			}
+			scale := normalisation / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	encode83(&b, (xComponents-1)+(yComponents-1)*9, 1)
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMaximum := 0.0
+		for _, f := range factors[1:] {
+			for _, c := range f {
+				actualMaximum = math.Max(actualMaximum, math.Abs(c))
+			}
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		encode83(&b, quantisedMaximum, 1)
+	} else {
+		encode83(&b, 0, 1)
+	}
+	dc := factors[0]
+	encode83(&b, linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4)
+	for _, f := range factors[1:] {
+		encode83(&b, quantiseAc(f[0], maximumValue)*19*19+quantiseAc(f[1], maximumValue)*19+quantiseAc(f[2], maximumValue), 2)
+	}
+	return b.String()
+}
+
+func quantiseAc(v, maximumValue float64) int {
+	q := math.Floor(signPow(v/maximumValue, 0.5)*9 + 9.5)
+	return int(math.Max(0, math.Min(18, q)))
+}
+
+func encode83(b *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		b.WriteByte(base83Chars[digit])
+	}
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(v float64) int {
+	c := math.Max(0, math.Min(1, v))
+	if c <= 0.0031308 {
+		return int(c*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
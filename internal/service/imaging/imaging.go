@@ -0,0 +1,104 @@
+// Package imaging makes previews of uploaded images using standard library decoders.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+var ErrTooManyPixels = errors.New("image is too large to decode")
+
+// Decode decodes PNG, JPEG or GIF image (first frame only). Dimensions are checked
+// before decoding, so small files declaring huge images don't exhaust memory.
+func Decode(data []byte, maxPixels int) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, "", ErrTooManyPixels
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// Encode writes thumbnail as JPEG for JPEG sources and as PNG otherwise
+// to keep transparency. It returns MIME type of the written image.
+func Encode(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// Fit downscales the image so its longest side is at most maxSide.
+// Each target pixel is an average of the source pixels it covers,
+// which is cheap and doesn't alias like nearest neighbour sampling.
+// Images already fitting are only converted to RGBA.
+func Fit(img image.Image, maxSide int) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	nw, nh := FitSize(w, h, maxSide)
+	if nw == w && nh == h {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := y*h/nh, (y+1)*h/nh
+		for x := 0; x < nw; x++ {
+			x0, x1 := x*w/nw, (x+1)*w/nw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				off := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[off])
+					g += uint64(src.Pix[off+1])
+					b += uint64(src.Pix[off+2])
+					a += uint64(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := y*dst.Stride + x*4
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// FitSize returns dimensions of the image scaled down to fit maxSide.
+func FitSize(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		nh := h * maxSide / w
+		if nh < 1 {
+			nh = 1
+		}
+		return maxSide, nh
+	}
+	nw := w * maxSide / h
+	if nw < 1 {
+		nw = 1
+	}
+	return nw, maxSide
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	return dst
+}
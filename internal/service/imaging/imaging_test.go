@@ -0,0 +1,48 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestBlurhash_SolidBlack(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	// no AC components, DC is black
+	if h := Blurhash(img, 4, 3); h != "L00000fQfQfQfQfQfQfQfQfQfQfQ" {
+		t.Errorf("blurhash MUST be L00000fQfQfQfQfQfQfQfQfQfQfQ, but %s given", h)
+	}
+}
+
+func TestFit(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 10))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	thumb := Fit(img, 64)
+	if thumb.Rect.Dx() != 64 || thumb.Rect.Dy() != 1 {
+		t.Fatalf("thumbnail MUST be 64x1, but %v given", thumb.Rect.Size())
+	}
+	if c := thumb.RGBAAt(10, 0); c != (color.RGBA{0x80, 0x80, 0x80, 0x80}) {
+		t.Errorf("averaged pixel MUST keep the color, but %v given", c)
+	}
+}
+
+func TestDecode_TooManyPixels(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black})
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// logical screen is 60000x60000 while the file is a few bytes
+	data[6], data[7], data[8], data[9] = 0x60, 0xea, 0x60, 0xea
+	if _, _, err := Decode(data, 1<<20); err != ErrTooManyPixels {
+		t.Errorf("Decode MUST fail with ErrTooManyPixels, but %v given", err)
+	}
+}
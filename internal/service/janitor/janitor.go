@@ -0,0 +1,68 @@
+package janitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Task cleans something up and returns how many items it removed.
+type Task func(now time.Time) (int, error)
+
+// Janitor runs periodic cleanup tasks in the background.
+type Janitor struct {
+	interval time.Duration
+	names    []string
+	tasks    []Task
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func New(interval time.Duration) *Janitor {
+	return &Janitor{interval: interval, stop: make(chan struct{})}
+}
+
+// Add registers the task, it must be called before Start.
+func (j *Janitor) Add(name string, t Task) {
+	j.names = append(j.names, name)
+	j.tasks = append(j.tasks, t)
+}
+
+// Start runs the tasks once and then every interval until Stop.
+func (j *Janitor) Start() {
+	j.done.Add(1)
+	go func() {
+		defer j.done.Done()
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		j.RunOnce(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				j.RunOnce(now)
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (j *Janitor) Stop() {
+	close(j.stop)
+	j.done.Wait()
+}
+
+// RunOnce runs every task, failures are reported and don't stop other tasks.
+func (j *Janitor) RunOnce(now time.Time) {
+	for i, t := range j.tasks {
+		n, err := t(now)
+		if err != nil {
+			fmt.Printf("janitor: %s failed: %v\n", j.names[i], err)
+			continue
+		}
+		if n > 0 {
+			fmt.Printf("janitor: %s removed %d\n", j.names[i], n)
+		}
+	}
+}
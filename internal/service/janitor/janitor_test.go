@@ -0,0 +1,34 @@
+package janitor
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	var runs int32
+	j := New(time.Millisecond)
+	j.Add("failing", func(time.Time) (int, error) {
+		return 0, errors.New("broken")
+	})
+	j.Add("counting", func(time.Time) (int, error) {
+		atomic.AddInt32(&runs, 1)
+		return 1, nil
+	})
+	j.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&runs) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("tasks aren't run periodically")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	j.Stop()
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(5 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != n {
+		t.Error("tasks are run after Stop")
+	}
+}
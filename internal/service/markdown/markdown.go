@@ -0,0 +1,524 @@
+// Package markdown renders message text into sanitized HTML.
+//
+// Markdown format supports a safe subset of CommonMark: paragraphs, emphasis,
+// inline code, fenced code blocks, links, autolinks, block quotes and lists.
+// Raw HTML is never passed through, it is escaped like any other text,
+// and links are allowed for http, https and mailto schemes only.
+// Line breaks inside paragraphs are kept as chat users expect.
+package markdown
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Format string
+
+const (
+	Plain    Format = "plain"
+	Markdown Format = "markdown"
+)
+
+var ErrUnknownFormat = errors.New("unknown message format")
+
+type EntityType string
+
+const (
+	EntityLink    EntityType = "link"
+	EntityCode    EntityType = "code"
+	EntityMention EntityType = "mention"
+	// EntityRoomMention is @room addressing everyone in the room,
+	// no login can be taken for it as logins are longer.
+	EntityRoomMention EntityType = "room-mention"
+)
+
+const roomMention = "room"
+
+// Entity is a structured part of the message clients may render specially.
+type Entity struct {
+	Type     EntityType
+	Text     string // link text, code block content or mentioned login
+	Url      string // for links
+	Language string // for code blocks, may be empty
+}
+
+type Document struct {
+	Html     string
+	Entities []Entity
+}
+
+// maxQuoteDepth stops nesting of block quotes, deeper markers are kept as text.
+const maxQuoteDepth = 8
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", Plain:
+		return Plain, nil
+	case Markdown:
+		return Markdown, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Render converts the source to HTML and extracts entities. Plain text only
+// gets links and mentions highlighted.
+func Render(src string, f Format) (Document, error) {
+	r := &renderer{}
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	switch f {
+	case Plain:
+		r.inline(src, inlinePlain)
+	case Markdown:
+		r.blocks(strings.Split(src, "\n"), 0)
+	default:
+		return Document{}, ErrUnknownFormat
+	}
+	return Document{Html: r.out.String(), Entities: r.entities}, nil
+}
+
+type inlineMode int
+
+const (
+	inlineMarkdown inlineMode = iota
+	inlinePlain
+	inlineLinkText // markdown without nested links
+)
+
+type renderer struct {
+	out      strings.Builder
+	entities []Entity
+}
+
+func (r *renderer) blocks(lines []string, depth int) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		r.out.WriteString("<p>")
+		r.inline(strings.Join(paragraph, "\n"), inlineMarkdown)
+		r.out.WriteString("</p>\n")
+		paragraph = nil
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+			i++
+		case indent < 4 && isFence(trimmed):
+			flush()
+			i = r.codeBlock(lines, i, trimmed)
+		case indent < 4 && strings.HasPrefix(trimmed, ">") && depth < maxQuoteDepth:
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				t = strings.TrimPrefix(t[1:], " ")
+				quoted = append(quoted, t)
+			}
+			r.out.WriteString("<blockquote>\n")
+			r.blocks(quoted, depth+1)
+			r.out.WriteString("</blockquote>\n")
+		case indent < 4 && listMarker(trimmed) != "":
+			flush()
+			i = r.list(lines, i)
+		default:
+			paragraph = append(paragraph, strings.TrimSpace(line))
+			i++
+		}
+	}
+	flush()
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// codeBlock renders fenced code block starting at lines[start] and returns
+// index of the line after it. Unclosed fence runs to the end of the message.
+func (r *renderer) codeBlock(lines []string, start int, opening string) int {
+	fenceChar := opening[0]
+	fenceLen := len(opening) - len(strings.TrimLeft(opening, string(fenceChar)))
+	info := strings.TrimSpace(opening[fenceLen:])
+	language := ""
+	if fields := strings.Fields(info); len(fields) > 0 {
+		language = fields[0]
+	}
+	i := start + 1
+	var code []string
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if len(t) >= fenceLen && strings.Trim(t, string(fenceChar)) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+	text := strings.Join(code, "\n")
+	r.out.WriteString("<pre><code")
+	if language != "" {
+		r.out.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+	}
+	r.out.WriteString(">")
+	r.out.WriteString(html.EscapeString(text))
+	if text != "" {
+		r.out.WriteString("\n")
+	}
+	r.out.WriteString("</code></pre>\n")
+	r.entities = append(r.entities, Entity{Type: EntityCode, Text: text, Language: language})
+	return i
+}
+
+// listMarker returns bullet or ordered list marker the line starts with.
+func listMarker(line string) string {
+	if len(line) >= 2 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' ' {
+		return line[:2]
+	}
+	digits := 0
+	for digits < len(line) && digits < 9 && '0' <= line[digits] && line[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && len(line) > digits+1 && (line[digits] == '.' || line[digits] == ')') && line[digits+1] == ' ' {
+		return line[:digits+2]
+	}
+	return ""
+}
+
+// list renders consecutive items of the same list kind. Lines indented
+// under an item continue it. Items hold inline content only.
+func (r *renderer) list(lines []string, start int) int {
+	first := listMarker(strings.TrimLeft(lines[start], " "))
+	ordered := first[0] >= '0' && first[0] <= '9'
+	delimiter := first[len(first)-2]
+	if ordered {
+		n, _ := strconv.Atoi(first[:len(first)-2])
+		if n != 1 {
+			r.out.WriteString(`<ol start="` + strconv.Itoa(n) + `">` + "\n")
+		} else {
+			r.out.WriteString("<ol>\n")
+		}
+	} else {
+		r.out.WriteString("<ul>\n")
+	}
+	var item []string
+	flush := func() {
+		if item == nil {
+			return
+		}
+		r.out.WriteString("<li>")
+		r.inline(strings.Join(item, "\n"), inlineMarkdown)
+		r.out.WriteString("</li>\n")
+		item = nil
+	}
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		marker := listMarker(trimmed)
+		if marker != "" && marker[len(marker)-2] == delimiter && len(line)-len(trimmed) < 4 {
+			flush()
+			item = []string{strings.TrimSpace(trimmed[len(marker):])}
+			continue
+		}
+		if strings.TrimSpace(line) == "" || len(line)-len(trimmed) < 2 {
+			break
+		}
+		item = append(item, strings.TrimSpace(line))
+	}
+	flush()
+	if ordered {
+		r.out.WriteString("</ol>\n")
+	} else {
+		r.out.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// inline renders span level elements. Everything that is not recognized
+// markup is written escaped.
+func (r *renderer) inline(s string, mode inlineMode) {
+	markdown := mode != inlinePlain
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			r.out.WriteString("<br>\n")
+			i++
+			continue
+		case markdown && c == '\\' && i+1 < len(s) && isAsciiPunct(s[i+1]):
+			r.out.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case markdown && c == '`':
+			if n := r.codeSpan(s[i:]); n > 0 {
+				i += n
+				continue
+			}
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			r.out.WriteString(s[i : i+run])
+			i += run
+			continue
+		case markdown && (c == '*' || c == '_'):
+			if n := r.emphasis(s, i, mode); n > 0 {
+				i += n
+				continue
+			}
+		case mode == inlineMarkdown && c == '[':
+			if n := r.link(s[i:]); n > 0 {
+				i += n
+				continue
+			}
+		case c == '<' && mode != inlineLinkText:
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if u, ok := safeUrl(s[i+1 : i+end]); ok && !strings.ContainsAny(s[i+1:i+end], " \n") {
+					r.writeLink(u, s[i+1:i+end], false)
+					i += end + 1
+					continue
+				}
+			}
+		case c == 'h' && mode != inlineLinkText && atWordStart(s, i):
+			if n := r.autolink(s[i:]); n > 0 {
+				i += n
+				continue
+			}
+		case c == '@' && atWordStart(s, i):
+			if n := r.mention(s[i:]); n > 0 {
+				i += n
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		r.out.WriteString(html.EscapeString(s[i : i+size]))
+		i += size
+	}
+}
+
+// codeSpan renders inline code and returns length of consumed input,
+// zero if there is no closing backtick run of the same length.
+func (r *renderer) codeSpan(s string) int {
+	n := len(s) - len(strings.TrimLeft(s, "`"))
+	for j := n; j < len(s); {
+		k := strings.IndexByte(s[j:], '`')
+		if k < 0 {
+			return 0
+		}
+		start := j + k
+		run := len(s[start:]) - len(strings.TrimLeft(s[start:], "`"))
+		if run == n {
+			code := strings.ReplaceAll(s[n:start], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			r.out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			return start + run
+		}
+		j = start + run
+	}
+	return 0
+}
+
+// emphasis renders *em*, _em_, **strong** and __strong__ starting at s[i].
+// Opening delimiter must be followed and closing one preceded by non-space,
+// underscores don't work inside words.
+func (r *renderer) emphasis(s string, i int, mode inlineMode) int {
+	c := s[i]
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0
+	}
+	delim := string(c)
+	if strings.HasPrefix(s[i:], delim+delim) {
+		delim += delim
+	}
+	open := i + len(delim)
+	if open >= len(s) || isSpaceByte(s[open]) {
+		return 0
+	}
+	for j := open; j < len(s); {
+		k := strings.IndexByte(s[j:], c)
+		if k < 0 {
+			return 0
+		}
+		end := j + k
+		run := len(s[end:]) - len(strings.TrimLeft(s[end:], delim[:1]))
+		after := end + run
+		if run == len(delim) && end > open && !isSpaceByte(s[end-1]) && s[end-1] != '\\' &&
+			(c != '_' || after >= len(s) || !isWordByte(s[after])) {
+			tag := "em"
+			if len(delim) == 2 {
+				tag = "strong"
+			}
+			r.out.WriteString("<" + tag + ">")
+			r.inline(s[open:end], mode)
+			r.out.WriteString("</" + tag + ">")
+			return after - i
+		}
+		j = after
+	}
+	return 0
+}
+
+// link renders [text](url) and returns consumed length, zero if s is not a link.
+// Links with unsafe urls are rendered as their text.
+func (r *renderer) link(s string) int {
+	depth := 0
+	closing := -1
+	for j := 0; j < len(s) && closing < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closing = j
+			}
+		}
+	}
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return 0
+	}
+	depth = 0
+	end := -1
+	for j := closing + 1; j < len(s) && end < 0; j++ {
+		switch s[j] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				end = j
+			}
+		case ' ', '\n':
+			return 0
+		}
+	}
+	if end < 0 {
+		return 0
+	}
+	text := s[1:closing]
+	if u, ok := safeUrl(s[closing+2 : end]); ok {
+		r.writeLink(u, text, true)
+	} else {
+		r.inline(text, inlineLinkText)
+	}
+	return end + 1
+}
+
+// autolink renders bare http and https urls. Trailing punctuation
+// is left out as it most likely belongs to the sentence.
+func (r *renderer) autolink(s string) int {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return 0
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>' || r == '"'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	for end > 0 && (strings.ContainsRune(".,:;!?*_'", rune(s[end-1])) ||
+		s[end-1] == ')' && strings.Count(s[:end], "(") < strings.Count(s[:end], ")")) {
+		end--
+	}
+	u, ok := safeUrl(s[:end])
+	if !ok || strings.HasSuffix(s[:end], "//") {
+		return 0
+	}
+	r.writeLink(u, s[:end], false)
+	return end
+}
+
+// mention renders @login or @room. Logins are letters and digits.
+func (r *renderer) mention(s string) int {
+	end := 1
+	for end < len(s) {
+		c, size := utf8.DecodeRuneInString(s[end:])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			break
+		}
+		end += size
+	}
+	if end == 1 {
+		return 0
+	}
+	login := s[1:end]
+	r.out.WriteString(`<span class="mention">@` + html.EscapeString(login) + "</span>")
+	if login == roomMention {
+		r.entities = append(r.entities, Entity{Type: EntityRoomMention, Text: login})
+	} else {
+		r.entities = append(r.entities, Entity{Type: EntityMention, Text: login})
+	}
+	return end
+}
+
+// writeLink renders a link, text of autolinks is not markup and is only escaped.
+func (r *renderer) writeLink(u, text string, markup bool) {
+	r.out.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener noreferrer">`)
+	start := r.out.Len()
+	if markup {
+		r.inline(text, inlineLinkText)
+	} else {
+		r.out.WriteString(html.EscapeString(text))
+	}
+	if r.out.Len() == start {
+		r.out.WriteString(html.EscapeString(u))
+	}
+	r.out.WriteString("</a>")
+	r.entities = append(r.entities, Entity{Type: EntityLink, Text: text, Url: u})
+}
+
+// safeUrl allows absolute http, https and mailto urls only,
+// so links can't run scripts or point into the app.
+func safeUrl(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return u.String(), true
+}
+
+// atWordStart reports whether s[i] doesn't continue a word,
+// so e-mail addresses aren't taken for mentions.
+func atWordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	c, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '/' && c != '@'
+}
+
+func isAsciiPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t'
+}
@@ -0,0 +1,61 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender_Markdown(t *testing.T) {
+	cases := []struct {
+		src  string
+		html string
+	}{
+		{"hello *world*", "<p>hello <em>world</em></p>\n"},
+		{"**bold** and _it_ and snake_case_name", "<p><strong>bold</strong> and <em>it</em> and snake_case_name</p>\n"},
+		{"*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>\n"},
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"[x](javascript:alert(1))", "<p>x</p>\n"},
+		{`[a "site"](https://example.com/?q="x")`, `<p><a href="https://example.com/?q=&#34;x&#34;" rel="nofollow noopener noreferrer">a &#34;site&#34;</a></p>` + "\n"},
+		{"see https://example.com/a_(b).", `<p>see <a href="https://example.com/a_(b)" rel="nofollow noopener noreferrer">https://example.com/a_(b)</a>.</p>` + "\n"},
+		{"`<b>` \\*not em\\*", "<p><code>&lt;b&gt;</code> *not em*</p>\n"},
+		{"```go\nfmt.Println(\"<hi>\")\n```", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n"},
+		{"> quote\n> more\n\n- one\n- two\n\n3. three", "<blockquote>\n<p>quote<br>\nmore</p>\n</blockquote>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n</ol>\n"},
+		{"hi @alice1, mail me at bob@example.com", "<p>hi <span class=\"mention\">@alice1</span>, mail me at bob@example.com</p>\n"},
+	}
+	for _, c := range cases {
+		doc, err := Render(c.src, Markdown)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Html != c.html {
+			t.Errorf("Render(%q):\n got %q\nwant %q", c.src, doc.Html, c.html)
+		}
+	}
+}
+
+func TestRender_Entities(t *testing.T) {
+	doc, err := Render("@alice1 look [here](https://example.com)\n```sh\nls\n```", Markdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entity{
+		{Type: EntityMention, Text: "alice1"},
+		{Type: EntityLink, Text: "here", Url: "https://example.com"},
+		{Type: EntityCode, Text: "ls", Language: "sh"},
+	}
+	if !reflect.DeepEqual(doc.Entities, expected) {
+		t.Errorf("entities:\n got %+v\nwant %+v", doc.Entities, expected)
+	}
+}
+
+func TestRender_Plain(t *testing.T) {
+	doc, err := Render("*not* <b>\nhttps://example.com @bob", Plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `*not* &lt;b&gt;<br>` + "\n" +
+		`<a href="https://example.com" rel="nofollow noopener noreferrer">https://example.com</a> <span class="mention">@bob</span>`
+	if doc.Html != expected {
+		t.Errorf("plain html:\n got %q\nwant %q", doc.Html, expected)
+	}
+}
@@ -0,0 +1,109 @@
+// Package outbound sends requests to urls registered by users, such as webhooks,
+// and keeps them off loopback, private and link-local addresses of the server's
+// own network.
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidUrl       = errors.New("url must be an absolute https url")
+	ErrForbiddenAddress = errors.New("address is not public")
+)
+
+// privateNets are ranges net.IP has no predicate for in go 1.16.
+var privateNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10", // carrier-grade nat
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15", // benchmarking
+	"fc00::/7",
+)
+
+// ValidateUrl checks the url is an absolute https url of at most maxLength bytes.
+// Addresses are checked by the dialer of NewClient once the host is resolved,
+// names can point elsewhere by then anyway.
+func ValidateUrl(s string, maxLength int) error {
+	if len(s) > maxLength {
+		return ErrInvalidUrl
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidUrl
+	}
+	return nil
+}
+
+// Public tells whether the address is routable outside of the server's network.
+func Public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Control rejects connections to addresses which aren't public. It runs after
+// name resolution, so names pointing inside the network are caught as well.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !Public(ip) {
+		return fmt.Errorf("%s: %w", host, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// NewClient returns a client which connects to public addresses only, ignores
+// proxy settings and doesn't follow redirects, since a redirect could lead
+// requests to a host nobody registered.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   Control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   timeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, n)
+	}
+	return res
+}
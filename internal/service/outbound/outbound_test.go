@@ -0,0 +1,51 @@
+package outbound
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublic(t *testing.T) {
+	for _, s := range []string{"127.0.0.1", "::1", "0.0.0.0", "10.1.2.3", "172.31.0.1", "192.168.1.1",
+		"169.254.169.254", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		if Public(net.ParseIP(s)) {
+			t.Errorf("%s MUST NOT be public", s)
+		}
+	}
+	for _, s := range []string{"93.184.216.34", "2606:2800:220:1::1"} {
+		if !Public(net.ParseIP(s)) {
+			t.Errorf("%s MUST be public", s)
+		}
+	}
+}
+
+func TestValidateUrl(t *testing.T) {
+	if err := ValidateUrl("https://example.com/hook", 100); err != nil {
+		t.Errorf("got %v for a public url", err)
+	}
+	for _, s := range []string{"http://example.com", "https://", "example.com", "https://example.com/" + string(make([]byte, 100))} {
+		if err := ValidateUrl(s, 100); !errors.Is(err, ErrInvalidUrl) {
+			t.Errorf("%q: got %v, want %v", s, err, ErrInvalidUrl)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(time.Second).Get(srv.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got %v, want %v", err, ErrForbiddenAddress)
+	}
+	if called {
+		t.Error("request reached the loopback server")
+	}
+}
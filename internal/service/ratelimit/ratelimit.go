@@ -0,0 +1,144 @@
+// Package ratelimit implements in-memory token buckets keyed by arbitrary strings,
+// such as account ids or client addresses.
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets which refilled completely are dropped,
+// a new bucket for the same key starts full anyway.
+const sweepInterval = time.Minute
+
+var ErrInvalidLimit = errors.New(`limit must look like "10/s", "30/m" or "100/h:20" with burst after the colon`)
+
+// Limit lets Rate requests per second through on average and up to Burst at once.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses "<count>/<s|m|h>[:burst]". Burst defaults to the count.
+func ParseLimit(s string) (Limit, error) {
+	spec, burst := s, ""
+	i := strings.IndexByte(s, ':')
+	if i >= 0 {
+		spec, burst = s[:i], s[i+1:]
+	}
+	hasBurst := i >= 0
+	i = strings.IndexByte(spec, '/')
+	if i < 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	count, err := strconv.Atoi(spec[:i])
+	if err != nil || count <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	var per time.Duration
+	switch spec[i+1:] {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, ErrInvalidLimit
+	}
+	l := Limit{Rate: float64(count) / per.Seconds(), Burst: count}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, ErrInvalidLimit
+		}
+	}
+	return l, nil
+}
+
+// Result describes the bucket after a request was counted.
+type Result struct {
+	Allowed    bool
+	Limit      int           // burst size
+	Remaining  int           // requests which can be made right now
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, zero if it is now
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	limit     Limit
+	now       func() time.Time
+	mu        *sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(l Limit) *Limiter {
+	return &Limiter{
+		limit:   l,
+		now:     time.Now,
+		mu:      &sync.Mutex{},
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of the key if there is one.
+func (l *Limiter) Allow(key string) Result {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lastSweep.IsZero() {
+		l.lastSweep = now
+	} else if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	burst := float64(l.limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	res := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.duration(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.duration(burst - b.tokens)
+	return res
+}
+
+// Len returns the number of tracked keys.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	burst := float64(l.limit.Burst)
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// duration returns how long it takes to refill the tokens.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("30/m:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Rate != 0.5 || l.Burst != 5 {
+		t.Errorf("got %+v, want half a request per second with burst of 5", l)
+	}
+	if l, err := ParseLimit("10/s"); err != nil || l.Burst != 10 {
+		t.Errorf("got %+v, %v, burst MUST default to the count", l, err)
+	}
+	for _, s := range []string{"", "10", "0/s", "10/d", "10/s:", "-1/s", "10/s:x"} {
+		if _, err := ParseLimit(s); err != ErrInvalidLimit {
+			t.Errorf("%q MUST be rejected, but got %v", s, err)
+		}
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(Limit{Rate: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if r := l.Allow("a"); !r.Allowed || r.Remaining != 1-i {
+			t.Fatalf("request %d within burst MUST pass, but got %+v", i, r)
+		}
+	}
+	r := l.Allow("a")
+	if r.Allowed || r.RetryAfter != time.Second || r.Reset != 2*time.Second {
+		t.Fatalf("request over burst MUST be limited for a second, but got %+v", r)
+	}
+	if r := l.Allow("b"); !r.Allowed {
+		t.Fatalf("other keys MUST have own buckets, but got %+v", r)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if r := l.Allow("a"); r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("half refilled token MUST NOT pass, but got %+v", r)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if r := l.Allow("a"); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("refilled token MUST pass, but got %+v", r)
+	}
+
+	now = now.Add(sweepInterval)
+	l.Allow("c")
+	if n := l.Len(); n != 1 {
+		t.Errorf("refilled buckets MUST be swept, but %d are tracked", n)
+	}
+}
@@ -9,6 +9,13 @@ import (
 	"time"
 )
 
+const (
+	mfaScope      = "mfa"
+	mfaExpiration = 5 * time.Minute
+)
+
+var ErrInvalidScope = errors.New("invalid token scope")
+
 // todo: key rotation
 type Jwt struct {
 	publicKey  *rsa.PublicKey
@@ -18,7 +25,8 @@ type Jwt struct {
 }
 
 type Claims struct {
-	Id string
+	Id    string
+	Scope string `json:",omitempty"`
 	jwt.StandardClaims
 }
 
@@ -39,17 +47,34 @@ func NewJwt(privateBytes, publicBytes []byte, keyExpiration time.Duration) (*Jwt
 }
 
 func (j Jwt) IssueToken(userId string) (string, error) {
+	return j.issue(userId, "", j.expire)
+}
+
+func (j Jwt) UserIdByToken(tokenString string) (string, error) {
+	return j.userId(tokenString, "")
+}
+
+func (j Jwt) IssueMfaToken(userId string) (string, error) {
+	return j.issue(userId, mfaScope, mfaExpiration)
+}
+
+func (j Jwt) UserIdByMfaToken(tokenString string) (string, error) {
+	return j.userId(tokenString, mfaScope)
+}
+
+func (j Jwt) issue(userId, scope string, expire time.Duration) (string, error) {
 	claims := Claims{
-		Id: userId,
+		Id:    userId,
+		Scope: scope,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(j.expire).Unix(),
+			ExpiresAt: time.Now().Add(expire).Unix(),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 	return token.SignedString(j.privateKey)
 }
 
-func (j Jwt) UserIdByToken(tokenString string) (string, error) {
+func (j Jwt) userId(tokenString, scope string) (string, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected token signing method")
@@ -63,5 +88,8 @@ func (j Jwt) UserIdByToken(tokenString string) (string, error) {
 	if !ok {
 		return "", errors.New("invalid token claims")
 	}
+	if claims.Scope != scope {
+		return "", ErrInvalidScope
+	}
 	return claims.Id, nil
 }
@@ -3,4 +3,9 @@ package token
 type Interface interface {
 	IssueToken(userId string) (string, error)
 	UserIdByToken(token string) (string, error)
+
+	// IssueMfaToken issues a short-lived token proving that the password
+	// was checked, but the second factor is still pending.
+	IssueMfaToken(userId string) (string, error)
+	UserIdByMfaToken(token string) (string, error)
 }
@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is "12345678901234567890" from RFC 6238 test vectors.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d MUST be %s, but %s given", v.unix, v.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code, now, 0)
+	if !ok {
+		t.Fatal("code from the previous step MUST be accepted")
+	}
+	if step != Step(now)-1 {
+		t.Errorf("matched step MUST be %d, but %d given", Step(now)-1, step)
+	}
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("code MUST NOT be accepted twice")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(5*time.Minute), 0); ok {
+		t.Error("outdated code MUST NOT be accepted")
+	}
+}
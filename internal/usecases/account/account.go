@@ -1,12 +1,25 @@
 package account
 
 import (
+	"github.com/mp-hl-2021/chat/internal/domain"
 	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/apitoken"
+	"github.com/mp-hl-2021/chat/internal/domain/lockout"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	domainroom "github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/schedule"
 	"github.com/mp-hl-2021/chat/internal/service/token"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+	"github.com/mp-hl-2021/chat/internal/usecases/room"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 	"unicode"
 )
 
@@ -16,10 +29,24 @@ var (
 	ErrTooShortString        = errors.New("too short string")
 	ErrTooLongString         = errors.New("too long string")
 
-	ErrInvalidLogin    = errors.New("login not found")
-	ErrInvalidPassword = errors.New("invalid password")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrAccountSuspended   = errors.New("account is suspended by moderators")
+
+	ErrInvalidMfaCode    = errors.New("invalid one-time password")
+	ErrMfaAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMfaNotEnrolled    = errors.New("two-factor authentication is not enrolled")
 )
 
+// LockoutError is returned when too many failed attempts were made
+// for a login or from a client address.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return "too many failed attempts"
+}
+
 const (
 	minLoginLength    = 6
 	maxLoginLength    = 32
@@ -27,24 +54,79 @@ const (
 	maxPasswordLength = 48
 )
 
+const (
+	maxFailedAttemptsPerLogin = 5
+	maxFailedAttemptsPerIp    = 20
+	failedAttemptsWindow      = time.Hour
+	lockoutBaseDelay          = time.Second
+	lockoutMaxDelay           = 15 * time.Minute
+)
+
 type Account struct {
-	Id string
+	Id      string
+	Login   string
+	Profile Profile
+	Bot     bool
+}
+
+// Session is a result of successful password check.
+type Session struct {
+	AccountId  string
+	Token      string
+	MfaPending bool // Token must be exchanged with CompleteMfaLogin
 }
 
+// Sign-ups, sign-ins, password resets and token revocations are written to the
+// audit log with the source of the request. Actor of the source is filled in
+// once the account is known, except for password resets: the reset token passes
+// through an admin, so its use isn't taken for the owner's.
 type Interface interface {
-	CreateAccount(login, password string) (Account, error)
+	CreateAccount(login, password string, src audit.Source) (Account, error)
 	GetAccountById(id string) (Account, error)
 
-	LoginToAccount(login, password string) (string, error)
+	LoginToAccount(login, password string, src audit.Source) (Session, error)
+	CompleteMfaLogin(mfaToken, code string, src audit.Source) (Session, error)
 	Authenticate(token string) (string, error)
+
+	EnrollTotp(accountId string) (TotpEnrollment, error)
+	ConfirmTotp(accountId, code string) ([]string, error)
+
+	GetProfile(actorId, accountId string) (Account, error)
+	UpdateProfile(actorId, accountId string, upd ProfileUpdate) (Account, error)
+	GetAccountsByIds(ids []string) ([]Account, error)
+
+	FindAccountByLogin(login string) (Account, error)
+	SearchAccounts(query string, offset, limit int) ([]Account, error)
+
+	DeleteAccount(actorId, accountId string, mode DeletionMode) (job.Job, error)
+
+	CreateBot(actorId, login string) (Account, error)
+	ListBots(actorId string) ([]Account, error)
+	CreateApiToken(actorId, botId, name string) (ApiToken, error)
+	ListApiTokens(actorId, botId string) ([]ApiToken, error)
+	RevokeApiToken(src audit.Source, botId, tokenId string) error
+
+	ForcePasswordReset(accountId string) (string, error)
+	// ResetPassword returns id of the account the password is set for.
+	ResetPassword(resetToken, password string, src audit.Source) (string, error)
 }
 
 type UseCases struct {
-	AccountStorage account.Interface
-	Auth           token.Interface
+	AccountStorage  account.Interface
+	TokenStorage    apitoken.Interface
+	MessageStorage  message.Interface
+	RoomStorage     domainroom.Interface // tells rooms under legal hold
+	ScheduleStorage schedule.Interface
+	Attachments     attachment.Deleter // removes attachments of erased messages
+	Lockout         lockout.Interface
+	Auth            token.Interface
+	RoomUseCases    room.Interface
+	Jobs            job.Interface
+	Audit           audit.Recorder // nothing is recorded if nil
+	ErasePolicy     ErasePolicy
 }
 
-func (a *UseCases) CreateAccount(login, password string) (Account, error) {
+func (a *UseCases) CreateAccount(login, password string, src audit.Source) (Account, error) {
 	if err := validateLogin(login); err != nil {
 		return Account{}, err
 	}
@@ -62,7 +144,20 @@ func (a *UseCases) CreateAccount(login, password string) (Account, error) {
 	if err != nil {
 		return Account{}, err
 	}
-	return Account{Id: acc.Id}, nil
+	src.Actor = acc.Id
+	if err := a.record(src, audit.ActionSignup, acc.Id, acc.Login); err != nil {
+		return Account{}, err
+	}
+	return toAccount(acc), nil
+}
+
+// record writes the event to the audit log. The action is done already, so a
+// failure is returned for the caller to know the log misses it.
+func (a *UseCases) record(src audit.Source, action, target, details string) error {
+	if a.Audit == nil {
+		return nil
+	}
+	return a.Audit.Record(src, action, target, details)
 }
 
 func (a *UseCases) GetAccountById(id string) (Account, error) {
@@ -70,33 +165,188 @@ func (a *UseCases) GetAccountById(id string) (Account, error) {
 	if err != nil {
 		return Account{}, err
 	}
-	return Account{Id: acc.Id}, err
+	return toAccount(acc), err
+}
+
+// LoginToAccount checks credentials and issues a token. Accounts with
+// two-factor authentication get MFA pending token instead of the full one.
+// Failed attempts are counted per login and per client address, and both
+// are locked out with an exponentially growing delay once their limit is exceeded.
+func (a *UseCases) LoginToAccount(login, password string, src audit.Source) (Session, error) {
+	s, err := a.login(login, password, src.Ip)
+	if err != nil {
+		// the caller needs the reason, e.g. how long the lockout lasts
+		if recordErr := a.record(src, audit.ActionSigninFailed, login, err.Error()); recordErr != nil {
+			fmt.Printf("account %s: failed to record failed sign in: %v\n", login, recordErr)
+		}
+		return Session{}, err
+	}
+	details := ""
+	if s.MfaPending {
+		details = "mfa pending"
+	}
+	src.Actor = s.AccountId
+	if err := a.record(src, audit.ActionSignin, s.AccountId, details); err != nil {
+		return Session{}, err
+	}
+	return s, nil
 }
 
-func (a *UseCases) LoginToAccount(login, password string) (string, error) {
+func (a *UseCases) login(login, password, ip string) (Session, error) {
 	if err := validateLogin(login); err != nil {
-		return "", err
+		return Session{}, err
 	}
 	if err := validatePassword(password); err != nil {
-		return "", err
+		return Session{}, err
+	}
+	loginKey := "login:" + login
+	ipKey := "ip:" + ip
+	if err := a.checkLockout(loginKey, ipKey); err != nil {
+		return Session{}, err
 	}
 	acc, err := a.AccountStorage.GetAccountByLogin(login)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return Session{}, err
+	}
+	found := err == nil && !acc.Deactivated && !acc.Bot
+	// note: unknown logins are checked against a dummy hash,
+	// so they take as much time as wrong passwords do.
+	hash := dummyPasswordHash()
+	if found {
+		hash = []byte(acc.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !found {
+		if err := a.registerFailures(loginKey, ipKey); err != nil {
+			return Session{}, err
+		}
+		return Session{}, ErrInvalidCredentials
+	}
+	if err := a.Lockout.ResetAttempts(loginKey); err != nil {
+		return Session{}, err
+	}
+	if acc.Suspended {
+		// told only to those knowing the password
+		return Session{}, ErrAccountSuspended
+	}
+	if acc.Totp.Enabled {
+		t, err := a.Auth.IssueMfaToken(acc.Id)
+		if err != nil {
+			return Session{}, err
+		}
+		return Session{AccountId: acc.Id, Token: t, MfaPending: true}, nil
+	}
+	t, err := a.Auth.IssueToken(acc.Id)
 	if err != nil {
-		return "", err
+		return Session{}, err
+	}
+	return Session{AccountId: acc.Id, Token: t}, err
+}
+
+// Authenticate returns account id for the token, either JWT or bot's api token.
+// Tokens of deactivated, suspended and erased accounts and of accounts
+// with forced password reset are rejected, so are api tokens of bots whose
+// owner is deactivated, suspended or erased.
+func (a *UseCases) Authenticate(token string) (string, error) {
+	var id string
+	var err error
+	if isApiToken(token) {
+		id, err = a.authenticateApiToken(token)
+	} else {
+		id, err = a.Auth.UserIdByToken(token)
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(acc.Credentials.Password), []byte(password)); err != nil {
-		// todo: check error type. return invalid login or password
+	if err != nil {
 		return "", err
 	}
-	t, err := a.Auth.IssueToken(acc.Id)
+	acc, err := a.AccountStorage.GetAccountById(id)
 	if err != nil {
 		return "", err
 	}
-	return t, err
+	if acc.Deactivated || acc.Suspended || acc.Reset.TokenHash != "" {
+		return "", domain.ErrUnauthorized
+	}
+	if acc.Bot {
+		// bots act on behalf of their owner and stop with them
+		owner, err := a.AccountStorage.GetAccountById(acc.BotOwner)
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", domain.ErrUnauthorized
+		}
+		if err != nil {
+			return "", err
+		}
+		if owner.Deactivated || owner.Suspended {
+			return "", domain.ErrUnauthorized
+		}
+	}
+	return id, nil
 }
 
-func (a *UseCases) Authenticate(token string) (string, error) {
-	return a.Auth.UserIdByToken(token)
+func (a *UseCases) checkLockout(keys ...string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range keys {
+		at, err := a.Lockout.GetAttempts(key)
+		if err != nil {
+			return err
+		}
+		if d := at.LockedUntil.Sub(now); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	if retryAfter > 0 {
+		return &LockoutError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (a *UseCases) registerFailures(accountKey, ipKey string) error {
+	if err := a.registerFailure(accountKey, maxFailedAttemptsPerLogin); err != nil {
+		return err
+	}
+	return a.registerFailure(ipKey, maxFailedAttemptsPerIp)
+}
+
+func (a *UseCases) registerFailure(key string, maxFailures int) error {
+	now := time.Now()
+	_, err := a.Lockout.UpdateAttempts(key, func(at lockout.Attempts) (lockout.Attempts, error) {
+		if now.Sub(at.LastFailure) > failedAttemptsWindow {
+			at.Failures = 0
+		}
+		at.Failures++
+		at.LastFailure = now
+		if at.Failures >= maxFailures {
+			at.LockedUntil = now.Add(lockoutDelay(at.Failures - maxFailures))
+		}
+		return at, nil
+	})
+	return err
+}
+
+// lockoutDelay doubles the base delay for every failure over the limit.
+func lockoutDelay(excess int) time.Duration {
+	d := lockoutBaseDelay
+	for i := 0; i < excess && d < lockoutMaxDelay; i++ {
+		d *= 2
+	}
+	if d > lockoutMaxDelay {
+		d = lockoutMaxDelay
+	}
+	return d
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		h, err := bcrypt.GenerateFromPassword([]byte("dummy password to compare with"), bcrypt.DefaultCost)
+		if err != nil {
+			panic(err)
+		}
+		dummyHash = h
+	})
+	return dummyHash
 }
 
 func validateLogin(login string) error {
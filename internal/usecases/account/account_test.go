@@ -0,0 +1,176 @@
+package account
+
+import (
+	domainaccount "github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/lockout"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/apitokenrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/lockoutrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/schedulerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokensFake issues tokens telling the account and scope as they are.
+type tokensFake struct{}
+
+func (tokensFake) IssueToken(userId string) (string, error) {
+	return "session:" + userId, nil
+}
+
+func (tokensFake) UserIdByToken(token string) (string, error) {
+	return parseFakeToken(token, "session:")
+}
+
+func (tokensFake) IssueMfaToken(userId string) (string, error) {
+	return "mfa:" + userId, nil
+}
+
+func (tokensFake) UserIdByMfaToken(token string) (string, error) {
+	return parseFakeToken(token, "mfa:")
+}
+
+func parseFakeToken(token, scope string) (string, error) {
+	if !strings.HasPrefix(token, scope) {
+		return "", errors.New("invalid token")
+	}
+	return strings.TrimPrefix(token, scope), nil
+}
+
+// newTestUseCases returns use cases over memory storage and the room use cases they leave rooms with.
+func newTestUseCases() (*UseCases, *room.UseCases) {
+	roomStorage := roomrepo.NewMemory()
+	rooms := &room.UseCases{
+		RoomStorage:     roomStorage,
+		SanctionStorage: sanctionrepo.NewMemory(),
+		BlockStorage:    blockrepo.NewMemory(),
+		Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+	}
+	return &UseCases{
+		AccountStorage:  accountrepo.NewMemory(),
+		TokenStorage:    apitokenrepo.NewMemory(),
+		MessageStorage:  messagerepo.NewMemory(),
+		RoomStorage:     roomStorage,
+		ScheduleStorage: schedulerepo.NewMemory(),
+		Lockout:         lockoutrepo.NewMemory(),
+		Auth:            tokensFake{},
+		RoomUseCases:    rooms,
+	}, rooms
+}
+
+func createAccount(t *testing.T, u *UseCases, login string) domainaccount.Account {
+	t.Helper()
+	acc, err := u.AccountStorage.CreateAccount(domainaccount.Credentials{Login: login, Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+const testPassword = "correct horse battery"
+
+// brokenAudit fails to record anything.
+type brokenAudit struct{}
+
+func (brokenAudit) Record(src audit.Source, action, target, details string) error {
+	return errors.New("audit log is down")
+}
+
+func TestLoginLockout(t *testing.T) {
+	u, _ := newTestUseCases()
+	src := audit.Source{Ip: "192.0.2.1"}
+	acc, err := u.CreateAccount("alice1", testPassword, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failed sign ins tell the reason even if the audit log misses them
+	u.Audit = brokenAudit{}
+	for i := 0; i < maxFailedAttemptsPerLogin; i++ {
+		if _, err := u.LoginToAccount("alice1", "wrong password guess", src); err != ErrInvalidCredentials {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, ErrInvalidCredentials)
+		}
+	}
+	_, err = u.LoginToAccount("alice1", testPassword, audit.Source{Ip: "192.0.2.2"})
+	var locked *LockoutError
+	if !errors.As(err, &locked) || locked.RetryAfter <= 0 || locked.RetryAfter > lockoutBaseDelay {
+		t.Fatalf("got %v signing in after too many failures, want lockout for up to %v", err, lockoutBaseDelay)
+	}
+	u.Audit = nil
+
+	// once the lock runs out, a right password resets the count
+	expireLock(t, u, "login:alice1")
+	s, err := u.LoginToAccount("alice1", testPassword, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.AccountId != acc.Id || s.MfaPending {
+		t.Errorf("got session %+v, want a full session of %s", s, acc.Id)
+	}
+	at, err := u.Lockout.GetAttempts("login:alice1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Failures != 0 {
+		t.Errorf("got %d failures after a successful sign in, want 0", at.Failures)
+	}
+}
+
+func TestLoginLockoutByIp(t *testing.T) {
+	u, _ := newTestUseCases()
+	src := audit.Source{Ip: "192.0.2.1"}
+	if _, err := u.CreateAccount("alice1", testPassword, src); err != nil {
+		t.Fatal(err)
+	}
+	// unknown logins count too, so guessing logins gets locked as well
+	for i := 0; i < maxFailedAttemptsPerIp; i++ {
+		login := "nobody" + string(rune('a'+i))
+		if _, err := u.LoginToAccount(login, testPassword, src); err != ErrInvalidCredentials {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, ErrInvalidCredentials)
+		}
+	}
+	var locked *LockoutError
+	if _, err := u.LoginToAccount("alice1", testPassword, src); !errors.As(err, &locked) {
+		t.Errorf("got %v signing in from a locked address, want lockout", err)
+	}
+	if _, err := u.LoginToAccount("alice1", testPassword, audit.Source{Ip: "192.0.2.2"}); err != nil {
+		t.Errorf("got %v signing in from another address", err)
+	}
+}
+
+func TestLockoutDelay(t *testing.T) {
+	for _, c := range []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, lockoutBaseDelay},
+		{3, 8 * lockoutBaseDelay},
+		{100, lockoutMaxDelay},
+	} {
+		if got := lockoutDelay(c.excess); got != c.want {
+			t.Errorf("excess %d: got %v, want %v", c.excess, got, c.want)
+		}
+	}
+}
+
+func expireLock(t *testing.T, u *UseCases, key string) {
+	t.Helper()
+	_, err := u.Lockout.UpdateAttempts(key, func(at lockout.Attempts) (lockout.Attempts, error) {
+		at.LockedUntil = time.Now().Add(-time.Second)
+		return at, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
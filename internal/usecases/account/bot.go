@@ -0,0 +1,190 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/apitoken"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// ApiTokenPrefix tells api tokens from JWT in Authorization header.
+	ApiTokenPrefix = "bot_"
+
+	apiTokenSize          = 32
+	maxApiTokenNameLength = 64
+	maxApiTokensPerBot    = 10
+)
+
+var (
+	ErrBotsCantManageBots = errors.New("bots can't manage bots")
+	ErrTooManyApiTokens   = errors.New("too many api tokens")
+)
+
+type ApiToken struct {
+	Id        string
+	Name      string
+	Token     string // set only when the token is created
+	CreatedAt time.Time
+}
+
+// CreateBot creates a bot account owned by the actor. Bots have no password,
+// they authenticate with api tokens issued by their owner.
+func (a *UseCases) CreateBot(actorId, login string) (Account, error) {
+	if err := validateLogin(login); err != nil {
+		return Account{}, err
+	}
+	if err := a.checkHuman(actorId); err != nil {
+		return Account{}, err
+	}
+	bot, err := a.AccountStorage.CreateBot(login, actorId)
+	if err != nil {
+		return Account{}, err
+	}
+	return toAccount(bot), nil
+}
+
+func (a *UseCases) ListBots(actorId string) ([]Account, error) {
+	bots, err := a.AccountStorage.ListBots(actorId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Account, 0, len(bots))
+	for _, bot := range bots {
+		if bot.Deactivated {
+			continue
+		}
+		res = append(res, toAccount(bot))
+	}
+	return res, nil
+}
+
+// CreateApiToken issues a token for the bot. The token is returned once,
+// only its hash is kept.
+func (a *UseCases) CreateApiToken(actorId, botId, name string) (ApiToken, error) {
+	if err := validateProfileString(name, maxApiTokenNameLength, false); err != nil {
+		return ApiToken{}, err
+	}
+	if _, err := a.ownedBot(actorId, botId); err != nil {
+		return ApiToken{}, err
+	}
+	tt, err := a.TokenStorage.ListTokens(botId)
+	if err != nil {
+		return ApiToken{}, err
+	}
+	if len(tt) >= maxApiTokensPerBot {
+		return ApiToken{}, ErrTooManyApiTokens
+	}
+	b := make([]byte, apiTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return ApiToken{}, err
+	}
+	secret := ApiTokenPrefix + hex.EncodeToString(b)
+	t, err := a.TokenStorage.CreateToken(apitoken.Token{
+		AccountId: botId,
+		Name:      name,
+		Hash:      hashApiToken(secret),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return ApiToken{}, err
+	}
+	res := toApiToken(t)
+	res.Token = secret
+	return res, nil
+}
+
+func (a *UseCases) ListApiTokens(actorId, botId string) ([]ApiToken, error) {
+	if _, err := a.ownedBot(actorId, botId); err != nil {
+		return nil, err
+	}
+	tt, err := a.TokenStorage.ListTokens(botId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ApiToken, 0, len(tt))
+	for _, t := range tt {
+		res = append(res, toApiToken(t))
+	}
+	return res, nil
+}
+
+func (a *UseCases) RevokeApiToken(src audit.Source, botId, tokenId string) error {
+	if _, err := a.ownedBot(src.Actor, botId); err != nil {
+		return err
+	}
+	tt, err := a.TokenStorage.ListTokens(botId)
+	if err != nil {
+		return err
+	}
+	for _, t := range tt {
+		if t.Id != tokenId {
+			continue
+		}
+		if err := a.TokenStorage.DeleteToken(tokenId); err != nil {
+			return err
+		}
+		return a.record(src, audit.ActionTokenRevoke, tokenId, "bot "+botId)
+	}
+	return domain.ErrNotFound
+}
+
+// authenticateApiToken returns id of the bot the token was issued for.
+func (a *UseCases) authenticateApiToken(token string) (string, error) {
+	t, err := a.TokenStorage.GetTokenByHash(hashApiToken(token))
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", domain.ErrUnauthorized
+	}
+	if err != nil {
+		return "", err
+	}
+	return t.AccountId, nil
+}
+
+// ownedBot returns the bot if the actor created it. Bots of other
+// accounts are reported as not found.
+func (a *UseCases) ownedBot(actorId, botId string) (account.Account, error) {
+	bot, err := a.AccountStorage.GetAccountById(botId)
+	if err != nil {
+		return bot, err
+	}
+	if !bot.Bot || bot.BotOwner != actorId || bot.Deactivated {
+		return account.Account{}, domain.ErrNotFound
+	}
+	return bot, nil
+}
+
+func (a *UseCases) checkHuman(actorId string) error {
+	acc, err := a.AccountStorage.GetAccountById(actorId)
+	if err != nil {
+		return err
+	}
+	if acc.Bot {
+		return ErrBotsCantManageBots
+	}
+	return nil
+}
+
+func isApiToken(token string) bool {
+	return strings.HasPrefix(token, ApiTokenPrefix)
+}
+
+func hashApiToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func toApiToken(t apitoken.Token) ApiToken {
+	return ApiToken{
+		Id:        t.Id,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+	}
+}
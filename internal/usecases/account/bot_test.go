@@ -0,0 +1,127 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	domainaccount "github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApiTokens(t *testing.T) {
+	u, _ := newTestUseCases()
+	owner := createAccount(t, u, "owner")
+	other := createAccount(t, u, "other")
+
+	bot, err := u.CreateBot(owner.Id, "buildbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CreateBot(bot.Id, "botsbot"); err != ErrBotsCantManageBots {
+		t.Errorf("got %v creating a bot as a bot, want %v", err, ErrBotsCantManageBots)
+	}
+	if _, err := u.CreateApiToken(other.Id, bot.Id, "ci"); err != domain.ErrNotFound {
+		t.Errorf("got %v issuing a token for another's bot, want %v", err, domain.ErrNotFound)
+	}
+	tok, err := u.CreateApiToken(owner.Id, bot.Id, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tok.Token, ApiTokenPrefix) {
+		t.Errorf("got token %q, want prefix %q", tok.Token, ApiTokenPrefix)
+	}
+	id, err := u.Authenticate(tok.Token)
+	if err != nil || id != bot.Id {
+		t.Errorf("got %q, %v authenticating the token, want %q", id, err, bot.Id)
+	}
+	if _, err := u.Authenticate(ApiTokenPrefix + "forged"); err != domain.ErrUnauthorized {
+		t.Errorf("got %v authenticating a forged token, want %v", err, domain.ErrUnauthorized)
+	}
+	tt, err := u.ListApiTokens(owner.Id, bot.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tt) != 1 || tt[0].Token != "" {
+		t.Errorf("got %v, want the token listed without its secret", tt)
+	}
+
+	for i := 1; i < maxApiTokensPerBot; i++ {
+		if _, err := u.CreateApiToken(owner.Id, bot.Id, "spare"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := u.CreateApiToken(owner.Id, bot.Id, "extra"); err != ErrTooManyApiTokens {
+		t.Errorf("got %v issuing too many tokens, want %v", err, ErrTooManyApiTokens)
+	}
+
+	if err := u.RevokeApiToken(audit.Source{Actor: other.Id}, bot.Id, tok.Id); err != domain.ErrNotFound {
+		t.Errorf("got %v revoking a token of another's bot, want %v", err, domain.ErrNotFound)
+	}
+	if err := u.RevokeApiToken(audit.Source{Actor: owner.Id}, bot.Id, tok.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Authenticate(tok.Token); err != domain.ErrUnauthorized {
+		t.Errorf("got %v authenticating a revoked token, want %v", err, domain.ErrUnauthorized)
+	}
+}
+
+func TestBotsStopWithOwner(t *testing.T) {
+	u, _ := newTestUseCases()
+	owner := createAccount(t, u, "owner")
+	bot, err := u.CreateBot(owner.Id, "buildbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := u.CreateApiToken(owner.Id, bot.Id, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = u.AccountStorage.UpdateAccount(owner.Id, func(acc domainaccount.Account) (domainaccount.Account, error) {
+		acc.Suspended = true
+		return acc, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Authenticate(tok.Token); err != domain.ErrUnauthorized {
+		t.Errorf("got %v authenticating a bot of a suspended owner, want %v", err, domain.ErrUnauthorized)
+	}
+}
+
+func TestEraseOwnerErasesBots(t *testing.T) {
+	u, rooms := newTestUseCases()
+	owner := createAccount(t, u, "owner")
+	bot, err := u.CreateBot(owner.Id, "buildbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := u.CreateApiToken(owner.Id, bot.Id, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rooms.CreateRoom(owner.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rooms.AddMembers(audit.Source{Actor: owner.Id}, r.Id, []string{bot.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	j := job.Job{Kind: EraseJobKind, Owner: owner.Id, Payload: owner.Id}
+	if _, err := u.EraseJob(j, func(string, int, int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AccountStorage.GetAccountById(bot.Id); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("got %v getting a bot of the erased account, want %v", err, domain.ErrNotFound)
+	}
+	if rr, err := rooms.ListRooms(bot.Id); err != nil || len(rr) != 0 {
+		t.Errorf("got %d rooms, %v of the erased bot", len(rr), err)
+	}
+	if _, err := u.Authenticate(tok.Token); err != domain.ErrUnauthorized {
+		t.Errorf("got %v authenticating a token of the erased bot, want %v", err, domain.ErrUnauthorized)
+	}
+}
@@ -0,0 +1,261 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownDeletionMode = errors.New("unknown deletion mode")
+
+type DeletionMode string
+
+const (
+	// Deactivate blocks login and hides the profile.
+	Deactivate DeletionMode = "deactivate"
+	// Erase removes credentials and profile, the account leaves all the rooms
+	// and its messages are processed according to ErasePolicy. Bots of the
+	// account are erased along with it.
+	Erase DeletionMode = "erase"
+)
+
+type ErasePolicy string
+
+const (
+	AnonymizeMessages ErasePolicy = "anonymize"
+	// DeleteMessages removes messages with their attachments, except in rooms
+	// under legal hold, where they are anonymized.
+	DeleteMessages ErasePolicy = "delete"
+)
+
+const EraseJobKind = "account-erasure"
+
+// eraseRetryDelay is how long a failed erasure waits before the next attempt
+const eraseRetryDelay = 5 * time.Minute
+
+// eraseBatchSize is the number of messages deleted at once
+const eraseBatchSize = 500
+
+// steps of erasure job saved as its cursor
+const (
+	eraseStepMessages = ""
+	eraseStepRooms    = "rooms"
+	eraseStepAccount  = "account"
+)
+
+// DeleteAccount deactivates the account or starts its erasure. Bots are also
+// deleted by their owners. The returned job is empty for deactivation.
+func (a *UseCases) DeleteAccount(actorId, accountId string, mode DeletionMode) (job.Job, error) {
+	if actorId != accountId {
+		if _, err := a.ownedBot(actorId, accountId); err != nil {
+			return job.Job{}, domain.ErrUnauthorized
+		}
+	}
+	if mode != Deactivate && mode != Erase {
+		return job.Job{}, ErrUnknownDeletionMode
+	}
+	_, err := a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		acc.Deactivated = true
+		return acc, nil
+	})
+	if err != nil {
+		return job.Job{}, err
+	}
+	if mode == Deactivate {
+		return job.Job{}, nil
+	}
+	j, err := a.Jobs.Submit(accountId, EraseJobKind, accountId)
+	if err != nil {
+		// the account can't sign in to ask again, so it stays as it was
+		_, rollbackErr := a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+			acc.Deactivated = false
+			return acc, nil
+		})
+		if rollbackErr != nil {
+			fmt.Printf("account %s: failed to reactivate after erasure wasn't started: %v\n", accountId, rollbackErr)
+		}
+		return job.Job{}, err
+	}
+	return j, nil
+}
+
+// EraseJob handles erasure jobs. The account is deactivated already and can't
+// ask again, so failed attempts are retried until the erasure is done. Every step
+// is safe to repeat: rooms the account has already left aren't listed anymore
+// and processed messages aren't found again.
+func (a *UseCases) EraseJob(j job.Job, progress job.Progress) (string, error) {
+	result, err := a.erase(j, progress)
+	if err != nil {
+		return "", job.RetryAfter(time.Now().Add(eraseRetryDelay), err)
+	}
+	return result, nil
+}
+
+func (a *UseCases) erase(j job.Job, progress job.Progress) (string, error) {
+	accountId := j.Payload
+	step := j.Cursor
+
+	if step == eraseStepMessages {
+		if err := a.eraseMessages(accountId); err != nil {
+			return "", err
+		}
+		step = eraseStepRooms
+	}
+
+	if step == eraseStepRooms {
+		rr, err := a.RoomUseCases.ListRooms(accountId)
+		if err != nil {
+			return "", err
+		}
+		total := j.Total
+		if total == 0 {
+			total = len(rr) + 1
+		}
+		done := total - len(rr) - 1
+		if err := progress(step, done, total); err != nil {
+			return "", err
+		}
+		for _, r := range rr {
+			if err := a.leaveRoom(accountId, r.Id); err != nil {
+				return "", err
+			}
+			done++
+			if err := progress(step, done, total); err != nil {
+				return "", err
+			}
+		}
+		step = eraseStepAccount
+		if err := progress(step, done, total); err != nil {
+			return "", err
+		}
+		j.Total = total
+	}
+
+	// bots go with their owner, erased ones aren't listed anymore
+	bots, err := a.AccountStorage.ListBots(accountId)
+	if err != nil {
+		return "", err
+	}
+	for _, bot := range bots {
+		if err := a.eraseBot(j.Owner, bot.Id); err != nil {
+			return "", fmt.Errorf("failed to erase bot %s: %w", bot.Id, err)
+		}
+	}
+	if err := a.deleteCredentials(accountId); err != nil {
+		return "", err
+	}
+	if err := a.record(audit.Source{Actor: j.Owner}, audit.ActionErase, accountId, string(a.ErasePolicy)); err != nil {
+		return "", err
+	}
+	return "", progress(step, j.Total, j.Total)
+}
+
+// eraseBot does all the steps of erasure at once, bots are members of few rooms.
+func (a *UseCases) eraseBot(actorId, botId string) error {
+	_, err := a.AccountStorage.UpdateAccount(botId, func(acc account.Account) (account.Account, error) {
+		acc.Deactivated = true
+		return acc, nil
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.eraseMessages(botId); err != nil {
+		return err
+	}
+	rr, err := a.RoomUseCases.ListRooms(botId)
+	if err != nil {
+		return err
+	}
+	for _, r := range rr {
+		if err := a.leaveRoom(botId, r.Id); err != nil {
+			return err
+		}
+	}
+	if err := a.deleteCredentials(botId); err != nil {
+		return err
+	}
+	return a.record(audit.Source{Actor: actorId}, audit.ActionErase, botId, string(a.ErasePolicy))
+}
+
+func (a *UseCases) eraseMessages(accountId string) error {
+	var err error
+	switch a.ErasePolicy {
+	case DeleteMessages:
+		err = a.deleteMessages(accountId)
+	default:
+		_, err = a.MessageStorage.AnonymizeMessages(accountId)
+	}
+	if err != nil {
+		return err
+	}
+	// unsent messages go whatever the policy is
+	_, err = a.ScheduleStorage.DeleteScheduledByAuthor(accountId)
+	return err
+}
+
+// deleteMessages removes messages of the account batch by batch. Attachments
+// go first, so a retry after a failure still finds the messages they belong to.
+// Rooms under legal hold keep the messages anonymized instead.
+func (a *UseCases) deleteMessages(accountId string) error {
+	held, err := a.RoomStorage.ListHeldRooms()
+	if err != nil {
+		return err
+	}
+	for {
+		mm, err := a.MessageStorage.ListMessagesByAuthor(accountId, held, eraseBatchSize)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(mm))
+		var attachmentIds []string
+		for _, m := range mm {
+			ids = append(ids, m.Id)
+			attachmentIds = append(attachmentIds, m.Attachments...)
+		}
+		if err := a.Attachments.DeleteAttachments(attachmentIds); err != nil {
+			return err
+		}
+		if _, err := a.MessageStorage.DeleteMessagesByIds(ids); err != nil {
+			return err
+		}
+		if len(mm) < eraseBatchSize {
+			break
+		}
+	}
+	// whatever is left is in held rooms, including rooms held since the listing
+	_, err = a.MessageStorage.AnonymizeMessages(accountId)
+	return err
+}
+
+func (a *UseCases) leaveRoom(accountId, roomId string) error {
+	if err := a.RoomUseCases.RemoveMembers(audit.Source{Actor: accountId}, roomId, []string{accountId}); err != nil {
+		return fmt.Errorf("failed to leave room %s: %w", roomId, err)
+	}
+	return nil
+}
+
+// deleteCredentials removes api tokens and the account itself.
+func (a *UseCases) deleteCredentials(accountId string) error {
+	tt, err := a.TokenStorage.ListTokens(accountId)
+	if err != nil {
+		return err
+	}
+	for _, t := range tt {
+		if err := a.TokenStorage.DeleteToken(t.Id); err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+	}
+	err = a.AccountStorage.DeleteAccount(accountId)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/apitoken"
+	domainattachment "github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+	"github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// flakyRooms fails to remove members the given number of times.
+type flakyRooms struct {
+	room.Interface
+	failures int
+}
+
+func (r *flakyRooms) RemoveMembers(src audit.Source, roomId string, members []string) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("storage is down")
+	}
+	return r.Interface.RemoveMembers(src, roomId, members)
+}
+
+func TestEraseJobResumes(t *testing.T) {
+	u, rooms := newTestUseCases()
+	u.RoomUseCases = &flakyRooms{Interface: rooms, failures: 1}
+	acc := createAccount(t, u, "gone")
+	for i := 0; i < 2; i++ {
+		r, err := rooms.CreateRoom(acc.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.MessageStorage.CreateMessage(message.Message{Author: acc.Id, Room: r.Id, Text: "hi", CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := u.TokenStorage.CreateToken(apitoken.Token{AccountId: acc.Id, Name: "ci", Hash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j := job.Job{Kind: EraseJobKind, Owner: acc.Id, Payload: acc.Id}
+	progress := func(cursor string, done, total int) error {
+		j.Cursor, j.Done, j.Total = cursor, done, total
+		return nil
+	}
+	_, err := u.EraseJob(j, progress)
+	var retry *job.RetryError
+	if !errors.As(err, &retry) || retry.Err == nil {
+		t.Fatalf("got %v, a failed erasure must be retried with the reason", err)
+	}
+	if j.Cursor != eraseStepRooms {
+		t.Errorf("got cursor %q, want %q once messages are processed", j.Cursor, eraseStepRooms)
+	}
+	if _, err := u.AccountStorage.GetAccountById(acc.Id); err != nil {
+		t.Errorf("got %v, the account must stay until the erasure is done", err)
+	}
+
+	// messages are not processed again, the messages step would anonymize this one
+	later, err := u.MessageStorage.CreateMessage(message.Message{Author: acc.Id, Room: "other", Text: "late", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.EraseJob(j, progress); err != nil {
+		t.Fatal(err)
+	}
+	if j.Done != j.Total || j.Total != 3 {
+		t.Errorf("got progress %d of %d, want 3 of 3", j.Done, j.Total)
+	}
+	rr, err := rooms.ListRooms(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rr) != 0 {
+		t.Errorf("got %d rooms of the erased account", len(rr))
+	}
+	if _, err := u.AccountStorage.GetAccountById(acc.Id); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("got %v getting the erased account, want %v", err, domain.ErrNotFound)
+	}
+	if tt, err := u.TokenStorage.ListTokens(acc.Id); err != nil || len(tt) != 0 {
+		t.Errorf("got %d tokens, %v of the erased account", len(tt), err)
+	}
+	mm, err := u.MessageStorage.GetMessagesByIds([]string{later.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].Author != acc.Id {
+		t.Errorf("got %v, the resumed erasure must start from the saved step", mm)
+	}
+}
+
+// blobsFake keeps keys of stored blobs.
+type blobsFake map[string]bool
+
+func (b blobsFake) PutBlob(key string, r io.Reader, size int64) error {
+	b[key] = true
+	return nil
+}
+
+func (b blobsFake) GetBlob(key string) (io.ReadCloser, error) {
+	panic("implement me")
+}
+
+func (b blobsFake) DeleteBlob(key string) error {
+	delete(b, key)
+	return nil
+}
+
+func TestEraseDeletesAttachments(t *testing.T) {
+	u, _ := newTestUseCases()
+	attachments := attachmentrepo.NewMemory()
+	blobs := blobsFake{"photo": true, "other": true, "evidence": true}
+	u.Attachments = &attachment.UseCases{AttachmentStorage: attachments, BlobStorage: blobs}
+	u.ErasePolicy = DeleteMessages
+	acc := createAccount(t, u, "gone")
+	held, err := u.RoomStorage.CreateRoom(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.RoomStorage.SetLegalHold(held.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	evidence, err := attachments.CreateAttachment(domainattachment.Attachment{Room: held.Id, Owner: acc.Id, Size: 1, BlobKey: "evidence"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heldMessage, err := u.MessageStorage.CreateMessage(message.Message{Author: acc.Id, Room: held.Id, Text: "kept", Attachments: []string{evidence.Id}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := attachments.CreateAttachment(domainattachment.Attachment{Room: "room", Owner: acc.Id, Size: 1, BlobKey: "photo"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := attachments.CreateAttachment(domainattachment.Attachment{Room: "room", Owner: "bob", Size: 1, BlobKey: "other"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.MessageStorage.CreateMessage(message.Message{Author: acc.Id, Room: "room", Text: "look", Attachments: []string{a.Id}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := u.MessageStorage.CreateMessage(message.Message{Author: "bob", Room: "room", Text: "nice", Attachments: []string{other.Id}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := job.Job{Kind: EraseJobKind, Owner: acc.Id, Payload: acc.Id}
+	progress := func(cursor string, done, total int) error {
+		j.Cursor, j.Done, j.Total = cursor, done, total
+		return nil
+	}
+	if _, err := u.EraseJob(j, progress); err != nil {
+		t.Fatal(err)
+	}
+	if aa, err := attachments.GetAttachmentsByIds([]string{a.Id, other.Id, evidence.Id}); err != nil || len(aa) != 2 {
+		t.Errorf("got %+v, %v, want attachments of the other author and of the held room", aa, err)
+	}
+	if blobs["photo"] || !blobs["other"] || !blobs["evidence"] {
+		t.Errorf("got blobs %v, want only the one of the erased message gone", blobs)
+	}
+	mm, err := u.MessageStorage.ListMessagesByAuthor(acc.Id, nil, 10)
+	if err != nil || len(mm) != 0 {
+		t.Errorf("got %d messages, %v of the erased account", len(mm), err)
+	}
+	if mm, err := u.MessageStorage.GetMessagesByIds([]string{kept.Id}); err != nil || len(mm) != 1 {
+		t.Errorf("got %v, %v, messages of others must stay", mm, err)
+	}
+	// messages in rooms under legal hold are anonymized instead
+	mm, err = u.MessageStorage.GetMessagesByIds([]string{heldMessage.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].Author != "" {
+		t.Errorf("got %+v, want the message of the held room anonymized", mm)
+	}
+}
@@ -0,0 +1,184 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/service/totp"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer          = "chat"
+	recoveryCodesNumber = 10
+	recoveryCodeSize    = 10
+)
+
+type TotpEnrollment struct {
+	Secret string
+	Uri    string
+}
+
+// EnrollTotp generates a new secret for the account. Two-factor authentication
+// is enabled only after the secret is confirmed with ConfirmTotp.
+func (a *UseCases) EnrollTotp(accountId string) (TotpEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+	acc, err := a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		if acc.Totp.Enabled {
+			return acc, ErrMfaAlreadyEnabled
+		}
+		acc.Totp = account.Totp{Secret: secret}
+		return acc, nil
+	})
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+	return TotpEnrollment{
+		Secret: secret,
+		Uri:    totp.Uri(totpIssuer, acc.Login, secret),
+	}, nil
+}
+
+// ConfirmTotp enables two-factor authentication if the code matches
+// the enrolled secret. It returns single-use recovery codes.
+func (a *UseCases) ConfirmTotp(accountId, code string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		if acc.Totp.Enabled {
+			return acc, ErrMfaAlreadyEnabled
+		}
+		if acc.Totp.Secret == "" {
+			return acc, ErrMfaNotEnrolled
+		}
+		step, ok := totp.Validate(acc.Totp.Secret, code, now, acc.Totp.LastStep)
+		if !ok {
+			return acc, ErrInvalidMfaCode
+		}
+		acc.Totp.Enabled = true
+		acc.Totp.LastStep = step
+		acc.Totp.RecoveryCodes = hashes
+		return acc, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CompleteMfaLogin exchanges MFA pending token and one-time password
+// or recovery code for the full token.
+func (a *UseCases) CompleteMfaLogin(mfaToken, code string, src audit.Source) (Session, error) {
+	s, err := a.completeMfaLogin(mfaToken, code, src.Ip)
+	if err != nil {
+		if recordErr := a.record(src, audit.ActionSigninFailed, "", "mfa: "+err.Error()); recordErr != nil {
+			fmt.Printf("account: failed to record failed second factor: %v\n", recordErr)
+		}
+		return Session{}, err
+	}
+	src.Actor = s.AccountId
+	if err := a.record(src, audit.ActionSignin, s.AccountId, "mfa"); err != nil {
+		return Session{}, err
+	}
+	return s, nil
+}
+
+func (a *UseCases) completeMfaLogin(mfaToken, code, ip string) (Session, error) {
+	id, err := a.Auth.UserIdByMfaToken(mfaToken)
+	if err != nil {
+		return Session{}, err
+	}
+	mfaKey := "mfa:" + id
+	ipKey := "ip:" + ip
+	if err := a.checkLockout(mfaKey, ipKey); err != nil {
+		return Session{}, err
+	}
+	now := time.Now()
+	_, err = a.AccountStorage.UpdateAccount(id, func(acc account.Account) (account.Account, error) {
+		if !acc.Totp.Enabled {
+			return acc, ErrMfaNotEnrolled
+		}
+		if step, ok := totp.Validate(acc.Totp.Secret, code, now, acc.Totp.LastStep); ok {
+			acc.Totp.LastStep = step
+			return acc, nil
+		}
+		rest, ok := useRecoveryCode(acc.Totp.RecoveryCodes, code)
+		if !ok {
+			return acc, ErrInvalidMfaCode
+		}
+		acc.Totp.RecoveryCodes = rest
+		return acc, nil
+	})
+	if errors.Is(err, ErrInvalidMfaCode) {
+		if err := a.registerFailures(mfaKey, ipKey); err != nil {
+			return Session{}, err
+		}
+		return Session{}, err
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if err := a.Lockout.ResetAttempts(mfaKey); err != nil {
+		return Session{}, err
+	}
+	t, err := a.Auth.IssueToken(id)
+	if err != nil {
+		return Session{}, err
+	}
+	return Session{AccountId: id, Token: t}, nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesNumber)
+	hashes := make([]string, 0, recoveryCodesNumber)
+	for i := 0; i < recoveryCodesNumber; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)
+		parts := make([]string, 0, len(raw)/4)
+		for j := 0; j < len(raw); j += 4 {
+			parts = append(parts, raw[j:j+4])
+		}
+		codes = append(codes, strings.Join(parts, "-"))
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// useRecoveryCode returns hashes without the used one.
+func useRecoveryCode(hashes []string, code string) ([]string, bool) {
+	h := hashRecoveryCode(code)
+	for i := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hashes[i]), []byte(h)) == 1 {
+			rest := make([]string, 0, len(hashes)-1)
+			rest = append(rest, hashes[:i]...)
+			return append(rest, hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
+
+// hashRecoveryCode doesn't need to be slow: recovery codes are random
+// and long enough to withstand brute force.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
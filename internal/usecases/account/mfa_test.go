@@ -0,0 +1,130 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/service/totp"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enrollTotp creates an account with two-factor authentication enabled
+// and returns it with its secret and recovery codes.
+func enrollTotp(t *testing.T, u *UseCases) (string, string, []string) {
+	t.Helper()
+	acc, err := u.CreateAccount("alice1", testPassword, audit.Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ConfirmTotp(acc.Id, "000000"); err != ErrMfaNotEnrolled {
+		t.Errorf("got %v confirming before enrollment, want %v", err, ErrMfaNotEnrolled)
+	}
+	e, err := u.EnrollTotp(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(e.Uri, "otpauth://totp/chat:alice1?") {
+		t.Errorf("got uri %s", e.Uri)
+	}
+	step := totp.Step(time.Now())
+	wrong := totpCode(t, e.Secret, step+100)
+	if _, err := u.ConfirmTotp(acc.Id, wrong); err != ErrInvalidMfaCode {
+		t.Errorf("got %v confirming with a wrong code, want %v", err, ErrInvalidMfaCode)
+	}
+	codes, err := u.ConfirmTotp(acc.Id, totpCode(t, e.Secret, step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodesNumber {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodesNumber)
+	}
+	if _, err := u.EnrollTotp(acc.Id); err != ErrMfaAlreadyEnabled {
+		t.Errorf("got %v enrolling again, want %v", err, ErrMfaAlreadyEnabled)
+	}
+	return acc.Id, e.Secret, codes
+}
+
+func TestMfaLogin(t *testing.T) {
+	u, _ := newTestUseCases()
+	id, secret, _ := enrollTotp(t, u)
+
+	s, err := u.LoginToAccount("alice1", testPassword, audit.Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.MfaPending {
+		t.Fatal("got a full session, want the second factor pending")
+	}
+	if _, err := u.Authenticate(s.Token); err == nil {
+		t.Error("authenticated with a token of pending sign in")
+	}
+
+	// the code used to confirm enrollment can't be used again
+	step := totp.Step(time.Now())
+	if _, err := u.CompleteMfaLogin(s.Token, totpCode(t, secret, step-1), audit.Source{}); err != ErrInvalidMfaCode {
+		t.Errorf("got %v with a used code, want %v", err, ErrInvalidMfaCode)
+	}
+	full, err := u.CompleteMfaLogin(s.Token, totpCode(t, secret, step+1), audit.Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.AccountId != id || full.MfaPending {
+		t.Errorf("got session %+v, want a full session of %s", full, id)
+	}
+	if got, err := u.Authenticate(full.Token); err != nil || got != id {
+		t.Errorf("got %q, %v authenticating the full session, want %q", got, err, id)
+	}
+	if _, err := u.CompleteMfaLogin(full.Token, totpCode(t, secret, step), audit.Source{}); err == nil {
+		t.Error("completed sign in with a full session token instead of the pending one")
+	}
+}
+
+func TestMfaRecoveryCodes(t *testing.T) {
+	u, _ := newTestUseCases()
+	_, _, codes := enrollTotp(t, u)
+	s, err := u.LoginToAccount("alice1", testPassword, audit.Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// codes are accepted in any case and with or without dashes
+	code := strings.ToLower(strings.Replace(codes[0], "-", "", 1))
+	if _, err := u.CompleteMfaLogin(s.Token, code, audit.Source{}); err != nil {
+		t.Fatalf("got %v with a recovery code", err)
+	}
+	if _, err := u.CompleteMfaLogin(s.Token, codes[0], audit.Source{}); err != ErrInvalidMfaCode {
+		t.Errorf("got %v using a recovery code twice, want %v", err, ErrInvalidMfaCode)
+	}
+	if _, err := u.CompleteMfaLogin(s.Token, codes[1], audit.Source{}); err != nil {
+		t.Errorf("got %v with another recovery code", err)
+	}
+}
+
+func TestMfaLockout(t *testing.T) {
+	u, _ := newTestUseCases()
+	enrollTotp(t, u)
+	s, err := u.LoginToAccount("alice1", testPassword, audit.Source{Ip: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxFailedAttemptsPerLogin; i++ {
+		if _, err := u.CompleteMfaLogin(s.Token, "000000", audit.Source{Ip: "192.0.2.1"}); err != ErrInvalidMfaCode {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, ErrInvalidMfaCode)
+		}
+	}
+	var locked *LockoutError
+	if _, err := u.CompleteMfaLogin(s.Token, "000000", audit.Source{Ip: "192.0.2.2"}); !errors.As(err, &locked) {
+		t.Errorf("got %v after too many wrong codes, want lockout", err)
+	}
+}
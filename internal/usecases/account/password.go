@@ -0,0 +1,98 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	resetTokenSize = 32
+	resetTokenTtl  = 24 * time.Hour
+)
+
+var (
+	ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+	ErrNoPassword        = errors.New("bots don't have passwords")
+)
+
+// ForcePasswordReset drops the password of the account and returns a token
+// the owner sets a new one with. Until then the account can't sign in and
+// its sessions are rejected.
+func (a *UseCases) ForcePasswordReset(accountId string) (string, error) {
+	b := make([]byte, resetTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(b)
+	_, err := a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		if acc.Bot {
+			return acc, ErrNoPassword
+		}
+		acc.Password = ""
+		acc.Reset = account.PasswordReset{
+			TokenHash: hashResetSecret(secret),
+			ExpiresAt: time.Now().Add(resetTokenTtl),
+		}
+		return acc, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	// the account id lets the reset find the account without a lookup by the token
+	return accountId + "." + secret, nil
+}
+
+// ResetPassword sets a new password with the token issued by ForcePasswordReset
+// and returns id of the account.
+func (a *UseCases) ResetPassword(resetToken, password string, src audit.Source) (string, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(resetToken, ".")
+	if i <= 0 {
+		return "", ErrInvalidResetToken
+	}
+	accountId, secret := resetToken[:i], resetToken[i+1:]
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	_, err = a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		if acc.Reset.TokenHash == "" || time.Now().After(acc.Reset.ExpiresAt) ||
+			subtle.ConstantTimeCompare([]byte(hashResetSecret(secret)), []byte(acc.Reset.TokenHash)) != 1 {
+			return acc, ErrInvalidResetToken
+		}
+		acc.Password = string(hashedPassword)
+		acc.Reset = account.PasswordReset{}
+		return acc, nil
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+	// the token passes through an admin, so whoever used it isn't taken for the
+	// owner: the entry has no actor, its address tells who it was
+	src.Actor = ""
+	if err := a.record(src, audit.ActionResetTokenUsed, accountId, ""); err != nil {
+		return "", err
+	}
+	return accountId, nil
+}
+
+func hashResetSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
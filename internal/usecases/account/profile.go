@@ -0,0 +1,199 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+
+	"errors"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidProfileString = errors.New("profile string contains invalid character")
+	ErrInvalidTimezone      = errors.New("unknown time zone")
+)
+
+const (
+	maxDisplayNameLength = 64
+	maxBioLength         = 512
+	maxAvatarLength      = 512
+	maxStatusLength      = 128
+)
+
+type Profile struct {
+	DisplayName string
+	Bio         string
+	Avatar      string
+	Status      string
+	Timezone    string
+}
+
+// ProfileUpdate contains only fields to be changed.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Avatar      *string
+	Status      *string
+	Timezone    *string
+}
+
+// GetProfile returns account profile if the actor is the owner
+// or shares a room with the account.
+func (a *UseCases) GetProfile(actorId, accountId string) (Account, error) {
+	if actorId != accountId {
+		shared, err := a.shareRoom(actorId, accountId)
+		if err != nil {
+			return Account{}, err
+		}
+		if !shared {
+			return Account{}, domain.ErrUnauthorized
+		}
+	}
+	acc, err := a.AccountStorage.GetAccountById(accountId)
+	if err != nil {
+		return Account{}, err
+	}
+	if acc.Deactivated && actorId != accountId {
+		return Account{}, domain.ErrNotFound
+	}
+	return toAccount(acc), nil
+}
+
+func (a *UseCases) UpdateProfile(actorId, accountId string, upd ProfileUpdate) (Account, error) {
+	if actorId != accountId {
+		return Account{}, domain.ErrUnauthorized
+	}
+	if err := validateProfileUpdate(upd); err != nil {
+		return Account{}, err
+	}
+	acc, err := a.AccountStorage.UpdateAccount(accountId, func(acc account.Account) (account.Account, error) {
+		p := &acc.Profile
+		if upd.DisplayName != nil {
+			p.DisplayName = *upd.DisplayName
+		}
+		if upd.Bio != nil {
+			p.Bio = *upd.Bio
+		}
+		if upd.Avatar != nil {
+			p.Avatar = *upd.Avatar
+		}
+		if upd.Status != nil {
+			p.Status = *upd.Status
+		}
+		if upd.Timezone != nil {
+			p.Timezone = *upd.Timezone
+		}
+		return acc, nil
+	})
+	if err != nil {
+		return Account{}, err
+	}
+	return toAccount(acc), nil
+}
+
+// GetAccountsByIds returns logins and display names only, it is meant
+// for embedding into listings the actor already has access to.
+func (a *UseCases) GetAccountsByIds(ids []string) ([]Account, error) {
+	aa, err := a.AccountStorage.GetAccountsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Account, 0, len(aa))
+	for _, acc := range aa {
+		if acc.Deactivated {
+			continue
+		}
+		res = append(res, toPublicAccount(acc))
+	}
+	return res, nil
+}
+
+func (a *UseCases) shareRoom(actorId, accountId string) (bool, error) {
+	rr, err := a.RoomUseCases.ListRooms(actorId)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rr {
+		for _, m := range r.Members {
+			if m == accountId {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// toPublicAccount keeps only fields visible to any account.
+func toPublicAccount(acc account.Account) Account {
+	return Account{
+		Id:      acc.Id,
+		Login:   acc.Login,
+		Profile: Profile{DisplayName: acc.Profile.DisplayName},
+		Bot:     acc.Bot,
+	}
+}
+
+func toAccount(acc account.Account) Account {
+	return Account{
+		Id:    acc.Id,
+		Login: acc.Login,
+		Profile: Profile{
+			DisplayName: acc.Profile.DisplayName,
+			Bio:         acc.Profile.Bio,
+			Avatar:      acc.Profile.Avatar,
+			Status:      acc.Profile.Status,
+			Timezone:    acc.Profile.Timezone,
+		},
+		Bot: acc.Bot,
+	}
+}
+
+func validateProfileUpdate(upd ProfileUpdate) error {
+	fields := []struct {
+		value     *string
+		maxLength int
+		multiline bool
+	}{
+		{upd.DisplayName, maxDisplayNameLength, false},
+		{upd.Bio, maxBioLength, true},
+		{upd.Avatar, maxAvatarLength, false},
+		{upd.Status, maxStatusLength, false},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		if err := validateProfileString(*f.value, f.maxLength, f.multiline); err != nil {
+			return err
+		}
+	}
+	if upd.Timezone != nil && *upd.Timezone != "" {
+		if *upd.Timezone == "Local" {
+			return ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(*upd.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	return nil
+}
+
+func validateProfileString(s string, maxLength int, multiline bool) error {
+	if !utf8.ValidString(s) {
+		return ErrInvalidProfileString
+	}
+	for _, r := range s {
+		if r == '\n' && multiline {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return ErrInvalidProfileString
+		}
+	}
+	if utf8.RuneCountInString(s) > maxLength {
+		return ErrTooLongString
+	}
+	return nil
+}
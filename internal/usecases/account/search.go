@@ -0,0 +1,63 @@
+package account
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidPaging = errors.New("invalid offset or limit")
+
+const (
+	minSearchQueryLength = 2
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 50
+)
+
+// FindAccountByLogin looks up an account by exact login.
+// Only public part of the profile is returned.
+func (a *UseCases) FindAccountByLogin(login string) (Account, error) {
+	if err := validateLogin(login); err != nil {
+		return Account{}, err
+	}
+	acc, err := a.AccountStorage.GetAccountByLogin(login)
+	if err != nil {
+		return Account{}, err
+	}
+	if acc.Deactivated {
+		return Account{}, domain.ErrNotFound
+	}
+	return toPublicAccount(acc), nil
+}
+
+// SearchAccounts searches accounts by login or display name prefix.
+// Only public part of profiles is returned.
+func (a *UseCases) SearchAccounts(query string, offset, limit int) ([]Account, error) {
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < minSearchQueryLength {
+		return nil, ErrTooShortString
+	}
+	if utf8.RuneCountInString(query) > maxDisplayNameLength {
+		return nil, ErrTooLongString
+	}
+	if offset < 0 || limit < 0 {
+		return nil, ErrInvalidPaging
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	aa, err := a.AccountStorage.SearchAccounts(query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Account, 0, len(aa))
+	for _, acc := range aa {
+		res = append(res, toPublicAccount(acc))
+	}
+	return res, nil
+}
@@ -0,0 +1,372 @@
+package admin
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/report"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"errors"
+	"unicode/utf8"
+)
+
+const (
+	defaultLimit    = 50
+	maxLimit        = 200
+	maxReasonLength = 1000 // in characters
+)
+
+var (
+	ErrNotStaff         = errors.New("only moderators and admins can use the admin api")
+	ErrNotAdmin         = errors.New("only admins can do this")
+	ErrProtectedAccount = errors.New("admins and moderators can't be suspended")
+	ErrInvalidReason    = errors.New("reason must be at most 1000 characters")
+	ErrInvalidPaging    = errors.New("invalid offset or limit")
+	ErrLegalHold        = errors.New("room is under legal hold")
+)
+
+// Account is what admins see of an account.
+type Account struct {
+	Id           string
+	Login        string
+	DisplayName  string
+	Role         string
+	Bot          bool
+	BotOwner     string
+	MfaEnabled   bool
+	Deactivated  bool
+	Suspended    bool
+	ResetPending bool
+}
+
+type Room struct {
+	Id      string
+	Creator string
+	Topic   string
+	Members []string
+}
+
+type Stats struct {
+	Accounts    int
+	Rooms       int
+	Messages    int
+	OpenReports int
+}
+
+// PasswordResetter forces password reset of the account and returns the reset token.
+type PasswordResetter interface {
+	ForcePasswordReset(accountId string) (string, error)
+}
+
+type Interface interface {
+	// Authorize checks the actor may use the admin api at all. Moderators
+	// pass it, other methods except moderation ones are for admins only.
+	Authorize(actorId string) error
+
+	// ListAccounts returns accounts whose login or display name starts with the query,
+	// deactivated ones included. Limit of zero means the default one.
+	ListAccounts(actorId, query string, offset, limit int) ([]Account, error)
+	GetAccount(actorId, accountId string) (Account, error)
+	// SuspendAccount, UnsuspendAccount, ResetPassword and DeleteRoom write the
+	// change with its reason to the audit log, src tells who acts and from where.
+	SuspendAccount(src audit.Source, accountId, reason string) (Account, error)
+	UnsuspendAccount(src audit.Source, accountId, reason string) (Account, error)
+	// ResetPassword signs the account out and returns a token to set a new password with.
+	ResetPassword(src audit.Source, accountId, reason string) (string, error)
+
+	GetRoom(actorId, roomId string) (Room, error)
+	// DeleteRoom removes the room with everything kept for it: members, messages,
+	// attachments with their blobs, webhooks, incoming hooks, commands, filter
+	// rules, bans and mutes. The room goes last, so a failed deletion can be retried.
+	DeleteRoom(src audit.Source, roomId, reason string) error
+
+	Stats(actorId string) (Stats, error)
+}
+
+type UseCases struct {
+	AccountStorage account.Interface
+	RoomStorage    room.Interface
+	MessageStorage message.Interface
+	ReportStorage  report.Interface
+	Passwords      PasswordResetter
+	Audit          audit.Recorder // nothing is recorded if nil
+
+	// used to delete rooms
+	Attachments     attachment.Deleter
+	WebhookStorage  webhook.Interface
+	HookStorage     incoming.Interface
+	CommandStorage  command.Interface
+	FilterStorage   filter.Interface
+	SanctionStorage sanction.Interface
+}
+
+func (u *UseCases) Authorize(actorId string) error {
+	acc, err := u.AccountStorage.GetAccountById(actorId)
+	if err != nil {
+		return err
+	}
+	if !acc.IsModerator() {
+		return ErrNotStaff
+	}
+	return nil
+}
+
+func (u *UseCases) ListAccounts(actorId, query string, offset, limit int) ([]Account, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if offset < 0 || limit < 0 || limit > maxLimit {
+		return nil, ErrInvalidPaging
+	}
+	if err := u.checkAdmin(actorId); err != nil {
+		return nil, err
+	}
+	aa, err := u.AccountStorage.ListAccounts(query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Account, 0, len(aa))
+	for _, a := range aa {
+		res = append(res, toAccount(a))
+	}
+	return res, nil
+}
+
+func (u *UseCases) GetAccount(actorId, accountId string) (Account, error) {
+	if err := u.checkAdmin(actorId); err != nil {
+		return Account{}, err
+	}
+	a, err := u.AccountStorage.GetAccountById(accountId)
+	if err != nil {
+		return Account{}, err
+	}
+	return toAccount(a), nil
+}
+
+func (u *UseCases) SuspendAccount(src audit.Source, accountId, reason string) (Account, error) {
+	return u.setSuspended(src, accountId, reason, true)
+}
+
+func (u *UseCases) UnsuspendAccount(src audit.Source, accountId, reason string) (Account, error) {
+	return u.setSuspended(src, accountId, reason, false)
+}
+
+func (u *UseCases) setSuspended(src audit.Source, accountId, reason string, suspended bool) (Account, error) {
+	if err := validateReason(reason); err != nil {
+		return Account{}, err
+	}
+	if err := u.checkAdmin(src.Actor); err != nil {
+		return Account{}, err
+	}
+	a, err := u.AccountStorage.UpdateAccount(accountId, func(a account.Account) (account.Account, error) {
+		if suspended && a.IsModerator() {
+			return a, ErrProtectedAccount
+		}
+		a.Suspended = suspended
+		return a, nil
+	})
+	if err != nil {
+		return Account{}, err
+	}
+	action := audit.ActionSuspend
+	if !suspended {
+		action = audit.ActionUnsuspend
+	}
+	if err := u.record(src, action, accountId, reason); err != nil {
+		return Account{}, err
+	}
+	return toAccount(a), nil
+}
+
+func (u *UseCases) ResetPassword(src audit.Source, accountId, reason string) (string, error) {
+	if err := validateReason(reason); err != nil {
+		return "", err
+	}
+	if err := u.checkAdmin(src.Actor); err != nil {
+		return "", err
+	}
+	token, err := u.Passwords.ForcePasswordReset(accountId)
+	if err != nil {
+		return "", err
+	}
+	if err := u.record(src, audit.ActionPasswordReset, accountId, reason); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (u *UseCases) GetRoom(actorId, roomId string) (Room, error) {
+	if err := u.checkAdmin(actorId); err != nil {
+		return Room{}, err
+	}
+	r, err := u.RoomStorage.InspectRoom(roomId)
+	if err != nil {
+		return Room{}, err
+	}
+	return Room{Id: r.Id, Creator: r.Creator, Topic: r.Topic, Members: r.Members}, nil
+}
+
+// DeleteRoom removes the room with everything in it. Rooms under legal hold
+// are refused with ErrLegalHold until the hold is released.
+func (u *UseCases) DeleteRoom(src audit.Source, roomId, reason string) error {
+	if err := validateReason(reason); err != nil {
+		return err
+	}
+	if err := u.checkAdmin(src.Actor); err != nil {
+		return err
+	}
+	r, err := u.RoomStorage.InspectRoom(roomId)
+	if err != nil {
+		return err
+	}
+	if r.LegalHold {
+		return ErrLegalHold
+	}
+	if err := u.deleteIntegrations(roomId); err != nil {
+		return err
+	}
+	if err := u.deleteSanctions(roomId); err != nil {
+		return err
+	}
+	if err := u.Attachments.DeleteRoomAttachments(roomId); err != nil {
+		return err
+	}
+	if _, err := u.MessageStorage.DeleteMessagesByRoom(roomId); err != nil {
+		return err
+	}
+	if err := u.RoomStorage.DeleteRoom(roomId); err != nil {
+		return err
+	}
+	return u.record(src, audit.ActionRoomDelete, roomId, reason)
+}
+
+// deleteIntegrations removes webhooks, incoming hooks, commands and filter rules of the room.
+func (u *UseCases) deleteIntegrations(roomId string) error {
+	ww, err := u.WebhookStorage.ListWebhooks(roomId)
+	if err != nil {
+		return err
+	}
+	for _, w := range ww {
+		if err := u.WebhookStorage.DeleteWebhook(w.Id); err != nil {
+			return err
+		}
+	}
+	hh, err := u.HookStorage.ListHooks(roomId)
+	if err != nil {
+		return err
+	}
+	for _, h := range hh {
+		if err := u.HookStorage.DeleteHook(h.Id); err != nil {
+			return err
+		}
+	}
+	cc, err := u.CommandStorage.ListCommands(roomId)
+	if err != nil {
+		return err
+	}
+	for _, c := range cc {
+		if err := u.CommandStorage.DeleteCommand(c.Id); err != nil {
+			return err
+		}
+	}
+	rr, err := u.FilterStorage.ListRules(roomId)
+	if err != nil {
+		return err
+	}
+	for _, r := range rr {
+		if err := u.FilterStorage.DeleteRule(r.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UseCases) deleteSanctions(roomId string) error {
+	bb, err := u.SanctionStorage.ListBans(roomId)
+	if err != nil {
+		return err
+	}
+	for _, b := range bb {
+		if err := u.SanctionStorage.DeleteBan(roomId, b.Account); err != nil {
+			return err
+		}
+	}
+	mm, err := u.SanctionStorage.ListMutes(roomId)
+	if err != nil {
+		return err
+	}
+	for _, m := range mm {
+		if err := u.SanctionStorage.DeleteMute(roomId, m.Account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UseCases) Stats(actorId string) (Stats, error) {
+	if err := u.checkAdmin(actorId); err != nil {
+		return Stats{}, err
+	}
+	var s Stats
+	var err error
+	if s.Accounts, err = u.AccountStorage.CountAccounts(); err != nil {
+		return Stats{}, err
+	}
+	if s.Rooms, err = u.RoomStorage.CountRooms(); err != nil {
+		return Stats{}, err
+	}
+	if s.Messages, err = u.MessageStorage.CountMessages(); err != nil {
+		return Stats{}, err
+	}
+	if s.OpenReports, err = u.ReportStorage.CountReports(report.StatusOpen); err != nil {
+		return Stats{}, err
+	}
+	return s, nil
+}
+
+func (u *UseCases) record(src audit.Source, action, target, details string) error {
+	if u.Audit == nil {
+		return nil
+	}
+	return u.Audit.Record(src, action, target, details)
+}
+
+func (u *UseCases) checkAdmin(actorId string) error {
+	acc, err := u.AccountStorage.GetAccountById(actorId)
+	if err != nil {
+		return err
+	}
+	if !acc.IsAdmin() {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+func validateReason(reason string) error {
+	if !utf8.ValidString(reason) || utf8.RuneCountInString(reason) > maxReasonLength {
+		return ErrInvalidReason
+	}
+	return nil
+}
+
+func toAccount(a account.Account) Account {
+	return Account{
+		Id:           a.Id,
+		Login:        a.Login,
+		DisplayName:  a.Profile.DisplayName,
+		Role:         a.Role,
+		Bot:          a.Bot,
+		BotOwner:     a.BotOwner,
+		MfaEnabled:   a.Totp.Enabled,
+		Deactivated:  a.Deactivated,
+		Suspended:    a.Suspended,
+		ResetPending: a.Reset.TokenHash != "",
+	}
+}
@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/commandrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/filterrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/incomingrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	attachmentusecases "github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"errors"
+	"io"
+	"testing"
+)
+
+// createStaff creates accounts of a server admin, a moderator and a member
+// and returns their ids by login.
+func createStaff(t *testing.T, accounts account.Interface) map[string]string {
+	ids := make(map[string]string)
+	for login, role := range map[string]string{"root": account.RoleAdmin, "mod": account.RoleModerator, "alice": ""} {
+		a, err := accounts.CreateAccount(account.Credentials{Login: login})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = accounts.UpdateAccount(a.Id, func(a account.Account) (account.Account, error) {
+			a.Role = role
+			return a, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[login] = a.Id
+	}
+	return ids
+}
+
+func TestSuspendAccount(t *testing.T) {
+	u := &UseCases{AccountStorage: accountrepo.NewMemory()}
+	ids := createStaff(t, u.AccountStorage)
+
+	if _, err := u.SuspendAccount(audit.Source{Actor: ids["mod"]}, ids["alice"], "spam"); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("got %v, want %v", err, ErrNotAdmin)
+	}
+	if _, err := u.SuspendAccount(audit.Source{Actor: ids["root"]}, ids["mod"], "spam"); !errors.Is(err, ErrProtectedAccount) {
+		t.Errorf("got %v, want %v", err, ErrProtectedAccount)
+	}
+	a, err := u.SuspendAccount(audit.Source{Actor: ids["root"]}, ids["alice"], "spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Suspended {
+		t.Errorf("got suspended %v, want true", a.Suspended)
+	}
+	a, err = u.UnsuspendAccount(audit.Source{Actor: ids["root"]}, ids["alice"], "appeal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Suspended {
+		t.Errorf("got suspended %v, want false", a.Suspended)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	u := &UseCases{AccountStorage: accountrepo.NewMemory()}
+	ids := createStaff(t, u.AccountStorage)
+
+	for login, want := range map[string]error{"root": nil, "mod": nil, "alice": ErrNotStaff} {
+		if err := u.Authorize(ids[login]); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", login, err, want)
+		}
+	}
+}
+
+type blobsFake map[string]bool
+
+func (b blobsFake) PutBlob(key string, r io.Reader, size int64) error {
+	b[key] = true
+	return nil
+}
+
+func (b blobsFake) GetBlob(key string) (io.ReadCloser, error) {
+	panic("implement me")
+}
+
+func (b blobsFake) DeleteBlob(key string) error {
+	delete(b, key)
+	return nil
+}
+
+func TestDeleteRoom(t *testing.T) {
+	attachments := attachmentrepo.NewMemory()
+	blobs := blobsFake{"file": true, "thumb": true}
+	u := &UseCases{
+		AccountStorage:  accountrepo.NewMemory(),
+		RoomStorage:     roomrepo.NewMemory(),
+		MessageStorage:  messagerepo.NewMemory(),
+		Attachments:     &attachmentusecases.UseCases{AttachmentStorage: attachments, BlobStorage: blobs},
+		WebhookStorage:  webhookrepo.NewMemory(),
+		HookStorage:     incomingrepo.NewMemory(),
+		CommandStorage:  commandrepo.NewMemory(),
+		FilterStorage:   filterrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+	}
+	ids := createStaff(t, u.AccountStorage)
+	r, err := u.RoomStorage.CreateRoom(ids["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := attachments.CreateAttachment(attachment.Attachment{
+		Room:       r.Id,
+		Size:       10,
+		BlobKey:    "file",
+		Thumbnails: []attachment.Thumbnail{{Size: 64, BlobKey: "thumb"}},
+	}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.MessageStorage.CreateMessage(message.Message{Author: ids["alice"], Room: r.Id, Attachments: []string{att.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.WebhookStorage.CreateWebhook(webhook.Webhook{Room: r.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.HookStorage.CreateHook(incoming.Hook{Room: r.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CommandStorage.CreateCommand(command.Command{Room: r.Id, Name: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.FilterStorage.CreateRule(filter.Rule{Room: r.Id, Pattern: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.SanctionStorage.PutBan(sanction.Ban{Room: r.Id, Account: ids["mod"]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.SanctionStorage.PutMute(sanction.Mute{Room: r.Id, Account: ids["root"]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.DeleteRoom(audit.Source{Actor: ids["mod"]}, r.Id, "abuse"); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("got %v, want %v", err, ErrNotAdmin)
+	}
+	if _, err := u.RoomStorage.SetLegalHold(r.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.DeleteRoom(audit.Source{Actor: ids["root"]}, r.Id, "abuse"); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("got %v deleting a held room, want %v", err, ErrLegalHold)
+	}
+	if n, err := u.MessageStorage.CountMessages(); err != nil || n == 0 {
+		t.Errorf("got %d messages, err %v, a held room must keep them", n, err)
+	}
+	if _, err := u.RoomStorage.SetLegalHold(r.Id, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.DeleteRoom(audit.Source{Actor: ids["root"]}, r.Id, "abuse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.RoomStorage.InspectRoom(r.Id); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("got %v inspecting the room, want %v", err, domain.ErrNotFound)
+	}
+	if n, err := u.MessageStorage.CountMessages(); err != nil || n != 0 {
+		t.Errorf("got %d messages, err %v, want none", n, err)
+	}
+	if aa, err := attachments.ListRoomAttachments(r.Id); err != nil || len(aa) != 0 {
+		t.Errorf("got attachments %v, err %v, want none", aa, err)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("got blobs %v left, want none", blobs)
+	}
+	if ww, err := u.WebhookStorage.ListWebhooks(r.Id); err != nil || len(ww) != 0 {
+		t.Errorf("got webhooks %+v, err %v, want none", ww, err)
+	}
+	if hh, err := u.HookStorage.ListHooks(r.Id); err != nil || len(hh) != 0 {
+		t.Errorf("got incoming hooks %+v, err %v, want none", hh, err)
+	}
+	if cc, err := u.CommandStorage.ListCommands(r.Id); err != nil || len(cc) != 0 {
+		t.Errorf("got commands %+v, err %v, want none", cc, err)
+	}
+	if rr, err := u.FilterStorage.ListRules(r.Id); err != nil || len(rr) != 0 {
+		t.Errorf("got filter rules %+v, err %v, want none", rr, err)
+	}
+	if bb, err := u.SanctionStorage.ListBans(r.Id); err != nil || len(bb) != 0 {
+		t.Errorf("got bans %+v, err %v, want none", bb, err)
+	}
+	if mm, err := u.SanctionStorage.ListMutes(r.Id); err != nil || len(mm) != 0 {
+		t.Errorf("got mutes %+v, err %v, want none", mm, err)
+	}
+}
@@ -0,0 +1,262 @@
+package attachment
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMaxFileSize = 10 << 20
+	DefaultRoomQuota   = 1 << 30
+
+	maxFilenameLength = 255
+
+	ThumbnailJobKind = "attachment-thumbnails"
+)
+
+var (
+	ErrFileTooLarge  = errors.New("file is too large")
+	ErrQuotaExceeded = attachment.ErrQuotaExceeded
+)
+
+type Attachment struct {
+	Id        string
+	Room      string
+	Owner     string
+	Filename  string
+	MimeType  string
+	Size      int64
+	Checksum  string // hex encoded sha256
+	CreatedAt time.Time
+
+	// image fields are set once thumbnails are made
+	Width       int
+	Height      int
+	Placeholder string
+	Thumbnails  []Thumbnail
+}
+
+type Thumbnail struct {
+	Size     int
+	Width    int
+	Height   int
+	MimeType string
+}
+
+type Interface interface {
+	Upload(actorId, roomId, filename, mimeType string, body io.Reader) (Attachment, error)
+	Download(actorId, roomId, attachmentId string) (Attachment, io.ReadCloser, error)
+	DownloadThumbnail(actorId, roomId, attachmentId string, size int) (Thumbnail, io.ReadCloser, error)
+}
+
+type UseCases struct {
+	AttachmentStorage attachment.Interface
+	BlobStorage       attachment.BlobStorage
+	RoomStorage       room.Interface
+	Jobs              job.Interface
+	MaxFileSize       int64         // per file limit in bytes
+	RoomQuota         int64         // total size of room's attachments in bytes
+	OrphanTtl         time.Duration // DefaultOrphanTtl if zero
+}
+
+// Upload stores the file for members of the room. The body is spooled to
+// a temporary file first to check the size limit and compute the checksum
+// before anything reaches blob storage.
+func (u *UseCases) Upload(actorId, roomId, filename, mimeType string, body io.Reader) (Attachment, error) {
+	if _, err := u.RoomStorage.GetRoomById(actorId, roomId); err != nil {
+		return Attachment{}, err
+	}
+	usage, err := u.AttachmentStorage.GetRoomUsage(roomId)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if usage >= u.RoomQuota {
+		return Attachment{}, ErrQuotaExceeded
+	}
+
+	tmp, err := ioutil.TempFile("", "chat-upload-*")
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, u.MaxFileSize+1))
+	if err != nil {
+		return Attachment{}, err
+	}
+	if size > u.MaxFileSize {
+		return Attachment{}, ErrFileTooLarge
+	}
+	if usage+size > u.RoomQuota {
+		return Attachment{}, ErrQuotaExceeded
+	}
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return Attachment{}, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Attachment{}, err
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		return Attachment{}, err
+	}
+	if err := u.BlobStorage.PutBlob(key, tmp, size); err != nil {
+		return Attachment{}, err
+	}
+	a, err := u.AttachmentStorage.CreateAttachment(attachment.Attachment{
+		Room:      roomId,
+		Owner:     actorId,
+		Filename:  cleanFilename(filename),
+		MimeType:  detectMimeType(head[:n], mimeType),
+		Size:      size,
+		Checksum:  hex.EncodeToString(h.Sum(nil)),
+		BlobKey:   key,
+		CreatedAt: time.Now(),
+	}, u.RoomQuota)
+	if err != nil {
+		u.BlobStorage.DeleteBlob(key)
+		return Attachment{}, err
+	}
+	if thumbnailMimeTypes[a.MimeType] {
+		// the upload is stored already, previews are only nice to have
+		if _, err := u.Jobs.Submit(actorId, ThumbnailJobKind, a.Id); err != nil {
+			fmt.Printf("attachment %s: failed to submit thumbnail job: %v\n", a.Id, err)
+		}
+	}
+	return toAttachment(a), nil
+}
+
+// Download returns attachment content to members of the room it was uploaded to.
+func (u *UseCases) Download(actorId, roomId, attachmentId string) (Attachment, io.ReadCloser, error) {
+	if _, err := u.RoomStorage.GetRoomById(actorId, roomId); err != nil {
+		return Attachment{}, nil, err
+	}
+	a, err := u.AttachmentStorage.GetAttachmentById(attachmentId)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	if a.Room != roomId {
+		return Attachment{}, nil, domain.ErrNotFound
+	}
+	rc, err := u.BlobStorage.GetBlob(a.BlobKey)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	return toAttachment(a), rc, nil
+}
+
+// DownloadThumbnail returns preview of the given size once it is made.
+func (u *UseCases) DownloadThumbnail(actorId, roomId, attachmentId string, size int) (Thumbnail, io.ReadCloser, error) {
+	if _, err := u.RoomStorage.GetRoomById(actorId, roomId); err != nil {
+		return Thumbnail{}, nil, err
+	}
+	a, err := u.AttachmentStorage.GetAttachmentById(attachmentId)
+	if err != nil {
+		return Thumbnail{}, nil, err
+	}
+	if a.Room != roomId {
+		return Thumbnail{}, nil, domain.ErrNotFound
+	}
+	for _, t := range a.Thumbnails {
+		if t.Size != size {
+			continue
+		}
+		rc, err := u.BlobStorage.GetBlob(t.BlobKey)
+		if err != nil {
+			return Thumbnail{}, nil, err
+		}
+		return toThumbnail(t), rc, nil
+	}
+	return Thumbnail{}, nil, domain.ErrNotFound
+}
+
+// detectMimeType trusts content over the client. The declared type is used
+// only when sniffing gives nothing specific.
+func detectMimeType(head []byte, declared string) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	if mt, params, err := mime.ParseMediaType(declared); err == nil {
+		return mime.FormatMediaType(mt, params)
+	}
+	return sniffed
+}
+
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+func newBlobKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toAttachment(a attachment.Attachment) Attachment {
+	res := Attachment{
+		Id:          a.Id,
+		Room:        a.Room,
+		Owner:       a.Owner,
+		Filename:    a.Filename,
+		MimeType:    a.MimeType,
+		Size:        a.Size,
+		Checksum:    a.Checksum,
+		CreatedAt:   a.CreatedAt,
+		Width:       a.Width,
+		Height:      a.Height,
+		Placeholder: a.Placeholder,
+		Thumbnails:  make([]Thumbnail, 0, len(a.Thumbnails)),
+	}
+	for _, t := range a.Thumbnails {
+		res.Thumbnails = append(res.Thumbnails, toThumbnail(t))
+	}
+	return res
+}
+
+func toThumbnail(t attachment.Thumbnail) Thumbnail {
+	return Thumbnail{
+		Size:     t.Size,
+		Width:    t.Width,
+		Height:   t.Height,
+		MimeType: t.MimeType,
+	}
+}
@@ -0,0 +1,241 @@
+package attachment
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blobsFake keeps blobs in memory.
+type blobsFake map[string][]byte
+
+func (b blobsFake) PutBlob(key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b[key] = data
+	return nil
+}
+
+func (b blobsFake) GetBlob(key string) (io.ReadCloser, error) {
+	data, ok := b[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b blobsFake) DeleteBlob(key string) error {
+	delete(b, key)
+	return nil
+}
+
+// newTestUseCases returns use cases over memory storage and a room of alice.
+func newTestUseCases(t *testing.T) (*UseCases, blobsFake, string) {
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := blobsFake{}
+	return &UseCases{
+		AttachmentStorage: attachmentrepo.NewMemory(),
+		BlobStorage:       blobs,
+		RoomStorage:       rooms,
+		MaxFileSize:       10,
+		RoomQuota:         15,
+	}, blobs, r.Id
+}
+
+func TestUpload(t *testing.T) {
+	u, blobs, roomId := newTestUseCases(t)
+
+	if _, err := u.Upload("mallory", roomId, "x.txt", "", strings.NewReader("hi")); err == nil {
+		t.Error("uploaded to a room of others")
+	}
+	if _, err := u.Upload("alice", roomId, "big.txt", "", strings.NewReader("0123456789a")); err != ErrFileTooLarge {
+		t.Errorf("got %v uploading too large file, want %v", err, ErrFileTooLarge)
+	}
+	a, err := u.Upload("alice", roomId, "../notes.txt", "image/png", strings.NewReader("plain text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Filename != "notes.txt" || !strings.HasPrefix(a.MimeType, "text/plain") || a.Size != 10 {
+		t.Errorf("got %s of type %s and size %d, want notes.txt of sniffed text type and size 10", a.Filename, a.MimeType, a.Size)
+	}
+	if _, err := u.Upload("alice", roomId, "more.txt", "", strings.NewReader("123456")); err != ErrQuotaExceeded {
+		t.Errorf("got %v uploading over the quota, want %v", err, ErrQuotaExceeded)
+	}
+	if len(blobs) != 1 {
+		t.Errorf("got %d blobs, rejected uploads must not be stored", len(blobs))
+	}
+
+	got, rc, err := u.Download("alice", roomId, a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "plain text" || got.Id != a.Id {
+		t.Errorf("got %q of %s, want the uploaded content", data, got.Id)
+	}
+	if _, _, err := u.Download("alice", "other", a.Id); err == nil {
+		t.Error("downloaded an attachment through another room")
+	}
+}
+
+func TestPurgeOrphaned(t *testing.T) {
+	u, blobs, roomId := newTestUseCases(t)
+	u.OrphanTtl = time.Hour
+	orphan, err := u.Upload("alice", roomId, "orphan.txt", "", strings.NewReader("orphan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	posted, err := u.Upload("alice", roomId, "posted.txt", "", strings.NewReader("posted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AttachmentStorage.SetAttached([]string{posted.Id}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := u.PurgeOrphaned(time.Now()); err != nil || n != 0 {
+		t.Errorf("got %d, %v purging fresh uploads, want 0", n, err)
+	}
+	n, err := u.PurgeOrphaned(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d purged, want only the orphan", n)
+	}
+	if _, err := u.AttachmentStorage.GetAttachmentById(orphan.Id); err != domain.ErrNotFound {
+		t.Errorf("got %v getting the orphan, want %v", err, domain.ErrNotFound)
+	}
+	if _, err := u.AttachmentStorage.GetAttachmentById(posted.Id); err != nil {
+		t.Errorf("got %v getting the attached upload", err)
+	}
+	if len(blobs) != 1 {
+		t.Errorf("got %d blobs, want the orphan's one deleted", len(blobs))
+	}
+	usage, err := u.AttachmentStorage.GetRoomUsage(roomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != posted.Size {
+		t.Errorf("got room usage %d, want %d once the orphan is gone", usage, posted.Size)
+	}
+}
+
+func TestDeleteRoomAttachments(t *testing.T) {
+	u, blobs, roomId := newTestUseCases(t)
+	a, err := u.AttachmentStorage.CreateAttachment(attachment.Attachment{
+		Room:       roomId,
+		Size:       1,
+		BlobKey:    "file",
+		Thumbnails: []attachment.Thumbnail{{Size: 64, BlobKey: "thumb"}},
+	}, u.RoomQuota)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs["file"], blobs["thumb"] = []byte("x"), []byte("x")
+
+	if err := u.DeleteRoomAttachments(roomId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AttachmentStorage.GetAttachmentById(a.Id); err != domain.ErrNotFound {
+		t.Errorf("got %v getting a deleted attachment, want %v", err, domain.ErrNotFound)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("got blobs %v left, thumbnails must go too", blobs)
+	}
+}
+
+func TestThumbnailJob(t *testing.T) {
+	u, blobs, roomId := newTestUseCases(t)
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	blobs["photo"] = buf.Bytes()
+	a, err := u.AttachmentStorage.CreateAttachment(attachment.Attachment{
+		Room:     roomId,
+		Size:     1,
+		MimeType: "image/png",
+		BlobKey:  "photo",
+	}, u.RoomQuota)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := u.DownloadThumbnail("alice", roomId, a.Id, 64); err != domain.ErrNotFound {
+		t.Errorf("got %v before thumbnails are made, want %v", err, domain.ErrNotFound)
+	}
+
+	j := job.Job{Kind: ThumbnailJobKind, Payload: a.Id}
+	if _, err := u.ThumbnailJob(j, func(string, int, int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := u.AttachmentStorage.GetAttachmentById(a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 300 || got.Height != 200 || got.Placeholder == "" {
+		t.Errorf("got %dx%d with placeholder %q, want 300x200 with a placeholder", got.Width, got.Height, got.Placeholder)
+	}
+	// the 1024 preview would be larger than the image itself
+	if len(got.Thumbnails) != 2 || got.Thumbnails[0].Size != 64 || got.Thumbnails[1].Size != 256 {
+		t.Fatalf("got thumbnails %+v, want 64 and 256", got.Thumbnails)
+	}
+	if len(blobs) != 3 {
+		t.Errorf("got %d blobs, want the image and two previews", len(blobs))
+	}
+
+	// a rerun keeps thumbnails made already
+	if _, err := u.ThumbnailJob(j, func(string, int, int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 3 {
+		t.Errorf("got %d blobs after a rerun, want 3", len(blobs))
+	}
+
+	if _, _, err := u.DownloadThumbnail("mallory", roomId, a.Id, 64); err == nil {
+		t.Error("downloaded a thumbnail from a room of others")
+	}
+	if _, _, err := u.DownloadThumbnail("alice", roomId, a.Id, 1024); err != domain.ErrNotFound {
+		t.Errorf("got %v downloading a skipped size, want %v", err, domain.ErrNotFound)
+	}
+	thumb, rc, err := u.DownloadThumbnail("alice", roomId, a.Id, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	decoded, err := png.Decode(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 64 || thumb.Height != 42 || decoded.Bounds().Dx() != 64 || decoded.Bounds().Dy() != 42 {
+		t.Errorf("got %dx%d preview of %v, want 64x42", thumb.Width, thumb.Height, decoded.Bounds())
+	}
+}
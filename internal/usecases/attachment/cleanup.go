@@ -0,0 +1,83 @@
+package attachment
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+
+	"fmt"
+	"time"
+)
+
+// DefaultOrphanTtl is how long an upload waits to be attached to a message.
+const DefaultOrphanTtl = 24 * time.Hour
+
+const orphanBatchSize = 100
+
+// Deleter removes attachments of deleted messages and rooms, it's all the
+// message, retention and admin use cases need of attachments.
+type Deleter interface {
+	DeleteAttachments(ids []string) error
+	// DeleteRoomAttachments removes every attachment uploaded to the room.
+	DeleteRoomAttachments(roomId string) error
+}
+
+// DeleteAttachments removes the attachments and then their blobs, thumbnails
+// included. A blob left behind by a failure is only wasted space, nothing
+// refers to it anymore.
+func (u *UseCases) DeleteAttachments(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	aa, err := u.AttachmentStorage.GetAttachmentsByIds(ids)
+	if err != nil {
+		return err
+	}
+	if _, err := u.AttachmentStorage.DeleteAttachments(ids); err != nil {
+		return err
+	}
+	u.deleteBlobs(aa)
+	return nil
+}
+
+func (u *UseCases) DeleteRoomAttachments(roomId string) error {
+	ids, err := u.AttachmentStorage.ListRoomAttachments(roomId)
+	if err != nil {
+		return err
+	}
+	return u.DeleteAttachments(ids)
+}
+
+// PurgeOrphaned deletes uploads never attached to a message within OrphanTtl,
+// so they stop counting toward the room quota. Attachments of cancelled and
+// dropped scheduled messages expire the same way.
+func (u *UseCases) PurgeOrphaned(now time.Time) (int, error) {
+	ttl := u.OrphanTtl
+	if ttl <= 0 {
+		ttl = DefaultOrphanTtl
+	}
+	total := 0
+	for {
+		aa, err := u.AttachmentStorage.DeleteUnattached(now.Add(-ttl), orphanBatchSize)
+		if err != nil {
+			return total, err
+		}
+		u.deleteBlobs(aa)
+		total += len(aa)
+		if len(aa) < orphanBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (u *UseCases) deleteBlobs(aa []attachment.Attachment) {
+	for _, a := range aa {
+		keys := []string{a.BlobKey}
+		for _, t := range a.Thumbnails {
+			keys = append(keys, t.BlobKey)
+		}
+		for _, key := range keys {
+			if err := u.BlobStorage.DeleteBlob(key); err != nil {
+				fmt.Printf("attachment %s: failed to delete blob %s: %v\n", a.Id, key, err)
+			}
+		}
+	}
+}
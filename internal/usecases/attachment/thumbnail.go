@@ -0,0 +1,92 @@
+package attachment
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/service/imaging"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"bytes"
+	"fmt"
+	"io/ioutil"
+)
+
+// ThumbnailSizes are longest sides of generated previews.
+var ThumbnailSizes = []int{64, 256, 1024}
+
+// maxImagePixels bounds memory a single decoded image may take.
+const maxImagePixels = 24 << 20
+
+var thumbnailMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// ThumbnailJob decodes uploaded image, records its dimensions and placeholder
+// and stores previews of ThumbnailSizes. Sizes not smaller than the image
+// are skipped, except the first one, so every image gets at least one preview.
+// Thumbnail blob keys are derived from the attachment, so reruns overwrite them.
+func (u *UseCases) ThumbnailJob(j job.Job, progress job.Progress) (string, error) {
+	a, err := u.AttachmentStorage.GetAttachmentById(j.Payload)
+	if err != nil {
+		return "", err
+	}
+	if len(a.Thumbnails) > 0 {
+		return a.Id, nil
+	}
+	rc, err := u.BlobStorage.GetBlob(a.BlobKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return "", err
+	}
+	img, format, err := imaging.Decode(data, maxImagePixels)
+	if err != nil {
+		return "", err
+	}
+
+	b := img.Bounds()
+	longest := b.Dx()
+	if b.Dy() > longest {
+		longest = b.Dy()
+	}
+	thumbnails := make([]attachment.Thumbnail, 0, len(ThumbnailSizes))
+	for i, size := range ThumbnailSizes {
+		if i > 0 && size >= longest {
+			break
+		}
+		thumb := imaging.Fit(img, size)
+		var buf bytes.Buffer
+		mimeType, err := imaging.Encode(&buf, thumb, format)
+		if err != nil {
+			return "", err
+		}
+		key := fmt.Sprintf("%s-%d", a.BlobKey, size)
+		if err := u.BlobStorage.PutBlob(key, &buf, int64(buf.Len())); err != nil {
+			return "", err
+		}
+		thumbnails = append(thumbnails, attachment.Thumbnail{
+			Size:     size,
+			Width:    thumb.Rect.Dx(),
+			Height:   thumb.Rect.Dy(),
+			MimeType: mimeType,
+			BlobKey:  key,
+		})
+		if err := progress("", i+1, len(ThumbnailSizes)); err != nil {
+			return "", err
+		}
+	}
+	placeholder := imaging.Blurhash(img, 4, 3)
+
+	_, err = u.AttachmentStorage.UpdateAttachment(a.Id, func(a attachment.Attachment) (attachment.Attachment, error) {
+		a.Width = b.Dx()
+		a.Height = b.Dy()
+		a.Placeholder = placeholder
+		a.Thumbnails = thumbnails
+		return a, nil
+	})
+	return a.Id, err
+}
@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/audit"
+
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// Actions written to the audit log.
+const (
+	ActionSignup           = "account.signup"
+	ActionSignin           = "account.signin"
+	ActionSigninFailed     = "account.signin-failed"
+	ActionPasswordSet      = "account.password-set"
+	ActionRoleChange       = "account.role"
+	ActionErase            = "account.erase"
+	ActionTokenRevoke      = "token.revoke"
+	ActionMemberAdd        = "room.member-add"
+	ActionMemberRemove     = "room.member-remove"
+	ActionBan              = "room.ban"
+	ActionUnban            = "room.unban"
+	ActionMessageDelete    = "message.delete"
+	ActionSuspend          = "account.suspend"
+	ActionUnsuspend        = "account.unsuspend"
+	ActionPasswordReset    = "account.password-reset"
+	ActionResetTokenUsed   = "account.password-reset-used"
+	ActionRoomDelete       = "room.delete"
+	ActionLegalHold        = "room.legal-hold"
+	ActionLegalHoldRelease = "room.legal-hold-release"
+	ActionRetentionPrune   = "room.retention-prune"
+	ActionImport           = "server.import"
+	ActionAuditExport      = "audit.export"
+	ActionAuditVerify      = "audit.verify"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+	readBatch    = 500
+
+	maxTargetLength = 64 // in characters
+)
+
+var (
+	ErrNotAdmin      = errors.New("only admins can read the audit log")
+	ErrInvalidPaging = errors.New("invalid offset or limit")
+)
+
+// Source tells who did the action and where the request came from.
+// Fields not known to the caller are left empty.
+type Source struct {
+	Actor     string
+	Ip        string
+	RequestId string
+}
+
+type Entry struct {
+	Id        string    `json:"id"`
+	Actor     string    `json:"actor-id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details,omitempty"`
+	Ip        string    `json:"ip,omitempty"`
+	RequestId string    `json:"request-id,omitempty"`
+	CreatedAt time.Time `json:"created-at"`
+	PrevHash  string    `json:"prev-hash"`
+	Hash      string    `json:"hash"`
+}
+
+type Filter = audit.Filter
+
+// Verification is the result of checking the hash chain. Head is the hash of
+// the last entry, keeping it elsewhere detects truncation of the log too.
+type Verification struct {
+	Entries  int
+	Head     string
+	BrokenAt string // id of the first entry not matching its hash or predecessor
+}
+
+// Recorder writes entries, it's all other use cases need of the log.
+type Recorder interface {
+	Record(src Source, action, target, details string) error
+}
+
+type Interface interface {
+	Recorder
+	// Authorize checks the actor may read the log.
+	Authorize(actorId string) error
+	ListEntries(actorId string, f Filter, offset, limit int) ([]Entry, error)
+	// Export writes the whole log to w as JSON lines in order of appending.
+	// The export is recorded before anything is written.
+	Export(src Source, w io.Writer) error
+	// Verify recomputes the hash chain and records the check with the head hash.
+	Verify(src Source) (Verification, error)
+}
+
+type UseCases struct {
+	AuditStorage   audit.Interface
+	AccountStorage account.Interface
+}
+
+func (u *UseCases) Record(src Source, action, target, details string) error {
+	_, err := u.AuditStorage.AppendEntry(audit.Entry{
+		Actor:     src.Actor,
+		Action:    action,
+		Target:    clip(target, maxTargetLength),
+		Details:   details,
+		Ip:        src.Ip,
+		RequestId: src.RequestId,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	})
+	return err
+}
+
+func (u *UseCases) ListEntries(actorId string, f Filter, offset, limit int) ([]Entry, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if offset < 0 || limit < 0 || limit > maxLimit {
+		return nil, ErrInvalidPaging
+	}
+	if err := u.Authorize(actorId); err != nil {
+		return nil, err
+	}
+	ee, err := u.AuditStorage.ListEntries(f, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Entry, 0, len(ee))
+	for _, e := range ee {
+		res = append(res, toEntry(e))
+	}
+	return res, nil
+}
+
+func (u *UseCases) Export(src Source, w io.Writer) error {
+	if err := u.Authorize(src.Actor); err != nil {
+		return err
+	}
+	if err := u.Record(src, ActionAuditExport, "", ""); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	return u.scan(func(e audit.Entry) error {
+		return enc.Encode(toEntry(e))
+	})
+}
+
+func (u *UseCases) Verify(src Source) (Verification, error) {
+	if err := u.Authorize(src.Actor); err != nil {
+		return Verification{}, err
+	}
+	var v Verification
+	err := u.scan(func(e audit.Entry) error {
+		if v.BrokenAt == "" && (e.PrevHash != v.Head || e.ComputeHash() != e.Hash) {
+			v.BrokenAt = e.Id
+		}
+		v.Entries++
+		v.Head = e.Hash
+		return nil
+	})
+	if err != nil {
+		return Verification{}, err
+	}
+	if err := u.Record(src, ActionAuditVerify, "", v.Head); err != nil {
+		return Verification{}, err
+	}
+	return v, nil
+}
+
+// scan calls f for every entry in order of appending.
+func (u *UseCases) scan(f func(e audit.Entry) error) error {
+	for offset := 0; ; offset += readBatch {
+		ee, err := u.AuditStorage.ReadEntries(offset, readBatch)
+		if err != nil {
+			return err
+		}
+		for _, e := range ee {
+			if err := f(e); err != nil {
+				return err
+			}
+		}
+		if len(ee) < readBatch {
+			return nil
+		}
+	}
+}
+
+func (u *UseCases) Authorize(actorId string) error {
+	acc, err := u.AccountStorage.GetAccountById(actorId)
+	if err != nil {
+		return err
+	}
+	if !acc.IsAdmin() {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+// RoomDetails names the room an account was acted on in.
+func RoomDetails(roomId, note string) string {
+	if note == "" {
+		return "room " + roomId
+	}
+	return "room " + roomId + ": " + note
+}
+
+// clip cuts s to n characters, targets of failed sign-ins are whatever the client sent.
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func toEntry(e audit.Entry) Entry {
+	return Entry{
+		Id:        e.Id,
+		Actor:     e.Actor,
+		Action:    e.Action,
+		Target:    e.Target,
+		Details:   e.Details,
+		Ip:        e.Ip,
+		RequestId: e.RequestId,
+		CreatedAt: e.CreatedAt,
+		PrevHash:  e.PrevHash,
+		Hash:      e.Hash,
+	}
+}
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/audit"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/auditrepo"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// createAdmin creates a server admin account and returns its id.
+func createAdmin(t *testing.T, accounts account.Interface) string {
+	a, err := accounts.CreateAccount(account.Credentials{Login: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = accounts.UpdateAccount(a.Id, func(a account.Account) (account.Account, error) {
+		a.Role = account.RoleAdmin
+		return a, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Id
+}
+
+func TestChain(t *testing.T) {
+	u := &UseCases{AuditStorage: auditrepo.NewMemory(), AccountStorage: accountrepo.NewMemory()}
+	adminId := createAdmin(t, u.AccountStorage)
+
+	src := Source{Actor: "7", Ip: "10.0.0.1", RequestId: "abc"}
+	for _, action := range []string{ActionSignin, ActionMemberAdd, ActionTokenRevoke} {
+		if err := u.Record(src, action, "1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v, err := u.Verify(Source{Actor: adminId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Entries != 3 || v.BrokenAt != "" || v.Head == "" {
+		t.Errorf("got %+v, want 3 entries with unbroken chain", v)
+	}
+
+	// the check and the export are logged as well, the export before it's written
+	var buf bytes.Buffer
+	if err := u.Export(Source{Actor: adminId}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var ee []Entry
+	var prev string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.PrevHash != prev {
+			t.Errorf("got line %s, want prev hash %q", sc.Text(), prev)
+		}
+		prev = e.Hash
+		ee = append(ee, e)
+	}
+	if len(ee) != 5 {
+		t.Fatalf("got %d lines, want 5", len(ee))
+	}
+	for _, e := range ee[:3] {
+		if e.Ip != src.Ip || e.RequestId != src.RequestId {
+			t.Errorf("got %+v, want source %+v", e, src)
+		}
+	}
+	if ee[3].Action != ActionAuditVerify || ee[3].Details != v.Head || ee[3].PrevHash != v.Head {
+		t.Errorf("got %+v, want the check of %s", ee[3], v.Head)
+	}
+	if ee[4].Action != ActionAuditExport || ee[4].Actor != adminId {
+		t.Errorf("got %+v, want the export by %s", ee[4], adminId)
+	}
+
+	ee, err = u.ListEntries(adminId, Filter{Action: ActionMemberAdd}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ee) != 1 || ee[0].Action != ActionMemberAdd {
+		t.Errorf("got %+v, want the %s entry", ee, ActionMemberAdd)
+	}
+}
+
+func TestNotAdmin(t *testing.T) {
+	u := &UseCases{AccountStorage: accountrepo.NewMemory()}
+	a, err := u.AccountStorage.CreateAccount(account.Credentials{Login: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.Verify(Source{Actor: a.Id}); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("got %v, want %v", err, ErrNotAdmin)
+	}
+	if err := u.Export(Source{Actor: a.Id}, &bytes.Buffer{}); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("got %v, want %v", err, ErrNotAdmin)
+	}
+}
+
+// tampered reads the log as someone with access to the database left it.
+type tampered struct {
+	audit.Interface
+	tamper func(ee []audit.Entry) []audit.Entry
+}
+
+func (t tampered) ReadEntries(offset, limit int) ([]audit.Entry, error) {
+	ee, err := t.Interface.ReadEntries(0, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	ee = t.tamper(ee)
+	if offset > len(ee) {
+		offset = len(ee)
+	}
+	ee = ee[offset:]
+	if len(ee) > limit {
+		ee = ee[:limit]
+	}
+	return ee, nil
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ee []audit.Entry) []audit.Entry
+		broken int // index of the entry reported
+	}{
+		{
+			name: "changed",
+			tamper: func(ee []audit.Entry) []audit.Entry {
+				ee[1].Target = "someone else"
+				return ee
+			},
+			broken: 1,
+		},
+		{
+			name: "changed with its hash",
+			tamper: func(ee []audit.Entry) []audit.Entry {
+				ee[1].Actor = "someone else"
+				ee[1].Hash = ee[1].ComputeHash()
+				return ee
+			},
+			broken: 2,
+		},
+		{
+			name: "removed",
+			tamper: func(ee []audit.Entry) []audit.Entry {
+				return append(ee[:1:1], ee[2:]...)
+			},
+			broken: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := &UseCases{AuditStorage: auditrepo.NewMemory(), AccountStorage: accountrepo.NewMemory()}
+			adminId := createAdmin(t, u.AccountStorage)
+			var ids []string
+			for _, target := range []string{"1", "2", "3", "4"} {
+				if err := u.Record(Source{Actor: "7"}, ActionBan, target, ""); err != nil {
+					t.Fatal(err)
+				}
+				ee, err := u.AuditStorage.ReadEntries(len(ids), 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, ee[0].Id)
+			}
+
+			v, err := u.Verify(Source{Actor: adminId})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.BrokenAt != "" {
+				t.Fatalf("got chain broken at %s before tampering", v.BrokenAt)
+			}
+
+			u.AuditStorage = tampered{Interface: u.AuditStorage, tamper: test.tamper}
+			v, err = u.Verify(Source{Actor: adminId})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.BrokenAt != ids[test.broken] {
+				t.Errorf("got chain broken at %q, want %q", v.BrokenAt, ids[test.broken])
+			}
+		})
+	}
+}
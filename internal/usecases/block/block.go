@@ -0,0 +1,62 @@
+package block
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+
+	"errors"
+	"time"
+)
+
+var ErrSelfBlock = errors.New("accounts can't block themselves")
+
+// Block is an account blocked by the actor.
+type Block struct {
+	Account   string
+	CreatedAt time.Time
+}
+
+// Interface manages blocks of the actor. Blocked accounts can't add the blocker
+// to rooms and their messages are hidden from the blocker. Blocks are private,
+// nobody but the blocker can list them.
+type Interface interface {
+	Block(actorId, accountId string) (Block, error)
+	Unblock(actorId, accountId string) error
+	// ListBlocks returns accounts blocked by the actor, newest blocks first.
+	ListBlocks(actorId string) ([]Block, error)
+}
+
+type UseCases struct {
+	BlockStorage   block.Interface
+	AccountStorage account.Interface
+}
+
+func (u *UseCases) Block(actorId, accountId string) (Block, error) {
+	if actorId == accountId {
+		return Block{}, ErrSelfBlock
+	}
+	if _, err := u.AccountStorage.GetAccountById(accountId); err != nil {
+		return Block{}, err
+	}
+	b := block.Block{Blocker: actorId, Blocked: accountId, CreatedAt: time.Now()}
+	if err := u.BlockStorage.CreateBlock(b); err != nil {
+		return Block{}, err
+	}
+	return Block{Account: b.Blocked, CreatedAt: b.CreatedAt}, nil
+}
+
+func (u *UseCases) Unblock(actorId, accountId string) error {
+	return u.BlockStorage.DeleteBlock(actorId, accountId)
+}
+
+func (u *UseCases) ListBlocks(actorId string) ([]Block, error) {
+	bb, err := u.BlockStorage.ListBlocks(actorId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Block, 0, len(bb))
+	for _, b := range bb {
+		res = append(res, Block{Account: b.Blocked, CreatedAt: b.CreatedAt})
+	}
+	return res, nil
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"errors"
+	"strings"
+	"time"
+)
+
+const shrug = `¯\_(ツ)_/¯`
+
+const (
+	usageTopic  = "/topic [new topic]"
+	usageInvite = "/invite @login..."
+	usageKick   = "/kick @login..."
+	usageMe     = "/me <action>"
+	usageShrug  = "/shrug [text]"
+)
+
+type builtin struct {
+	usage string
+	run   func(u *UseCases, c Call) (Reply, error)
+}
+
+// builtins are available in every room, forwarded commands can't take their names.
+var builtins = map[string]builtin{
+	"topic":  {usage: usageTopic, run: (*UseCases).topic},
+	"invite": {usage: usageInvite, run: (*UseCases).invite},
+	"kick":   {usage: usageKick, run: (*UseCases).kick},
+	"me":     {usage: usageMe, run: (*UseCases).me},
+	"shrug":  {usage: usageShrug, run: (*UseCases).shrug},
+}
+
+// topic shows the room topic to the caller or changes it and tells the room.
+func (u *UseCases) topic(c Call) (Reply, error) {
+	if c.Args == "" {
+		r, err := u.RoomUseCases.GetRoomById(c.ActorId, c.RoomId)
+		if err != nil {
+			return Reply{}, err
+		}
+		if r.Topic == "" {
+			return Reply{Text: "The room has no topic."}, nil
+		}
+		return Reply{Text: "Topic: " + r.Topic}, nil
+	}
+	if err := u.checkMuted(c.ActorId, c.RoomId); err != nil {
+		return Reply{}, err
+	}
+	// a flagged topic is let through, the announcement below is flagged when posted
+	if _, err := u.Filters.Check(filter.Message{AuthorId: c.ActorId, RoomId: c.RoomId, Text: c.Args}); err != nil {
+		return Reply{}, err
+	}
+	if err := u.RoomUseCases.SetTopic(c.ActorId, c.RoomId, c.Args); err != nil {
+		return Reply{}, err
+	}
+	login, err := u.login(c.ActorId)
+	if err != nil {
+		return Reply{}, err
+	}
+	return Reply{Text: "* " + login + " changed the topic to: " + c.Args, Public: true}, nil
+}
+
+func (u *UseCases) invite(c Call) (Reply, error) {
+	ids, problem, err := u.resolveLogins(c.Args)
+	if err != nil {
+		return Reply{}, err
+	}
+	if ids == nil {
+		return Reply{Text: problem + usageInvite}, nil
+	}
+	err = u.RoomUseCases.AddMembers(audit.Source{Actor: c.ActorId}, c.RoomId, ids)
+	if errors.Is(err, roomusecases.ErrBanned) {
+		return Reply{Text: "Banned accounts can't be invited"}, nil
+	}
+	if errors.Is(err, roomusecases.ErrNotAddable) {
+		return Reply{Text: "Some of the accounts can't be invited"}, nil
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+	return Reply{Text: "Invited " + c.Args}, nil
+}
+
+func (u *UseCases) kick(c Call) (Reply, error) {
+	ids, problem, err := u.resolveLogins(c.Args)
+	if err != nil {
+		return Reply{}, err
+	}
+	if ids == nil {
+		return Reply{Text: problem + usageKick}, nil
+	}
+	if err := u.RoomUseCases.RemoveMembers(audit.Source{Actor: c.ActorId}, c.RoomId, ids); err != nil {
+		return Reply{}, err
+	}
+	return Reply{Text: "Removed " + c.Args}, nil
+}
+
+func (u *UseCases) me(c Call) (Reply, error) {
+	if c.Args == "" {
+		return Reply{Text: "Usage: " + usageMe}, nil
+	}
+	login, err := u.login(c.ActorId)
+	if err != nil {
+		return Reply{}, err
+	}
+	return Reply{Text: "* " + login + " " + c.Args, Public: true}, nil
+}
+
+func (u *UseCases) shrug(c Call) (Reply, error) {
+	return Reply{Text: strings.TrimSpace(c.Args + " " + shrug), Public: true}, nil
+}
+
+// checkMuted returns ErrMuted while the account is muted in the room.
+func (u *UseCases) checkMuted(accountId, roomId string) error {
+	m, err := u.SanctionStorage.GetMute(roomId, accountId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(m.Until) {
+		return ErrMuted
+	}
+	return nil
+}
+
+// resolveLogins finds accounts of space separated logins. If some login is
+// unknown or there are none, ids are nil and problem explains why.
+func (u *UseCases) resolveLogins(args string) (ids []string, problem string, err error) {
+	logins := strings.Fields(args)
+	if len(logins) == 0 {
+		return nil, "Usage: ", nil
+	}
+	ids = make([]string, 0, len(logins))
+	for _, l := range logins {
+		acc, err := u.AccountStorage.GetAccountByLogin(strings.TrimPrefix(l, "@"))
+		if errors.Is(err, domain.ErrNotFound) || err == nil && acc.Deactivated {
+			return nil, "Unknown account " + l + ". Usage: ", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, acc.Id)
+	}
+	return ids, "", nil
+}
+
+func (u *UseCases) login(accountId string) (string, error) {
+	acc, err := u.AccountStorage.GetAccountById(accountId)
+	if err != nil {
+		return "", err
+	}
+	return acc.Login, nil
+}
@@ -0,0 +1,239 @@
+package command
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/service/outbound"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxUrlLength = 2048
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrNotRoomAdmin   = errors.New("only room admins can manage commands")
+	ErrNotBot         = errors.New("commands are forwarded to bots owned by their creator")
+	ErrInvalidName    = errors.New("command name must be 1 to 32 lowercase letters, digits, dashes or underscores")
+	ErrReservedName   = errors.New("command name is taken by a built-in command")
+	ErrInvalidUrl     = errors.New("command url must be an absolute https url")
+	ErrBotUnavailable = errors.New("bot didn't answer the command")
+	ErrMuted          = errors.New("caller is muted in the room")
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Call is a command invocation parsed from a message.
+type Call struct {
+	ActorId string
+	RoomId  string
+	Name    string // without the leading slash
+	Args    string // rest of the message with surrounding spaces trimmed
+}
+
+// Reply is the outcome of a command. Public replies are posted to the room,
+// others are shown to the caller only and never stored.
+type Reply struct {
+	Text     string
+	Format   string // plain or markdown, plain if empty
+	Public   bool
+	AuthorId string // account public reply is posted as, the caller if empty
+}
+
+// Command is either a built-in command or one forwarded to a bot.
+type Command struct {
+	Id        string // empty for built-in commands
+	Room      string
+	Name      string
+	Usage     string
+	Bot       string
+	Creator   string
+	Url       string
+	Secret    string // set only when the command is created
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// Run executes the command in the text, which starts with a slash, with
+	// room permissions of the actor.
+	Run(actorId, roomId, text string) (Reply, error)
+
+	// CreateCommand registers a command of the room forwarded to the bot at rawUrl.
+	// The bot must be owned by the actor, it is added to the room if it isn't a member yet.
+	CreateCommand(actorId, roomId, name, botId, rawUrl string) (Command, error)
+	// ListCommands lists built-in commands followed by forwarded ones to room members.
+	ListCommands(actorId, roomId string) ([]Command, error)
+	DeleteCommand(actorId, roomId, commandId string) error
+}
+
+type UseCases struct {
+	CommandStorage  command.Interface
+	AccountStorage  account.Interface
+	RoomStorage     room.Interface
+	SanctionStorage sanction.Interface
+	RoomUseCases    roomusecases.Interface
+	Filters         filter.Interface
+
+	Client *http.Client // forwarded commands are sent with defaultClient if nil
+}
+
+func (u *UseCases) Run(actorId, roomId, text string) (Reply, error) {
+	if _, err := u.RoomUseCases.GetRoomById(actorId, roomId); err != nil {
+		return Reply{}, err
+	}
+	c := parse(text)
+	c.ActorId = actorId
+	c.RoomId = roomId
+	if b, ok := builtins[c.Name]; ok {
+		return b.run(u, c)
+	}
+	cmd, err := u.CommandStorage.GetCommandByName(roomId, c.Name)
+	if errors.Is(err, domain.ErrNotFound) {
+		return Reply{}, ErrUnknownCommand
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+	return u.forward(cmd, c)
+}
+
+func (u *UseCases) CreateCommand(actorId, roomId, name, botId, rawUrl string) (Command, error) {
+	if !validName.MatchString(name) {
+		return Command{}, ErrInvalidName
+	}
+	if _, ok := builtins[name]; ok {
+		return Command{}, ErrReservedName
+	}
+	if err := validateUrl(rawUrl); err != nil {
+		return Command{}, err
+	}
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return Command{}, err
+	}
+	bot, err := u.AccountStorage.GetAccountById(botId)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return Command{}, err
+	}
+	if err != nil || !bot.Bot || bot.BotOwner != actorId || bot.Deactivated {
+		return Command{}, ErrNotBot
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return Command{}, err
+	}
+	if err := u.RoomUseCases.AddMembers(audit.Source{Actor: actorId}, roomId, []string{botId}); err != nil {
+		return Command{}, err
+	}
+	c, err := u.CommandStorage.CreateCommand(command.Command{
+		Room:      roomId,
+		Name:      name,
+		Bot:       botId,
+		Creator:   actorId,
+		Url:       rawUrl,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return Command{}, err
+	}
+	res := toCommand(c)
+	res.Secret = c.Secret
+	return res, nil
+}
+
+func (u *UseCases) ListCommands(actorId, roomId string) ([]Command, error) {
+	if _, err := u.RoomUseCases.GetRoomById(actorId, roomId); err != nil {
+		return nil, err
+	}
+	cc, err := u.CommandStorage.ListCommands(roomId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Command, 0, len(builtins)+len(cc))
+	for name, b := range builtins {
+		res = append(res, Command{Room: roomId, Name: name, Usage: b.usage})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	for _, c := range cc {
+		res = append(res, toCommand(c))
+	}
+	return res, nil
+}
+
+func (u *UseCases) DeleteCommand(actorId, roomId, commandId string) error {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return err
+	}
+	c, err := u.CommandStorage.GetCommandById(commandId)
+	if err != nil {
+		return err
+	}
+	if c.Room != roomId {
+		return domain.ErrNotFound
+	}
+	return u.CommandStorage.DeleteCommand(commandId)
+}
+
+func (u *UseCases) checkAdmin(actorId, roomId string) error {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return err
+	}
+	if !r.IsAdmin(actorId) {
+		return ErrNotRoomAdmin
+	}
+	return nil
+}
+
+// parse splits "/name args" into the call. Names are case insensitive.
+func parse(text string) Call {
+	text = strings.TrimPrefix(text, "/")
+	name := text
+	args := ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, args = text[:i], text[i:]
+	}
+	return Call{Name: strings.ToLower(name), Args: strings.TrimSpace(args)}
+}
+
+func validateUrl(s string) error {
+	if err := outbound.ValidateUrl(s, maxUrlLength); err != nil {
+		return ErrInvalidUrl
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toCommand(c command.Command) Command {
+	return Command{
+		Id:        c.Id,
+		Room:      c.Room,
+		Name:      c.Name,
+		Usage:     "/" + c.Name + " ...",
+		Bot:       c.Bot,
+		Creator:   c.Creator,
+		Url:       c.Url,
+		CreatedAt: c.CreatedAt,
+	}
+}
@@ -0,0 +1,172 @@
+package command
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/commandrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBuiltins(t *testing.T) {
+	accounts := accountrepo.NewMemory()
+	admin, err := accounts.CreateAccount(account.Credentials{Login: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := accounts.CreateAccount(account.Credentials{Login: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom(admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	sanctions := sanctionrepo.NewMemory()
+	u := &UseCases{
+		CommandStorage:  commandrepo.NewMemory(),
+		AccountStorage:  accounts,
+		RoomStorage:     rooms,
+		SanctionStorage: sanctions,
+		RoomUseCases: &roomusecases.UseCases{
+			RoomStorage:     rooms,
+			SanctionStorage: sanctions,
+			BlockStorage:    blockrepo.NewMemory(),
+			Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+		},
+		Filters: &filter.UseCases{Chain: []filter.Filter{filter.MaxLength(20)}},
+	}
+
+	reply, err := u.Run(admin.Id, roomId, "/invite @bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Public {
+		t.Errorf("invite confirmation %+v should be shown to the caller only", reply)
+	}
+	reply, err = u.Run(member.Id, roomId, "/ME waves")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Public || reply.Text != "* bob waves" {
+		t.Errorf("got %+v for /me, want public action of bob", reply)
+	}
+	if _, err := u.Run(member.Id, roomId, "/topic  release  "); err != nil {
+		t.Fatal(err)
+	}
+	var rejected *filter.RejectedError
+	if _, err := u.Run(member.Id, roomId, "/topic this is way too long for the room"); !errors.As(err, &rejected) {
+		t.Errorf("got %v for a topic the filters reject, want rejection", err)
+	}
+	if err := sanctions.PutMute(sanction.Mute{Room: roomId, Account: member.Id, Until: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Run(member.Id, roomId, "/topic muted"); err != ErrMuted {
+		t.Errorf("got %v changing the topic while muted, want %v", err, ErrMuted)
+	}
+	reply, err = u.Run(admin.Id, roomId, "/topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Public || reply.Text != "Topic: release" {
+		t.Errorf("got %+v for /topic, want the topic shown to the caller", reply)
+	}
+	if _, err := u.Run(admin.Id, roomId, "/kick bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Run(member.Id, roomId, "/shrug"); err == nil {
+		t.Error("kicked account can still run commands in the room")
+	}
+	if _, err := u.Run(admin.Id, roomId, "/nope"); err != ErrUnknownCommand {
+		t.Errorf("got %v for unknown command, want %v", err, ErrUnknownCommand)
+	}
+}
+
+func TestForwardedCommand(t *testing.T) {
+	var secret string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if r.Header.Get(webhook.HeaderSignature) != webhook.Sign(secret, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req forwardRequest
+		json.Unmarshal(body, &req)
+		json.NewEncoder(w).Encode(forwardReply{Text: "deploying " + req.Args, Public: req.Args != ""})
+	}))
+	defer srv.Close()
+
+	accounts := accountrepo.NewMemory()
+	admin, err := accounts.CreateAccount(account.Credentials{Login: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom(admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	u := &UseCases{
+		CommandStorage: commandrepo.NewMemory(),
+		AccountStorage: accounts,
+		RoomStorage:    rooms,
+		RoomUseCases: &roomusecases.UseCases{
+			RoomStorage:     rooms,
+			SanctionStorage: sanctionrepo.NewMemory(),
+			BlockStorage:    blockrepo.NewMemory(),
+			Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+		},
+		Client: srv.Client(),
+	}
+	bot, err := accounts.CreateBot("deploybot", admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CreateCommand(admin.Id, roomId, "me", bot.Id, srv.URL); err != ErrReservedName {
+		t.Errorf("got %v for built-in name, want %v", err, ErrReservedName)
+	}
+	c, err := u.CreateCommand(admin.Id, roomId, "deploy", bot.Id, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret = c.Secret
+
+	reply, err := u.Run(admin.Id, roomId, "/deploy v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Public || reply.AuthorId != bot.Id || reply.Text != "deploying v2" {
+		t.Errorf("got %+v, want public reply posted as the bot", reply)
+	}
+	reply, err = u.Run(admin.Id, roomId, "/deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Public || reply.AuthorId != "" {
+		t.Errorf("got %+v, want reply to the caller only", reply)
+	}
+
+	secret = "wrong"
+	if _, err := u.Run(admin.Id, roomId, "/deploy v3"); err == nil {
+		t.Error("failed bot request isn't reported")
+	}
+}
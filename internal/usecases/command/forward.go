@@ -0,0 +1,102 @@
+package command
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/command"
+	"github.com/mp-hl-2021/chat/internal/service/markdown"
+	"github.com/mp-hl-2021/chat/internal/service/outbound"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EventCommand is sent in the event header of forwarded commands.
+const EventCommand = "command.invoked"
+
+const (
+	// maxReplyBody limits the bot reply, message text is limited anyway.
+	maxReplyBody = 64 << 10
+	// ForwardTimeout is how long bots have to answer. The command is run while
+	// the message is being posted and ephemeral replies go back in its response,
+	// so the caller waits for the bot all this time.
+	ForwardTimeout = 2 * time.Second
+)
+
+// defaultClient refuses internal addresses the same way webhook deliveries do.
+var defaultClient = outbound.NewClient(ForwardTimeout)
+
+type forwardRequest struct {
+	Command   string `json:"command"`
+	Args      string `json:"args"`
+	RoomId    string `json:"room-id"`
+	AccountId string `json:"account-id"`
+}
+
+type forwardReply struct {
+	Text   string `json:"text"`
+	Format string `json:"format"`
+	Public bool   `json:"public"`
+}
+
+// forward sends the call to the bot of the command, signed the same way as
+// webhook deliveries. The bot answers with a reply, public ones are posted
+// on behalf of the bot. An empty response means there is nothing to show.
+func (u *UseCases) forward(cmd command.Command, c Call) (Reply, error) {
+	body, err := json.Marshal(forwardRequest{
+		Command:   cmd.Name,
+		Args:      c.Args,
+		RoomId:    c.RoomId,
+		AccountId: c.ActorId,
+	})
+	if err != nil {
+		return Reply{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, cmd.Url, bytes.NewReader(body))
+	if err != nil {
+		return Reply{}, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chat-commands")
+	req.Header.Set(webhook.HeaderEvent, EventCommand)
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(cmd.Secret, timestamp, body))
+
+	client := u.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Reply{}, fmt.Errorf("%w: %v", ErrBotUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Reply{}, fmt.Errorf("%w: unexpected status %s", ErrBotUnavailable, resp.Status)
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxReplyBody))
+	if err != nil {
+		return Reply{}, fmt.Errorf("%w: %v", ErrBotUnavailable, err)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return Reply{}, nil
+	}
+	var r forwardReply
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return Reply{}, fmt.Errorf("%w: malformed reply: %v", ErrBotUnavailable, err)
+	}
+	if _, err := markdown.ParseFormat(r.Format); err != nil {
+		return Reply{}, fmt.Errorf("%w: %v", ErrBotUnavailable, err)
+	}
+	reply := Reply{Text: r.Text, Format: r.Format, Public: r.Public && r.Text != ""}
+	if reply.Public {
+		reply.AuthorId = cmd.Bot
+	}
+	return reply, nil
+}
@@ -0,0 +1,216 @@
+package export
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrNotReady = errors.New("export is not ready")
+	ErrExpired  = errors.New("export archive has expired")
+)
+
+const ExportJobKind = "account-export"
+
+// DefaultArchiveTtl is how long finished archives are kept for download.
+const DefaultArchiveTtl = 24 * time.Hour
+
+type Interface interface {
+	StartExport(actorId, accountId string) (job.Job, error)
+	GetExport(actorId, exportId string) (job.Job, error)
+	OpenArchive(actorId, exportId string) (io.ReadCloser, error)
+}
+
+type UseCases struct {
+	AccountStorage account.Interface
+	RoomStorage    room.Interface
+	MessageStorage message.Interface
+	Jobs           job.Interface
+	Dir            string        // directory to keep archives in
+	ArchiveTtl     time.Duration // DefaultArchiveTtl if zero
+}
+
+// StartExport starts a job bundling account's profile, rooms
+// and messages of those rooms into a zip archive.
+func (u *UseCases) StartExport(actorId, accountId string) (job.Job, error) {
+	if actorId != accountId {
+		return job.Job{}, domain.ErrUnauthorized
+	}
+	return u.Jobs.Submit(accountId, ExportJobKind, accountId)
+}
+
+func (u *UseCases) GetExport(actorId, exportId string) (job.Job, error) {
+	j, err := u.Jobs.GetJobById(actorId, exportId)
+	if err != nil {
+		return job.Job{}, err
+	}
+	if j.Kind != ExportJobKind {
+		return job.Job{}, domain.ErrNotFound
+	}
+	return j, nil
+}
+
+func (u *UseCases) OpenArchive(actorId, exportId string) (io.ReadCloser, error) {
+	j, err := u.GetExport(actorId, exportId)
+	if err != nil {
+		return nil, err
+	}
+	if j.State != job.StateDone {
+		return nil, ErrNotReady
+	}
+	f, err := os.Open(filepath.Join(u.Dir, j.Result))
+	if os.IsNotExist(err) {
+		return nil, ErrExpired
+	}
+	return f, err
+}
+
+// PurgeArchives deletes archives older than ArchiveTtl along with temporary
+// files left by jobs interrupted before finishing them.
+func (u *UseCases) PurgeArchives(now time.Time) (int, error) {
+	ttl := u.ArchiveTtl
+	if ttl <= 0 {
+		ttl = DefaultArchiveTtl
+	}
+	ff, err := ioutil.ReadDir(u.Dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range ff {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".zip" && ext != ".tmp") || now.Sub(f.ModTime()) < ttl {
+			continue
+		}
+		err := os.Remove(filepath.Join(u.Dir, f.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ExportJob handles export jobs. The archive is written from scratch on every run
+// and renamed once complete, so interrupted jobs leave no partial archives.
+func (u *UseCases) ExportJob(j job.Job, progress job.Progress) (string, error) {
+	accountId := j.Payload
+	acc, err := u.AccountStorage.GetAccountById(accountId)
+	if err != nil {
+		return "", err
+	}
+	rr, err := u.RoomStorage.ListRooms(accountId)
+	if err != nil {
+		return "", err
+	}
+	total := len(rr) + 1
+	if err := progress("", 0, total); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(u.Dir, j.Id+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	if err := writeJson(zw, "profile.json", toProfileModel(acc)); err != nil {
+		return "", err
+	}
+	rooms := make([]roomModel, 0, len(rr))
+	transcript := make([]transcriptRoom, 0, len(rr))
+	for i, r := range rr {
+		mm, err := u.MessageStorage.ListMessages(accountId, r.Id)
+		if err != nil {
+			return "", err
+		}
+		names, err := u.displayNames(r.Members, mm)
+		if err != nil {
+			return "", err
+		}
+		rooms = append(rooms, toRoomModel(r, names))
+		messages := make([]messageModel, 0, len(mm))
+		for _, m := range mm {
+			messages = append(messages, toMessageModel(m, names))
+		}
+		if err := writeJson(zw, fmt.Sprintf("messages/%s.json", r.Id), messages); err != nil {
+			return "", err
+		}
+		transcript = append(transcript, transcriptRoom{Id: r.Id, Messages: messages})
+		if err := progress(r.Id, i+1, total); err != nil {
+			return "", err
+		}
+	}
+	if err := writeJson(zw, "rooms.json", rooms); err != nil {
+		return "", err
+	}
+	w, err := zw.Create("transcript.html")
+	if err != nil {
+		return "", err
+	}
+	if err := transcriptTemplate.Execute(w, transcriptData{
+		Account:     toProfileModel(acc),
+		Rooms:       transcript,
+		GeneratedAt: time.Now().UTC(),
+	}); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	name := j.Id + ".zip"
+	if err := os.Rename(tmp.Name(), filepath.Join(u.Dir, name)); err != nil {
+		return "", err
+	}
+	return name, progress("", total, total)
+}
+
+// displayNames resolves names of room members and message authors at once.
+func (u *UseCases) displayNames(members []string, mm []message.Message) (map[string]string, error) {
+	ids := append([]string(nil), members...)
+	for _, m := range mm {
+		ids = append(ids, m.Author)
+	}
+	aa, err := u.AccountStorage.GetAccountsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(aa))
+	for _, a := range aa {
+		names[a.Id] = a.Login
+		if a.Profile.DisplayName != "" {
+			names[a.Id] = a.Profile.DisplayName
+		}
+	}
+	return names, nil
+}
+
+func writeJson(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jobsFake keeps submitted jobs without running them.
+type jobsFake struct {
+	job.Interface
+	jobs map[string]job.Job
+}
+
+func (f *jobsFake) Submit(owner, kind, payload string) (job.Job, error) {
+	j := job.Job{Id: "job" + payload, Kind: kind, Owner: owner, State: job.StatePending, Payload: payload}
+	f.jobs[j.Id] = j
+	return j, nil
+}
+
+func (f *jobsFake) GetJobById(actorId, jobId string) (job.Job, error) {
+	j, ok := f.jobs[jobId]
+	if !ok || j.Owner != actorId {
+		return job.Job{}, domain.ErrNotFound
+	}
+	return j, nil
+}
+
+func noProgress(string, int, int) error { return nil }
+
+func TestExport(t *testing.T) {
+	accounts := accountrepo.NewMemory()
+	rooms := roomrepo.NewMemory()
+	messages := messagerepo.NewMemory()
+	jobs := &jobsFake{jobs: make(map[string]job.Job)}
+	u := &UseCases{
+		AccountStorage: accounts,
+		RoomStorage:    rooms,
+		MessageStorage: messages,
+		Jobs:           jobs,
+		Dir:            t.TempDir(),
+	}
+	acc, err := accounts.CreateAccount(account.Credentials{Login: "alice", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rooms.CreateRoom(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messages.CreateMessage(message.Message{Author: acc.Id, Room: r.Id, Text: "<script>", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.StartExport("mallory", acc.Id); err != domain.ErrUnauthorized {
+		t.Errorf("got %v exporting another account, want %v", err, domain.ErrUnauthorized)
+	}
+	j, err := u.StartExport(acc.Id, acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.OpenArchive(acc.Id, j.Id); err != ErrNotReady {
+		t.Errorf("got %v opening a pending export, want %v", err, ErrNotReady)
+	}
+	if _, err := u.GetExport("mallory", j.Id); err != domain.ErrNotFound {
+		t.Errorf("got %v getting export of another account, want %v", err, domain.ErrNotFound)
+	}
+
+	name, err := u.ExportJob(j, noProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.State, j.Result = job.StateDone, name
+	jobs.jobs[j.Id] = j
+
+	zr, err := zip.OpenReader(filepath.Join(u.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"profile.json", "rooms.json", "messages/" + r.Id + ".json", "transcript.html"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+	if !strings.Contains(files["messages/"+r.Id+".json"], `"text": "<script>"`) {
+		t.Errorf("got messages %s, want the message text as is", files["messages/"+r.Id+".json"])
+	}
+	if strings.Contains(files["transcript.html"], "<script>") {
+		t.Error("transcript must escape message texts")
+	}
+
+	archive, err := u.OpenArchive(acc.Id, j.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.Close()
+}
+
+func TestPurgeArchives(t *testing.T) {
+	jobs := &jobsFake{jobs: map[string]job.Job{
+		"old": {Id: "old", Kind: ExportJobKind, Owner: "alice", State: job.StateDone, Result: "old.zip"},
+		"new": {Id: "new", Kind: ExportJobKind, Owner: "alice", State: job.StateDone, Result: "new.zip"},
+	}}
+	u := &UseCases{Jobs: jobs, Dir: t.TempDir(), ArchiveTtl: time.Hour}
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"old.zip":         2 * time.Hour,
+		"new.zip":         time.Minute,
+		"interrupted.tmp": 2 * time.Hour,
+		"notes.txt":       2 * time.Hour,
+	} {
+		path := filepath.Join(u.Dir, name)
+		if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := u.PurgeArchives(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d files deleted, want the old archive and the leftover temporary file", n)
+	}
+	if _, err := u.OpenArchive("alice", "old"); err != ErrExpired {
+		t.Errorf("got %v opening a deleted archive, want %v", err, ErrExpired)
+	}
+	archive, err := u.OpenArchive("alice", "new")
+	if err != nil {
+		t.Fatalf("got %v opening a fresh archive", err)
+	}
+	archive.Close()
+	if _, err := os.Stat(filepath.Join(u.Dir, "notes.txt")); err != nil {
+		t.Errorf("got %v, files other than archives must be left alone", err)
+	}
+}
@@ -0,0 +1,116 @@
+package export
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+
+	"html/template"
+	"time"
+)
+
+type profileModel struct {
+	Id          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display-name"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+	Status      string `json:"status"`
+	Timezone    string `json:"timezone"`
+}
+
+func toProfileModel(a account.Account) profileModel {
+	return profileModel{
+		Id:          a.Id,
+		Login:       a.Login,
+		DisplayName: a.Profile.DisplayName,
+		Bio:         a.Profile.Bio,
+		Avatar:      a.Profile.Avatar,
+		Status:      a.Profile.Status,
+		Timezone:    a.Profile.Timezone,
+	}
+}
+
+type roomModel struct {
+	Id        string        `json:"id"`
+	CreatorId string        `json:"creator-id"`
+	Members   []memberModel `json:"members"`
+}
+
+type memberModel struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func toRoomModel(r room.Room, names map[string]string) roomModel {
+	m := roomModel{
+		Id:        r.Id,
+		CreatorId: r.Creator,
+		Members:   make([]memberModel, 0, len(r.Members)),
+	}
+	for _, id := range r.Members {
+		m.Members = append(m.Members, memberModel{Id: id, Name: names[id]})
+	}
+	return m
+}
+
+type messageModel struct {
+	Id         string    `json:"id"`
+	AuthorId   string    `json:"author-id"`
+	AuthorName string    `json:"author-name"`
+	CreatedAt  time.Time `json:"created-at"`
+	Text       string    `json:"text"`
+}
+
+func toMessageModel(m message.Message, names map[string]string) messageModel {
+	return messageModel{
+		Id:         m.Id,
+		AuthorId:   m.Author,
+		AuthorName: names[m.Author],
+		CreatedAt:  m.CreatedAt,
+		Text:       m.Text,
+	}
+}
+
+type transcriptRoom struct {
+	Id       string
+	Messages []messageModel
+}
+
+type transcriptData struct {
+	Account     profileModel
+	Rooms       []transcriptRoom
+	GeneratedAt time.Time
+}
+
+// transcriptTemplate escapes all the user provided strings.
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat history of {{.Account.Login}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: auto; }
+.time { color: #888; font-size: small; }
+.author { font-weight: bold; }
+.text { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Chat history of {{.Account.Login}}</h1>
+<p class="time">Generated at {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+{{range .Rooms}}
+<h2>Room {{.Id}}</h2>
+{{range .Messages}}
+<p>
+<span class="time">{{.CreatedAt.Format "2006-01-02 15:04:05"}}</span>
+<span class="author">{{if .AuthorName}}{{.AuthorName}}{{else}}deleted account{{end}}</span>
+<span class="text">{{.Text}}</span>
+</p>
+{{else}}
+<p>No messages.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,271 @@
+package filter
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionReject Action = "reject"
+	ActionFlag   Action = "flag" // post the message, but record it for review
+)
+
+const (
+	maxPatternLength = 200
+	maxRulesPerRoom  = 100
+	defaultFlagLimit = 50
+	maxFlagLimit     = 200
+)
+
+var (
+	ErrNotRoomAdmin   = errors.New("only room admins can manage filters")
+	ErrInvalidPattern = errors.New("invalid filter pattern")
+	ErrInvalidAction  = errors.New("filter action must be reject or flag")
+	ErrTooManyRules   = errors.New("too many filter rules in the room")
+	ErrInvalidLimit   = errors.New("invalid limit")
+)
+
+// RejectedError is returned for messages a filter doesn't let through.
+type RejectedError struct {
+	Filter string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("message rejected by %s filter: %s", e.Filter, e.Reason)
+}
+
+// Message is what filters see of a message about to be posted.
+type Message struct {
+	AuthorId string
+	RoomId   string
+	Text     string
+	Links    []string // urls found in the text
+}
+
+type Decision struct {
+	Action Action
+	Filter string // name of the filter which made the decision
+	Reason string
+}
+
+// Filter is a step of the chain.
+type Filter interface {
+	Name() string
+	Check(m Message) (Decision, error)
+}
+
+type Rule struct {
+	Id        string
+	Room      string
+	Pattern   string
+	Regexp    bool
+	Action    Action
+	Creator   string
+	CreatedAt time.Time
+}
+
+// RuleDraft is a rule before it is created.
+type RuleDraft struct {
+	Pattern string
+	Regexp  bool
+	Action  Action // reject if empty
+}
+
+type Flag struct {
+	Id        string
+	Message   string
+	Author    string
+	Filter    string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// Check runs the message through the chain. The first rejection stops it and
+	// is returned as *RejectedError, otherwise the decision is to allow the message
+	// or to flag it for review.
+	Check(m Message) (Decision, error)
+	// Flag records the posted message flagged by Check.
+	Flag(messageId string, m Message, d Decision) error
+
+	CreateRule(actorId, roomId string, d RuleDraft) (Rule, error)
+	ListRules(actorId, roomId string) ([]Rule, error)
+	DeleteRule(actorId, roomId, ruleId string) error
+	// ListFlags returns flagged messages of the room, newest first.
+	// Limit of zero means the default one.
+	ListFlags(actorId, roomId string, limit int) ([]Flag, error)
+}
+
+type UseCases struct {
+	FilterStorage filter.Interface
+	RoomStorage   room.Interface
+	Chain         []Filter
+
+	// Observe is called with every decision of every filter, e.g. to count them.
+	Observe func(d Decision)
+}
+
+func (u *UseCases) Check(m Message) (Decision, error) {
+	res := Decision{Action: ActionAllow}
+	for _, f := range u.Chain {
+		d, err := f.Check(m)
+		if err != nil {
+			return Decision{}, err
+		}
+		d.Filter = f.Name()
+		if u.Observe != nil {
+			u.Observe(d)
+		}
+		switch d.Action {
+		case ActionReject:
+			fmt.Printf("filter %s: rejected message of %s in room %s: %s\n", d.Filter, m.AuthorId, m.RoomId, d.Reason)
+			return Decision{}, &RejectedError{Filter: d.Filter, Reason: d.Reason}
+		case ActionFlag:
+			fmt.Printf("filter %s: flagged message of %s in room %s: %s\n", d.Filter, m.AuthorId, m.RoomId, d.Reason)
+			if res.Action == ActionAllow {
+				res = d
+			}
+		}
+	}
+	return res, nil
+}
+
+func (u *UseCases) Flag(messageId string, m Message, d Decision) error {
+	_, err := u.FilterStorage.CreateFlag(filter.Flag{
+		Message:   messageId,
+		Room:      m.RoomId,
+		Author:    m.AuthorId,
+		Filter:    d.Filter,
+		Reason:    d.Reason,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+func (u *UseCases) CreateRule(actorId, roomId string, d RuleDraft) (Rule, error) {
+	if d.Action == "" {
+		d.Action = ActionReject
+	}
+	if d.Action != ActionReject && d.Action != ActionFlag {
+		return Rule{}, ErrInvalidAction
+	}
+	if d.Pattern == "" || !utf8.ValidString(d.Pattern) || utf8.RuneCountInString(d.Pattern) > maxPatternLength {
+		return Rule{}, ErrInvalidPattern
+	}
+	r := filter.Rule{
+		Room:      roomId,
+		Pattern:   d.Pattern,
+		Regexp:    d.Regexp,
+		Action:    string(d.Action),
+		Creator:   actorId,
+		CreatedAt: time.Now(),
+	}
+	if _, err := compile(r); err != nil {
+		return Rule{}, ErrInvalidPattern
+	}
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return Rule{}, err
+	}
+	rr, err := u.FilterStorage.ListRules(roomId)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(rr) >= maxRulesPerRoom {
+		return Rule{}, ErrTooManyRules
+	}
+	r, err = u.FilterStorage.CreateRule(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	return toRule(r), nil
+}
+
+func (u *UseCases) ListRules(actorId, roomId string) ([]Rule, error) {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return nil, err
+	}
+	rr, err := u.FilterStorage.ListRules(roomId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Rule, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, toRule(r))
+	}
+	return res, nil
+}
+
+func (u *UseCases) DeleteRule(actorId, roomId, ruleId string) error {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return err
+	}
+	r, err := u.FilterStorage.GetRuleById(ruleId)
+	if err != nil {
+		return err
+	}
+	if r.Room != roomId {
+		return domain.ErrNotFound
+	}
+	return u.FilterStorage.DeleteRule(ruleId)
+}
+
+func (u *UseCases) ListFlags(actorId, roomId string, limit int) ([]Flag, error) {
+	if limit == 0 {
+		limit = defaultFlagLimit
+	}
+	if limit < 0 || limit > maxFlagLimit {
+		return nil, ErrInvalidLimit
+	}
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return nil, err
+	}
+	ff, err := u.FilterStorage.ListFlags(roomId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Flag, 0, len(ff))
+	for _, f := range ff {
+		res = append(res, Flag{
+			Id:        f.Id,
+			Message:   f.Message,
+			Author:    f.Author,
+			Filter:    f.Filter,
+			Reason:    f.Reason,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+func (u *UseCases) checkAdmin(actorId, roomId string) error {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return err
+	}
+	if !r.IsAdmin(actorId) {
+		return ErrNotRoomAdmin
+	}
+	return nil
+}
+
+func toRule(r filter.Rule) Rule {
+	return Rule{
+		Id:        r.Id,
+		Room:      r.Room,
+		Pattern:   r.Pattern,
+		Regexp:    r.Regexp,
+		Action:    Action(r.Action),
+		Creator:   r.Creator,
+		CreatedAt: r.CreatedAt,
+	}
+}
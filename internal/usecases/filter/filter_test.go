@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/filterrepo"
+
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	storage := filterrepo.NewMemory()
+	words, err := NewWords([]filter.Rule{
+		{Pattern: "spam", Action: string(ActionReject)},
+		{Pattern: `buy\s+now`, Regexp: true, Action: string(ActionFlag)},
+	}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.CreateRule(filter.Rule{Room: "1", Pattern: "Ёлка", Action: string(ActionReject)}); err != nil {
+		t.Fatal(err)
+	}
+	flood := NewFlood(time.Minute, 2)
+	now := time.Unix(0, 0)
+	flood.now = func() time.Time { return now }
+	var observed []Decision
+	u := &UseCases{
+		FilterStorage: storage,
+		Chain:         []Filter{MaxLength(20), words, NewLinks([]string{"evil.com"}), flood},
+		Observe:       func(d Decision) { observed = append(observed, d) },
+	}
+
+	for _, tc := range []struct {
+		m      Message
+		want   Action
+		filter string
+	}{
+		{m: Message{RoomId: "1", Text: "hello"}, want: ActionAllow},
+		{m: Message{RoomId: "1", Text: "this is way too long for the room"}, want: ActionReject, filter: "max-length"},
+		{m: Message{RoomId: "1", Text: "SPAM!"}, want: ActionReject, filter: "banned-words"},
+		{m: Message{RoomId: "1", Text: "spammer"}, want: ActionAllow},
+		{m: Message{RoomId: "1", Text: "BUY  now"}, want: ActionFlag, filter: "banned-words"},
+		{m: Message{RoomId: "1", Text: "ёлка"}, want: ActionReject, filter: "banned-words"},
+		{m: Message{RoomId: "2", Text: "ёлка"}, want: ActionAllow},
+		{m: Message{RoomId: "1", Text: "look", Links: []string{"https://www.Evil.com/x"}}, want: ActionReject, filter: "links"},
+		{m: Message{RoomId: "1", Text: "look", Links: []string{"https://notevil.com"}}, want: ActionAllow},
+	} {
+		d, err := u.Check(tc.m)
+		var rejected *RejectedError
+		switch {
+		case tc.want == ActionReject:
+			if !errors.As(err, &rejected) || rejected.Filter != tc.filter {
+				t.Errorf("%q MUST be rejected by %s, but got %v", tc.m.Text, tc.filter, err)
+			}
+		case err != nil:
+			t.Errorf("%q MUST pass, but got %v", tc.m.Text, err)
+		case d.Action != tc.want || d.Filter != tc.filter:
+			t.Errorf("%q got %+v, want %s by %q", tc.m.Text, d, tc.want, tc.filter)
+		}
+	}
+	if len(observed) == 0 {
+		t.Error("decisions MUST be observed")
+	}
+}
+
+func TestFlood(t *testing.T) {
+	f := NewFlood(time.Minute, 2)
+	now := time.Unix(0, 0)
+	f.now = func() time.Time { return now }
+	m := Message{AuthorId: "a", RoomId: "1", Text: "hi  there"}
+	for i := 0; i < 2; i++ {
+		if d, _ := f.Check(m); d.Action != ActionAllow {
+			t.Fatalf("message %d MUST pass, but got %+v", i, d)
+		}
+	}
+	if d, _ := f.Check(Message{AuthorId: "a", RoomId: "1", Text: "HI there"}); d.Action != ActionReject {
+		t.Fatalf("third copy MUST be rejected, but got %+v", d)
+	}
+	if d, _ := f.Check(Message{AuthorId: "b", RoomId: "1", Text: "hi there"}); d.Action != ActionAllow {
+		t.Fatalf("other authors MUST NOT be affected, but got %+v", d)
+	}
+	now = now.Add(time.Minute)
+	if d, _ := f.Check(m); d.Action != ActionAllow {
+		t.Fatalf("message after the window MUST pass, but got %+v", d)
+	}
+}
+
+func TestWordsCompilesOnce(t *testing.T) {
+	storage := filterrepo.NewMemory()
+	words, err := NewWords(nil, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := storage.CreateRule(filter.Rule{Room: "1", Pattern: "spam", Action: string(ActionReject), CreatedAt: time.Unix(1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if d, err := words.Check(Message{RoomId: "1", Text: "spam"}); err != nil || d.Action != ActionReject {
+			t.Fatalf("got %+v, err %v, want rejection", d, err)
+		}
+	}
+	first := words.compiled[r.Id].re
+	if first == nil || len(words.compiled) != 1 {
+		t.Fatalf("got compiled %+v, want the room rule", words.compiled)
+	}
+	if _, err := words.Check(Message{RoomId: "1", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if words.compiled[r.Id].re != first {
+		t.Error("rule was compiled again")
+	}
+
+	// another rule under the same id is compiled anew
+	words.compiledRule(filter.Rule{Id: r.Id, Room: "1", Pattern: "eggs", Action: string(ActionReject), CreatedAt: time.Unix(2, 0)})
+	if d, err := words.Check(Message{RoomId: "1", Text: "spam"}); err != nil || d.Action != ActionReject {
+		t.Errorf("got %+v, err %v, want rejection by the stored rule", d, err)
+	}
+}
@@ -0,0 +1,221 @@
+package filter
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/filter"
+
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type maxLength int
+
+// MaxLength rejects messages longer than n characters.
+func MaxLength(n int) Filter {
+	return maxLength(n)
+}
+
+func (maxLength) Name() string {
+	return "max-length"
+}
+
+func (f maxLength) Check(m Message) (Decision, error) {
+	if utf8.RuneCountInString(m.Text) > int(f) {
+		return Decision{Action: ActionReject, Reason: fmt.Sprintf("message is longer than %d characters", int(f))}, nil
+	}
+	return Decision{Action: ActionAllow}, nil
+}
+
+// maxCompiledRules bounds the cache of compiled room rules, it starts over once full.
+const maxCompiledRules = 10000
+
+type compiledRule struct {
+	rule filter.Rule
+	re   *regexp.Regexp // nil if the pattern doesn't compile
+}
+
+// Words matches messages against banned words and regular expressions,
+// the global ones and the ones of the room. Matching is case insensitive,
+// words match whole words only.
+type Words struct {
+	global  []compiledRule
+	storage filter.Interface
+
+	// room rules compiled before, by id. Rules aren't changed once created,
+	// CreatedAt tells a rule from another one stored under the same id.
+	compiled map[string]compiledRule
+	mu       *sync.Mutex
+}
+
+// NewWords compiles global rules, their Room is ignored.
+func NewWords(global []filter.Rule, storage filter.Interface) (*Words, error) {
+	w := &Words{
+		storage:  storage,
+		compiled: make(map[string]compiledRule),
+		mu:       &sync.Mutex{},
+	}
+	for _, r := range global {
+		re, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("global rule %q: %w", r.Pattern, err)
+		}
+		w.global = append(w.global, compiledRule{rule: r, re: re})
+	}
+	return w, nil
+}
+
+func (*Words) Name() string {
+	return "banned-words"
+}
+
+func (w *Words) Check(m Message) (Decision, error) {
+	rr, err := w.storage.ListRules(m.RoomId)
+	if err != nil {
+		return Decision{}, err
+	}
+	rules := append([]compiledRule(nil), w.global...)
+	for _, r := range rr {
+		rules = append(rules, w.compiledRule(r))
+	}
+	res := Decision{Action: ActionAllow}
+	for _, r := range rules {
+		if r.re == nil || !r.re.MatchString(m.Text) {
+			continue
+		}
+		d := Decision{Action: Action(r.rule.Action), Reason: fmt.Sprintf("matches %q", r.rule.Pattern)}
+		if d.Action == ActionReject {
+			return d, nil
+		}
+		if res.Action == ActionAllow {
+			res = d
+		}
+	}
+	return res, nil
+}
+
+// compiledRule returns the room rule compiled, the pattern is compiled once per rule.
+func (w *Words) compiledRule(r filter.Rule) compiledRule {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.compiled[r.Id]
+	if ok && c.rule.CreatedAt.Equal(r.CreatedAt) {
+		return c
+	}
+	// rules are validated on creation, the syntax may have changed since
+	re, _ := compile(r)
+	c = compiledRule{rule: r, re: re}
+	if len(w.compiled) >= maxCompiledRules {
+		w.compiled = make(map[string]compiledRule)
+	}
+	w.compiled[r.Id] = c
+	return c
+}
+
+func compile(r filter.Rule) (*regexp.Regexp, error) {
+	if r.Regexp {
+		return regexp.Compile("(?i)" + r.Pattern)
+	}
+	return regexp.Compile(`(?i)(^|[^\pL\pN_])` + regexp.QuoteMeta(r.Pattern) + `($|[^\pL\pN_])`)
+}
+
+// Links rejects messages linking to blocked hosts or their subdomains.
+type Links struct {
+	hosts []string
+}
+
+func NewLinks(hosts []string) *Links {
+	l := &Links{}
+	for _, h := range hosts {
+		l.hosts = append(l.hosts, strings.TrimSuffix(strings.ToLower(h), "."))
+	}
+	return l
+}
+
+func (*Links) Name() string {
+	return "links"
+}
+
+func (l *Links) Check(m Message) (Decision, error) {
+	for _, link := range m.Links {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		for _, blocked := range l.hosts {
+			if host == blocked || strings.HasSuffix(host, "."+blocked) {
+				return Decision{Action: ActionReject, Reason: "links to blocked host " + blocked}, nil
+			}
+		}
+	}
+	return Decision{Action: ActionAllow}, nil
+}
+
+// Flood rejects a message when its author has posted the same text to the room
+// max times within the window already. Texts are compared ignoring case and spacing.
+type Flood struct {
+	window    time.Duration
+	max       int
+	now       func() time.Time
+	mu        *sync.Mutex
+	posted    map[string][]time.Time // by author, room and text hash
+	lastSweep time.Time
+}
+
+func NewFlood(window time.Duration, max int) *Flood {
+	return &Flood{
+		window: window,
+		max:    max,
+		now:    time.Now,
+		mu:     &sync.Mutex{},
+		posted: make(map[string][]time.Time),
+	}
+}
+
+func (*Flood) Name() string {
+	return "flood"
+}
+
+func (f *Flood) Check(m Message) (Decision, error) {
+	text := strings.Join(strings.Fields(strings.ToLower(m.Text)), " ")
+	if text == "" {
+		return Decision{Action: ActionAllow}, nil
+	}
+	sum := sha256.Sum256([]byte(text))
+	key := m.AuthorId + "\x00" + m.RoomId + "\x00" + string(sum[:])
+	now := f.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.lastSweep) >= f.window {
+		for k, tt := range f.posted {
+			if tt = f.recent(tt, now); len(tt) == 0 {
+				delete(f.posted, k)
+			} else {
+				f.posted[k] = tt
+			}
+		}
+		f.lastSweep = now
+	}
+	tt := f.recent(f.posted[key], now)
+	if len(tt) >= f.max {
+		f.posted[key] = tt
+		return Decision{Action: ActionReject, Reason: fmt.Sprintf("the same message is posted %d times in %v", len(tt), f.window)}, nil
+	}
+	f.posted[key] = append(tt, now)
+	return Decision{Action: ActionAllow}, nil
+}
+
+// recent drops times out of the window, they are in increasing order.
+func (f *Flood) recent(tt []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(tt) && now.Sub(tt[i]) >= f.window {
+		i++
+	}
+	return tt[i:]
+}
@@ -0,0 +1,211 @@
+package incoming
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/message"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	tokenSize         = 32
+	maxHookNameLength = 64
+)
+
+var (
+	ErrNotRoomAdmin   = errors.New("only room admins can manage incoming webhooks")
+	ErrNotBot         = errors.New("incoming webhooks post as bots owned by their creator")
+	ErrInvalidName    = errors.New("invalid incoming webhook name")
+	ErrBotDeactivated = errors.New("bot of the incoming webhook is deactivated")
+	ErrCreatorRevoked = errors.New("creator of the incoming webhook can't manage it anymore")
+)
+
+type Hook struct {
+	Id        string
+	Room      string
+	Bot       string
+	Creator   string
+	Name      string
+	Token     string // set only when the hook is created
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// CreateHook creates a hook posting to the room as the bot. The bot must be
+	// owned by the actor, it is added to the room if it isn't a member yet.
+	CreateHook(actorId, roomId, botId, name string) (Hook, error)
+	ListHooks(actorId, roomId string) ([]Hook, error)
+	DeleteHook(actorId, roomId, hookId string) error
+
+	// Post creates a message as the bot of the hook if the token matches. Hooks
+	// stop posting once their creator leaves the room, is deactivated or suspended.
+	Post(hookId, token string, d message.Draft) (message.Message, error)
+}
+
+type UseCases struct {
+	HookStorage     incoming.Interface
+	AccountStorage  account.Interface
+	RoomStorage     room.Interface
+	RoomUseCases    roomusecases.Interface
+	MessageUseCases message.Interface
+}
+
+func (u *UseCases) CreateHook(actorId, roomId, botId, name string) (Hook, error) {
+	if err := validateName(name); err != nil {
+		return Hook{}, err
+	}
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return Hook{}, err
+	}
+	bot, err := u.AccountStorage.GetAccountById(botId)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return Hook{}, err
+	}
+	if err != nil || !bot.Bot || bot.BotOwner != actorId || bot.Deactivated {
+		return Hook{}, ErrNotBot
+	}
+	if err := u.RoomUseCases.AddMembers(audit.Source{Actor: actorId}, roomId, []string{botId}); err != nil {
+		return Hook{}, err
+	}
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return Hook{}, err
+	}
+	token := hex.EncodeToString(b)
+	h, err := u.HookStorage.CreateHook(incoming.Hook{
+		Room:      roomId,
+		Bot:       botId,
+		Creator:   actorId,
+		Name:      name,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return Hook{}, err
+	}
+	res := toHook(h)
+	res.Token = token
+	return res, nil
+}
+
+func (u *UseCases) ListHooks(actorId, roomId string) ([]Hook, error) {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return nil, err
+	}
+	hh, err := u.HookStorage.ListHooks(roomId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Hook, 0, len(hh))
+	for _, h := range hh {
+		res = append(res, toHook(h))
+	}
+	return res, nil
+}
+
+func (u *UseCases) DeleteHook(actorId, roomId, hookId string) error {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return err
+	}
+	h, err := u.HookStorage.GetHookById(hookId)
+	if err != nil {
+		return err
+	}
+	if h.Room != roomId {
+		return domain.ErrNotFound
+	}
+	return u.HookStorage.DeleteHook(hookId)
+}
+
+func (u *UseCases) Post(hookId, token string, d message.Draft) (message.Message, error) {
+	h, err := u.HookStorage.GetHookById(hookId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return message.Message{}, domain.ErrUnauthorized
+	}
+	if err != nil {
+		return message.Message{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(h.TokenHash)) != 1 {
+		return message.Message{}, domain.ErrUnauthorized
+	}
+	bot, err := u.AccountStorage.GetAccountById(h.Bot)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return message.Message{}, err
+	}
+	if err != nil || bot.Deactivated {
+		return message.Message{}, ErrBotDeactivated
+	}
+	if err := u.checkCreator(h); err != nil {
+		return message.Message{}, err
+	}
+	// hooks post text only, attachments need an upload made by the bot itself
+	d.Attachments = nil
+	return u.MessageUseCases.CreateMessage(h.Bot, h.Room, d)
+}
+
+func (u *UseCases) checkAdmin(actorId, roomId string) error {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return err
+	}
+	if !r.IsAdmin(actorId) {
+		return ErrNotRoomAdmin
+	}
+	return nil
+}
+
+// checkCreator tells whether the creator of the hook still could create it.
+func (u *UseCases) checkCreator(h incoming.Hook) error {
+	creator, err := u.AccountStorage.GetAccountById(h.Creator)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if err != nil || creator.Deactivated || creator.Suspended {
+		return ErrCreatorRevoked
+	}
+	err = u.checkAdmin(h.Creator, h.Room)
+	if errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrUnauthorized) || errors.Is(err, ErrNotRoomAdmin) {
+		return ErrCreatorRevoked
+	}
+	return err
+}
+
+func validateName(name string) error {
+	if name == "" || !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxHookNameLength {
+		return ErrInvalidName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func toHook(h incoming.Hook) Hook {
+	return Hook{
+		Id:        h.Id,
+		Room:      h.Room,
+		Bot:       h.Bot,
+		Creator:   h.Creator,
+		Name:      h.Name,
+		CreatedAt: h.CreatedAt,
+	}
+}
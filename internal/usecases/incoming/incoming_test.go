@@ -0,0 +1,133 @@
+package incoming
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/incoming"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/incomingrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/message"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"testing"
+)
+
+// messagesFake keeps posted messages.
+type messagesFake struct {
+	message.Interface
+	posted []message.Draft
+}
+
+func (f *messagesFake) CreateMessage(creatorId, roomId string, d message.Draft) (message.Message, error) {
+	f.posted = append(f.posted, d)
+	return message.Message{Id: "m", Author: creatorId, Room: roomId, Text: d.Text}, nil
+}
+
+func TestPost(t *testing.T) {
+	accounts := accountrepo.NewMemory()
+	rooms := roomrepo.NewMemory()
+	roomUseCases := &roomusecases.UseCases{
+		RoomStorage:     rooms,
+		SanctionStorage: sanctionrepo.NewMemory(),
+		BlockStorage:    blockrepo.NewMemory(),
+		Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+	}
+	messages := &messagesFake{}
+	u := &UseCases{
+		HookStorage:     incomingrepo.NewMemory(),
+		AccountStorage:  accounts,
+		RoomStorage:     rooms,
+		RoomUseCases:    roomUseCases,
+		MessageUseCases: messages,
+	}
+	admin, err := accounts.CreateAccount(account.Credentials{Login: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := accounts.CreateBot("alerts", admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := roomUseCases.CreateRoom(admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roomUseCases.AddMembers(audit.Source{Actor: admin.Id}, r.Id, []string{"member"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.CreateHook("member", r.Id, bot.Id, "ci"); err != ErrNotRoomAdmin {
+		t.Errorf("got %v creating a hook as a member, want %v", err, ErrNotRoomAdmin)
+	}
+	if _, err := u.CreateHook(admin.Id, r.Id, admin.Id, "ci"); err != ErrNotBot {
+		t.Errorf("got %v creating a hook posting as a person, want %v", err, ErrNotBot)
+	}
+	h, err := u.CreateHook(admin.Id, r.Id, bot.Id, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Post(h.Id, "wrong", message.Draft{Text: "hi"}); err != domain.ErrUnauthorized {
+		t.Errorf("got %v posting with a wrong token, want %v", err, domain.ErrUnauthorized)
+	}
+	m, err := u.Post(h.Id, h.Token, message.Draft{Text: "build failed", Attachments: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Author != bot.Id || len(messages.posted[0].Attachments) != 0 {
+		t.Errorf("got message by %s with attachments %v, want text only by the bot", m.Author, messages.posted[0].Attachments)
+	}
+
+	// the creator leaves the room and can't manage the hook anymore
+	if err := roomUseCases.RemoveMembers(audit.Source{Actor: admin.Id}, r.Id, []string{admin.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Post(h.Id, h.Token, message.Draft{Text: "hi"}); err != ErrCreatorRevoked {
+		t.Errorf("got %v posting after the creator left, want %v", err, ErrCreatorRevoked)
+	}
+	if len(messages.posted) != 1 {
+		t.Errorf("got %d messages posted, want 1", len(messages.posted))
+	}
+}
+
+func TestPostWithSuspendedCreator(t *testing.T) {
+	accounts := accountrepo.NewMemory()
+	rooms := roomrepo.NewMemory()
+	u := &UseCases{
+		HookStorage:     incomingrepo.NewMemory(),
+		AccountStorage:  accounts,
+		RoomStorage:     rooms,
+		MessageUseCases: &messagesFake{},
+	}
+	admin, err := accounts.CreateAccount(account.Credentials{Login: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := accounts.CreateBot("alerts", admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rooms.CreateRoom(admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := u.HookStorage.CreateHook(incoming.Hook{Room: r.Id, Bot: bot.Id, Creator: admin.Id, TokenHash: hashToken("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = accounts.UpdateAccount(admin.Id, func(acc account.Account) (account.Account, error) {
+		acc.Suspended = true
+		return acc, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Post(h.Id, "secret", message.Draft{Text: "hi"}); err != ErrCreatorRevoked {
+		t.Errorf("got %v posting for a suspended creator, want %v", err, ErrCreatorRevoked)
+	}
+}
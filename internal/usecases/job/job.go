@@ -0,0 +1,392 @@
+package job
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/job"
+
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatePending = string(job.StatePending)
+	StateRunning = string(job.StateRunning)
+	StateDone    = string(job.StateDone)
+	StateFailed  = string(job.StateFailed)
+)
+
+type Job struct {
+	Id        string
+	Kind      string
+	Owner     string
+	State     string
+	Payload   string
+	Cursor    string
+	Done      int
+	Total     int
+	Result    string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Handler performs a job of some kind. Handlers must be idempotent:
+// interrupted jobs are started again from the last saved cursor.
+type Handler func(j Job, progress Progress) (result string, err error)
+
+// Progress saves position of the job, so it can be resumed.
+type Progress func(cursor string, done, total int) error
+
+// RetryError returned by a handler puts the job back to pending until At.
+// The job runs again from the last saved cursor and holds no worker meanwhile.
+type RetryError struct {
+	At  time.Time
+	Err error // why the attempt failed, saved as the job error
+}
+
+func (e *RetryError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error() + ", retry at " + e.At.Format(time.RFC3339)
+	}
+	return "retry at " + e.At.Format(time.RFC3339)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAt asks to run the job again at t.
+func RetryAt(t time.Time) error {
+	return &RetryError{At: t}
+}
+
+// RetryAfter asks to run the job again at t after the attempt failed with err.
+func RetryAfter(t time.Time, err error) error {
+	return &RetryError{At: t, Err: err}
+}
+
+// errSkipped means the job is finished, isn't due yet or another instance holds it.
+var errSkipped = errors.New("job is skipped")
+
+// errLeaseLost means another instance took the job over after the lease ran out.
+var errLeaseLost = errors.New("job lease is lost")
+
+const (
+	// jobLease is how long an instance holds a job without renewing the lease
+	jobLease = time.Minute
+	// renewEvery is how often the lease of a running job is renewed
+	renewEvery = jobLease / 3
+)
+
+type Interface interface {
+	// Register adds handler for jobs of the kind. At most workers jobs
+	// of the kind run at once, the rest wait in pending state.
+	Register(kind string, h Handler, workers int)
+	Submit(owner, kind, payload string) (Job, error)
+	// Resume starts unfinished jobs no instance holds, including the ones
+	// interrupted by a server shutdown. It returns how many jobs it started
+	// and is safe to call periodically on every instance.
+	Resume() (int, error)
+
+	GetJobById(actorId, jobId string) (Job, error)
+	// GetJobStatus returns a job without an owner check. Job ids are random,
+	// so knowing the id is enough to read progress. Callers decide which kinds
+	// of jobs are shown this way.
+	GetJobStatus(jobId string) (Job, error)
+}
+
+type UseCases struct {
+	JobStorage job.Interface
+
+	handlers map[string]registration
+	active   map[string]struct{} // jobs started by this instance and not finished yet
+	mu       sync.Mutex
+
+	leaseOwner string // identifies the server instance holding jobs
+	once       sync.Once
+}
+
+type registration struct {
+	handler Handler
+	workers chan struct{} // semaphore limiting concurrent jobs of the kind
+}
+
+func (u *UseCases) Register(kind string, h Handler, workers int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.handlers == nil {
+		u.handlers = make(map[string]registration)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	u.handlers[kind] = registration{handler: h, workers: make(chan struct{}, workers)}
+}
+
+func (u *UseCases) Submit(owner, kind, payload string) (Job, error) {
+	if _, ok := u.handler(kind); !ok {
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	id, err := newJobId()
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now()
+	j, err := u.JobStorage.CreateJob(job.Job{
+		Id:        id,
+		Kind:      kind,
+		Owner:     owner,
+		State:     job.StatePending,
+		Payload:   payload,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	u.start(j)
+	return toJob(j), nil
+}
+
+func (u *UseCases) Resume() (int, error) {
+	jj, err := u.JobStorage.ListUnfinishedJobs()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	n := 0
+	for _, j := range jj {
+		if now.Before(j.LeaseUntil) {
+			continue
+		}
+		if u.start(j) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (u *UseCases) GetJobById(actorId, jobId string) (Job, error) {
+	j, err := u.JobStorage.GetJobById(jobId)
+	if err != nil {
+		return Job{}, err
+	}
+	if j.Owner != actorId {
+		return Job{}, domain.ErrNotFound
+	}
+	return toJob(j), nil
+}
+
+func (u *UseCases) GetJobStatus(jobId string) (Job, error) {
+	j, err := u.JobStorage.GetJobById(jobId)
+	if err != nil {
+		return Job{}, err
+	}
+	return toJob(j), nil
+}
+
+func (u *UseCases) handler(kind string) (registration, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	h, ok := u.handlers[kind]
+	return h, ok
+}
+
+// start runs the job once it's due unless this instance has started it already.
+func (u *UseCases) start(j job.Job) bool {
+	u.mu.Lock()
+	if u.active == nil {
+		u.active = make(map[string]struct{})
+	}
+	_, ok := u.active[j.Id]
+	u.active[j.Id] = struct{}{}
+	u.mu.Unlock()
+	if ok {
+		return false
+	}
+	u.schedule(j)
+	return true
+}
+
+func (u *UseCases) schedule(j job.Job) {
+	if d := time.Until(j.RunAt); d > 0 {
+		time.AfterFunc(d, func() { u.run(j) })
+		return
+	}
+	go u.run(j)
+}
+
+func (u *UseCases) finish(jobId string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.active, jobId)
+}
+
+// run claims the job and runs its handler. The lease is renewed while the
+// handler works, so a job outliving an instance is taken over by another one
+// once the lease runs out, and is never run by two instances at once.
+func (u *UseCases) run(j job.Job) {
+	postponed := false
+	defer func() {
+		if !postponed {
+			u.finish(j.Id)
+		}
+	}()
+	reg, ok := u.handler(j.Kind)
+	if !ok {
+		fmt.Printf("job %s: no handler for kind %s\n", j.Id, j.Kind)
+		return
+	}
+	reg.workers <- struct{}{}
+	defer func() { <-reg.workers }()
+	started, err := u.claim(j.Id, time.Now())
+	if errors.Is(err, errSkipped) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("job %s: failed to start: %v\n", j.Id, err)
+		return
+	}
+	j = started
+	stop := make(chan struct{})
+	defer close(stop)
+	go u.renew(j.Id, stop)
+	progress := func(cursor string, done, total int) error {
+		_, err := u.update(j.Id, func(j job.Job) (job.Job, error) {
+			j.Cursor = cursor
+			j.Done = done
+			j.Total = total
+			j.UpdatedAt = time.Now()
+			return j, nil
+		})
+		return err
+	}
+	result, runErr := reg.handler(toJob(j), progress)
+	if errors.Is(runErr, errLeaseLost) {
+		fmt.Printf("job %s: stopped, another instance runs it\n", j.Id)
+		return
+	}
+	var retry *RetryError
+	if errors.As(runErr, &retry) {
+		pending, err := u.update(j.Id, func(j job.Job) (job.Job, error) {
+			j.State = job.StatePending
+			j.RunAt = retry.At
+			j.Error = ""
+			if retry.Err != nil {
+				j.Error = retry.Err.Error()
+			}
+			j.LeaseOwner = ""
+			j.LeaseUntil = time.Time{}
+			j.UpdatedAt = time.Now()
+			return j, nil
+		})
+		if err != nil {
+			fmt.Printf("job %s: failed to postpone: %v\n", j.Id, err)
+			return
+		}
+		postponed = true
+		u.schedule(pending)
+		return
+	}
+	_, err = u.update(j.Id, func(j job.Job) (job.Job, error) {
+		j.State = job.StateDone
+		j.Result = result
+		j.Error = ""
+		if runErr != nil {
+			j.State = job.StateFailed
+			j.Error = runErr.Error()
+		}
+		j.LeaseOwner = ""
+		j.LeaseUntil = time.Time{}
+		j.UpdatedAt = time.Now()
+		return j, nil
+	})
+	if err != nil {
+		fmt.Printf("job %s: failed to finish: %v\n", j.Id, err)
+	}
+}
+
+// claim leases the job to this instance if it's due and no one holds it.
+func (u *UseCases) claim(jobId string, now time.Time) (job.Job, error) {
+	return u.JobStorage.UpdateJob(jobId, func(j job.Job) (job.Job, error) {
+		if j.State != job.StatePending && j.State != job.StateRunning {
+			return j, errSkipped
+		}
+		if now.Before(j.RunAt) || now.Before(j.LeaseUntil) {
+			return j, errSkipped
+		}
+		j.State = job.StateRunning
+		j.LeaseOwner = u.owner()
+		j.LeaseUntil = now.Add(jobLease)
+		j.UpdatedAt = now
+		return j, nil
+	})
+}
+
+func (u *UseCases) renew(jobId string, stop <-chan struct{}) {
+	t := time.NewTicker(renewEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			_, err := u.update(jobId, func(j job.Job) (job.Job, error) {
+				j.LeaseUntil = now.Add(jobLease)
+				return j, nil
+			})
+			if err != nil && !errors.Is(err, errLeaseLost) {
+				fmt.Printf("job %s: failed to renew lease: %v\n", jobId, err)
+			}
+		}
+	}
+}
+
+// update changes the job as long as this instance holds it.
+func (u *UseCases) update(jobId string, upd job.UpdateFunc) (job.Job, error) {
+	return u.JobStorage.UpdateJob(jobId, func(j job.Job) (job.Job, error) {
+		if j.LeaseOwner != u.owner() {
+			return j, errLeaseLost
+		}
+		return upd(j)
+	})
+}
+
+// owner identifies this server instance in leases of jobs.
+func (u *UseCases) owner() string {
+	u.once.Do(func() {
+		b := make([]byte, 8)
+		rand.Read(b)
+		u.leaseOwner = hex.EncodeToString(b)
+	})
+	return u.leaseOwner
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toJob(j job.Job) Job {
+	return Job{
+		Id:        j.Id,
+		Kind:      j.Kind,
+		Owner:     j.Owner,
+		State:     string(j.State),
+		Payload:   j.Payload,
+		Cursor:    j.Cursor,
+		Done:      j.Done,
+		Total:     j.Total,
+		Result:    j.Result,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+}
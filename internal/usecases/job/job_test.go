@@ -0,0 +1,191 @@
+package job
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/job"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/jobrepo"
+
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (u *UseCases) running() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.active)
+}
+
+func createJob(t *testing.T, storage job.Interface, j job.Job) {
+	t.Helper()
+	j.Kind = "test"
+	if j.State == "" {
+		j.State = job.StatePending
+	}
+	if _, err := storage.CreateJob(j); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitState(t *testing.T, u *UseCases, jobId, state string) Job {
+	t.Helper()
+	var j Job
+	waitFor(t, "job "+state, func() bool {
+		var err error
+		j, err = u.GetJobStatus(jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return j.State == state
+	})
+	return j
+}
+
+func TestResumeOnSeveralInstances(t *testing.T) {
+	storage := jobrepo.NewMemory()
+	createJob(t, storage, job.Job{Id: "j"})
+
+	var mu sync.Mutex
+	runs := make([]*UseCases, 0)
+	release := make(chan struct{})
+	instances := []*UseCases{{JobStorage: storage}, {JobStorage: storage}}
+	for _, u := range instances {
+		u := u
+		u.Register("test", func(j Job, progress Progress) (string, error) {
+			mu.Lock()
+			runs = append(runs, u)
+			mu.Unlock()
+			<-release
+			return "ok", nil
+		}, 1)
+	}
+	for _, u := range instances {
+		if _, err := u.Resume(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the job to start", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runs) > 0
+	})
+	mu.Lock()
+	other := instances[0]
+	if runs[0] == other {
+		other = instances[1]
+	}
+	mu.Unlock()
+	// the other instance finds the job leased and gives it up
+	waitFor(t, "the other instance to skip the job", func() bool { return other.running() == 0 })
+	if n, err := other.Resume(); err != nil || n != 0 {
+		t.Errorf("got %d, %v resuming a leased job, want 0", n, err)
+	}
+	close(release)
+
+	waitState(t, instances[0], "j", StateDone)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) != 1 {
+		t.Errorf("the job ran %d times, want once", len(runs))
+	}
+}
+
+func TestResumeTakesOverExpiredLease(t *testing.T) {
+	storage := jobrepo.NewMemory()
+	now := time.Now()
+	createJob(t, storage, job.Job{Id: "abandoned", State: job.StateRunning, Cursor: "half",
+		LeaseOwner: "stopped", LeaseUntil: now.Add(-time.Second)})
+	createJob(t, storage, job.Job{Id: "held", State: job.StateRunning,
+		LeaseOwner: "alive", LeaseUntil: now.Add(time.Hour)})
+
+	u := &UseCases{JobStorage: storage}
+	cursors := make(chan string, 2)
+	u.Register("test", func(j Job, progress Progress) (string, error) {
+		cursors <- j.Cursor
+		return "", nil
+	}, 1)
+	n, err := u.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d jobs started, want only the one with expired lease", n)
+	}
+	waitState(t, u, "abandoned", StateDone)
+	if c := <-cursors; c != "half" {
+		t.Errorf("got cursor %q, the job must resume where it stopped", c)
+	}
+	j, err := storage.GetJobById("abandoned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.LeaseOwner != "" || !j.LeaseUntil.IsZero() {
+		t.Errorf("got lease %s until %v on a finished job", j.LeaseOwner, j.LeaseUntil)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	storage := jobrepo.NewMemory()
+	createJob(t, storage, job.Job{Id: "j"})
+	u := &UseCases{JobStorage: storage}
+	at := time.Now().Add(time.Hour)
+	u.Register("test", func(j Job, progress Progress) (string, error) {
+		return "", RetryAfter(at, errors.New("storage is down"))
+	}, 1)
+	if _, err := u.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the job to be postponed", func() bool {
+		j, err := storage.GetJobById("j")
+		return err == nil && j.RunAt.Equal(at)
+	})
+	j, err := storage.GetJobById("j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.State != job.StatePending || j.Error != "storage is down" || j.LeaseOwner != "" {
+		t.Errorf("got state %s, error %q, lease %q, want pending with the error and no lease", j.State, j.Error, j.LeaseOwner)
+	}
+	if n, err := u.Resume(); err != nil || n != 0 {
+		t.Errorf("got %d, %v resuming a job waiting on this instance, want 0", n, err)
+	}
+}
+
+func TestLostLease(t *testing.T) {
+	storage := jobrepo.NewMemory()
+	createJob(t, storage, job.Job{Id: "j"})
+	u := &UseCases{JobStorage: storage}
+	u.Register("test", func(j Job, progress Progress) (string, error) {
+		// another instance takes the job over, as if this one got stuck
+		_, err := storage.UpdateJob(j.Id, func(j job.Job) (job.Job, error) {
+			j.LeaseOwner = "other"
+			return j, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return "", progress("next", 1, 2)
+	}, 1)
+	if _, err := u.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the job to stop", func() bool { return u.running() == 0 })
+	j, err := storage.GetJobById("j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.State != job.StateRunning || j.LeaseOwner != "other" || j.Cursor != "" {
+		t.Errorf("got state %s, owner %s, cursor %q, the job must be left to the other instance", j.State, j.LeaseOwner, j.Cursor)
+	}
+}
@@ -0,0 +1,165 @@
+package mention
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+	"github.com/mp-hl-2021/chat/internal/domain/mention"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+
+	"errors"
+	"time"
+)
+
+const (
+	EventType = "mention"
+
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var ErrInvalidPaging = errors.New("invalid offset or limit")
+
+// Mention is a message mentioning the account.
+type Mention struct {
+	MessageId string
+	Room      string
+	Author    string
+	Text      string
+	Format    string
+	Html      string
+	CreatedAt time.Time
+	Read      bool
+}
+
+// Event notifies the account it was mentioned.
+type Event struct {
+	MessageId string
+	Room      string
+	Author    string
+	CreatedAt time.Time
+}
+
+type Interface interface {
+	// ListMentions returns messages mentioning the actor, newest first.
+	// Limit of zero means the default one.
+	ListMentions(actorId string, unreadOnly bool, offset, limit int) ([]Mention, error)
+	// MarkRead marks mentions in the messages read, all of them if no ids given.
+	MarkRead(actorId string, messageIds []string) (int, error)
+	CountUnread(actorId string) (int, error)
+	// Notify records mentions of the accounts in the message and sends them events.
+	// Accounts which blocked the author are skipped.
+	Notify(m message.Message, accountIds []string) error
+}
+
+type UseCases struct {
+	MentionStorage mention.Interface
+	MessageStorage message.Interface
+	BlockStorage   block.Interface
+	Events         events.Interface
+}
+
+func (u *UseCases) ListMentions(actorId string, unreadOnly bool, offset, limit int) ([]Mention, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if offset < 0 || limit < 0 || limit > maxLimit {
+		return nil, ErrInvalidPaging
+	}
+	mm, err := u.MentionStorage.ListMentions(actorId, unreadOnly, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(mm))
+	for _, m := range mm {
+		ids = append(ids, m.MessageId)
+	}
+	msgs, err := u.MessageStorage.GetMessagesByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	bb, err := u.BlockStorage.ListBlocks(actorId)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(bb))
+	for _, b := range bb {
+		blocked[b.Blocked] = true
+	}
+	byId := make(map[string]message.Message, len(msgs))
+	for _, msg := range msgs {
+		// mentions made before the author was blocked are hidden as well
+		if !blocked[msg.Author] {
+			byId[msg.Id] = msg
+		}
+	}
+	res := make([]Mention, 0, len(mm))
+	for _, m := range mm {
+		// the message may be gone with its erased author or hidden
+		msg, ok := byId[m.MessageId]
+		if !ok {
+			continue
+		}
+		res = append(res, Mention{
+			MessageId: m.MessageId,
+			Room:      m.Room,
+			Author:    msg.Author,
+			Text:      msg.Text,
+			Format:    msg.Format,
+			Html:      msg.Html,
+			CreatedAt: m.CreatedAt,
+			Read:      m.Read,
+		})
+	}
+	return res, nil
+}
+
+func (u *UseCases) MarkRead(actorId string, messageIds []string) (int, error) {
+	return u.MentionStorage.MarkRead(actorId, messageIds)
+}
+
+func (u *UseCases) CountUnread(actorId string) (int, error) {
+	return u.MentionStorage.CountUnread(actorId)
+}
+
+func (u *UseCases) Notify(m message.Message, accountIds []string) error {
+	bb, err := u.BlockStorage.ListBlockers(m.Author)
+	if err != nil {
+		return err
+	}
+	blockers := make(map[string]bool, len(bb))
+	for _, b := range bb {
+		blockers[b.Blocker] = true
+	}
+	notified := make([]string, 0, len(accountIds))
+	for _, id := range accountIds {
+		if !blockers[id] {
+			notified = append(notified, id)
+		}
+	}
+	accountIds = notified
+	if len(accountIds) == 0 {
+		return nil
+	}
+	mm := make([]mention.Mention, 0, len(accountIds))
+	for _, id := range accountIds {
+		mm = append(mm, mention.Mention{
+			AccountId: id,
+			MessageId: m.Id,
+			Room:      m.Room,
+			Author:    m.Author,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	if err := u.MentionStorage.CreateMentions(mm); err != nil {
+		return err
+	}
+	for _, id := range accountIds {
+		u.Events.Publish(id, EventType, Event{
+			MessageId: m.Id,
+			Room:      m.Room,
+			Author:    m.Author,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mention
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/mentionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	messages := messagerepo.NewMemory()
+	blocks := blockrepo.NewMemory()
+	bus := events.NewBus(10)
+	u := &UseCases{
+		MentionStorage: mentionrepo.NewMemory(),
+		MessageStorage: messages,
+		BlockStorage:   blocks,
+		Events:         bus,
+	}
+	if err := blocks.CreateBlock(block.Block{Blocker: "carol", Blocked: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	_, bobEvents := bus.Subscribe("bob", "")
+	defer bobEvents.Close()
+	_, carolEvents := bus.Subscribe("carol", "")
+	defer carolEvents.Close()
+
+	var ids []string
+	for _, text := range []string{"hi @bob @carol", "again @bob"} {
+		m, err := messages.CreateMessage(message.Message{Author: "alice", Room: "room", Text: text, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := u.Notify(m, []string{"bob", "carol"}); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+
+	select {
+	case e := <-bobEvents.C:
+		d, ok := e.Data.(Event)
+		if e.Type != EventType || !ok || d.MessageId != ids[0] || d.Author != "alice" {
+			t.Errorf("got event %s %+v, want mention in %s", e.Type, e.Data, ids[0])
+		}
+	default:
+		t.Error("got no mention event")
+	}
+	select {
+	case e := <-carolEvents.C:
+		t.Errorf("got event %s %+v, mentions by blocked authors must be skipped", e.Type, e.Data)
+	default:
+	}
+	if n, err := u.CountUnread("carol"); err != nil || n != 0 {
+		t.Errorf("got %d, %v unread of the blocker, want 0", n, err)
+	}
+
+	if _, err := u.ListMentions("bob", false, -1, 0); err != ErrInvalidPaging {
+		t.Errorf("got %v with negative offset, want %v", err, ErrInvalidPaging)
+	}
+	mm, err := u.ListMentions("bob", false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 2 || mm[0].MessageId != ids[1] || mm[0].Text != "again @bob" || mm[0].Read {
+		t.Fatalf("got %+v, want both unread mentions, newest first", mm)
+	}
+	if n, err := u.MarkRead("bob", []string{ids[0]}); err != nil || n != 1 {
+		t.Errorf("got %d, %v marking a mention read, want 1", n, err)
+	}
+	mm, err = u.ListMentions("bob", true, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].MessageId != ids[1] {
+		t.Errorf("got unread %+v, want only %s", mm, ids[1])
+	}
+
+	// blocking the author later hides mentions made before
+	if err := blocks.CreateBlock(block.Block{Blocker: "bob", Blocked: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if mm, err := u.ListMentions("bob", false, 0, 0); err != nil || len(mm) != 0 {
+		t.Errorf("got %+v, %v, want mentions by the blocked author hidden", mm, err)
+	}
+}
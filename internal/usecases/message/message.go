@@ -1,50 +1,622 @@
 package message
 
 import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
 	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/domain/schedule"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+	"github.com/mp-hl-2021/chat/internal/service/markdown"
+	attachmentusecases "github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/command"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	"github.com/mp-hl-2021/chat/internal/usecases/mention"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
 
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
+)
+
+const (
+	// EventDeleted is published to room members when a message is gone,
+	// clients drop it from the timeline.
+	EventDeleted = "message.deleted"
+
+	maxAttachmentsPerMessage = 10
+	// MaxTextLength is the longest text stored, in characters. The length
+	// filter may be stricter, never looser.
+	MaxTextLength = 8000
+	MaxTtl        = 7 * 24 * time.Hour
+
+	purgeBatchSize = 500
+)
+
+var (
+	ErrInvalidFormat      = markdown.ErrUnknownFormat
+	ErrMessageTooLong     = errors.New("message text is too long")
+	ErrEmptyMessage       = errors.New("message has neither text nor attachments")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidAttachment  = errors.New("attachment is not uploaded to the room by the author")
+	ErrCommandAttachments = errors.New("commands can't have attachments")
+	ErrMuted              = errors.New("author is muted in the room")
+	ErrInvalidTtl         = errors.New("time to live must be positive and at most a week")
 )
 
 type Message struct {
+	Id          string
+	Text        string // source as written by the author
+	Format      string
+	Html        string // sanitized rendering of the text
+	Entities    []Entity
+	Author      string // account id
+	Room        string // room id
+	CreatedAt   time.Time
+	Attachments []Attachment
+	Ephemeral   bool      // reply to a command shown to its caller only, it isn't stored
+	ExpiresAt   time.Time // zero if the message doesn't expire
+	SendAt      time.Time // set if the message is scheduled, Id is then its id in the queue
+	Pinned      bool
+	System      bool // notice of the server like a pin, Author is the account which caused it
+}
+
+// DeletedEvent tells room members the message is gone.
+type DeletedEvent struct {
+	MessageId string
+	Room      string
+}
+
+// Entity is a link, code block or mention found in the text.
+type Entity struct {
+	Type      string // link, code or mention
 	Text      string
-	Author    string // account id
-	Room      string // room id
-	CreatedAt time.Time
+	Url       string
+	Language  string
+	AccountId string // for mentions of room members
+}
+
+type Attachment struct {
+	Id          string
+	Filename    string
+	MimeType    string
+	Size        int64
+	Checksum    string
+	Width       int
+	Height      int
+	Placeholder string
+	Thumbnails  []Thumbnail
+}
+
+type Thumbnail struct {
+	Size   int
+	Width  int
+	Height int
+}
+
+// Draft is a message before it is posted.
+type Draft struct {
+	Text        string
+	Format      string   // plain or markdown, plain if empty
+	Attachments []string // ids of uploaded attachments
+	// Ttl makes the message delete itself for everyone after the time, zero keeps it.
+	Ttl time.Duration
+	// SendAt in the future puts the message into the queue of the author instead.
+	SendAt time.Time
+
+	scheduledId string // set when the queue posts the message
 }
 
 type Interface interface {
-	CreateMessage(creatorId, roomId string, text string) error
+	// CreateMessage posts the message. Text starting with a slash is a command,
+	// the result is its reply, which is ephemeral unless the command posts it
+	// to the room. Text starting with two slashes is posted without the first one.
+	// Drafts to be sent later are scheduled, commands can't be.
+	CreateMessage(creatorId, roomId string, d Draft) (Message, error)
 	ListMessages(actorId, roomId string) ([]Message, error)
+	// ListScheduled returns the queue of the account, the ones to be sent first go first.
+	ListScheduled(actorId string) ([]Scheduled, error)
+	CancelScheduled(actorId, scheduledId string) error
+	// PublishScheduled posts due scheduled messages. It's run by the scheduler
+	// and returns the number of messages taken off the queue.
+	PublishScheduled(now time.Time) (int, error)
+
+	// Pin pins the message for everyone in the room, it's for room admins.
+	// Pins and unpins are noted in the room by system messages.
+	Pin(actorId, roomId, messageId string) (Message, error)
+	Unpin(actorId, roomId, messageId string) error
+	// ListPins returns pinned messages of the room, oldest first.
+	ListPins(actorId, roomId string) ([]Message, error)
+	// PurgeExpired deletes expired messages with their attachments and tells
+	// room members about it. It's run by the janitor and returns the number
+	// of deleted messages. Rooms under legal hold keep expired messages, reads
+	// leave them out all the same.
+	PurgeExpired(now time.Time) (int, error)
+	// DeleteMessage removes the message with its attachments for everyone and
+	// tells room members about it. It's for moderators, who needn't be members.
+	DeleteMessage(messageId string) error
 }
 
 type UseCases struct {
-	MessageStorage message.Interface
+	AccountStorage    account.Interface
+	MessageStorage    message.Interface
+	RoomStorage       room.Interface
+	AttachmentStorage attachment.Interface
+	Mentions          mention.Interface
+	Webhooks          webhook.Interface
+	Commands          command.Interface
+	Filters           filter.Interface
+	SanctionStorage   sanction.Interface
+	BlockStorage      block.Interface
+	Attachments       attachmentusecases.Deleter // removes attachments of expired messages
+	Events            events.Interface
+	ScheduleStorage   schedule.Interface
+
+	leaseOwner string // identifies the server instance claiming scheduled messages
+	once       sync.Once
+}
+
+func (u *UseCases) CreateMessage(creatorId, roomId string, d Draft) (Message, error) {
+	scheduled := d.SendAt.After(time.Now())
+	if strings.HasPrefix(d.Text, "//") {
+		d.Text = d.Text[1:]
+	} else if strings.HasPrefix(d.Text, "/") {
+		if scheduled {
+			return Message{}, ErrScheduledCommand
+		}
+		return u.runCommand(creatorId, roomId, d)
+	}
+	if scheduled {
+		return u.scheduleMessage(creatorId, roomId, d)
+	}
+	return u.createMessage(creatorId, roomId, d)
+}
+
+func (u *UseCases) runCommand(creatorId, roomId string, d Draft) (Message, error) {
+	if len(d.Attachments) > 0 {
+		return Message{}, ErrCommandAttachments
+	}
+	if utf8.RuneCountInString(d.Text) > MaxTextLength {
+		return Message{}, ErrMessageTooLong
+	}
+	reply, err := u.Commands.Run(creatorId, roomId, d.Text)
+	if err != nil {
+		return Message{}, err
+	}
+	if reply.Public {
+		author := reply.AuthorId
+		if author == "" {
+			author = creatorId
+		}
+		return u.createMessage(author, roomId, Draft{Text: reply.Text, Format: reply.Format})
+	}
+	format, err := markdown.ParseFormat(reply.Format)
+	if err != nil {
+		return Message{}, err
+	}
+	doc, err := markdown.Render(reply.Text, format)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Text:        reply.Text,
+		Format:      string(format),
+		Html:        doc.Html,
+		Entities:    make([]Entity, 0),
+		Room:        roomId,
+		CreatedAt:   time.Now(),
+		Attachments: make([]Attachment, 0),
+		Ephemeral:   true,
+	}, nil
+}
+
+func (u *UseCases) createMessage(creatorId, roomId string, d Draft) (Message, error) {
+	format, err := checkDraft(d)
+	if err != nil {
+		return Message{}, err
+	}
+	r, err := u.RoomStorage.GetRoomById(creatorId, roomId)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := u.checkMuted(creatorId, roomId); err != nil {
+		return Message{}, err
+	}
+	// a scheduled message is posted with the attachments it has taken already
+	aa, err := u.checkAttachments(creatorId, roomId, d.Attachments, d.scheduledId != "")
+	if err != nil {
+		return Message{}, err
+	}
+	doc, err := markdown.Render(d.Text, format)
+	if err != nil {
+		return Message{}, err
+	}
+	entities, err := u.resolveEntities(doc.Entities, r.Members)
+	if err != nil {
+		return Message{}, err
+	}
+	fm := filter.Message{AuthorId: creatorId, RoomId: roomId, Text: d.Text}
+	for _, e := range entities {
+		if e.Type == string(markdown.EntityLink) {
+			fm.Links = append(fm.Links, e.Url)
+		}
+	}
+	decision, err := u.Filters.Check(fm)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := u.attach(d.Attachments); err != nil {
+		return Message{}, err
+	}
+	now := time.Now()
+	var expiresAt time.Time
+	if d.Ttl > 0 {
+		expiresAt = now.Add(d.Ttl)
+	}
+	m, err := u.MessageStorage.CreateMessage(message.Message{
+		Author:      creatorId,
+		Room:        roomId,
+		CreatedAt:   now,
+		Text:        d.Text,
+		Format:      string(format),
+		Html:        doc.Html,
+		Entities:    entities,
+		Attachments: d.Attachments,
+		ExpiresAt:   expiresAt,
+		ScheduledId: d.scheduledId,
+	})
+	if err != nil {
+		if d.scheduledId == "" {
+			u.detach(d.Attachments)
+		}
+		return Message{}, err
+	}
+	if decision.Action == filter.ActionFlag {
+		if err := u.Filters.Flag(m.Id, fm, decision); err != nil {
+			fmt.Printf("message %s: failed to flag for review: %v\n", m.Id, err)
+		}
+	}
+	if mentioned := mentionedAccounts(m, r.Members); len(mentioned) > 0 {
+		// the message is posted already, failing here would make clients post it twice
+		if err := u.Mentions.Notify(m, mentioned); err != nil {
+			fmt.Printf("message %s: failed to notify mentioned accounts: %v\n", m.Id, err)
+		}
+	}
+	err = u.Webhooks.Dispatch(roomId, webhook.EventMessageCreated, webhook.MessageData{
+		Id:        m.Id,
+		AuthorId:  m.Author,
+		Format:    m.Format,
+		Text:      m.Text,
+		CreatedAt: m.CreatedAt,
+	})
+	if err != nil {
+		fmt.Printf("message %s: failed to dispatch webhooks: %v\n", m.Id, err)
+	}
+	return toMessage(m, attachmentsById(aa)), nil
+}
+
+// checkDraft validates the draft by itself and returns its format.
+func checkDraft(d Draft) (markdown.Format, error) {
+	if d.Text == "" && len(d.Attachments) == 0 {
+		return "", ErrEmptyMessage
+	}
+	if len(d.Attachments) > maxAttachmentsPerMessage {
+		return "", ErrTooManyAttachments
+	}
+	if utf8.RuneCountInString(d.Text) > MaxTextLength {
+		return "", ErrMessageTooLong
+	}
+	if d.Ttl < 0 || d.Ttl > MaxTtl {
+		return "", ErrInvalidTtl
+	}
+	return markdown.ParseFormat(d.Format)
 }
 
-func (u *UseCases) CreateMessage(creatorId, roomId string, text string) error {
-	t := time.Now()
-	// todo: check whether room exists
-	_, err := u.MessageStorage.CreateMessage(creatorId, roomId, text, t)
+// checkAttachments returns the attachments if the author uploaded all of them to
+// the room. An upload belongs to one message, so attached ones are refused unless
+// taken is set.
+func (u *UseCases) checkAttachments(creatorId, roomId string, ids []string, taken bool) ([]attachment.Attachment, error) {
+	aa, err := u.AttachmentStorage.GetAttachmentsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(aa) != len(ids) {
+		return nil, ErrInvalidAttachment
+	}
+	for _, a := range aa {
+		if a.Room != roomId || a.Owner != creatorId || (a.Attached && !taken) {
+			return nil, ErrInvalidAttachment
+		}
+	}
+	return aa, nil
+}
+
+// attach marks the attachments as taken, so they don't expire as unattached
+// uploads. It fails if some of them have expired since they were checked.
+func (u *UseCases) attach(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	n, err := u.AttachmentStorage.SetAttached(ids, true)
 	if err != nil {
 		return err
 	}
+	if n < len(ids) {
+		return ErrInvalidAttachment
+	}
 	return nil
 }
 
+// detach lets the attachments expire once nothing refers to them.
+func (u *UseCases) detach(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := u.AttachmentStorage.SetAttached(ids, false); err != nil {
+		fmt.Printf("attachments %s: failed to detach: %v\n", strings.Join(ids, ","), err)
+	}
+}
+
 func (u *UseCases) ListMessages(actorId, roomId string) ([]Message, error) {
+	if _, err := u.RoomStorage.GetRoomById(actorId, roomId); err != nil {
+		return nil, err
+	}
 	mm, err := u.MessageStorage.ListMessages(actorId, roomId)
 	if err != nil {
 		return nil, err
 	}
+	mm, err = u.hideBlocked(actorId, mm)
+	if err != nil {
+		return nil, err
+	}
+	return u.withAttachments(mm)
+}
+
+// withAttachments converts the messages along with their attachments.
+func (u *UseCases) withAttachments(mm []message.Message) ([]Message, error) {
+	ids := make([]string, 0)
+	for _, m := range mm {
+		ids = append(ids, m.Attachments...)
+	}
+	aa, err := u.AttachmentStorage.GetAttachmentsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := attachmentsById(aa)
 	res := make([]Message, 0, len(mm))
 	for _, m := range mm {
-		res = append(res, Message{
-			Text:      m.Text,
-			Author:    m.Author,
-			Room:      m.Room,
-			CreatedAt: m.CreatedAt,
+		res = append(res, toMessage(m, byId))
+	}
+	return res, nil
+}
+
+func (u *UseCases) PurgeExpired(now time.Time) (int, error) {
+	held, err := u.RoomStorage.ListHeldRooms()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for {
+		mm, err := u.MessageStorage.ListExpired(now, held, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(mm) == 0 {
+			return total, nil
+		}
+		ids := make([]string, 0, len(mm))
+		var attachmentIds []string
+		for _, m := range mm {
+			ids = append(ids, m.Id)
+			attachmentIds = append(attachmentIds, m.Attachments...)
+		}
+		// attachments go first, so the messages stay to be found again if they fail
+		if err := u.Attachments.DeleteAttachments(attachmentIds); err != nil {
+			return total, err
+		}
+		n, err := u.MessageStorage.DeleteMessagesByIds(ids)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		u.publishDeleted(mm)
+		if len(mm) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (u *UseCases) DeleteMessage(messageId string) error {
+	mm, err := u.MessageStorage.GetMessagesByIds([]string{messageId})
+	if err != nil {
+		return err
+	}
+	if len(mm) == 0 {
+		return domain.ErrNotFound
+	}
+	// attachments go first, so the message stays to be deleted again if they fail
+	if err := u.Attachments.DeleteAttachments(mm[0].Attachments); err != nil {
+		return err
+	}
+	if err := u.MessageStorage.DeleteMessage(messageId); err != nil {
+		return err
+	}
+	u.publishDeleted(mm)
+	return nil
+}
+
+// publishDeleted tells current members of the rooms about deleted messages.
+func (u *UseCases) publishDeleted(mm []message.Message) {
+	members := make(map[string][]string)
+	for _, m := range mm {
+		ids, ok := members[m.Room]
+		if !ok {
+			r, err := u.RoomStorage.InspectRoom(m.Room)
+			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+				fmt.Printf("room %s: failed to publish deleted messages: %v\n", m.Room, err)
+			}
+			ids = r.Members
+			members[m.Room] = ids
+		}
+		for _, id := range ids {
+			u.Events.Publish(id, EventDeleted, DeletedEvent{MessageId: m.Id, Room: m.Room})
+		}
+	}
+}
+
+// resolveEntities finds accounts of mentioned logins. Only room members
+// can be mentioned, mentions of anyone else stay plain text.
+func (u *UseCases) resolveEntities(ee []markdown.Entity, members []string) ([]message.Entity, error) {
+	isMember := make(map[string]bool, len(members))
+	for _, id := range members {
+		isMember[id] = true
+	}
+	res := make([]message.Entity, 0, len(ee))
+	accountIds := make(map[string]string)
+	for _, e := range ee {
+		me := message.Entity{Type: string(e.Type), Text: e.Text, Url: e.Url, Language: e.Language}
+		if e.Type == markdown.EntityMention {
+			id, ok := accountIds[e.Text]
+			if !ok {
+				acc, err := u.AccountStorage.GetAccountByLogin(e.Text)
+				if err != nil && !errors.Is(err, domain.ErrNotFound) {
+					return nil, err
+				}
+				if isMember[acc.Id] {
+					id = acc.Id
+				}
+				accountIds[e.Text] = id
+			}
+			me.AccountId = id
+		}
+		res = append(res, me)
+	}
+	return res, nil
+}
+
+// mentionedAccounts lists accounts the message mentions, except its author.
+func mentionedAccounts(m message.Message, members []string) []string {
+	seen := map[string]bool{m.Author: true}
+	res := make([]string, 0)
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	for _, e := range m.Entities {
+		switch markdown.EntityType(e.Type) {
+		case markdown.EntityMention:
+			add(e.AccountId)
+		case markdown.EntityRoomMention:
+			for _, id := range members {
+				add(id)
+			}
+		}
+	}
+	return res
+}
+
+func attachmentsById(aa []attachment.Attachment) map[string]attachment.Attachment {
+	res := make(map[string]attachment.Attachment, len(aa))
+	for _, a := range aa {
+		res[a.Id] = a
+	}
+	return res
+}
+
+func toMessage(m message.Message, attachments map[string]attachment.Attachment) Message {
+	if m.Format == "" {
+		m.Format = string(markdown.Plain)
+	}
+	if m.Html == "" && m.Text != "" {
+		// messages stored before rendering was introduced, imported ones among them
+		if doc, err := markdown.Render(m.Text, markdown.Format(m.Format)); err == nil {
+			m.Html = doc.Html
+		}
+	}
+	res := Message{
+		Id:          m.Id,
+		Text:        m.Text,
+		Format:      m.Format,
+		Html:        m.Html,
+		Entities:    make([]Entity, 0, len(m.Entities)),
+		Author:      m.Author,
+		Room:        m.Room,
+		CreatedAt:   m.CreatedAt,
+		Attachments: make([]Attachment, 0, len(m.Attachments)),
+		ExpiresAt:   m.ExpiresAt,
+		Pinned:      m.Pinned,
+		System:      m.System,
+	}
+	for _, e := range m.Entities {
+		res.Entities = append(res.Entities, Entity{
+			Type:      e.Type,
+			Text:      e.Text,
+			Url:       e.Url,
+			Language:  e.Language,
+			AccountId: e.AccountId,
 		})
 	}
+	for _, id := range m.Attachments {
+		a, ok := attachments[id]
+		if !ok {
+			continue
+		}
+		att := Attachment{
+			Id:          a.Id,
+			Filename:    a.Filename,
+			MimeType:    a.MimeType,
+			Size:        a.Size,
+			Checksum:    a.Checksum,
+			Width:       a.Width,
+			Height:      a.Height,
+			Placeholder: a.Placeholder,
+			Thumbnails:  make([]Thumbnail, 0, len(a.Thumbnails)),
+		}
+		for _, t := range a.Thumbnails {
+			att.Thumbnails = append(att.Thumbnails, Thumbnail{Size: t.Size, Width: t.Width, Height: t.Height})
+		}
+		res.Attachments = append(res.Attachments, att)
+	}
+	return res
+}
+
+func (u *UseCases) checkMuted(accountId, roomId string) error {
+	m, err := u.SanctionStorage.GetMute(roomId, accountId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(m.Until) {
+		return ErrMuted
+	}
+	return nil
+}
+
+// hideBlocked drops messages of accounts the actor blocked.
+func (u *UseCases) hideBlocked(actorId string, mm []message.Message) ([]message.Message, error) {
+	bb, err := u.BlockStorage.ListBlocks(actorId)
+	if err != nil || len(bb) == 0 {
+		return mm, err
+	}
+	blocked := make(map[string]bool, len(bb))
+	for _, b := range bb {
+		blocked[b.Blocked] = true
+	}
+	res := make([]message.Message, 0, len(mm))
+	for _, m := range mm {
+		if !blocked[m.Author] {
+			res = append(res, m)
+		}
+	}
 	return res, nil
 }
@@ -0,0 +1,483 @@
+package message
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	domainattachment "github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/schedulerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+	"github.com/mp-hl-2021/chat/internal/usecases/mention"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateMessageInvalidTtl(t *testing.T) {
+	u := &UseCases{}
+	for _, ttl := range []time.Duration{-time.Second, MaxTtl + time.Second} {
+		if _, err := u.CreateMessage("1", "1", Draft{Text: "hi", Ttl: ttl}); !errors.Is(err, ErrInvalidTtl) {
+			t.Errorf("ttl %v: got %v, want %v", ttl, err, ErrInvalidTtl)
+		}
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := messagerepo.NewMemory()
+	now := time.Now()
+	var ids []string
+	for _, expiresAt := range []time.Time{{}, now.Add(-time.Minute), now.Add(time.Hour)} {
+		m, err := messages.CreateMessage(message.Message{Author: "1", Room: r.Id, CreatedAt: now.Add(-time.Hour), ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+	bus := events.NewBus(10)
+	_, sub := bus.Subscribe("1", "")
+	defer sub.Close()
+	attachments := attachmentrepo.NewMemory()
+	u := &UseCases{
+		RoomStorage:       rooms,
+		MessageStorage:    messages,
+		AttachmentStorage: attachments,
+		Attachments:       &attachment.UseCases{AttachmentStorage: attachments},
+		Events:            bus,
+	}
+
+	// expired messages are hidden before the purge gets to them
+	mm, err := messages.GetMessagesByIds(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 2 {
+		t.Errorf("got %d messages, want 2", len(mm))
+	}
+
+	n, err := u.PurgeExpired(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d purged, want 1", n)
+	}
+	select {
+	case e := <-sub.C:
+		d, ok := e.Data.(DeletedEvent)
+		if e.Type != EventDeleted || !ok || d.MessageId != ids[1] || d.Room != r.Id {
+			t.Errorf("got event %s %+v, want deletion of %s", e.Type, e.Data, ids[1])
+		}
+	default:
+		t.Error("got no deletion event")
+	}
+
+	// a held room keeps expired messages, reads leave them out anyway
+	if _, err := rooms.SetLegalHold(r.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	n, err = u.PurgeExpired(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d purged under legal hold, want 0", n)
+	}
+	if mm, err := messages.ListExpired(now.Add(2*time.Hour), nil, 10); err != nil || len(mm) != 1 || mm[0].Id != ids[2] {
+		t.Errorf("got expired %+v, err %v, want %s kept", mm, err, ids[2])
+	}
+	if _, err := rooms.SetLegalHold(r.Id, false); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = u.PurgeExpired(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d purged later, want 1", n)
+	}
+	mm, err = messages.ListMessages("1", r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].Id != ids[0] {
+		t.Errorf("got %+v, want only the message without expiry", mm)
+	}
+}
+
+// newRoom returns use cases over memory storage and a room created by the account.
+func newRoom(t *testing.T) (*UseCases, account.Account, room.Room) {
+	accounts := accountrepo.NewMemory()
+	acc, err := accounts.CreateAccount(account.Credentials{Login: "alice", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &UseCases{
+		AccountStorage:    accounts,
+		MessageStorage:    messagerepo.NewMemory(),
+		RoomStorage:       rooms,
+		AttachmentStorage: attachmentrepo.NewMemory(),
+		Webhooks:          &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+		Filters:           &filter.UseCases{},
+		SanctionStorage:   sanctionrepo.NewMemory(),
+		BlockStorage:      blockrepo.NewMemory(),
+		ScheduleStorage:   schedulerepo.NewMemory(),
+	}
+	return u, acc, r
+}
+
+func TestScheduledMessages(t *testing.T) {
+	u, acc, r := newRoom(t)
+	now := time.Now()
+	sendAt := now.Add(time.Hour)
+
+	if _, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "/help", SendAt: sendAt}); !errors.Is(err, ErrScheduledCommand) {
+		t.Errorf("got %v scheduling a command, want %v", err, ErrScheduledCommand)
+	}
+	if _, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "hi", SendAt: now.Add(MaxScheduleAhead + time.Hour)}); !errors.Is(err, ErrInvalidSendAt) {
+		t.Errorf("got %v scheduling too far, want %v", err, ErrInvalidSendAt)
+	}
+	later, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "later", SendAt: sendAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !later.SendAt.Equal(sendAt) {
+		t.Errorf("got send time %v, want %v", later.SendAt, sendAt)
+	}
+	cancelled, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "never", SendAt: sendAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CancelScheduled("someone", cancelled.Id); err == nil {
+		t.Error("cancelled a message of someone else")
+	}
+	if err := u.CancelScheduled(acc.Id, cancelled.Id); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := u.ListScheduled(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].Id != later.Id {
+		t.Fatalf("got queue %+v, want only %s", queue, later.Id)
+	}
+
+	if n, err := u.PublishScheduled(now); err != nil || n != 0 {
+		t.Errorf("got %d published early, err %v", n, err)
+	}
+	if n, err := u.PublishScheduled(sendAt); err != nil || n != 1 {
+		t.Errorf("got %d published, err %v, want 1", n, err)
+	}
+	mm, err := u.ListMessages(acc.Id, r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].Text != "later" {
+		t.Errorf("got messages %+v, want the scheduled one", mm)
+	}
+
+	// another instance holds the lease, so neither posting nor cancelling happens
+	leased, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "elsewhere", SendAt: sendAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ScheduleStorage.ClaimDue("other", sendAt, sendAt.Add(time.Minute), 10); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := u.PublishScheduled(sendAt); err != nil || n != 0 {
+		t.Errorf("got %d published while leased, err %v", n, err)
+	}
+	if err := u.CancelScheduled(acc.Id, leased.Id); !errors.Is(err, ErrSending) {
+		t.Errorf("got %v cancelling a leased message, want %v", err, ErrSending)
+	}
+}
+
+func TestAttachmentsTaken(t *testing.T) {
+	u, acc, r := newRoom(t)
+	upload := func() string {
+		a, err := u.AttachmentStorage.CreateAttachment(domainattachment.Attachment{Room: r.Id, Owner: acc.Id, Size: 1}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Id
+	}
+	attached := func(id string) bool {
+		a, err := u.AttachmentStorage.GetAttachmentById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Attached
+	}
+
+	posted := upload()
+	if _, err := u.CreateMessage(acc.Id, r.Id, Draft{Attachments: []string{posted}}); err != nil {
+		t.Fatal(err)
+	}
+	if !attached(posted) {
+		t.Error("posted attachment must be marked attached")
+	}
+	if _, err := u.CreateMessage(acc.Id, r.Id, Draft{Attachments: []string{posted}}); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("got %v attaching an upload twice, want %v", err, ErrInvalidAttachment)
+	}
+
+	sendAt := time.Now().Add(time.Hour)
+	cancelled := upload()
+	m, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "never", Attachments: []string{cancelled}, SendAt: sendAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !attached(cancelled) {
+		t.Error("attachment of a scheduled message must be marked attached")
+	}
+	if err := u.CancelScheduled(acc.Id, m.Id); err != nil {
+		t.Fatal(err)
+	}
+	if attached(cancelled) {
+		t.Error("attachment of a cancelled message must expire as unattached")
+	}
+
+	scheduled := upload()
+	if _, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "later", Attachments: []string{scheduled}, SendAt: sendAt}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := u.PublishScheduled(sendAt); err != nil || n != 1 {
+		t.Fatalf("got %d published, err %v, want the message posted with its attachment", n, err)
+	}
+	if !attached(scheduled) {
+		t.Error("attachment of a posted scheduled message must stay attached")
+	}
+}
+
+func TestPins(t *testing.T) {
+	u, acc, r := newRoom(t)
+	m, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "rules of the room"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.RoomStorage.UpdateRoom(acc.Id, r.Id, func(r room.Room) (room.Room, error) {
+		r.Members = append(r.Members, "member")
+		return r, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Pin("member", r.Id, m.Id); !errors.Is(err, ErrNotRoomAdmin) {
+		t.Errorf("got %v pinning as a member, want %v", err, ErrNotRoomAdmin)
+	}
+	pinned, err := u.Pin(acc.Id, r.Id, m.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned.Pinned {
+		t.Error("pinned message isn't flagged")
+	}
+	// pinning again changes nothing
+	if _, err := u.Pin(acc.Id, r.Id, m.Id); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := u.ListPins("member", r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Id != m.Id {
+		t.Errorf("got pins %+v, want %s", pins, m.Id)
+	}
+	if err := u.Unpin(acc.Id, r.Id, m.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	mm, err := u.ListMessages(acc.Id, r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rules of the room", "pinned message " + m.Id, "unpinned message " + m.Id}
+	if len(mm) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(mm), len(want))
+	}
+	for i, m := range mm {
+		if m.Text != want[i] || m.System != (i > 0) || m.Pinned {
+			t.Errorf("got message %d %q system %v pinned %v, want %q", i, m.Text, m.System, m.Pinned, want[i])
+		}
+	}
+
+	for i := 0; i < MaxPinsPerRoom; i++ {
+		m, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "pin me"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Pin(acc.Id, r.Id, m.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := u.Pin(acc.Id, r.Id, m.Id); !errors.Is(err, ErrPinLimit) {
+		t.Errorf("got %v pinning over the limit, want %v", err, ErrPinLimit)
+	}
+}
+
+func TestHideBlocked(t *testing.T) {
+	u, acc, r := newRoom(t)
+	bob, err := u.AccountStorage.CreateAccount(account.Credentials{Login: "bob", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.RoomStorage.UpdateRoom(acc.Id, r.Id, func(r room.Room) (room.Room, error) {
+		r.Members = append(r.Members, bob.Id)
+		return r, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mine, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	his, err := u.CreateMessage(bob.Id, r.Id, Draft{Text: "buy my stuff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Pin(acc.Id, r.Id, his.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.BlockStorage.CreateBlock(block.Block{Blocker: acc.Id, Blocked: bob.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	mm, err := u.ListMessages(acc.Id, r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mm {
+		if m.Id == his.Id {
+			t.Errorf("got message %s of the blocked account", m.Id)
+		}
+	}
+	if len(mm) != 2 || mm[0].Id != mine.Id || !mm[1].System {
+		t.Errorf("got %+v, want the own message and the pin notice", mm)
+	}
+	if pins, err := u.ListPins(acc.Id, r.Id); err != nil || len(pins) != 0 {
+		t.Errorf("got pins %+v, %v, want the pin of the blocked account hidden", pins, err)
+	}
+
+	// the blocked account still sees everything
+	if mm, err := u.ListMessages(bob.Id, r.Id); err != nil || len(mm) != 3 {
+		t.Errorf("got %d messages, %v for the blocked account, want 3", len(mm), err)
+	}
+	if pins, err := u.ListPins(bob.Id, r.Id); err != nil || len(pins) != 1 || pins[0].Id != his.Id {
+		t.Errorf("got pins %+v, %v for the blocked account, want %s", pins, err, his.Id)
+	}
+}
+
+func TestScheduledPostedOnce(t *testing.T) {
+	u, acc, r := newRoom(t)
+	sendAt := time.Now().Add(time.Hour)
+	s, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "once", SendAt: sendAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an instance posted the message and went down before removing it from the queue
+	claimed, err := u.ScheduleStorage.ClaimDue("gone", sendAt, sendAt.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Id != s.Id {
+		t.Fatalf("got claimed %+v, want %s", claimed, s.Id)
+	}
+	if err := u.postScheduled(claimed[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := u.PublishScheduled(sendAt.Add(2 * time.Minute)); err != nil || n != 1 {
+		t.Errorf("got %d published after the lease, err %v, want 1", n, err)
+	}
+	mm, err := u.ListMessages(acc.Id, r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 {
+		t.Errorf("got %d messages, want the scheduled one posted once", len(mm))
+	}
+	if queue, err := u.ListScheduled(acc.Id); err != nil || len(queue) != 0 {
+		t.Errorf("got queue %+v, err %v, want it empty", queue, err)
+	}
+}
+
+// mentionsFake keeps accounts notified of mentions.
+type mentionsFake struct {
+	mention.Interface
+	notified []string
+}
+
+func (f *mentionsFake) Notify(m message.Message, accountIds []string) error {
+	f.notified = append(f.notified, accountIds...)
+	return nil
+}
+
+func TestMentions(t *testing.T) {
+	u, acc, r := newRoom(t)
+	mentions := &mentionsFake{}
+	u.Mentions = mentions
+	bob, err := u.AccountStorage.CreateAccount(account.Credentials{Login: "bob", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// carol isn't in the room, mentioning her leaves plain text
+	if _, err := u.AccountStorage.CreateAccount(account.Credentials{Login: "carol", Password: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.RoomStorage.UpdateRoom(acc.Id, r.Id, func(r room.Room) (room.Room, error) {
+		r.Members = append(r.Members, bob.Id)
+		return r, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := u.CreateMessage(acc.Id, r.Id, Draft{Text: "hi @bob @carol @nobody @alice, @bob again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"bob": bob.Id, "carol": "", "nobody": "", "alice": acc.Id}
+	n := 0
+	for _, e := range m.Entities {
+		if e.Type != "mention" {
+			continue
+		}
+		n++
+		if id, ok := want[e.Text]; !ok || e.AccountId != id {
+			t.Errorf("got mention of %q resolved to %q, want %q", e.Text, e.AccountId, id)
+		}
+	}
+	if n != 5 {
+		t.Errorf("got %d mentions, want 5", n)
+	}
+	if len(mentions.notified) != 1 || mentions.notified[0] != bob.Id {
+		t.Errorf("got %v notified, want only bob, once and without the author", mentions.notified)
+	}
+
+	mentions.notified = nil
+	if _, err := u.CreateMessage(bob.Id, r.Id, Draft{Text: "look @room"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions.notified) != 1 || mentions.notified[0] != acc.Id {
+		t.Errorf("got %v notified of @room, want members but the author", mentions.notified)
+	}
+}
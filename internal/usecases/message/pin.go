@@ -0,0 +1,126 @@
+package message
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/service/markdown"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"fmt"
+	"time"
+)
+
+const MaxPinsPerRoom = 50
+
+var (
+	ErrNotRoomAdmin = errors.New("only room admins can pin messages")
+	ErrPinLimit     = message.ErrPinLimit
+)
+
+func (u *UseCases) Pin(actorId, roomId, messageId string) (Message, error) {
+	m, err := u.pinnable(actorId, roomId, messageId)
+	if err != nil {
+		return Message{}, err
+	}
+	if !m.Pinned {
+		if m, err = u.MessageStorage.PinMessage(messageId, MaxPinsPerRoom); err != nil {
+			return Message{}, err
+		}
+		u.postSystemMessage(actorId, roomId, "pinned message "+m.Id)
+	}
+	mm, err := u.withAttachments([]message.Message{m})
+	if err != nil {
+		return Message{}, err
+	}
+	return mm[0], nil
+}
+
+func (u *UseCases) Unpin(actorId, roomId, messageId string) error {
+	m, err := u.pinnable(actorId, roomId, messageId)
+	if err != nil || !m.Pinned {
+		return err
+	}
+	if _, err := u.MessageStorage.UnpinMessage(messageId); err != nil {
+		return err
+	}
+	u.postSystemMessage(actorId, roomId, "unpinned message "+m.Id)
+	return nil
+}
+
+func (u *UseCases) ListPins(actorId, roomId string) ([]Message, error) {
+	if _, err := u.RoomStorage.GetRoomById(actorId, roomId); err != nil {
+		return nil, err
+	}
+	mm, err := u.MessageStorage.ListPinned(roomId)
+	if err != nil {
+		return nil, err
+	}
+	mm, err = u.hideBlocked(actorId, mm)
+	if err != nil {
+		return nil, err
+	}
+	return u.withAttachments(mm)
+}
+
+// pinnable returns the message of the room if the actor administers the room.
+func (u *UseCases) pinnable(actorId, roomId, messageId string) (message.Message, error) {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return message.Message{}, err
+	}
+	if !r.IsAdmin(actorId) {
+		return message.Message{}, ErrNotRoomAdmin
+	}
+	mm, err := u.MessageStorage.GetMessagesByIds([]string{messageId})
+	if err != nil {
+		return message.Message{}, err
+	}
+	if len(mm) == 0 || mm[0].Room != roomId {
+		return message.Message{}, domain.ErrNotFound
+	}
+	return mm[0], nil
+}
+
+// postSystemMessage notes the action of the actor in the room timeline. Notices
+// refer to messages by id and never quote them, a quote would outlive the expiry
+// of the message and show it to members who blocked its author. The action is
+// done already, so failures are only logged.
+func (u *UseCases) postSystemMessage(actorId, roomId, text string) {
+	doc, err := markdown.Render(text, markdown.Plain)
+	if err != nil {
+		fmt.Printf("room %s: failed to render system message: %v\n", roomId, err)
+		return
+	}
+	// mentions in quotes stay plain text, nobody is notified by system messages
+	entities, err := u.resolveEntities(doc.Entities, nil)
+	if err != nil {
+		fmt.Printf("room %s: failed to post system message: %v\n", roomId, err)
+		return
+	}
+	m, err := u.MessageStorage.CreateMessage(message.Message{
+		Author:    actorId,
+		Room:      roomId,
+		CreatedAt: time.Now(),
+		Text:      text,
+		Format:    string(markdown.Plain),
+		Html:      doc.Html,
+		Entities:  entities,
+		System:    true,
+	})
+	if err != nil {
+		fmt.Printf("room %s: failed to post system message: %v\n", roomId, err)
+		return
+	}
+	err = u.Webhooks.Dispatch(roomId, webhook.EventMessageCreated, webhook.MessageData{
+		Id:        m.Id,
+		AuthorId:  m.Author,
+		Format:    m.Format,
+		Text:      m.Text,
+		CreatedAt: m.CreatedAt,
+		System:    true,
+	})
+	if err != nil {
+		fmt.Printf("message %s: failed to dispatch webhooks: %v\n", m.Id, err)
+	}
+}
@@ -0,0 +1,226 @@
+package message
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/schedule"
+	"github.com/mp-hl-2021/chat/internal/service/markdown"
+	"github.com/mp-hl-2021/chat/internal/usecases/filter"
+
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	MaxScheduleAhead      = 365 * 24 * time.Hour
+	maxScheduledPerAuthor = 100
+
+	// scheduleLease is how long an instance may take to post claimed messages
+	// before other instances consider it gone and post them instead.
+	scheduleLease     = time.Minute
+	scheduleBatchSize = 100
+)
+
+var (
+	ErrInvalidSendAt    = errors.New("send time must be within a year")
+	ErrScheduledCommand = errors.New("commands can't be scheduled")
+	ErrTooManyScheduled = errors.New("too many scheduled messages")
+	ErrSending          = schedule.ErrLeased
+
+	errAuthorGone = errors.New("author is deactivated or suspended")
+)
+
+// Scheduled is a message waiting to be posted.
+type Scheduled struct {
+	Id          string
+	Room        string
+	Text        string
+	Format      string
+	Attachments []string
+	Ttl         time.Duration
+	SendAt      time.Time
+	CreatedAt   time.Time
+}
+
+// scheduleMessage checks the draft and puts it into the queue. Mutes, filters
+// and mentions apply when the message is posted.
+func (u *UseCases) scheduleMessage(creatorId, roomId string, d Draft) (Message, error) {
+	now := time.Now()
+	if d.SendAt.Sub(now) > MaxScheduleAhead {
+		return Message{}, ErrInvalidSendAt
+	}
+	format, err := checkDraft(d)
+	if err != nil {
+		return Message{}, err
+	}
+	if _, err := u.RoomStorage.GetRoomById(creatorId, roomId); err != nil {
+		return Message{}, err
+	}
+	aa, err := u.checkAttachments(creatorId, roomId, d.Attachments, false)
+	if err != nil {
+		return Message{}, err
+	}
+	queue, err := u.ScheduleStorage.ListScheduledByAuthor(creatorId)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(queue) >= maxScheduledPerAuthor {
+		return Message{}, ErrTooManyScheduled
+	}
+	doc, err := markdown.Render(d.Text, format)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := u.attach(d.Attachments); err != nil {
+		return Message{}, err
+	}
+	s, err := u.ScheduleStorage.CreateScheduled(schedule.Message{
+		Author:      creatorId,
+		Room:        roomId,
+		Text:        d.Text,
+		Format:      string(format),
+		Attachments: d.Attachments,
+		Ttl:         d.Ttl,
+		SendAt:      d.SendAt,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		u.detach(d.Attachments)
+		return Message{}, err
+	}
+	// entities are resolved against room members when it's posted
+	res := toMessage(message.Message{
+		Id:          s.Id,
+		Author:      s.Author,
+		Room:        s.Room,
+		CreatedAt:   s.CreatedAt,
+		Text:        s.Text,
+		Format:      s.Format,
+		Html:        doc.Html,
+		Attachments: s.Attachments,
+	}, attachmentsById(aa))
+	res.SendAt = s.SendAt
+	return res, nil
+}
+
+func (u *UseCases) ListScheduled(actorId string) ([]Scheduled, error) {
+	mm, err := u.ScheduleStorage.ListScheduledByAuthor(actorId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Scheduled, 0, len(mm))
+	for _, m := range mm {
+		res = append(res, toScheduled(m))
+	}
+	return res, nil
+}
+
+func (u *UseCases) CancelScheduled(actorId, scheduledId string) error {
+	m, err := u.ScheduleStorage.GetScheduledById(scheduledId)
+	if err != nil {
+		return err
+	}
+	if m.Author != actorId {
+		return domain.ErrNotFound
+	}
+	if err := u.ScheduleStorage.CancelScheduled(scheduledId, time.Now()); err != nil {
+		return err
+	}
+	u.detach(m.Attachments)
+	return nil
+}
+
+// PublishScheduled posts claimed messages one by one and then removes them
+// from the queue. Messages which can't be posted anymore are dropped, the ones
+// failed for other reasons are posted again once the lease runs out. A message
+// is stored once whatever happens to the lease: another attempt to post it finds
+// it posted and only removes it from the queue.
+func (u *UseCases) PublishScheduled(now time.Time) (int, error) {
+	total := 0
+	for {
+		mm, err := u.ScheduleStorage.ClaimDue(u.owner(), now, now.Add(scheduleLease), scheduleBatchSize)
+		if err != nil {
+			return total, err
+		}
+		for _, m := range mm {
+			err := u.postScheduled(m)
+			if errors.Is(err, domain.ErrAlreadyExist) {
+				err = nil
+			}
+			if err != nil && !rejected(err) {
+				fmt.Printf("scheduled message %s: failed to post: %v\n", m.Id, err)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("scheduled message %s: dropped: %v\n", m.Id, err)
+			}
+			if err := u.ScheduleStorage.DeleteScheduled(m.Id); err != nil {
+				fmt.Printf("scheduled message %s: failed to delete: %v\n", m.Id, err)
+				continue
+			}
+			if err != nil {
+				u.detach(m.Attachments)
+			}
+			total++
+		}
+		if len(mm) < scheduleBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (u *UseCases) postScheduled(m schedule.Message) error {
+	acc, err := u.AccountStorage.GetAccountById(m.Author)
+	if err != nil {
+		return err
+	}
+	if acc.Deactivated || acc.Suspended {
+		return errAuthorGone
+	}
+	_, err = u.createMessage(m.Author, m.Room, Draft{
+		Text:        m.Text,
+		Format:      m.Format,
+		Attachments: m.Attachments,
+		Ttl:         m.Ttl,
+		scheduledId: m.Id,
+	})
+	return err
+}
+
+// rejected tells whether posting failed for good, so retries would fail too.
+func rejected(err error) bool {
+	var r *filter.RejectedError
+	return errors.As(err, &r) ||
+		errors.Is(err, domain.ErrNotFound) ||
+		errors.Is(err, errAuthorGone) ||
+		errors.Is(err, ErrMuted) ||
+		errors.Is(err, ErrInvalidAttachment) ||
+		errors.Is(err, ErrInvalidFormat) ||
+		errors.Is(err, ErrInvalidTtl)
+}
+
+// owner identifies this server instance in leases of scheduled messages.
+func (u *UseCases) owner() string {
+	u.once.Do(func() {
+		b := make([]byte, 8)
+		rand.Read(b)
+		u.leaseOwner = hex.EncodeToString(b)
+	})
+	return u.leaseOwner
+}
+
+func toScheduled(m schedule.Message) Scheduled {
+	return Scheduled{
+		Id:          m.Id,
+		Room:        m.Room,
+		Text:        m.Text,
+		Format:      m.Format,
+		Attachments: append([]string{}, m.Attachments...),
+		Ttl:         m.Ttl,
+		SendAt:      m.SendAt,
+		CreatedAt:   m.CreatedAt,
+	}
+}
@@ -0,0 +1,419 @@
+package moderation
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/report"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	messageusecases "github.com/mp-hl-2021/chat/internal/usecases/message"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Actions a report is resolved with.
+const (
+	ActionDismiss       = "dismiss"
+	ActionDeleteMessage = "delete-message"
+	ActionMute          = "mute"
+	ActionBan           = "ban"
+	ActionSuspend       = "suspend"
+
+	actionClaim = "claim" // recorded when a moderator takes a report
+)
+
+const (
+	DefaultMuteDuration = 24 * time.Hour
+	maxMuteDuration     = 30 * 24 * time.Hour
+
+	maxReasonLength    = 1000 // in characters
+	defaultReportLimit = 50
+	maxReportLimit     = 200
+)
+
+var (
+	ErrNotModerator     = errors.New("only moderators can handle reports")
+	ErrInvalidReason    = errors.New("report reason must be 1 to 1000 characters")
+	ErrInvalidTarget    = errors.New("report either a message or an account other than yours")
+	ErrInvalidStatus    = errors.New("unknown report status")
+	ErrInvalidLimit     = errors.New("invalid limit")
+	ErrAlreadyClaimed   = errors.New("report is claimed by another moderator")
+	ErrNotClaimed       = errors.New("claim the report before resolving it")
+	ErrAlreadyResolved  = errors.New("report is resolved already")
+	ErrResolving        = errors.New("report is being resolved")
+	ErrInvalidAction    = errors.New("unknown action or it doesn't apply to the report")
+	ErrInvalidDuration  = errors.New("mute duration must be positive and at most 30 days")
+	ErrProtectedAccount = errors.New("moderators can't be suspended")
+)
+
+type Report struct {
+	Id         string
+	Reporter   string
+	Message    string
+	Room       string
+	Account    string
+	Reason     string
+	Status     string
+	Moderator  string
+	Resolution string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Action struct {
+	Id        string
+	Moderator string
+	Action    string
+	Note      string
+	CreatedAt time.Time
+}
+
+// Draft is a report before it is filed, either MessageId or AccountId is set.
+type Draft struct {
+	MessageId string
+	AccountId string
+	Reason    string
+}
+
+// Resolution is what a moderator does about a report.
+type Resolution struct {
+	Action string
+	// RoomId is where to mute or ban the account, the room of the message
+	// is used if empty.
+	RoomId  string
+	MuteFor time.Duration // DefaultMuteDuration if zero
+	Note    string
+}
+
+type Interface interface {
+	// Report files a report. Members can report messages of their rooms and any account.
+	Report(actorId string, d Draft) (Report, error)
+
+	// ListReports returns the queue to moderators, oldest reports first.
+	// Empty status lists all reports, limit of zero means the default one.
+	ListReports(actorId, status string, limit int) ([]Report, error)
+	// GetReport returns the report with actions taken on it.
+	GetReport(actorId, reportId string) (Report, []Action, error)
+	// ClaimReport assigns the open report to the moderator. A report left resolving
+	// by a failed server returns to claimed when its moderator claims it again.
+	ClaimReport(actorId, reportId string) (Report, error)
+	// ResolveReport applies the action and closes the report claimed by the moderator.
+	// The report is resolving while the action is applied, so it's applied once.
+	// Deletions, bans and suspensions are written to the audit log.
+	ResolveReport(src audit.Source, reportId string, res Resolution) (Report, error)
+}
+
+type UseCases struct {
+	ReportStorage   report.Interface
+	AccountStorage  account.Interface
+	MessageStorage  message.Interface
+	RoomStorage     room.Interface
+	SanctionStorage sanction.Interface
+	Messages        messageusecases.Interface
+	Rooms           roomusecases.Interface
+	Audit           audit.Recorder // nothing is recorded if nil
+}
+
+func (u *UseCases) Report(actorId string, d Draft) (Report, error) {
+	if d.Reason == "" || !utf8.ValidString(d.Reason) || utf8.RuneCountInString(d.Reason) > maxReasonLength {
+		return Report{}, ErrInvalidReason
+	}
+	if (d.MessageId == "") == (d.AccountId == "") {
+		return Report{}, ErrInvalidTarget
+	}
+	now := time.Now()
+	r := report.Report{
+		Reporter:  actorId,
+		Reason:    d.Reason,
+		Status:    report.StatusOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if d.MessageId != "" {
+		mm, err := u.MessageStorage.GetMessagesByIds([]string{d.MessageId})
+		if err != nil {
+			return Report{}, err
+		}
+		if len(mm) == 0 {
+			return Report{}, domain.ErrNotFound
+		}
+		// only messages the reporter can read may be reported
+		if _, err := u.RoomStorage.GetRoomById(actorId, mm[0].Room); err != nil {
+			return Report{}, domain.ErrNotFound
+		}
+		r.Message, r.Room, r.Account = mm[0].Id, mm[0].Room, mm[0].Author
+	} else {
+		if _, err := u.AccountStorage.GetAccountById(d.AccountId); err != nil {
+			return Report{}, err
+		}
+		r.Account = d.AccountId
+	}
+	if r.Account == actorId {
+		return Report{}, ErrInvalidTarget
+	}
+	r, err := u.ReportStorage.CreateReport(r)
+	if err != nil {
+		return Report{}, err
+	}
+	return toReport(r), nil
+}
+
+func (u *UseCases) ListReports(actorId, status string, limit int) ([]Report, error) {
+	switch status {
+	case "", report.StatusOpen, report.StatusClaimed, report.StatusResolving, report.StatusResolved:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	if limit == 0 {
+		limit = defaultReportLimit
+	}
+	if limit < 0 || limit > maxReportLimit {
+		return nil, ErrInvalidLimit
+	}
+	if err := u.checkModerator(actorId); err != nil {
+		return nil, err
+	}
+	rr, err := u.ReportStorage.ListReports(status, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Report, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, toReport(r))
+	}
+	return res, nil
+}
+
+func (u *UseCases) GetReport(actorId, reportId string) (Report, []Action, error) {
+	if err := u.checkModerator(actorId); err != nil {
+		return Report{}, nil, err
+	}
+	r, err := u.ReportStorage.GetReportById(reportId)
+	if err != nil {
+		return Report{}, nil, err
+	}
+	aa, err := u.ReportStorage.ListActions(reportId)
+	if err != nil {
+		return Report{}, nil, err
+	}
+	actions := make([]Action, 0, len(aa))
+	for _, a := range aa {
+		actions = append(actions, Action{
+			Id:        a.Id,
+			Moderator: a.Moderator,
+			Action:    a.Action,
+			Note:      a.Note,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	return toReport(r), actions, nil
+}
+
+func (u *UseCases) ClaimReport(actorId, reportId string) (Report, error) {
+	if err := u.checkModerator(actorId); err != nil {
+		return Report{}, err
+	}
+	r, err := u.ReportStorage.UpdateReport(reportId, func(r report.Report) (report.Report, error) {
+		switch {
+		case r.Status == report.StatusResolved:
+			return r, ErrAlreadyResolved
+		case r.Status != report.StatusOpen && r.Moderator != actorId:
+			return r, ErrAlreadyClaimed
+		}
+		r.Status = report.StatusClaimed
+		r.Moderator = actorId
+		r.UpdatedAt = time.Now()
+		return r, nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	if err := u.record(reportId, actorId, actionClaim, ""); err != nil {
+		return Report{}, err
+	}
+	return toReport(r), nil
+}
+
+func (u *UseCases) ResolveReport(src audit.Source, reportId string, res Resolution) (Report, error) {
+	actorId := src.Actor
+	if err := u.checkModerator(actorId); err != nil {
+		return Report{}, err
+	}
+	if utf8.RuneCountInString(res.Note) > maxReasonLength {
+		return Report{}, ErrInvalidReason
+	}
+	r, err := u.setStatus(reportId, actorId, report.StatusClaimed, report.StatusResolving)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := u.apply(src, r, res); err != nil {
+		// the moderator may try another action
+		if _, err := u.setStatus(reportId, actorId, report.StatusResolving, report.StatusClaimed); err != nil {
+			fmt.Printf("report %s: failed to return to claimed: %v\n", reportId, err)
+		}
+		return Report{}, err
+	}
+	r, err = u.ReportStorage.UpdateReport(reportId, func(r report.Report) (report.Report, error) {
+		r.Status = report.StatusResolved
+		r.Resolution = res.Action
+		r.UpdatedAt = time.Now()
+		return r, nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	if err := u.record(reportId, actorId, res.Action, res.Note); err != nil {
+		return Report{}, err
+	}
+	if err := u.recordAudit(src, r, res); err != nil {
+		return Report{}, err
+	}
+	return toReport(r), nil
+}
+
+// apply takes the action against the reported account or message.
+func (u *UseCases) apply(src audit.Source, r report.Report, res Resolution) error {
+	actorId := src.Actor
+	roomId := res.RoomId
+	if roomId == "" {
+		roomId = r.Room
+	}
+	now := time.Now()
+	switch res.Action {
+	case ActionDismiss:
+		return nil
+	case ActionDeleteMessage:
+		if r.Message == "" {
+			return ErrInvalidAction
+		}
+		err := u.Messages.DeleteMessage(r.Message)
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return err
+	case ActionMute:
+		if roomId == "" {
+			return ErrInvalidAction
+		}
+		d := res.MuteFor
+		if d == 0 {
+			d = DefaultMuteDuration
+		}
+		if d < 0 || d > maxMuteDuration {
+			return ErrInvalidDuration
+		}
+		return u.SanctionStorage.PutMute(sanction.Mute{
+			Room:      roomId,
+			Account:   r.Account,
+			Actor:     actorId,
+			Reason:    reasonOf(r, res),
+			Until:     now.Add(d),
+			CreatedAt: now,
+		})
+	case ActionBan:
+		if roomId == "" {
+			return ErrInvalidAction
+		}
+		// banned as room admins ban, with the audit entry and the member removed event
+		_, err := u.Rooms.BanAccount(src, roomId, r.Account, reasonOf(r, res))
+		return err
+	case ActionSuspend:
+		_, err := u.AccountStorage.UpdateAccount(r.Account, func(a account.Account) (account.Account, error) {
+			if a.IsModerator() {
+				return a, ErrProtectedAccount
+			}
+			a.Suspended = true
+			return a, nil
+		})
+		return err
+	default:
+		return ErrInvalidAction
+	}
+}
+
+// recordAudit writes the action taken on the report to the audit log.
+// Bans are recorded by the room use cases.
+func (u *UseCases) recordAudit(src audit.Source, r report.Report, res Resolution) error {
+	if u.Audit == nil {
+		return nil
+	}
+	note := "report " + r.Id
+	switch res.Action {
+	case ActionDeleteMessage:
+		return u.Audit.Record(src, audit.ActionMessageDelete, r.Message, note)
+	case ActionSuspend:
+		return u.Audit.Record(src, audit.ActionSuspend, r.Account, note)
+	}
+	return nil
+}
+
+func (u *UseCases) record(reportId, moderatorId, action, note string) error {
+	_, err := u.ReportStorage.CreateAction(report.Action{
+		Report:    reportId,
+		Moderator: moderatorId,
+		Action:    action,
+		Note:      note,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+func (u *UseCases) checkModerator(actorId string) error {
+	acc, err := u.AccountStorage.GetAccountById(actorId)
+	if err != nil {
+		return err
+	}
+	if !acc.IsModerator() {
+		return ErrNotModerator
+	}
+	return nil
+}
+
+// setStatus moves the report of the moderator from one status to another,
+// so only one request can take the report out of the status.
+func (u *UseCases) setStatus(reportId, actorId, from, to string) (report.Report, error) {
+	return u.ReportStorage.UpdateReport(reportId, func(r report.Report) (report.Report, error) {
+		switch {
+		case r.Status == report.StatusResolved:
+			return r, ErrAlreadyResolved
+		case r.Status == report.StatusOpen:
+			return r, ErrNotClaimed
+		case r.Moderator != actorId:
+			return r, ErrAlreadyClaimed
+		case r.Status != from:
+			return r, ErrResolving
+		}
+		r.Status = to
+		r.UpdatedAt = time.Now()
+		return r, nil
+	})
+}
+
+func reasonOf(r report.Report, res Resolution) string {
+	if res.Note != "" {
+		return res.Note
+	}
+	return fmt.Sprintf("report %s: %s", r.Id, r.Reason)
+}
+
+func toReport(r report.Report) Report {
+	return Report{
+		Id:         r.Id,
+		Reporter:   r.Reporter,
+		Message:    r.Message,
+		Room:       r.Room,
+		Account:    r.Account,
+		Reason:     r.Reason,
+		Status:     r.Status,
+		Moderator:  r.Moderator,
+		Resolution: r.Resolution,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+}
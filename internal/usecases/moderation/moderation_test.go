@@ -0,0 +1,329 @@
+package moderation
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/report"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/reportrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/service/events"
+	attachmentusecases "github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	messageusecases "github.com/mp-hl-2021/chat/internal/usecases/message"
+	roomusecases "github.com/mp-hl-2021/chat/internal/usecases/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// spam is a message of bob reported by alice in her room.
+type spam struct {
+	moderator string
+	reporter  string
+	author    string
+	roomId    string
+	messageId string
+}
+
+// postSpam creates accounts of a moderator, alice and bob in u's storage
+// and a message of bob in the room of alice.
+func postSpam(t *testing.T, u *UseCases) spam {
+	var ids []string
+	for _, login := range []string{"mod", "alice", "bob"} {
+		a, err := u.AccountStorage.CreateAccount(account.Credentials{Login: login})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, a.Id)
+	}
+	_, err := u.AccountStorage.UpdateAccount(ids[0], func(a account.Account) (account.Account, error) {
+		a.Role = account.RoleModerator
+		return a, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := u.RoomStorage.CreateRoom(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.RoomStorage.UpdateRoom(ids[1], r.Id, func(r room.Room) (room.Room, error) {
+		r.Members = append(r.Members, ids[2])
+		return r, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := u.MessageStorage.CreateMessage(message.Message{Author: ids[2], Room: r.Id, Text: "spam", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spam{moderator: ids[0], reporter: ids[1], author: ids[2], roomId: r.Id, messageId: msg.Id}
+}
+
+func TestReportQueue(t *testing.T) {
+	u := &UseCases{
+		ReportStorage:   reportrepo.NewMemory(),
+		AccountStorage:  accountrepo.NewMemory(),
+		MessageStorage:  messagerepo.NewMemory(),
+		RoomStorage:     roomrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+	}
+	f := postSpam(t, u)
+
+	rep, err := u.Report(f.reporter, Draft{MessageId: f.messageId, Reason: "spam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Account != f.author || rep.Room != f.roomId || rep.Status != report.StatusOpen {
+		t.Errorf("got report %+v, want open report of the message author", rep)
+	}
+	if _, err := u.ListReports(f.reporter, "", 0); err != ErrNotModerator {
+		t.Errorf("got %v listing reports as a member, want %v", err, ErrNotModerator)
+	}
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionDismiss}); err != ErrNotClaimed {
+		t.Errorf("got %v resolving unclaimed report, want %v", err, ErrNotClaimed)
+	}
+	if _, err := u.ClaimReport(f.moderator, rep.Id); err != nil {
+		t.Fatal(err)
+	}
+	open, err := u.ListReports(f.moderator, report.StatusOpen, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 0 {
+		t.Errorf("got %d open reports, claimed one must not be listed", len(open))
+	}
+
+	rep, err = u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionMute, MuteFor: time.Hour, Note: "cool down"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != report.StatusResolved || rep.Resolution != ActionMute {
+		t.Errorf("got report %+v, want resolved with mute", rep)
+	}
+	m, err := u.SanctionStorage.GetMute(f.roomId, f.author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Until.Before(time.Now().Add(59*time.Minute)) || m.Reason != "cool down" {
+		t.Errorf("got mute %+v, want an hour long one with the note", m)
+	}
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionBan}); err != ErrAlreadyResolved {
+		t.Errorf("got %v resolving report twice, want %v", err, ErrAlreadyResolved)
+	}
+
+	_, actions, err := u.GetReport(f.moderator, rep.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Action != actionClaim || actions[1].Action != ActionMute {
+		t.Errorf("got actions %+v, want claim and mute", actions)
+	}
+}
+
+// blobsFake keeps keys of stored blobs.
+type blobsFake map[string]bool
+
+func (b blobsFake) PutBlob(key string, r io.Reader, size int64) error {
+	b[key] = true
+	return nil
+}
+
+func (b blobsFake) GetBlob(key string) (io.ReadCloser, error) {
+	panic("implement me")
+}
+
+func (b blobsFake) DeleteBlob(key string) error {
+	delete(b, key)
+	return nil
+}
+
+// webhooksFake keeps dispatched events.
+type webhooksFake struct {
+	webhook.Interface
+	events []string
+}
+
+func (f *webhooksFake) Dispatch(roomId, event string, data interface{}) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestResolveActions(t *testing.T) {
+	messages := messagerepo.NewMemory()
+	rooms := roomrepo.NewMemory()
+	attachments := attachmentrepo.NewMemory()
+	blobs := blobsFake{"image": true}
+	sanctions := sanctionrepo.NewMemory()
+	hooks := &webhooksFake{}
+	bus := events.NewBus(10)
+	u := &UseCases{
+		ReportStorage:   reportrepo.NewMemory(),
+		AccountStorage:  accountrepo.NewMemory(),
+		MessageStorage:  messages,
+		RoomStorage:     rooms,
+		SanctionStorage: sanctions,
+		Messages: &messageusecases.UseCases{
+			MessageStorage: messages,
+			RoomStorage:    rooms,
+			Attachments:    &attachmentusecases.UseCases{AttachmentStorage: attachments, BlobStorage: blobs},
+			Events:         bus,
+		},
+		Rooms: &roomusecases.UseCases{
+			RoomStorage:     rooms,
+			SanctionStorage: sanctions,
+			Webhooks:        hooks,
+		},
+	}
+	f := postSpam(t, u)
+	a, err := attachments.CreateAttachment(attachment.Attachment{Room: f.roomId, Owner: f.author, Size: 1, BlobKey: "image"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attachments.SetAttached([]string{a.Id}, true); err != nil {
+		t.Fatal(err)
+	}
+	abusive, err := messages.CreateMessage(message.Message{Author: f.author, Room: f.roomId, Attachments: []string{a.Id}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sub := bus.Subscribe(f.reporter, "")
+	defer sub.Close()
+
+	resolve := func(d Draft, res Resolution) {
+		t.Helper()
+		rep, err := u.Report(f.reporter, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.ClaimReport(f.moderator, rep.Id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolve(Draft{MessageId: abusive.Id, Reason: "abuse"}, Resolution{Action: ActionDeleteMessage})
+	if mm, _ := u.MessageStorage.GetMessagesByIds([]string{abusive.Id}); len(mm) != 0 {
+		t.Error("reported message wasn't deleted")
+	}
+	if _, err := attachments.GetAttachmentById(a.Id); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("got %v getting attachment of the deleted message, want %v", err, domain.ErrNotFound)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("got blobs %v left, want the image deleted", blobs)
+	}
+	select {
+	case e := <-sub.C:
+		d, ok := e.Data.(messageusecases.DeletedEvent)
+		if e.Type != messageusecases.EventDeleted || !ok || d.MessageId != abusive.Id {
+			t.Errorf("got event %s %+v, want deletion of %s", e.Type, e.Data, abusive.Id)
+		}
+	default:
+		t.Error("room members got no deletion event")
+	}
+
+	resolve(Draft{AccountId: f.author, Reason: "spam bot"}, Resolution{Action: ActionBan, RoomId: f.roomId})
+	if _, err := u.SanctionStorage.GetBan(f.roomId, f.author); err != nil {
+		t.Errorf("got %v, want account banned", err)
+	}
+	if _, err := u.RoomStorage.GetRoomById(f.author, f.roomId); !errors.Is(err, domain.ErrNotFound) && !errors.Is(err, domain.ErrUnauthorized) {
+		t.Errorf("got %v, banned account must be removed from the room", err)
+	}
+	if len(hooks.events) != 1 || hooks.events[0] != webhook.EventMemberRemoved {
+		t.Errorf("got webhook events %v, want the member removed like by a room admin", hooks.events)
+	}
+	// the room admin is protected as from bans of other admins
+	rep, err := u.Report(f.author, Draft{AccountId: f.reporter, Reason: "revenge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ClaimReport(f.moderator, rep.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionBan, RoomId: f.roomId}); !errors.Is(err, roomusecases.ErrProtectedMember) {
+		t.Errorf("got %v banning the room admin, want %v", err, roomusecases.ErrProtectedMember)
+	}
+
+	resolve(Draft{AccountId: f.author, Reason: "spam bot"}, Resolution{Action: ActionSuspend})
+	acc, err := u.AccountStorage.GetAccountById(f.author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acc.Suspended {
+		t.Error("account wasn't suspended")
+	}
+}
+
+func TestReportValidation(t *testing.T) {
+	u := &UseCases{
+		ReportStorage:  reportrepo.NewMemory(),
+		AccountStorage: accountrepo.NewMemory(),
+		MessageStorage: messagerepo.NewMemory(),
+		RoomStorage:    roomrepo.NewMemory(),
+	}
+	f := postSpam(t, u)
+
+	if _, err := u.Report(f.author, Draft{AccountId: f.author, Reason: "me"}); err != ErrInvalidTarget {
+		t.Errorf("got %v reporting yourself, want %v", err, ErrInvalidTarget)
+	}
+	if _, err := u.Report(f.reporter, Draft{MessageId: f.messageId}); err != ErrInvalidReason {
+		t.Errorf("got %v for empty reason, want %v", err, ErrInvalidReason)
+	}
+	if _, err := u.Report(f.moderator, Draft{MessageId: f.messageId, Reason: "spam"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("got %v reporting a message of other room, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestResolveOnce(t *testing.T) {
+	u := &UseCases{
+		ReportStorage:   reportrepo.NewMemory(),
+		AccountStorage:  accountrepo.NewMemory(),
+		MessageStorage:  messagerepo.NewMemory(),
+		RoomStorage:     roomrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+	}
+	f := postSpam(t, u)
+	rep, err := u.Report(f.reporter, Draft{MessageId: f.messageId, Reason: "spam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ClaimReport(f.moderator, rep.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed action leaves the report claimed for another try
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: "burn"}); err != ErrInvalidAction {
+		t.Fatalf("got %v, want %v", err, ErrInvalidAction)
+	}
+	// another request of the moderator is applying an action right now
+	if _, err := u.setStatus(rep.Id, f.moderator, report.StatusClaimed, report.StatusResolving); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionDeleteMessage}); err != ErrResolving {
+		t.Errorf("got %v resolving a report twice at once, want %v", err, ErrResolving)
+	}
+	if mm, _ := u.MessageStorage.GetMessagesByIds([]string{f.messageId}); len(mm) != 1 {
+		t.Error("action was applied by the second request")
+	}
+
+	// claiming again takes the report back from a request which never finished
+	if _, err := u.ClaimReport(f.moderator, rep.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ResolveReport(audit.Source{Actor: f.moderator}, rep.Id, Resolution{Action: ActionDismiss}); err != nil {
+		t.Fatal(err)
+	}
+}
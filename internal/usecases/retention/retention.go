@@ -0,0 +1,215 @@
+package retention
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	maxDays     = 100 * 365
+	maxKeepLast = 1000000
+
+	defaultBatchSize = 500
+	roomsPage        = 100
+)
+
+var (
+	ErrNotRoomAdmin  = errors.New("only room admins can change retention")
+	ErrNotAdmin      = errors.New("only server admins can set a legal hold")
+	ErrInvalidPolicy = errors.New("retention days and kept messages must not be negative or too large")
+)
+
+// Policy limits how long messages are kept. Zero fields don't limit.
+type Policy struct {
+	Days     int
+	KeepLast int
+}
+
+// Settings of the room. Both the room and the server policy apply,
+// Effective is the stricter of them.
+type Settings struct {
+	Room      Policy
+	Server    Policy
+	Effective Policy
+	LegalHold bool
+}
+
+type Interface interface {
+	GetSettings(actorId, roomId string) (Settings, error)
+	// SetPolicy changes the room policy, it's for room admins.
+	SetPolicy(actorId, roomId string, p Policy) (Settings, error)
+	// SetLegalHold stops or resumes deletion of room messages, it's for server admins.
+	// Holds and releases are written to the audit log.
+	SetLegalHold(src audit.Source, roomId string, hold bool) (Settings, error)
+	// Enforce deletes messages outside of retention of every room, with their
+	// attachments. It's run by the janitor and returns the number of deleted messages.
+	// Every pruned room is written to the audit log with no actor.
+	Enforce(now time.Time) (int, error)
+}
+
+type UseCases struct {
+	RoomStorage    room.Interface
+	MessageStorage message.Interface
+	Attachments    attachment.Deleter
+	AccountStorage account.Interface
+	Audit          audit.Recorder // nothing is recorded if nil
+
+	Default Policy
+	// BatchSize is the number of messages deleted at once, each batch is a short
+	// query so chats aren't blocked. defaultBatchSize is used if zero.
+	BatchSize int
+}
+
+func (u *UseCases) GetSettings(actorId, roomId string) (Settings, error) {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return Settings{}, err
+	}
+	return u.settings(r), nil
+}
+
+func (u *UseCases) SetPolicy(actorId, roomId string, p Policy) (Settings, error) {
+	if p.Days < 0 || p.Days > maxDays || p.KeepLast < 0 || p.KeepLast > maxKeepLast {
+		return Settings{}, ErrInvalidPolicy
+	}
+	r, err := u.RoomStorage.UpdateRoom(actorId, roomId, func(r room.Room) (room.Room, error) {
+		if !r.IsAdmin(actorId) {
+			return r, ErrNotRoomAdmin
+		}
+		r.Retention = room.Retention{Days: p.Days, KeepLast: p.KeepLast}
+		return r, nil
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return u.settings(r), nil
+}
+
+func (u *UseCases) SetLegalHold(src audit.Source, roomId string, hold bool) (Settings, error) {
+	acc, err := u.AccountStorage.GetAccountById(src.Actor)
+	if err != nil {
+		return Settings{}, err
+	}
+	if !acc.IsAdmin() {
+		return Settings{}, ErrNotAdmin
+	}
+	r, err := u.RoomStorage.SetLegalHold(roomId, hold)
+	if err != nil {
+		return Settings{}, err
+	}
+	action := audit.ActionLegalHold
+	if !hold {
+		action = audit.ActionLegalHoldRelease
+	}
+	if err := u.record(src, action, roomId, ""); err != nil {
+		return Settings{}, err
+	}
+	return u.settings(r), nil
+}
+
+func (u *UseCases) Enforce(now time.Time) (int, error) {
+	total := 0
+	for offset := 0; ; offset += roomsPage {
+		rr, err := u.RoomStorage.ListAllRooms(offset, roomsPage)
+		if err != nil {
+			return total, err
+		}
+		for _, r := range rr {
+			if r.LegalHold {
+				continue
+			}
+			n, err := u.prune(r.Id, u.settings(r).Effective, now)
+			total += n
+			if n > 0 {
+				// the janitor acts on its own, nobody is behind it
+				if err := u.record(audit.Source{}, audit.ActionRetentionPrune, r.Id, fmt.Sprintf("%d messages", n)); err != nil {
+					return total, fmt.Errorf("room %s: %w", r.Id, err)
+				}
+			}
+			if err != nil {
+				return total, fmt.Errorf("room %s: %w", r.Id, err)
+			}
+		}
+		if len(rr) < roomsPage {
+			return total, nil
+		}
+	}
+}
+
+// prune deletes messages of the room outside of the policy batch by batch.
+func (u *UseCases) prune(roomId string, p Policy, now time.Time) (int, error) {
+	if p.Days == 0 && p.KeepLast == 0 {
+		return 0, nil
+	}
+	var before time.Time
+	if p.Days > 0 {
+		before = now.AddDate(0, 0, -p.Days)
+	}
+	batch := u.BatchSize
+	if batch == 0 {
+		batch = defaultBatchSize
+	}
+	total := 0
+	for {
+		mm, err := u.MessageStorage.ListPrunable(roomId, before, p.KeepLast, batch)
+		if err != nil {
+			return total, err
+		}
+		if len(mm) == 0 {
+			return total, nil
+		}
+		ids := make([]string, 0, len(mm))
+		var attachmentIds []string
+		for _, m := range mm {
+			ids = append(ids, m.Id)
+			attachmentIds = append(attachmentIds, m.Attachments...)
+		}
+		// attachments go first, so the messages stay to be found again if they fail
+		if err := u.Attachments.DeleteAttachments(attachmentIds); err != nil {
+			return total, err
+		}
+		n, err := u.MessageStorage.DeleteMessagesByIds(ids)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if len(mm) < batch {
+			return total, nil
+		}
+	}
+}
+
+func (u *UseCases) record(src audit.Source, action, target, details string) error {
+	if u.Audit == nil {
+		return nil
+	}
+	return u.Audit.Record(src, action, target, details)
+}
+
+func (u *UseCases) settings(r room.Room) Settings {
+	p := Policy{Days: r.Retention.Days, KeepLast: r.Retention.KeepLast}
+	return Settings{
+		Room:   p,
+		Server: u.Default,
+		Effective: Policy{
+			Days:     stricter(p.Days, u.Default.Days),
+			KeepLast: stricter(p.KeepLast, u.Default.KeepLast),
+		},
+		LegalHold: r.LegalHold,
+	}
+}
+
+// stricter returns the smaller limit, zero means no limit.
+func stricter(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,145 @@
+package retention
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/account"
+	"github.com/mp-hl-2021/chat/internal/domain/attachment"
+	"github.com/mp-hl-2021/chat/internal/domain/message"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/accountrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/attachmentrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/messagerepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	attachmentusecases "github.com/mp-hl-2021/chat/internal/usecases/attachment"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type blobsFake map[string]bool
+
+func (b blobsFake) PutBlob(key string, r io.Reader, size int64) error {
+	b[key] = true
+	return nil
+}
+
+func (b blobsFake) GetBlob(key string) (io.ReadCloser, error) {
+	panic("implement me")
+}
+
+func (b blobsFake) DeleteBlob(key string) error {
+	delete(b, key)
+	return nil
+}
+
+func TestEnforce(t *testing.T) {
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachments := attachmentrepo.NewMemory()
+	att, err := attachments.CreateAttachment(attachment.Attachment{Room: r.Id, Size: 10, BlobKey: "a"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := blobsFake{"a": true}
+	messages := messagerepo.NewMemory()
+	now := time.Now()
+	var ids []string
+	for i, age := range []int{40, 35, 31, 20, 10, 1} {
+		m := message.Message{Author: "1", Room: r.Id, CreatedAt: now.AddDate(0, 0, -age), Pinned: i == 1}
+		if i == 0 {
+			m.Attachments = []string{att.Id}
+		}
+		m, err := messages.CreateMessage(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+	u := &UseCases{
+		RoomStorage:    rooms,
+		MessageStorage: messages,
+		Attachments:    &attachmentusecases.UseCases{AttachmentStorage: attachments, BlobStorage: blobs},
+		Default:        Policy{Days: 30},
+		BatchSize:      1,
+	}
+
+	if _, err := u.SetPolicy("1", r.Id, Policy{KeepLast: 2}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := u.Enforce(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pinned one survives both limits
+	if n != 3 {
+		t.Errorf("got %d deleted, want 3", n)
+	}
+	mm, err := messages.ListMessages("1", r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ids[1], ids[4], ids[5]}
+	if len(mm) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(mm), len(want))
+	}
+	for i, m := range mm {
+		if m.Id != want[i] {
+			t.Errorf("got message %s at %d, want %s", m.Id, i, want[i])
+		}
+	}
+	if _, err := attachments.GetAttachmentById(att.Id); err == nil || blobs["a"] {
+		t.Errorf("got attachment of deleted message kept")
+	}
+}
+
+func TestLegalHold(t *testing.T) {
+	accounts := accountrepo.NewMemory()
+	admin, err := accounts.CreateAccount(account.Credentials{Login: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = accounts.UpdateAccount(admin.Id, func(a account.Account) (account.Account, error) {
+		a.Role = account.RoleAdmin
+		return a, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := accounts.CreateAccount(account.Credentials{Login: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom(owner.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := messagerepo.NewMemory()
+	if _, err := messages.CreateMessage(message.Message{Room: r.Id, CreatedAt: time.Now().AddDate(-1, 0, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	u := &UseCases{
+		RoomStorage:    rooms,
+		MessageStorage: messages,
+		AccountStorage: accounts,
+		Default:        Policy{Days: 30},
+	}
+
+	if _, err := u.SetLegalHold(audit.Source{Actor: owner.Id}, r.Id, true); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("got %v, want %v", err, ErrNotAdmin)
+	}
+	s, err := u.SetLegalHold(audit.Source{Actor: admin.Id}, r.Id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.LegalHold {
+		t.Errorf("got legal hold %v, want true", s.LegalHold)
+	}
+	if n, err := u.Enforce(time.Now()); err != nil || n != 0 {
+		t.Errorf("got %d deleted, %v, want nothing deleted under legal hold", n, err)
+	}
+}
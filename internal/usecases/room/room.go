@@ -2,12 +2,33 @@ package room
 
 import (
 	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/block"
 	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxTopicLength = 250 // in characters
+
+var (
+	ErrInvalidTopic = errors.New("topic is too long or contains invalid characters")
+	ErrBanned       = errors.New("account is banned from the room")
+	// ErrNotAddable is returned when one of accounts blocked the actor,
+	// it doesn't tell which one so blocks stay private.
+	ErrNotAddable = errors.New("account can't be added to the room")
 )
 
 type Room struct {
 	Id      string
 	Members []string // account ids or some structures later
+	Topic   string
 }
 
 type Interface interface {
@@ -15,12 +36,36 @@ type Interface interface {
 	ListRooms(accountId string) ([]Room, error) // todo
 
 	GetRoomById(actorId, roomId string) (Room, error)
-	AddMembers(actorId, roomId string, members []string) error
-	RemoveMembers(actorId, roomId string, members []string) error
+	// AddMembers and RemoveMembers write changed memberships to the audit log,
+	// src tells who acts and where the request came from.
+	AddMembers(src audit.Source, roomId string, members []string) error
+	RemoveMembers(src audit.Source, roomId string, members []string) error
+	// SetTopic changes the room topic, an empty one clears it.
+	SetTopic(actorId, roomId, topic string) error
+
+	// BanMember removes the account from the room and keeps it from being added back.
+	// Only room admin manages bans and mutes, bans are written to the audit log.
+	BanMember(src audit.Source, roomId, accountId, reason string) (Ban, error)
+	// BanAccount bans the same way on behalf of server moderators, who needn't
+	// be admins or members of the room. Room admins can't be banned either way.
+	BanAccount(src audit.Source, roomId, accountId, reason string) (Ban, error)
+	UnbanMember(src audit.Source, roomId, accountId string) error
+	ListBans(actorId, roomId string) ([]Ban, error)
+	// MuteMember stops the account from posting to the room for the duration.
+	MuteMember(actorId, roomId, accountId string, d time.Duration, reason string) (Mute, error)
+	UnmuteMember(actorId, roomId, accountId string) error
+	// ListMutes returns mutes of the room which haven't expired yet.
+	ListMutes(actorId, roomId string) ([]Mute, error)
 }
 
 type UseCases struct {
-	RoomStorage room.Interface
+	RoomStorage     room.Interface
+	SanctionStorage sanction.Interface
+	BlockStorage    block.Interface
+	Webhooks        webhook.Interface
+	Audit           audit.Recorder // nothing is recorded if nil
+
+	now func() time.Time // time.Now if nil
 }
 
 func (u *UseCases) CreateRoom(creatorId string) (Room, error) {
@@ -28,7 +73,7 @@ func (u *UseCases) CreateRoom(creatorId string) (Room, error) {
 	if err != nil {
 		return Room{}, err
 	}
-	return Room{Id: r.Id, Members: r.Members}, nil
+	return Room{Id: r.Id, Members: r.Members, Topic: r.Topic}, nil
 }
 
 func (u *UseCases) ListRooms(accountId string) ([]Room, error) {
@@ -38,7 +83,7 @@ func (u *UseCases) ListRooms(accountId string) ([]Room, error) {
 	}
 	res := make([]Room, 0, len(rr))
 	for _, r := range rr {
-		res = append(res, Room{Id: r.Id, Members: r.Members})
+		res = append(res, Room{Id: r.Id, Members: r.Members, Topic: r.Topic})
 	}
 	return res, nil
 }
@@ -50,13 +95,27 @@ func (u *UseCases) GetRoomById(actorId, roomId string) (Room, error) {
 	}
 	for _, m := range r.Members {
 		if m == actorId {
-			return Room{Id: r.Id, Members: r.Members}, nil
+			return Room{Id: r.Id, Members: r.Members, Topic: r.Topic}, nil
 		}
 	}
 	return Room{}, domain.ErrNotFound // todo: may be "unauthorized"?
 }
 
-func (u *UseCases) AddMembers(actorId, roomId string, members []string) error {
+func (u *UseCases) AddMembers(src audit.Source, roomId string, members []string) error {
+	actorId := src.Actor
+	for _, m := range members {
+		_, err := u.SanctionStorage.GetBan(roomId, m)
+		if err == nil {
+			return ErrBanned
+		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+	}
+	if err := u.checkBlocked(actorId, members); err != nil {
+		return err
+	}
+	var added []string
 	_, err := u.RoomStorage.UpdateRoom(actorId, roomId, func(r room.Room) (room.Room, error) {
 		authorized := authorize(actorId, r.Members)
 		if !authorized {
@@ -77,12 +136,19 @@ func (u *UseCases) AddMembers(actorId, roomId string, members []string) error {
 			}
 		}
 		r.Members = append(r.Members, newMembers...)
+		added = newMembers
 		return r, nil
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	u.dispatchMembers(webhook.EventMemberAdded, actorId, roomId, added)
+	return u.recordMembers(src, audit.ActionMemberAdd, roomId, added)
 }
 
-func (u *UseCases) RemoveMembers(actorId, roomId string, members []string) error {
+func (u *UseCases) RemoveMembers(src audit.Source, roomId string, members []string) error {
+	actorId := src.Actor
+	var removed []string
 	_, err := u.RoomStorage.UpdateRoom(actorId, roomId, func(r room.Room) (room.Room, error) {
 		authorized := authorize(actorId, r.Members)
 		if !authorized {
@@ -92,6 +158,7 @@ func (u *UseCases) RemoveMembers(actorId, roomId string, members []string) error
 		for i := 0; i < len(members); i++ {
 			for j := 0; j < len(r.Members); j++ {
 				if members[i] == r.Members[j] {
+					removed = append(removed, members[i])
 					r.Members[j] = r.Members[len(r.Members)-1]
 					r.Members = r.Members[:len(r.Members)-1]
 					break
@@ -100,9 +167,85 @@ func (u *UseCases) RemoveMembers(actorId, roomId string, members []string) error
 		}
 		return r, nil
 	})
+	if err != nil {
+		return err
+	}
+	u.dispatchMembers(webhook.EventMemberRemoved, actorId, roomId, removed)
+	return u.recordMembers(src, audit.ActionMemberRemove, roomId, removed)
+}
+
+func (u *UseCases) SetTopic(actorId, roomId, topic string) error {
+	if !validTopic(topic) {
+		return ErrInvalidTopic
+	}
+	_, err := u.RoomStorage.UpdateRoom(actorId, roomId, func(r room.Room) (room.Room, error) {
+		if !authorize(actorId, r.Members) {
+			return r, domain.ErrNotFound
+		}
+		r.Topic = topic
+		return r, nil
+	})
 	return err
 }
 
+// checkBlocked fails if any of the accounts blocked the actor.
+func (u *UseCases) checkBlocked(actorId string, accountIds []string) error {
+	bb, err := u.BlockStorage.ListBlockers(actorId)
+	if err != nil {
+		return err
+	}
+	for _, b := range bb {
+		for _, id := range accountIds {
+			if b.Blocker == id {
+				return ErrNotAddable
+			}
+		}
+	}
+	return nil
+}
+
+func validTopic(topic string) bool {
+	if !utf8.ValidString(topic) || utf8.RuneCountInString(topic) > maxTopicLength {
+		return false
+	}
+	for _, r := range topic {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// dispatchMembers notifies room webhooks about membership changes. Members are
+// changed already, so failures are only reported.
+func (u *UseCases) dispatchMembers(event, actorId, roomId string, accountIds []string) {
+	if len(accountIds) == 0 {
+		return
+	}
+	err := u.Webhooks.Dispatch(roomId, event, webhook.MembersData{ActorId: actorId, AccountIds: accountIds})
+	if err != nil {
+		fmt.Printf("room %s: failed to dispatch webhooks: %v\n", roomId, err)
+	}
+}
+
+// recordMembers writes membership changes to the audit log. Members are changed
+// already, so a failure is returned for the caller to know the log misses them.
+func (u *UseCases) recordMembers(src audit.Source, action, roomId string, accountIds []string) error {
+	for _, id := range accountIds {
+		if err := u.record(src, action, id, audit.RoomDetails(roomId, "")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UseCases) record(src audit.Source, action, target, details string) error {
+	if u.Audit == nil {
+		return nil
+	}
+	return u.Audit.Record(src, action, target, details)
+}
+
 func authorize(actorId string, members []string) bool {
 	for _, m := range members {
 		if m == actorId {
@@ -0,0 +1,48 @@
+package room
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/block"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"testing"
+	"time"
+)
+
+func TestAddMembersBlocked(t *testing.T) {
+	u := &UseCases{
+		RoomStorage:     roomrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+		BlockStorage:    blockrepo.NewMemory(),
+		Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+	}
+	admins, err := u.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "admin"}, admins.Id, []string{"spammer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.BlockStorage.CreateBlock(block.Block{Blocker: "victim", Blocked: "spammer", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "spammer"}, admins.Id, []string{"victim"}); err != ErrNotAddable {
+		t.Errorf("got %v adding the blocker, want %v", err, ErrNotAddable)
+	}
+	r, err := u.CreateRoom("spammer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "spammer"}, r.Id, []string{"victim"}); err != ErrNotAddable {
+		t.Errorf("got %v opening a conversation with the blocker, want %v", err, ErrNotAddable)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "admin"}, admins.Id, []string{"victim"}); err != nil {
+		t.Errorf("got %v, others can still add the blocker", err)
+	}
+}
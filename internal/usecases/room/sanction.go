@@ -0,0 +1,231 @@
+package room
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/sanction"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxMuteDuration = 30 * 24 * time.Hour
+	maxReasonLength = 1000 // in characters
+)
+
+var (
+	ErrNotRoomAdmin    = errors.New("only room admins can ban and mute")
+	ErrProtectedMember = errors.New("room admin can't be banned or muted")
+	ErrInvalidReason   = errors.New("reason must be at most 1000 characters")
+	ErrInvalidDuration = errors.New("mute duration must be positive and at most 30 days")
+)
+
+type Ban struct {
+	Account   string
+	Actor     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type Mute struct {
+	Account   string
+	Actor     string
+	Reason    string
+	Until     time.Time
+	CreatedAt time.Time
+}
+
+func (u *UseCases) BanMember(src audit.Source, roomId, accountId, reason string) (Ban, error) {
+	if err := u.checkSanction(src.Actor, roomId, accountId, reason); err != nil {
+		return Ban{}, err
+	}
+	return u.ban(src, roomId, accountId, reason)
+}
+
+func (u *UseCases) BanAccount(src audit.Source, roomId, accountId, reason string) (Ban, error) {
+	if !utf8.ValidString(reason) || utf8.RuneCountInString(reason) > maxReasonLength {
+		return Ban{}, ErrInvalidReason
+	}
+	r, err := u.RoomStorage.InspectRoom(roomId)
+	if err != nil {
+		return Ban{}, err
+	}
+	if r.IsAdmin(accountId) {
+		return Ban{}, ErrProtectedMember
+	}
+	return u.ban(src, roomId, accountId, reason)
+}
+
+func (u *UseCases) ban(src audit.Source, roomId, accountId, reason string) (Ban, error) {
+	b := sanction.Ban{
+		Room:      roomId,
+		Account:   accountId,
+		Actor:     src.Actor,
+		Reason:    reason,
+		CreatedAt: u.clock(),
+	}
+	if err := u.SanctionStorage.PutBan(b); err != nil {
+		return Ban{}, err
+	}
+	r, err := u.RoomStorage.InspectRoom(roomId)
+	if err != nil {
+		return Ban{}, err
+	}
+	if isMember(r, accountId) {
+		if err := u.RoomStorage.RemoveMember(roomId, accountId); err != nil {
+			return Ban{}, err
+		}
+		u.dispatchMembers(webhook.EventMemberRemoved, src.Actor, roomId, []string{accountId})
+	}
+	if err := u.record(src, audit.ActionBan, accountId, audit.RoomDetails(roomId, reason)); err != nil {
+		return Ban{}, err
+	}
+	return toBan(b), nil
+}
+
+func (u *UseCases) UnbanMember(src audit.Source, roomId, accountId string) error {
+	if err := u.checkAdmin(src.Actor, roomId); err != nil {
+		return err
+	}
+	if err := u.SanctionStorage.DeleteBan(roomId, accountId); err != nil {
+		return err
+	}
+	return u.record(src, audit.ActionUnban, accountId, audit.RoomDetails(roomId, ""))
+}
+
+func (u *UseCases) ListBans(actorId, roomId string) ([]Ban, error) {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return nil, err
+	}
+	bb, err := u.SanctionStorage.ListBans(roomId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Ban, 0, len(bb))
+	for _, b := range bb {
+		res = append(res, toBan(b))
+	}
+	return res, nil
+}
+
+func (u *UseCases) MuteMember(actorId, roomId, accountId string, d time.Duration, reason string) (Mute, error) {
+	if d <= 0 || d > maxMuteDuration {
+		return Mute{}, ErrInvalidDuration
+	}
+	if err := u.checkSanction(actorId, roomId, accountId, reason); err != nil {
+		return Mute{}, err
+	}
+	now := u.clock()
+	m := sanction.Mute{
+		Room:      roomId,
+		Account:   accountId,
+		Actor:     actorId,
+		Reason:    reason,
+		Until:     now.Add(d),
+		CreatedAt: now,
+	}
+	if err := u.SanctionStorage.PutMute(m); err != nil {
+		return Mute{}, err
+	}
+	return toMute(m), nil
+}
+
+func (u *UseCases) UnmuteMember(actorId, roomId, accountId string) error {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return err
+	}
+	return u.SanctionStorage.DeleteMute(roomId, accountId)
+}
+
+func (u *UseCases) ListMutes(actorId, roomId string) ([]Mute, error) {
+	if err := u.checkAdmin(actorId, roomId); err != nil {
+		return nil, err
+	}
+	mm, err := u.SanctionStorage.ListMutes(roomId)
+	if err != nil {
+		return nil, err
+	}
+	now := u.clock()
+	res := make([]Mute, 0, len(mm))
+	for _, m := range mm {
+		// expired mutes wait for LiftExpiredMutes, they don't apply already
+		if m.Until.After(now) {
+			res = append(res, toMute(m))
+		}
+	}
+	return res, nil
+}
+
+// LiftExpiredMutes removes mutes which have expired, it's run periodically
+// so the storage doesn't grow. Expired mutes stop applying on their own.
+func (u *UseCases) LiftExpiredMutes(now time.Time) (int, error) {
+	return u.SanctionStorage.DeleteExpiredMutes(now)
+}
+
+func (u *UseCases) checkSanction(actorId, roomId, accountId, reason string) error {
+	if !utf8.ValidString(reason) || utf8.RuneCountInString(reason) > maxReasonLength {
+		return ErrInvalidReason
+	}
+	r, err := u.getAdminRoom(actorId, roomId)
+	if err != nil {
+		return err
+	}
+	if accountId == actorId || r.IsAdmin(accountId) {
+		return ErrProtectedMember
+	}
+	return nil
+}
+
+func (u *UseCases) checkAdmin(actorId, roomId string) error {
+	_, err := u.getAdminRoom(actorId, roomId)
+	return err
+}
+
+func (u *UseCases) getAdminRoom(actorId, roomId string) (room.Room, error) {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return room.Room{}, err
+	}
+	if !r.IsAdmin(actorId) {
+		return room.Room{}, ErrNotRoomAdmin
+	}
+	return r, nil
+}
+
+func (u *UseCases) clock() time.Time {
+	if u.now != nil {
+		return u.now()
+	}
+	return time.Now()
+}
+
+func isMember(r room.Room, accountId string) bool {
+	for _, m := range r.Members {
+		if m == accountId {
+			return true
+		}
+	}
+	return false
+}
+
+func toBan(b sanction.Ban) Ban {
+	return Ban{
+		Account:   b.Account,
+		Actor:     b.Actor,
+		Reason:    b.Reason,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+func toMute(m sanction.Mute) Mute {
+	return Mute{
+		Account:   m.Account,
+		Actor:     m.Actor,
+		Reason:    m.Reason,
+		Until:     m.Until,
+		CreatedAt: m.CreatedAt,
+	}
+}
@@ -0,0 +1,97 @@
+package room
+
+import (
+	"github.com/mp-hl-2021/chat/internal/interface/memory/blockrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/sanctionrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/audit"
+	"github.com/mp-hl-2021/chat/internal/usecases/webhook"
+
+	"testing"
+	"time"
+)
+
+func TestBanMember(t *testing.T) {
+	u := &UseCases{
+		RoomStorage:     roomrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+		BlockStorage:    blockrepo.NewMemory(),
+		Webhooks:        &webhook.UseCases{WebhookStorage: webhookrepo.NewMemory()},
+	}
+	r, err := u.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	if err := u.AddMembers(audit.Source{Actor: "admin"}, roomId, []string{"member", "spammer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.BanMember(audit.Source{Actor: "member"}, roomId, "spammer", ""); err != ErrNotRoomAdmin {
+		t.Errorf("got %v banning as a member, want %v", err, ErrNotRoomAdmin)
+	}
+	if _, err := u.BanMember(audit.Source{Actor: "admin"}, roomId, "spammer", "ads"); err != nil {
+		t.Fatal(err)
+	}
+	r, err = u.GetRoomById("admin", roomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Members) != 2 {
+		t.Errorf("got members %v, banned account must be removed", r.Members)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "member"}, roomId, []string{"spammer"}); err != ErrBanned {
+		t.Errorf("got %v adding banned account back, want %v", err, ErrBanned)
+	}
+
+	if err := u.UnbanMember(audit.Source{Actor: "admin"}, roomId, "spammer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddMembers(audit.Source{Actor: "member"}, roomId, []string{"spammer"}); err != nil {
+		t.Errorf("got %v adding unbanned account", err)
+	}
+}
+
+func TestMuteMember(t *testing.T) {
+	now := time.Now()
+	u := &UseCases{
+		RoomStorage:     roomrepo.NewMemory(),
+		SanctionStorage: sanctionrepo.NewMemory(),
+		now:             func() time.Time { return now },
+	}
+	r, err := u.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+
+	if _, err := u.MuteMember("admin", roomId, "spammer", 0, ""); err != ErrInvalidDuration {
+		t.Errorf("got %v for zero duration, want %v", err, ErrInvalidDuration)
+	}
+	if _, err := u.MuteMember("admin", roomId, "admin", time.Hour, ""); err != ErrProtectedMember {
+		t.Errorf("got %v muting yourself, want %v", err, ErrProtectedMember)
+	}
+	if _, err := u.MuteMember("admin", roomId, "spammer", time.Hour, "flood"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.MuteMember("admin", roomId, "member", time.Millisecond, ""); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+
+	mm, err := u.ListMutes("admin", roomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 1 || mm[0].Account != "spammer" || mm[0].Reason != "flood" {
+		t.Errorf("got mutes %+v, want only the active one", mm)
+	}
+	n, err := u.LiftExpiredMutes(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("lifted %d mutes, want 1 expired", n)
+	}
+}
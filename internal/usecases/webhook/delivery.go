@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+	"github.com/mp-hl-2021/chat/internal/service/outbound"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const DeliveryJobKind = "webhook-delivery"
+
+// Headers of delivery requests. The signature is "sha256=" followed by hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the webhook secret.
+const (
+	HeaderEvent     = "X-Chat-Event"
+	HeaderDelivery  = "X-Chat-Delivery" // event id, the same for all attempts
+	HeaderTimestamp = "X-Chat-Timestamp"
+	HeaderSignature = "X-Chat-Signature"
+)
+
+// maxResponseBody is how much of receiver's response is read to reuse the connection.
+const maxResponseBody = 64 << 10
+
+// defaultClient refuses internal addresses, anyone can create a room and
+// register webhooks of it.
+var defaultClient = outbound.NewClient(10 * time.Second)
+
+type envelope struct {
+	Id        string      `json:"id"`
+	Event     string      `json:"event"`
+	RoomId    string      `json:"room-id"`
+	CreatedAt time.Time   `json:"created-at"`
+	Data      interface{} `json:"data"`
+}
+
+type deliveryPayload struct {
+	WebhookId string `json:"webhook-id"`
+	EventId   string `json:"event-id"`
+	Event     string `json:"event"`
+	Body      string `json:"body"`
+}
+
+// Sign computes the signature header value for the body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliveryJob makes an attempt to send the event to the webhook. Failed attempts
+// are retried with exponential backoff by postponing the job, so waiting for a
+// retry holds no worker. Every attempt is written to the delivery log, and the
+// cursor counts attempts made. Deliveries which failed all attempts are counted,
+// and the webhook is disabled after DisableAfter of them in a row.
+func (u *UseCases) DeliveryJob(j job.Job, progress job.Progress) (string, error) {
+	var p deliveryPayload
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return "", err
+	}
+	attempts := 0
+	if j.Cursor != "" {
+		n, err := strconv.Atoi(j.Cursor)
+		if err != nil {
+			return "", err
+		}
+		attempts = n
+	}
+	maxAttempts := u.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	backoff := u.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if attempts < maxAttempts {
+		w, err := u.WebhookStorage.GetWebhookById(p.WebhookId)
+		if errors.Is(err, domain.ErrNotFound) {
+			return "webhook deleted", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !w.Active {
+			return "webhook disabled", nil
+		}
+		attempts++
+		d := u.send(w, p, attempts)
+		if _, err := u.WebhookStorage.CreateDelivery(d); err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return "", err
+		}
+		if err := progress(strconv.Itoa(attempts), attempts, maxAttempts); err != nil {
+			return "", err
+		}
+		if d.Success {
+			if w.Failures > 0 {
+				_, err := u.WebhookStorage.UpdateWebhook(w.Id, func(w webhook.Webhook) (webhook.Webhook, error) {
+					w.Failures = 0
+					return w, nil
+				})
+				if err != nil && !errors.Is(err, domain.ErrNotFound) {
+					return "", err
+				}
+			}
+			return "delivered", nil
+		}
+		if attempts < maxAttempts {
+			return "", job.RetryAt(time.Now().Add(backoff << uint(attempts-1)))
+		}
+	}
+	if err := u.countFailure(p.WebhookId); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("event %s was not delivered in %d attempts", p.EventId, attempts)
+}
+
+func (u *UseCases) countFailure(webhookId string) error {
+	disableAfter := u.DisableAfter
+	if disableAfter <= 0 {
+		disableAfter = DefaultDisableAfter
+	}
+	_, err := u.WebhookStorage.UpdateWebhook(webhookId, func(w webhook.Webhook) (webhook.Webhook, error) {
+		w.Failures++
+		if w.Failures >= disableAfter {
+			w.Active = false
+		}
+		return w, nil
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// send makes a single delivery attempt.
+func (u *UseCases) send(w webhook.Webhook, p deliveryPayload, attempt int) webhook.Delivery {
+	d := webhook.Delivery{
+		Webhook:   w.Id,
+		EventId:   p.EventId,
+		Event:     p.Event,
+		Attempt:   attempt,
+		CreatedAt: time.Now(),
+	}
+	body := []byte(p.Body)
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	timestamp := d.CreatedAt.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chat-webhooks")
+	req.Header.Set(HeaderEvent, p.Event)
+	req.Header.Set(HeaderDelivery, p.EventId)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, body))
+
+	client := u.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	d.Duration = time.Since(d.CreatedAt)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	resp.Body.Close()
+	d.StatusCode = resp.StatusCode
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return d
+}
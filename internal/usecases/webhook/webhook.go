@@ -0,0 +1,369 @@
+package webhook
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain"
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/domain/webhook"
+	"github.com/mp-hl-2021/chat/internal/service/outbound"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Events webhooks can subscribe to.
+const (
+	EventMessageCreated = "message.created"
+	EventMemberAdded    = "member.added"
+	EventMemberRemoved  = "member.removed"
+)
+
+var knownEvents = map[string]bool{
+	EventMessageCreated: true,
+	EventMemberAdded:    true,
+	EventMemberRemoved:  true,
+}
+
+const (
+	DefaultMaxAttempts  = 5
+	DefaultBackoff      = 2 * time.Second
+	DefaultDisableAfter = 5
+
+	maxUrlLength         = 2048
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+var (
+	ErrNotRoomAdmin  = errors.New("only room admins can manage webhooks")
+	ErrInvalidUrl    = errors.New("webhook url must be an absolute https url")
+	ErrInvalidEvents = errors.New("webhook must subscribe to known events")
+	ErrInvalidLimit  = errors.New("invalid limit")
+)
+
+type Webhook struct {
+	Id        string
+	Room      string
+	Creator   string
+	Url       string
+	Secret    string // set only when the webhook is created
+	Events    []string
+	Active    bool
+	Failures  int
+	CreatedAt time.Time
+}
+
+type Delivery struct {
+	Id         string
+	EventId    string
+	Event      string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Success    bool
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+// Update changes the webhook fields which are not nil.
+// Activating a webhook resets its failure counter.
+type Update struct {
+	Url    *string
+	Events *[]string
+	Active *bool
+}
+
+// MessageData is the payload of message.created events.
+type MessageData struct {
+	Id        string    `json:"id"`
+	AuthorId  string    `json:"author-id"`
+	Format    string    `json:"format"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created-at"`
+	System    bool      `json:"system,omitempty"` // a notice like a pin, AuthorId caused it
+}
+
+// MembersData is the payload of member.added and member.removed events.
+type MembersData struct {
+	ActorId    string   `json:"actor-id"`
+	AccountIds []string `json:"account-ids"`
+}
+
+type Interface interface {
+	CreateWebhook(actorId, roomId, rawUrl string, events []string) (Webhook, error)
+	ListWebhooks(actorId, roomId string) ([]Webhook, error)
+	UpdateWebhook(actorId, roomId, webhookId string, upd Update) (Webhook, error)
+	DeleteWebhook(actorId, roomId, webhookId string) error
+	// ListDeliveries returns the delivery log of the webhook, newest attempts first.
+	// Limit of zero means the default one.
+	ListDeliveries(actorId, roomId, webhookId string, limit int) ([]Delivery, error)
+
+	// Dispatch queues delivery of the event to active webhooks of the room subscribed to it.
+	Dispatch(roomId, event string, data interface{}) error
+}
+
+type UseCases struct {
+	WebhookStorage webhook.Interface
+	RoomStorage    room.Interface
+	Jobs           job.Interface
+
+	Client       *http.Client  // deliveries are sent with defaultClient if nil
+	MaxAttempts  int           // attempts to deliver an event, DefaultMaxAttempts if zero
+	Backoff      time.Duration // delay before the second attempt, doubled for each next one, DefaultBackoff if zero
+	DisableAfter int           // failed deliveries in a row disabling the webhook, DefaultDisableAfter if zero
+}
+
+func (u *UseCases) CreateWebhook(actorId, roomId, rawUrl string, events []string) (Webhook, error) {
+	if _, err := u.adminRoom(actorId, roomId); err != nil {
+		return Webhook{}, err
+	}
+	if err := validateUrl(rawUrl); err != nil {
+		return Webhook{}, err
+	}
+	events, err := normalizeEvents(events)
+	if err != nil {
+		return Webhook{}, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+	w, err := u.WebhookStorage.CreateWebhook(webhook.Webhook{
+		Room:      roomId,
+		Creator:   actorId,
+		Url:       rawUrl,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+	res := toWebhook(w)
+	res.Secret = w.Secret
+	return res, nil
+}
+
+func (u *UseCases) ListWebhooks(actorId, roomId string) ([]Webhook, error) {
+	if _, err := u.adminRoom(actorId, roomId); err != nil {
+		return nil, err
+	}
+	ww, err := u.WebhookStorage.ListWebhooks(roomId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Webhook, 0, len(ww))
+	for _, w := range ww {
+		res = append(res, toWebhook(w))
+	}
+	return res, nil
+}
+
+func (u *UseCases) UpdateWebhook(actorId, roomId, webhookId string, upd Update) (Webhook, error) {
+	if _, err := u.roomWebhook(actorId, roomId, webhookId); err != nil {
+		return Webhook{}, err
+	}
+	if upd.Url != nil {
+		if err := validateUrl(*upd.Url); err != nil {
+			return Webhook{}, err
+		}
+	}
+	var events []string
+	if upd.Events != nil {
+		var err error
+		if events, err = normalizeEvents(*upd.Events); err != nil {
+			return Webhook{}, err
+		}
+	}
+	w, err := u.WebhookStorage.UpdateWebhook(webhookId, func(w webhook.Webhook) (webhook.Webhook, error) {
+		if upd.Url != nil {
+			w.Url = *upd.Url
+		}
+		if upd.Events != nil {
+			w.Events = events
+		}
+		if upd.Active != nil {
+			if *upd.Active && !w.Active {
+				w.Failures = 0
+			}
+			w.Active = *upd.Active
+		}
+		return w, nil
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+	return toWebhook(w), nil
+}
+
+func (u *UseCases) DeleteWebhook(actorId, roomId, webhookId string) error {
+	if _, err := u.roomWebhook(actorId, roomId, webhookId); err != nil {
+		return err
+	}
+	return u.WebhookStorage.DeleteWebhook(webhookId)
+}
+
+func (u *UseCases) ListDeliveries(actorId, roomId, webhookId string, limit int) ([]Delivery, error) {
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit < 0 || limit > maxDeliveryLimit {
+		return nil, ErrInvalidLimit
+	}
+	if _, err := u.roomWebhook(actorId, roomId, webhookId); err != nil {
+		return nil, err
+	}
+	dd, err := u.WebhookStorage.ListDeliveries(webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Delivery, 0, len(dd))
+	for _, d := range dd {
+		res = append(res, Delivery{
+			Id:         d.Id,
+			EventId:    d.EventId,
+			Event:      d.Event,
+			Attempt:    d.Attempt,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			Success:    d.Success,
+			Duration:   d.Duration,
+			CreatedAt:  d.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+func (u *UseCases) Dispatch(roomId, event string, data interface{}) error {
+	ww, err := u.WebhookStorage.ListWebhooks(roomId)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	var eventId string
+	for _, w := range ww {
+		if !w.Active || !subscribed(w, event) {
+			continue
+		}
+		if body == nil {
+			// the same body goes to every webhook, so receivers may dedupe by event id
+			if eventId, err = newEventId(); err != nil {
+				return err
+			}
+			body, err = json.Marshal(envelope{
+				Id:        eventId,
+				Event:     event,
+				RoomId:    roomId,
+				CreatedAt: time.Now(),
+				Data:      data,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		p, err := json.Marshal(deliveryPayload{WebhookId: w.Id, EventId: eventId, Event: event, Body: string(body)})
+		if err != nil {
+			return err
+		}
+		if _, err := u.Jobs.Submit(w.Creator, DeliveryJobKind, string(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adminRoom returns the room if the actor administers it.
+func (u *UseCases) adminRoom(actorId, roomId string) (room.Room, error) {
+	r, err := u.RoomStorage.GetRoomById(actorId, roomId)
+	if err != nil {
+		return r, err
+	}
+	if !r.IsAdmin(actorId) {
+		return r, ErrNotRoomAdmin
+	}
+	return r, nil
+}
+
+// roomWebhook returns the webhook if it belongs to the room the actor administers.
+func (u *UseCases) roomWebhook(actorId, roomId, webhookId string) (webhook.Webhook, error) {
+	if _, err := u.adminRoom(actorId, roomId); err != nil {
+		return webhook.Webhook{}, err
+	}
+	w, err := u.WebhookStorage.GetWebhookById(webhookId)
+	if err != nil {
+		return w, err
+	}
+	if w.Room != roomId {
+		return webhook.Webhook{}, domain.ErrNotFound
+	}
+	return w, nil
+}
+
+func validateUrl(s string) error {
+	if err := outbound.ValidateUrl(s, maxUrlLength); err != nil {
+		return ErrInvalidUrl
+	}
+	return nil
+}
+
+// normalizeEvents checks events are known and drops duplicates.
+func normalizeEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, ErrInvalidEvents
+	}
+	res := make([]string, 0, len(events))
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if !knownEvents[e] {
+			return nil, ErrInvalidEvents
+		}
+		if !seen[e] {
+			seen[e] = true
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func subscribed(w webhook.Webhook, event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newEventId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toWebhook(w webhook.Webhook) Webhook {
+	return Webhook{
+		Id:        w.Id,
+		Room:      w.Room,
+		Creator:   w.Creator,
+		Url:       w.Url,
+		Events:    append([]string(nil), w.Events...),
+		Active:    w.Active,
+		Failures:  w.Failures,
+		CreatedAt: w.CreatedAt,
+	}
+}
@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"github.com/mp-hl-2021/chat/internal/domain/room"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/jobrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/roomrepo"
+	"github.com/mp-hl-2021/chat/internal/interface/memory/webhookrepo"
+	"github.com/mp-hl-2021/chat/internal/usecases/job"
+
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// waitDeliveries polls the delivery log until it has n attempts.
+func waitDeliveries(t *testing.T, u *UseCases, roomId, webhookId string, n int) []Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dd, err := u.ListDeliveries("admin", roomId, webhookId, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dd) >= n || time.Now().After(deadline) {
+			return dd
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliveryRetriesAndSignature(t *testing.T) {
+	var mu sync.Mutex
+	var got []received
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{header: r.Header, body: body})
+		n := len(got)
+		mu.Unlock()
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	jobs := &job.UseCases{JobStorage: jobrepo.NewMemory()}
+	u := &UseCases{
+		WebhookStorage: webhookrepo.NewMemory(),
+		RoomStorage:    rooms,
+		Jobs:           jobs,
+		Client:         srv.Client(),
+		MaxAttempts:    3,
+		Backoff:        time.Millisecond,
+		DisableAfter:   2,
+	}
+	jobs.Register(DeliveryJobKind, u.DeliveryJob, 1)
+	wh, err := u.CreateWebhook("admin", roomId, srv.URL+"/hook", []string{EventMessageCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Dispatch(roomId, EventMemberAdded, MembersData{ActorId: "admin", AccountIds: []string{"1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Dispatch(roomId, EventMessageCreated, MessageData{Id: "7", AuthorId: "admin", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dd := waitDeliveries(t, u, roomId, wh.Id, 3)
+	if len(dd) != 3 {
+		t.Fatalf("got %d delivery attempts, want 3", len(dd))
+	}
+	if !dd[0].Success || dd[0].Attempt != 3 || dd[0].StatusCode != http.StatusNoContent {
+		t.Errorf("last attempt is %+v, want third successful one", dd[0])
+	}
+	if dd[1].Success || dd[1].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second attempt is %+v, want failed one", dd[1])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range got {
+		if e := r.header.Get(HeaderEvent); e != EventMessageCreated {
+			t.Errorf("got %s event, only subscribed one should be delivered", e)
+		}
+		timestamp, err := strconv.ParseInt(r.header.Get(HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig := r.header.Get(HeaderSignature); sig != Sign(wh.Secret, timestamp, r.body) {
+			t.Errorf("signature %s doesn't match the body", sig)
+		}
+		if id := r.header.Get(HeaderDelivery); id != got[0].header.Get(HeaderDelivery) {
+			t.Errorf("retries have different delivery ids %s and %s", id, got[0].header.Get(HeaderDelivery))
+		}
+	}
+	var e struct {
+		Event  string      `json:"event"`
+		RoomId string      `json:"room-id"`
+		Data   MessageData `json:"data"`
+	}
+	if err := json.Unmarshal(got[0].body, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Event != EventMessageCreated || e.RoomId != roomId || e.Data.Id != "7" || e.Data.Text != "hi" {
+		t.Errorf("unexpected payload %s", got[0].body)
+	}
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	jobs := &job.UseCases{JobStorage: jobrepo.NewMemory()}
+	u := &UseCases{
+		WebhookStorage: webhookrepo.NewMemory(),
+		RoomStorage:    rooms,
+		Jobs:           jobs,
+		Client:         srv.Client(),
+		MaxAttempts:    3,
+		Backoff:        time.Millisecond,
+		DisableAfter:   2,
+	}
+	jobs.Register(DeliveryJobKind, u.DeliveryJob, 1)
+	wh, err := u.CreateWebhook("admin", roomId, srv.URL, []string{EventMessageCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := u.Dispatch(roomId, EventMessageCreated, MessageData{Id: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if dd := waitDeliveries(t, u, roomId, wh.Id, 3*i); len(dd) != 3*i {
+			t.Fatalf("got %d delivery attempts, want %d", len(dd), 3*i)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ww, err := u.ListWebhooks("admin", roomId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ww[0].Active {
+			if ww[0].Failures != 2 {
+				t.Errorf("got %d failures, want 2", ww[0].Failures)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("webhook wasn't disabled after repeated failures")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	active := true
+	wh, err = u.UpdateWebhook("admin", roomId, wh.Id, Update{Active: &active})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wh.Active || wh.Failures != 0 {
+		t.Errorf("re-enabled webhook is %+v, want active without failures", wh)
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	rooms := roomrepo.NewMemory()
+	r, err := rooms.CreateRoom("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId := r.Id
+	u := &UseCases{WebhookStorage: webhookrepo.NewMemory(), RoomStorage: rooms}
+	if _, err := u.CreateWebhook("admin", roomId, "http://example.com/hook", []string{EventMessageCreated}); err != ErrInvalidUrl {
+		t.Errorf("got %v for plain http url, want %v", err, ErrInvalidUrl)
+	}
+	if _, err := u.CreateWebhook("admin", roomId, "https://example.com/hook", []string{"message.deleted"}); err != ErrInvalidEvents {
+		t.Errorf("got %v for unknown event, want %v", err, ErrInvalidEvents)
+	}
+	if _, err := u.RoomStorage.UpdateRoom("admin", roomId, addMember("member")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CreateWebhook("member", roomId, "https://example.com/hook", []string{EventMessageCreated}); err != ErrNotRoomAdmin {
+		t.Errorf("got %v for room member, want %v", err, ErrNotRoomAdmin)
+	}
+}
+
+func addMember(id string) room.UpdateFunc {
+	return func(r room.Room) (room.Room, error) {
+		r.Members = append(r.Members, id)
+		return r, nil
+	}
+}